@@ -1,5 +1,5 @@
 import { atom } from 'jotai';
-import type { ChatMessage, Session } from '../types/chat';
+import type { ChatMessage, InterruptedTurn, QueuedMessage, Session } from '../types/chat';
 
 // Core chat state
 export const messagesAtom = atom<ChatMessage[]>([]);
@@ -9,6 +9,8 @@ export const systemPromptAtom = atom<string>('{{.Builtin.SystemPrompt}}');
 export const primaryBranchIdAtom = atom<string>('');
 export const currentSessionNameAtom = atom<string>(''); // Track current session name (including temporary sessions)
 export const currentSessionArchivedAtom = atom<boolean>(false); // Track current session archived status
+export const queuedMessagesAtom = atom<QueuedMessage[]>([]); // Messages waiting for the active call to finish
+export const interruptedTurnAtom = atom<InterruptedTurn | null>(null); // Turn interrupted by a server restart
 
 // Derived atoms
 export const addMessageAtom = atom(null, (_get, set, newMessage: ChatMessage) => {
@@ -67,6 +69,8 @@ export const resetChatSessionStateAtom = atom(null, (_get, set) => {
   set(primaryBranchIdAtom, '');
   set(currentSessionNameAtom, '');
   set(currentSessionArchivedAtom, false);
+  set(queuedMessagesAtom, []);
+  set(interruptedTurnAtom, null);
   // Note: selectedFilesAtom is NOT reset - attachments are preserved across sessions
   // Note: isSystemPromptEditingAtom is NOT reset here - handled separately
 });
@@ -9,4 +9,4 @@ export const editingMessageIdAtom = atom<string | null>(null);
 export const editingSourceAtom = atom<'edit' | 'update' | null>(null);
 export const isModelManuallySelectedAtom = atom<boolean>(false);
 export const isSessionConfigOpenAtom = atom<boolean>(false);
-export const sessionConfigTabAtom = atom<'model' | 'prompt'>('model');
+export const sessionConfigTabAtom = atom<'model' | 'prompt' | 'params'>('model');
@@ -13,6 +13,7 @@ import { useSessionFSM } from '../hooks/useSessionFSM';
 import { useSessionManagerContext } from '../hooks/SessionManagerContext';
 import { getSessionId } from '../utils/sessionStateHelpers';
 import useEscToCancel from '../hooks/useEscToCancel';
+import { useScheduleFailureToast } from '../hooks/useScheduleFailureToast';
 import { useWorkspaces } from '../hooks/WorkspaceContext';
 import ChatArea from './chat/ChatArea';
 import ChatHeader from './chat/ChatHeader';
@@ -70,6 +71,7 @@ const ChatLayout: React.FC<ChatLayoutProps> = ({ children, isTemporary = false }
   } = useChatSession(isTemporary);
 
   const [toastMessage, setToastMessage] = useAtom(toastMessageAtom);
+  useScheduleFailureToast();
 
   // Determine disabled reason for input
   const disabledBecause: 'notauth' | 'archived' | undefined = !isAuthenticated
@@ -3,9 +3,10 @@ import { useEffect } from 'react';
 import { useAtom, useAtomValue, useSetAtom } from 'jotai';
 import InputArea from './InputArea';
 import ConfirmationDialog from '../ConfirmationDialog';
+import InterruptedTurnBanner from './InterruptedTurnBanner';
 import MessageListContainer from './MessageListContainer';
 import ChatAreaDragDropOverlay from './ChatAreaDragDropOverlay';
-import { messagesAtom, primaryBranchIdAtom } from '../../atoms/chatAtoms';
+import { interruptedTurnAtom, messagesAtom, primaryBranchIdAtom } from '../../atoms/chatAtoms';
 import { pendingConfirmationAtom } from '../../atoms/confirmationAtoms';
 import { selectedFilesAtom } from '../../atoms/fileAtoms';
 import { availableModelsAtom } from '../../atoms/modelAtoms';
@@ -101,8 +102,10 @@ const ChatArea: React.FC<ChatAreaProps> = ({
     isLoading: isPriorSessionLoading,
     hasMoreMessages: hasMoreMessagesState,
     loadEarlierMessages,
+    resumeTurn,
   } = sessionFSM;
   const pendingConfirmation = useAtomValue(pendingConfirmationAtom);
+  const interruptedTurn = useAtomValue(interruptedTurnAtom);
 
   // Use message grouping hook
   const { renderedMessages } = useMessageGrouping({
@@ -148,21 +151,26 @@ const ChatArea: React.FC<ChatAreaProps> = ({
             confirmationData={JSON.parse(pendingConfirmation)}
           />
         ) : (
-          <InputArea
-            handleSendMessage={handleSendMessage}
-            onFilesSelected={onFilesSelected}
-            handleRemoveFile={handleRemoveFile}
-            handleFileResizeStateChange={handleFileResizeStateChange}
-            handleFileProcessingStateChange={handleFileProcessingStateChange}
-            handleFileResized={handleFileResized}
-            handleCancelStreaming={handleCancelStreaming}
-            chatInputRef={chatInputRef}
-            chatAreaRef={chatAreaRef}
-            sessionId={sessionId}
-            selectedFiles={selectedFiles}
-            isSendDisabledByResizing={isSendDisabledByResizing}
-            disabledBecause={disabledBecause}
-          />
+          <>
+            {interruptedTurn && !disabledBecause && (
+              <InterruptedTurnBanner interruptedTurn={interruptedTurn} onResume={resumeTurn} />
+            )}
+            <InputArea
+              handleSendMessage={handleSendMessage}
+              onFilesSelected={onFilesSelected}
+              handleRemoveFile={handleRemoveFile}
+              handleFileResizeStateChange={handleFileResizeStateChange}
+              handleFileProcessingStateChange={handleFileProcessingStateChange}
+              handleFileResized={handleFileResized}
+              handleCancelStreaming={handleCancelStreaming}
+              chatInputRef={chatInputRef}
+              chatAreaRef={chatAreaRef}
+              sessionId={sessionId}
+              selectedFiles={selectedFiles}
+              isSendDisabledByResizing={isSendDisabledByResizing}
+              disabledBecause={disabledBecause}
+            />
+          </>
         )}
       </ChatAreaDragDropOverlay>
     </div>
@@ -57,6 +57,7 @@ const ChatMessage: React.FC<ChatMessageProps> = React.memo(
     const messageInfoComponent = (
       <MessageInfo
         cumulTokenCount={cumulTokenCount}
+        cachedTokenCount={message.aux?.cachedTokenCount}
         possibleBranches={message.possibleBranches}
         model={model}
         maxTokens={maxTokens}
@@ -124,6 +125,15 @@ const ChatMessage: React.FC<ChatMessageProps> = React.memo(
       return <SystemMessage text={text} messageInfo={messageInfoComponent} messageId={message.id} />;
     } else if (type === 'system_prompt') {
       return <SystemMessage text={text} messageInfo={messageInfoComponent} messageId={message.id} />;
+    } else if (type === 'steering') {
+      return (
+        <SystemMessage
+          text={`**Steering:** ${text || ''}`}
+          className="steering-message"
+          messageInfo={messageInfoComponent}
+          messageId={message.id}
+        />
+      );
     } else if (type === 'model_error') {
       return (
         <ModelTextMessage
@@ -0,0 +1,32 @@
+import type React from 'react';
+import type { InterruptedTurn } from '../../types/chat';
+
+interface InterruptedTurnBannerProps {
+  interruptedTurn: InterruptedTurn;
+  onResume: () => void;
+}
+
+// Offers to resume a turn which was still running when the server stopped
+const InterruptedTurnBanner: React.FC<InterruptedTurnBannerProps> = ({ interruptedTurn, onResume }) => {
+  const description = interruptedTurn.pendingFunction
+    ? `The agent was interrupted while running the tool: ${interruptedTurn.pendingFunction}.`
+    : 'The agent was interrupted in the middle of its turn.';
+
+  return (
+    <div
+      style={{
+        backgroundColor: '#FFFACD',
+        padding: '10px 20px',
+        display: 'flex',
+        alignItems: 'center',
+        justifyContent: 'center',
+        gap: '10px',
+      }}
+    >
+      <span>{description}</span>
+      <button onClick={() => onResume()}>Resume</button>
+    </div>
+  );
+};
+
+export default InterruptedTurnBanner;
@@ -10,6 +10,7 @@ import './MessageInfo.css';
 
 export interface MessageInfoProps {
   cumulTokenCount?: number | null;
+  cachedTokenCount?: number | null; // Part of cumulTokenCount served from a context cache
   possibleBranches?: PossibleNextMessage[];
   model?: string;
   maxTokens?: number;
@@ -35,6 +36,7 @@ export interface MessageInfoProps {
 const MessageInfo: React.FC<MessageInfoProps> = React.memo(
   ({
     cumulTokenCount,
+    cachedTokenCount,
     possibleBranches,
     model,
     maxTokens,
@@ -82,6 +84,7 @@ const MessageInfo: React.FC<MessageInfoProps> = React.memo(
             : cumulTokenCount
               ? `${cumulTokenCount}T`
               : ''}
+          {cumulTokenCount && cachedTokenCount ? ` (${cachedTokenCount}T cached)` : ''}
         </span>
         {isEditing ? (
           <>
@@ -1,5 +1,5 @@
 import type React from 'react';
-import { useCallback, useEffect } from 'react';
+import { useCallback, useEffect, useState } from 'react';
 import { useLocation } from 'react-router-dom';
 import { useAtom, useSetAtom } from 'jotai';
 import { availableModelsAtom, selectedModelAtom } from '../../atoms/modelAtoms';
@@ -48,6 +48,132 @@ const ModelTab: React.FC = () => {
   );
 };
 
+interface GenParams {
+  temperature?: number;
+  topK?: number;
+  topP?: number;
+  maxOutputTokens?: number;
+  stopSequences?: string[];
+  seed?: number;
+  presencePenalty?: number;
+  frequencyPenalty?: number;
+  mediaResolution?: string;
+}
+
+const numberFields: { key: keyof GenParams; label: string; step: string }[] = [
+  { key: 'temperature', label: 'Temperature', step: '0.05' },
+  { key: 'topP', label: 'Top P', step: '0.05' },
+  { key: 'topK', label: 'Top K', step: '1' },
+  { key: 'maxOutputTokens', label: 'Max output tokens', step: '1' },
+  { key: 'seed', label: 'Seed', step: '1' },
+  { key: 'presencePenalty', label: 'Presence penalty', step: '0.1' },
+  { key: 'frequencyPenalty', label: 'Frequency penalty', step: '0.1' },
+];
+
+const mediaResolutions = ['MEDIA_RESOLUTION_LOW', 'MEDIA_RESOLUTION_MEDIUM', 'MEDIA_RESOLUTION_HIGH'];
+
+const ParamsTab: React.FC<{ sessionId: string }> = ({ sessionId }) => {
+  const [params, setParams] = useState<GenParams>({});
+  const [stopSequences, setStopSequences] = useState('');
+  const [status, setStatus] = useState<string | null>(null);
+
+  useEffect(() => {
+    apiFetch(`/api/chat/${sessionId}/genParams`)
+      .then((response) => (response.ok ? response.json() : {}))
+      .then((data: GenParams) => {
+        setParams(data);
+        setStopSequences((data.stopSequences || []).join('\n'));
+      })
+      .catch((error) => {
+        console.error('Error fetching generation params:', error);
+      });
+  }, [sessionId]);
+
+  const saveParams = async (newParams: GenParams) => {
+    try {
+      const response = await apiFetch(`/api/chat/${sessionId}/genParams`, {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(newParams),
+      });
+      if (!response.ok) {
+        setStatus(`Failed to save: ${await response.text()}`);
+        return;
+      }
+      const saved: GenParams = await response.json();
+      setParams(saved);
+      setStopSequences((saved.stopSequences || []).join('\n'));
+      setStatus('Saved. Empty fields use the model defaults.');
+    } catch (error) {
+      console.error('Error saving generation params:', error);
+      setStatus('Error saving parameters');
+    }
+  };
+
+  const handleSave = () => {
+    const stops = stopSequences.split('\n').filter((stop) => stop !== '');
+    saveParams({ ...params, stopSequences: stops.length > 0 ? stops : undefined });
+  };
+
+  return (
+    <div>
+      <div className="config-params-grid">
+        {numberFields.map(({ key, label, step }) => (
+          <div className="config-form-group" key={key}>
+            <label htmlFor={`config-param-${key}`}>{label}:</label>
+            <input
+              id={`config-param-${key}`}
+              type="number"
+              step={step}
+              value={(params[key] as number | undefined) ?? ''}
+              placeholder="Model default"
+              onChange={(e) =>
+                setParams({ ...params, [key]: e.target.value === '' ? undefined : Number(e.target.value) })
+              }
+              className="config-input"
+            />
+          </div>
+        ))}
+        <div className="config-form-group">
+          <label htmlFor="config-param-mediaResolution">Media resolution:</label>
+          <select
+            id="config-param-mediaResolution"
+            value={params.mediaResolution || ''}
+            onChange={(e) => setParams({ ...params, mediaResolution: e.target.value || undefined })}
+            className="config-select"
+          >
+            <option value="">Model default</option>
+            {mediaResolutions.map((resolution) => (
+              <option key={resolution} value={resolution}>
+                {resolution.replace('MEDIA_RESOLUTION_', '').toLowerCase()}
+              </option>
+            ))}
+          </select>
+        </div>
+      </div>
+      <div className="config-form-group">
+        <label htmlFor="config-param-stopSequences">Stop sequences (one per line):</label>
+        <textarea
+          id="config-param-stopSequences"
+          value={stopSequences}
+          onChange={(e) => setStopSequences(e.target.value)}
+          rows={2}
+          className="config-input"
+        />
+      </div>
+      <div className="config-form-group">
+        <button onClick={handleSave} className="config-button">
+          Save
+        </button>
+        <button onClick={() => saveParams({})} className="config-button secondary">
+          Reset to model defaults
+        </button>
+        {status && <span className="config-status">{status}</span>}
+      </div>
+    </div>
+  );
+};
+
 const PromptTabContent: React.FC<{
   workspaceId?: string;
   predefinedPrompts?: PredefinedPrompt[];
@@ -106,10 +232,19 @@ const SessionConfiguration: React.FC<SessionConfigurationProps> = ({ workspaceId
         >
           Prompt
         </button>
+        {sessionId && !isNewSessionURL(location.pathname) && (
+          <button
+            className={`config-tab ${activeTab === 'params' ? 'active' : ''}`}
+            onClick={() => setActiveTab('params')}
+          >
+            Parameters
+          </button>
+        )}
       </div>
       <div className="session-config-content">
         {activeTab === 'model' && <ModelTab />}
         {activeTab === 'prompt' && <PromptTabContent workspaceId={workspaceId} predefinedPrompts={predefinedPrompts} />}
+        {activeTab === 'params' && sessionId && <ParamsTab sessionId={sessionId} />}
       </div>
     </div>
   );
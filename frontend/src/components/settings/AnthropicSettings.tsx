@@ -0,0 +1,277 @@
+import type React from 'react';
+import { useState, useEffect } from 'react';
+import { apiFetch } from '../../api/apiClient';
+
+interface AnthropicConfig {
+  id: string;
+  name: string;
+  endpoint: string;
+  api_key: string;
+  enabled: boolean;
+  created_at?: string;
+}
+
+const emptyConfig = { name: '', endpoint: '', api_key: '' };
+
+const inputStyle: React.CSSProperties = {
+  width: '100%',
+  padding: '8px',
+  border: '1px solid #ccc',
+  borderRadius: '3px',
+  boxSizing: 'border-box',
+};
+
+const smallButtonStyle = (backgroundColor: string): React.CSSProperties => ({
+  marginRight: '10px',
+  padding: '6px 12px',
+  backgroundColor,
+  color: 'white',
+  border: 'none',
+  borderRadius: '3px',
+  cursor: 'pointer',
+  fontSize: '12px',
+});
+
+const AnthropicSettings: React.FC = () => {
+  const [configs, setConfigs] = useState<AnthropicConfig[]>([]);
+  const [loading, setLoading] = useState(true);
+  const [editingConfig, setEditingConfig] = useState<AnthropicConfig | null>(null);
+  const [newConfig, setNewConfig] = useState(emptyConfig);
+  const [isAddingNew, setIsAddingNew] = useState(false);
+
+  const fetchConfigs = async () => {
+    try {
+      const response = await apiFetch('/api/anthropic-configs');
+      if (response.ok) {
+        const data = await response.json();
+        setConfigs(data || []);
+      } else {
+        console.error('Failed to fetch Anthropic configs:', response.status);
+      }
+    } catch (error) {
+      console.error('Error fetching Anthropic configs:', error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    fetchConfigs();
+  }, []);
+
+  const saveConfig = async (config: Partial<AnthropicConfig>) => {
+    try {
+      const response = await apiFetch('/api/anthropic-configs', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(config),
+      });
+      if (!response.ok) {
+        alert('Failed to save Anthropic config');
+        return false;
+      }
+      await fetchConfigs();
+      return true;
+    } catch (error) {
+      console.error('Error saving Anthropic config:', error);
+      alert('Error saving config');
+      return false;
+    }
+  };
+
+  const handleSaveConfig = async () => {
+    const saved = await saveConfig({
+      id: editingConfig?.id,
+      name: newConfig.name.trim(),
+      endpoint: newConfig.endpoint.trim(),
+      api_key: newConfig.api_key.trim(),
+      enabled: editingConfig ? editingConfig.enabled : true,
+    });
+    if (saved) {
+      handleCancel();
+    }
+  };
+
+  const handleDeleteConfig = async (id: string) => {
+    if (window.confirm('Are you sure you want to delete this Anthropic config?')) {
+      try {
+        const response = await apiFetch(`/api/anthropic-configs/${id}`, {
+          method: 'DELETE',
+        });
+        if (response.ok) {
+          await fetchConfigs();
+        } else {
+          alert('Failed to delete Anthropic config');
+        }
+      } catch (error) {
+        console.error('Error deleting Anthropic config:', error);
+        alert('Error deleting config');
+      }
+    }
+  };
+
+  const handleEditConfig = (config: AnthropicConfig) => {
+    setEditingConfig(config);
+    setNewConfig({ name: config.name, endpoint: config.endpoint, api_key: config.api_key });
+    setIsAddingNew(true);
+  };
+
+  const handleCancel = () => {
+    setEditingConfig(null);
+    setNewConfig(emptyConfig);
+    setIsAddingNew(false);
+  };
+
+  if (loading) {
+    return <div>Loading Anthropic configurations...</div>;
+  }
+
+  const canSave = newConfig.name.trim() !== '' && newConfig.api_key.trim() !== '';
+
+  return (
+    <div>
+      <h4>Anthropic API Configuration</h4>
+      <p style={{ color: '#666', fontSize: '14px', marginBottom: '20px' }}>
+        Configure Anthropic API keys to use Claude models through the Messages API. Enabled keys are tried in order
+        until one succeeds.
+      </p>
+
+      {isAddingNew && (
+        <div
+          style={{
+            border: '1px solid #ddd',
+            padding: '15px',
+            marginBottom: '20px',
+            borderRadius: '5px',
+            backgroundColor: '#f9f9f9',
+          }}
+        >
+          <h5>{editingConfig ? 'Edit Anthropic Config' : 'Add New Anthropic Config'}</h5>
+          <div style={{ marginBottom: '10px' }}>
+            <label style={{ display: 'block', marginBottom: '5px' }}>Name:</label>
+            <input
+              type="text"
+              value={newConfig.name}
+              onChange={(e) => setNewConfig({ ...newConfig, name: e.target.value })}
+              placeholder="e.g., Personal Key"
+              style={inputStyle}
+            />
+          </div>
+          <div style={{ marginBottom: '10px' }}>
+            <label style={{ display: 'block', marginBottom: '5px' }}>API Key:</label>
+            <input
+              type="password"
+              value={newConfig.api_key}
+              onChange={(e) => setNewConfig({ ...newConfig, api_key: e.target.value })}
+              placeholder="Enter your Anthropic API key"
+              style={inputStyle}
+            />
+          </div>
+          <div style={{ marginBottom: '10px' }}>
+            <label style={{ display: 'block', marginBottom: '5px' }}>Endpoint (optional):</label>
+            <input
+              type="text"
+              value={newConfig.endpoint}
+              onChange={(e) => setNewConfig({ ...newConfig, endpoint: e.target.value })}
+              placeholder="https://api.anthropic.com/v1"
+              style={inputStyle}
+            />
+          </div>
+          <div>
+            <button
+              onClick={handleSaveConfig}
+              disabled={!canSave}
+              style={{
+                marginRight: '10px',
+                padding: '8px 16px',
+                backgroundColor: canSave ? '#007bff' : '#ccc',
+                color: 'white',
+                border: 'none',
+                borderRadius: '3px',
+                cursor: canSave ? 'pointer' : 'not-allowed',
+              }}
+            >
+              {editingConfig ? 'Update' : 'Save'}
+            </button>
+            <button
+              onClick={handleCancel}
+              style={{
+                padding: '8px 16px',
+                backgroundColor: '#6c757d',
+                color: 'white',
+                border: 'none',
+                borderRadius: '3px',
+                cursor: 'pointer',
+              }}
+            >
+              Cancel
+            </button>
+          </div>
+        </div>
+      )}
+
+      <div style={{ marginBottom: '20px' }}>
+        <button
+          onClick={() => setIsAddingNew(true)}
+          disabled={isAddingNew}
+          style={{
+            padding: '8px 16px',
+            backgroundColor: '#28a745',
+            color: 'white',
+            border: 'none',
+            borderRadius: '3px',
+            cursor: isAddingNew ? 'not-allowed' : 'pointer',
+          }}
+        >
+          Add New Anthropic Key
+        </button>
+      </div>
+
+      {configs.map((config) => (
+        <div
+          key={config.id}
+          style={{
+            border: '1px solid #ddd',
+            padding: '15px',
+            marginBottom: '10px',
+            borderRadius: '5px',
+            backgroundColor: config.enabled ? '#fff' : '#f8f9fa',
+          }}
+        >
+          <div style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+            <div>
+              <h5 style={{ margin: '0 0 5px 0' }}>
+                {config.name}
+                {!config.enabled && <span style={{ color: '#dc3545', marginLeft: '10px' }}>Disabled</span>}
+              </h5>
+              <p style={{ margin: '0', fontSize: '12px', color: '#666' }}>
+                API Key: {config.api_key.substring(0, 12)}...{config.api_key.substring(config.api_key.length - 4)}
+              </p>
+              {config.endpoint && (
+                <p style={{ margin: '5px 0 0 0', fontSize: '12px', color: '#666' }}>Endpoint: {config.endpoint}</p>
+              )}
+            </div>
+            <div>
+              <button
+                onClick={() => saveConfig({ ...config, enabled: !config.enabled })}
+                style={smallButtonStyle(config.enabled ? '#ffc107' : '#28a745')}
+              >
+                {config.enabled ? 'Disable' : 'Enable'}
+              </button>
+              <button onClick={() => handleEditConfig(config)} style={smallButtonStyle('#007bff')}>
+                Edit
+              </button>
+              <button onClick={() => handleDeleteConfig(config.id)} style={smallButtonStyle('#dc3545')}>
+                Delete
+              </button>
+            </div>
+          </div>
+        </div>
+      ))}
+    </div>
+  );
+};
+
+export default AnthropicSettings;
@@ -163,6 +163,22 @@ const MCPSettings: React.FC = () => {
           }
           style={{ marginRight: '10px', padding: '5px', width: '300px' }}
         />
+        <input
+          type="number"
+          min="0"
+          placeholder="Timeout (s)"
+          value={newConfig.config_json?.timeout ?? ''}
+          onChange={(e) =>
+            setNewConfig({
+              ...newConfig,
+              config_json: {
+                ...(newConfig.config_json || {}),
+                timeout: e.target.value === '' ? undefined : Number(e.target.value),
+              },
+            })
+          }
+          style={{ marginRight: '10px', padding: '5px', width: '100px' }}
+        />
         <button onClick={() => handleSave(newConfig)}>Add</button>
       </div>
     </div>
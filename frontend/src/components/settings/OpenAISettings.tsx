@@ -6,6 +6,7 @@ interface OpenAIConfig {
   name: string;
   endpoint: string;
   api_key: string;
+  api_mode: string;
   enabled: boolean;
   created_at: string;
   updated_at: string;
@@ -33,6 +34,7 @@ const OpenAISettings: React.FC<OpenAISettingsProps> = ({ onConfigChange }) => {
     name: '',
     endpoint: '',
     api_key: '',
+    api_mode: 'chat',
     enabled: true,
   });
 
@@ -132,6 +134,7 @@ const OpenAISettings: React.FC<OpenAISettingsProps> = ({ onConfigChange }) => {
       name: config.name,
       endpoint: config.endpoint,
       api_key: config.api_key,
+      api_mode: config.api_mode || 'chat',
       enabled: config.enabled,
     });
   };
@@ -197,6 +200,7 @@ const OpenAISettings: React.FC<OpenAISettingsProps> = ({ onConfigChange }) => {
       name: '',
       endpoint: '',
       api_key: '',
+      api_mode: 'chat',
       enabled: true,
     });
     setEditingConfig(null);
@@ -278,6 +282,18 @@ const OpenAISettings: React.FC<OpenAISettingsProps> = ({ onConfigChange }) => {
               />
             </div>
 
+            <div>
+              <label style={{ display: 'block', marginBottom: '5px', fontWeight: 'bold' }}>API Mode:</label>
+              <select
+                value={formData.api_mode}
+                onChange={(e) => setFormData({ ...formData, api_mode: e.target.value })}
+                style={{ width: '100%', padding: '8px', border: '1px solid #ccc', borderRadius: '4px' }}
+              >
+                <option value="chat">Chat Completions (/chat/completions)</option>
+                <option value="responses">Responses (/responses, with reasoning items)</option>
+              </select>
+            </div>
+
             <div>
               <label style={{ display: 'flex', alignItems: 'center', gap: '10px' }}>
                 <input
@@ -327,7 +343,7 @@ const OpenAISettings: React.FC<OpenAISettingsProps> = ({ onConfigChange }) => {
       {!editingConfig && !showAddForm && (
         <button
           onClick={() => {
-            setFormData({ name: '', endpoint: '', api_key: '', enabled: true });
+            setFormData({ name: '', endpoint: '', api_key: '', api_mode: 'chat', enabled: true });
             setShowAddForm(true);
           }}
           style={{
@@ -384,6 +400,9 @@ const OpenAISettings: React.FC<OpenAISettingsProps> = ({ onConfigChange }) => {
                   <p style={{ margin: '5px 0', fontSize: '14px' }}>
                     <strong>API Key:</strong> {config.api_key ? '••••••••••••••••' : 'Not set'}
                   </p>
+                  <p style={{ margin: '5px 0', fontSize: '14px' }}>
+                    <strong>API Mode:</strong> {config.api_mode === 'responses' ? 'Responses' : 'Chat Completions'}
+                  </p>
                   <p style={{ margin: '5px 0', fontSize: '12px', color: '#666' }}>
                     Created: {new Date(config.created_at).toLocaleString()}
                     {config.updated_at !== config.created_at && (
@@ -81,7 +81,7 @@ export const useCommandProcessor = (sessionId: string | null) => {
 
       const result = await response.json();
       setStatusMessage(
-        `Compression successful! Original tokens: ${result.originalTokenCount}, New tokens: ${result.newTokenCount}`,
+        `Compression successful (${result.strategy})! Original tokens: ${result.originalTokenCount}, New tokens: ${result.newTokenCount}, Saved: ${result.tokensSaved}`,
       );
 
       addMessageToChat(
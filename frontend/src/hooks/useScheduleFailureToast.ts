@@ -0,0 +1,31 @@
+import { useEffect } from 'react';
+import { useAtomValue, useSetAtom } from 'jotai';
+import { isAuthenticatedAtom } from '../atoms/systemAtoms';
+import { toastMessageAtom } from '../atoms/uiAtoms';
+import { EventScheduledRunFailed, parseSseEvent } from '../types/events';
+
+// Shows a toast whenever a scheduled prompt fails to run, while the page is open.
+export const useScheduleFailureToast = () => {
+  const isAuthenticated = useAtomValue(isAuthenticatedAtom);
+  const setToastMessage = useSetAtom(toastMessageAtom);
+
+  useEffect(() => {
+    if (!isAuthenticated) return;
+
+    const eventSource = new EventSource('/api/schedules/events', { withCredentials: true });
+    eventSource.onmessage = (event: MessageEvent) => {
+      try {
+        const parsedEvent = parseSseEvent(event.data);
+        if (parsedEvent.type === EventScheduledRunFailed) {
+          setToastMessage(`Scheduled prompt "${parsedEvent.scheduledPromptName}" failed: ${parsedEvent.run.error}`);
+        }
+      } catch (error) {
+        console.error('Error parsing schedule event:', error);
+      }
+    };
+
+    return () => {
+      eventSource.close();
+    };
+  }, [isAuthenticated, setToastMessage]);
+};
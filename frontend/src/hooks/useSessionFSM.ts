@@ -20,6 +20,8 @@ import {
   inputMessageAtom,
   currentSessionNameAtom,
   currentSessionArchivedAtom,
+  queuedMessagesAtom,
+  interruptedTurnAtom,
 } from '../atoms/chatAtoms';
 import { pendingConfirmationAtom, temporaryEnvChangeMessageAtom } from '../atoms/confirmationAtoms';
 import { isSystemPromptEditingAtom, editingMessageIdAtom } from '../atoms/uiAtoms';
@@ -36,9 +38,13 @@ import {
   EventComplete,
   EventAcknowledge,
   EventCumulTokenCount,
+  EventCompression,
   EventInlineData,
   EventPendingConfirmation,
   EventGenerationChanged,
+  EventQueueChanged,
+  EventQueuedMessageSent,
+  EventSteering,
   EventPing,
   EventFinish,
   type SseEvent,
@@ -77,6 +83,8 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
   const setSessionNameInList = useSetAtom(setSessionNameAtom);
   const setCurrentSessionName = useSetAtom(currentSessionNameAtom);
   const setCurrentSessionArchived = useSetAtom(currentSessionArchivedAtom);
+  const setQueuedMessages = useSetAtom(queuedMessagesAtom);
+  const setInterruptedTurn = useSetAtom(interruptedTurnAtom);
   const setInputMessage = useSetAtom(inputMessageAtom);
   const setEditingMessageId = useSetAtom(editingMessageIdAtom);
   const updateUserMessageId = useSetAtom(updateUserMessageIdAtom);
@@ -126,6 +134,8 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
         // Set current session name (for both temporary and regular sessions)
         setCurrentSessionName(data.name);
         setCurrentSessionArchived(data.archived || false);
+        setQueuedMessages(data.queuedMessages || []);
+        setInterruptedTurn(data.interrupted || null);
 
         // Handle pending confirmation
         if (data.pendingConfirmation) {
@@ -256,12 +266,33 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
             } as ChatMessage);
             break;
 
+          case EventCompression:
+            // History was compressed automatically; compressed messages remain above the snapshot
+            addMessage({
+              id: event.messageId,
+              role: 'user',
+              parts: [{ text: `${event.compressedUpToMessageId}\n${event.summary}` }],
+              type: 'compression',
+              timestamp: new Date().toISOString(),
+              cumulTokenCount: event.newTokenCount,
+            } as ChatMessage);
+            break;
+
           case EventCumulTokenCount:
             // Handle cumulative token count update
             setMessages((prevMessages) => {
               const messageId = event.messageId;
               const cumulTokenCount = event.cumulTokenCount;
-              return prevMessages.map((msg) => (msg.id === messageId ? { ...msg, cumulTokenCount } : msg));
+              const cachedTokenCount = event.cachedTokenCount;
+              return prevMessages.map((msg) =>
+                msg.id === messageId
+                  ? {
+                      ...msg,
+                      cumulTokenCount,
+                      ...(cachedTokenCount !== undefined && { aux: { ...msg.aux, cachedTokenCount } }),
+                    }
+                  : msg,
+              );
             });
             break;
 
@@ -276,6 +307,28 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
             setTemporaryEnvChangeMessage(envChanged);
             break;
 
+          case EventQueueChanged:
+            // Queued messages were added, edited, cancelled or sent
+            setQueuedMessages(event.queuedMessages);
+            break;
+
+          case EventQueuedMessageSent:
+            // A queued message has been sent as a new user message
+            addMessage({ ...event.message, sessionId: event.message.sessionId || sessionManager.sessionId } as ChatMessage);
+            setQueuedMessages((prev) => prev.filter((queued) => queued.id !== event.queuedMessageId));
+            break;
+
+          case EventSteering:
+            // A steering note has been delivered to the model along with a function response
+            addMessage({
+              id: event.messageId,
+              role: 'user',
+              parts: [{ text: event.text }],
+              type: 'steering',
+              timestamp: new Date().toISOString(),
+            } as ChatMessage);
+            break;
+
           case EventSessionName:
             // Update current session name (for both temporary and regular sessions)
             setCurrentSessionName(event.newName);
@@ -439,6 +492,7 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
       setInputMessage('');
       setSelectedFiles([]);
       setPreserveSelectedFiles([]);
+      setInterruptedTurn(null); // A new turn supersedes the interrupted one
 
       // Delegate to operation manager
       operationManager.handleMessageSend(params, sessionId, eventHandlers, temporaryMessageId);
@@ -451,6 +505,7 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
       setInputMessage,
       setSelectedFiles,
       setPreserveSelectedFiles,
+      setInterruptedTurn,
     ],
   );
 
@@ -661,6 +716,39 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
     ],
   );
 
+  const resumeTurn = useCallback(async () => {
+    if (!operationManager) return;
+
+    const sessionId = sessionManager.sessionId;
+    if (!sessionId) {
+      addErrorMessage('No session to resume');
+      return;
+    }
+    if (!primaryBranchId) {
+      addErrorMessage('No branch ID available for resume');
+      return;
+    }
+
+    setInterruptedTurn(null);
+    sessionManager.dispatch({
+      type: 'SEND_MESSAGE',
+      content: '',
+      attachments: [],
+      model: selectedModel,
+      systemPrompt,
+    });
+    await operationManager.handleResume(sessionId, primaryBranchId, eventHandlers);
+  }, [
+    sessionManager,
+    operationManager,
+    addErrorMessage,
+    eventHandlers,
+    setInterruptedTurn,
+    primaryBranchId,
+    selectedModel,
+    systemPrompt,
+  ]);
+
   const updateMessage = useCallback(
     async (messageId: string, editedText: string) => {
       if (!operationManager) return;
@@ -776,6 +864,7 @@ export const useSessionFSM = ({ onSessionSwitch }: UseSessionFSMProps = {}) => {
     retryMessage,
     editMessage,
     retryError,
+    resumeTurn,
     updateMessage,
     continueMessage,
     cancelCurrentOperation,
@@ -1,4 +1,4 @@
-import type { ChatMessage, FileAttachment, InitialState } from '../types/chat';
+import type { ChatMessage, FileAttachment, InitialState, InterruptedTurn, QueuedMessage } from '../types/chat';
 import type { ModelInfo } from '../api/models';
 import { apiFetch, fetchSessionHistory } from '../api/apiClient';
 import { sendMessage, processStreamResponse, type SseEventHandler } from '../utils/messageHandler';
@@ -13,6 +13,7 @@ import {
   EventInitialState,
   EventInitialStateNoCall,
   EventFinish,
+  EventQueuedMessageSent,
   EARLIER_MESSAGES_LOADED,
 } from '../types/events';
 
@@ -39,6 +40,8 @@ export interface InitialStateData {
   workspaceId?: string;
   temporaryEnvChangeMessage?: ChatMessage;
   archived?: boolean;
+  queuedMessages?: QueuedMessage[];
+  interrupted?: InterruptedTurn;
 }
 
 export interface OperationEventHandlers {
@@ -268,6 +271,13 @@ export class SessionOperationManager {
         this.activeOperation = 'none'; // Update internal state but don't close stream yet
         break;
 
+      case EventQueuedMessageSent:
+        // A queued message started a new turn after EventComplete, so the call is active again
+        this._dispatch({ type: 'STREAM_STARTED', activeOperation: 'streaming' });
+        this.activeOperation = 'streaming';
+        handlers?.onEvent?.(event);
+        break;
+
       case EventFinish:
         // EventFinish indicates no more events will be sent
         // Close the EventSource and reset operation state
@@ -315,6 +325,8 @@ export class SessionOperationManager {
       pendingConfirmation: initialState.pendingConfirmation,
       workspaceId: initialState.workspaceId,
       archived: initialState.archived,
+      queuedMessages: initialState.queuedMessages,
+      interrupted: initialState.interrupted,
     };
   }
 
@@ -403,6 +415,14 @@ export class SessionOperationManager {
                 break;
               }
 
+              case EventQueuedMessageSent: {
+                // A queued message started a new turn after EventComplete, so the call is active again
+                this._dispatch({ type: 'STREAM_STARTED', activeOperation: 'streaming' });
+                this.activeOperation = 'streaming';
+                handlers?.onEvent?.(parsedEvent);
+                break;
+              }
+
               case EventFinish: {
                 // EventFinish indicates no more events will be sent
                 // Close the EventSource and reset operation state
@@ -663,6 +683,29 @@ export class SessionOperationManager {
     }
   }
 
+  /**
+   * Handle resuming a turn interrupted by a server restart
+   */
+  async handleResume(sessionId: string, branchId: string, handlers?: OperationEventHandlers): Promise<void> {
+    this.setupStreamingOperation(sessionId, handlers);
+
+    try {
+      this._dispatch({ type: 'STREAM_STARTED', activeOperation: 'streaming' });
+
+      const response = await apiFetch(`/api/chat/${sessionId}/branch/${branchId}/resume`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({}),
+      });
+
+      if (this.validateResponse(response, 'Resume')) return;
+
+      await this.startStreaming(response, sessionId, false);
+    } catch (error) {
+      this.handleOperationError(error, `Resume failed: ${error}`);
+    }
+  }
+
   /**
    * Handle message update operation (PUT, no streaming, no side effects)
    */
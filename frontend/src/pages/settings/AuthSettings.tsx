@@ -3,6 +3,7 @@ import { useEffect, useState, useRef } from 'react';
 import { apiFetch, fetchAccountDetails, AccountDetailsResponse } from '../../api/apiClient';
 import { useSetAtom } from 'jotai';
 import GeminiAPISettings from '../../components/settings/GeminiAPISettings';
+import AnthropicSettings from '../../components/settings/AnthropicSettings';
 import { AccountDetailsModal } from '../../components/settings/AccountDetailsModal';
 import { hasConnectedAccountsAtom, isAuthenticatedAtom } from '../../atoms/systemAtoms';
 
@@ -296,6 +297,10 @@ const AuthSettings: React.FC = () => {
 
       <GeminiAPISettings onConfigChange={() => {}} />
 
+      <hr style={{ margin: '30px 0', border: 'none', borderTop: '1px solid #eee' }} />
+
+      <AnthropicSettings />
+
       {/* Account Details Modal */}
       {selectedAccountDetails && (
         <AccountDetailsModal
@@ -38,6 +38,7 @@ export interface ChatMessage {
     | 'compression'
     | 'env_changed'
     | 'command'
+    | 'steering'
     | 'workspace_hint';
   attachments?: FileAttachment[];
   cumulTokenCount?: number | null;
@@ -62,6 +63,34 @@ export interface InitialState {
   pendingConfirmation?: string;
   envChanged?: EnvChanged;
   archived?: boolean;
+  queuedMessages?: QueuedMessage[];
+  interrupted?: InterruptedTurn;
+}
+
+// An agent turn which was still running when the server stopped
+export interface InterruptedTurn {
+  branchId: string;
+  pendingFunction?: string; // The function call to be re-run on resume, if any
+}
+
+// A user message waiting for the active call to finish
+export interface QueuedMessage {
+  id: number;
+  text: string;
+  attachments?: FileAttachment[];
+  model?: string;
+  createdAt: string;
+}
+
+// A single run of a scheduled prompt
+export interface ScheduledPromptRun {
+  id: number;
+  scheduledPromptId: number;
+  sessionId?: string;
+  status: 'running' | 'succeeded' | 'failed';
+  error?: string;
+  startedAt: string;
+  finishedAt?: string;
 }
 
 export interface Session {
@@ -1,11 +1,16 @@
 import { splitOnceByNewline } from '../utils/stringUtils';
-import type { InitialState } from './chat';
+import type { ChatMessage, InitialState, QueuedMessage, ScheduledPromptRun } from './chat';
 
 // SSE Event Types
 //
-// Sending initial messages: A -> 0 -> any number of T/M/F/R/C/I -> P/E or (Q -> N) -> $
-// Sending subsequent messages: any number of G -> A -> any number of T/M/F/R/C/I -> P/E/Q -> $
-// Loading messages and streaming current call: W -> 1 or (0 -> any number of T/M/F/R/C/I -> P/E or (Q -> optional N) -> $)
+// Sending initial messages: A -> 0 -> any number of T/M/F/R/C/I/Z -> P/E or (Q -> N) -> $
+// Sending subsequent messages: any number of G -> A -> any number of T/M/F/R/C/I/Z -> P/E/Q -> $
+// Steering notes posted during a call are delivered with the next function response, so S may follow any R.
+// Loading messages and streaming current call: W -> 1 or (0 -> any number of T/M/F/R/C/I/Z -> P/E or (Q -> optional N) -> $)
+// Sending messages while a call is active: K -> $ (the message is queued, and every subscribed client gets K as well)
+// Once a call finishes with Q, any queued message is sent as if it was a subsequent message: U -> any number of T/M/F/R/C/I/Z -> P/E/Q
+// Editing or cancelling queued messages broadcasts K to every subscribed client at any time.
+// Schedule events (/api/schedules/events) are not tied to any session: any number of Y, never followed by $.
 export const EventWorkspaceHint = 'W';
 export const EventInitialState = '0';
 export const EventInitialStateNoCall = '1';
@@ -17,8 +22,13 @@ export const EventFunctionResponse = 'R';
 export const EventInlineData = 'I';
 export const EventSessionName = 'N';
 export const EventCumulTokenCount = 'C';
+export const EventCompression = 'Z';
 export const EventPendingConfirmation = 'P';
 export const EventGenerationChanged = 'G';
+export const EventQueueChanged = 'K';
+export const EventQueuedMessageSent = 'U';
+export const EventSteering = 'S';
+export const EventScheduledRunFailed = 'Y';
 export const EventError = 'E';
 export const EventComplete = 'Q';
 export const EventFinish = '$';
@@ -93,6 +103,16 @@ export type SseCumulTokenCount = {
   type: typeof EventCumulTokenCount;
   messageId: string;
   cumulTokenCount: number;
+  cachedTokenCount?: number; // Part of cumulTokenCount served from a context cache
+};
+
+export type SseCompression = {
+  type: typeof EventCompression;
+  messageId: string;
+  originalTokenCount: number;
+  newTokenCount: number;
+  compressedUpToMessageId: string;
+  summary: string;
 };
 
 export type SsePendingConfirmation = {
@@ -106,6 +126,29 @@ export type SseGenerationChanged = {
   envChangedJson: string;
 };
 
+export type SseQueueChanged = {
+  type: typeof EventQueueChanged;
+  queuedMessages: QueuedMessage[];
+};
+
+export type SseQueuedMessageSent = {
+  type: typeof EventQueuedMessageSent;
+  queuedMessageId: number;
+  message: ChatMessage;
+};
+
+export type SseSteering = {
+  type: typeof EventSteering;
+  messageId: string;
+  text: string;
+};
+
+export type SseScheduledRunFailed = {
+  type: typeof EventScheduledRunFailed;
+  scheduledPromptName: string;
+  run: ScheduledPromptRun;
+};
+
 export type SsePing = {
   type: typeof EventPing;
 };
@@ -138,8 +181,13 @@ export type SseEvent =
   | SseInlineData
   | SseSessionName
   | SseCumulTokenCount
+  | SseCompression
   | SsePendingConfirmation
   | SseGenerationChanged
+  | SseQueueChanged
+  | SseQueuedMessageSent
+  | SseSteering
+  | SseScheduledRunFailed
   | SseError
   | SseComplete
   | SseFinish
@@ -239,13 +287,30 @@ export function parseSseEvent(eventString: string): SseEvent {
       } as SseSessionName;
 
     case EventCumulTokenCount:
-      const [ctcMessageId, cumulTokenCountStr] = splitOnceByNewline(data);
+      const [ctcMessageId, ctcCounts] = splitOnceByNewline(data);
+      const [cumulTokenCountStr, cachedTokenCountStr] = splitOnceByNewline(ctcCounts);
       return {
         type: EventCumulTokenCount,
         messageId: ctcMessageId,
         cumulTokenCount: parseInt(cumulTokenCountStr, 10),
+        cachedTokenCount: cachedTokenCountStr ? parseInt(cachedTokenCountStr, 10) : undefined,
       } as SseCumulTokenCount;
 
+    case EventCompression: {
+      const [compMessageId, compRest1] = splitOnceByNewline(data);
+      const [originalTokenCountStr, compRest2] = splitOnceByNewline(compRest1);
+      const [newTokenCountStr, compRest3] = splitOnceByNewline(compRest2);
+      const [compressedUpToMessageId, summary] = splitOnceByNewline(compRest3);
+      return {
+        type: EventCompression,
+        messageId: compMessageId,
+        originalTokenCount: parseInt(originalTokenCountStr, 10),
+        newTokenCount: parseInt(newTokenCountStr, 10),
+        compressedUpToMessageId,
+        summary,
+      } as SseCompression;
+    }
+
     case EventPendingConfirmation:
       return {
         type: EventPendingConfirmation,
@@ -260,6 +325,39 @@ export function parseSseEvent(eventString: string): SseEvent {
         envChangedJson,
       } as SseGenerationChanged;
 
+    case EventQueueChanged:
+      return {
+        type: EventQueueChanged,
+        queuedMessages: JSON.parse(data),
+      } as SseQueueChanged;
+
+    case EventQueuedMessageSent: {
+      const [queuedMessageId, messageJson] = splitOnceByNewline(data);
+      return {
+        type: EventQueuedMessageSent,
+        queuedMessageId: parseInt(queuedMessageId, 10),
+        message: JSON.parse(messageJson),
+      } as SseQueuedMessageSent;
+    }
+
+    case EventSteering: {
+      const [steeringMessageId, steeringText] = splitOnceByNewline(data);
+      return {
+        type: EventSteering,
+        messageId: steeringMessageId,
+        text: steeringText,
+      } as SseSteering;
+    }
+
+    case EventScheduledRunFailed: {
+      const [scheduledPromptName, runJson] = splitOnceByNewline(data);
+      return {
+        type: EventScheduledRunFailed,
+        scheduledPromptName,
+        run: JSON.parse(runJson) as ScheduledPromptRun,
+      } as SseScheduledRunFailed;
+    }
+
     case EventPing:
       return {
         type: EventPing,
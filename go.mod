@@ -15,6 +15,7 @@ require (
 	github.com/lifthrasiir/angel/internal/server v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/tool v0.0.0-00010101000000-000000000000 // indirect
 	github.com/lifthrasiir/angel/internal/tool/file v0.0.0-00010101000000-000000000000 // indirect
+	github.com/lifthrasiir/angel/internal/tool/memory v0.0.0-00010101000000-000000000000 // indirect
 	github.com/lifthrasiir/angel/internal/tool/search_chat v0.0.0-00010101000000-000000000000 // indirect
 	github.com/lifthrasiir/angel/internal/tool/shell v0.0.0-00010101000000-000000000000 // indirect
 	github.com/lifthrasiir/angel/internal/tool/subagent v0.0.0-00010101000000-000000000000 // indirect
@@ -36,6 +37,7 @@ replace (
 	github.com/lifthrasiir/angel/internal/server => ./src/internal/server
 	github.com/lifthrasiir/angel/internal/tool => ./src/internal/tool
 	github.com/lifthrasiir/angel/internal/tool/file => ./src/internal/tool/file
+	github.com/lifthrasiir/angel/internal/tool/memory => ./src/internal/tool/memory
 	github.com/lifthrasiir/angel/internal/tool/search_chat => ./src/internal/tool/search_chat
 	github.com/lifthrasiir/angel/internal/tool/shell => ./src/internal/tool/shell
 	github.com/lifthrasiir/angel/internal/tool/subagent => ./src/internal/tool/subagent
@@ -51,6 +53,7 @@ require (
 	github.com/bmatcuk/doublestar/v4 v4.9.1 // indirect
 	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
 	github.com/creack/pty v1.1.24 // indirect
+	github.com/dlclark/regexp2 v1.11.5 // indirect
 	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/fvbommel/sortorder v1.1.0 // indirect
 	github.com/gorilla/csrf v1.7.3 // indirect
@@ -63,6 +66,7 @@ require (
 	github.com/ncruces/julianday v1.0.0 // indirect
 	github.com/sergi/go-diff v1.4.0 // indirect
 	github.com/tetratelabs/wazero v1.10.1 // indirect
+	github.com/tiktoken-go/tokenizer v0.7.0 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
 	golang.org/x/oauth2 v0.23.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
@@ -299,6 +299,13 @@ func readPipeToBuffer(wg *sync.WaitGroup, pipe io.ReadCloser, mu *sync.Mutex, bu
 // The PTY provides terminal emulation, allowing interactive programs and ANSI escape
 // sequences to work properly. The terminal size is set to 80x24 characters.
 func (sf *SessionFS) Run(ctx context.Context, command string, workingDir string) (*RunningCommand, error) {
+	return sf.RunWithStdin(ctx, command, workingDir, nil)
+}
+
+// RunWithStdin is the same as Run but also feeds stdin to the command when non-nil.
+// On Unix the command reads stdin from a pipe instead of the PTY;
+// on Windows stdin is written to the PTY followed by an end-of-file marker.
+func (sf *SessionFS) RunWithStdin(ctx context.Context, command string, workingDir string, stdin []byte) (*RunningCommand, error) {
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
 
@@ -389,6 +396,9 @@ func (sf *SessionFS) Run(ctx context.Context, command string, workingDir string)
 	}
 
 	execCmd.Dir = actualWorkingDir
+	if stdin != nil && runtime.GOOS != "windows" {
+		execCmd.Stdin = bytes.NewReader(stdin)
+	}
 
 	// Start PTY with the command (80x24 terminal size)
 	pty, err := terminal.StartPTY(execCmd, 80, 24)
@@ -398,6 +408,15 @@ func (sf *SessionFS) Run(ctx context.Context, command string, workingDir string)
 		return nil, fmt.Errorf("failed to start PTY: %w", err)
 	}
 
+	if stdin != nil && runtime.GOOS == "windows" {
+		if _, err := pty.Write(append(stdin, "\r\n\x1a\r\n"...)); err != nil {
+			_ = pty.Close()
+			cancel()
+			_ = sandbox.Close()
+			return nil, fmt.Errorf("failed to write stdin to PTY: %w", err)
+		}
+	}
+
 	rc := &RunningCommand{
 		Cmd:     execCmd,
 		sandbox: sandbox,
@@ -19,15 +19,25 @@ type baseClient struct {
 	clientName     string // Used for logging
 }
 
-// MakeAPIRequest creates and executes an HTTP request with common error handling
+// MakeAPIRequest creates and executes a POST request with common error handling
 func (c *baseClient) MakeAPIRequest(ctx context.Context, url string, reqBody interface{}, headers map[string]string) (*http.Response, error) {
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		log.Printf("%s.makeAPIRequest: Failed to marshal request body: %v", c.clientName, err)
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	return c.MakeAPIRequestWithMethod(ctx, "POST", url, reqBody, headers)
+}
+
+// MakeAPIRequestWithMethod creates and executes an HTTP request with common error handling.
+// A nil reqBody sends no body.
+func (c *baseClient) MakeAPIRequestWithMethod(ctx context.Context, method, url string, reqBody interface{}, headers map[string]string) (*http.Response, error) {
+	var body io.Reader
+	if reqBody != nil {
+		jsonBody, err := json.Marshal(reqBody)
+		if err != nil {
+			log.Printf("%s.makeAPIRequest: Failed to marshal request body: %v", c.clientName, err)
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		body = bytes.NewBuffer(jsonBody)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		log.Printf("%s.makeAPIRequest: Failed to create HTTP request: %v", c.clientName, err)
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
@@ -56,14 +66,14 @@ func (c *baseClient) MakeAPIRequest(ctx context.Context, url string, reqBody int
 
 		// Skip logging for cancellation errors
 		if ctx.Err() == context.Canceled {
-			return nil, &APIError{StatusCode: resp.StatusCode, Message: resp.Status, Response: string(bodyBytes)}
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: resp.Status, Response: string(bodyBytes), RetryAfter: resp.Header.Get("Retry-After")}
 		}
 
 		// Log both request and response when status code is not OK
 		filteredReq := filterLargeJSON(reqBody)
 		filteredResp := filterLargeJSON(string(bodyBytes))
 		log.Printf("%s.makeAPIRequest: API response error - Request: %s, Status %d %s, Response: %s", c.clientName, filteredReq, resp.StatusCode, resp.Status, filteredResp)
-		return nil, &APIError{StatusCode: resp.StatusCode, Message: resp.Status, Response: string(bodyBytes)}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: resp.Status, Response: string(bodyBytes), RetryAfter: resp.Header.Get("Retry-After")}
 	}
 
 	return resp, nil
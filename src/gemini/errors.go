@@ -9,12 +9,28 @@ type APIError struct {
 	StatusCode int
 	Message    string
 	Response   string
+	RetryAfter string // Retry-After header, if any
 }
 
 func (e *APIError) Error() string {
 	return fmt.Sprintf("API response error: %d %s, response: %s", e.StatusCode, e.Message, e.Response)
 }
 
+// ErrorStatus represents an error reported inside a response stream (google.rpc.Status).
+// Code is an HTTP status code, or 0 if the stream itself was interrupted.
+type ErrorStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status,omitempty"`
+}
+
+func (e *ErrorStatus) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("stream error: %d %s: %s", e.Code, e.Status, e.Message)
+	}
+	return fmt.Sprintf("stream error: %d: %s", e.Code, e.Message)
+}
+
 // FinishReasonMessage creates an appropriate error message based on the finish reason.
 func FinishReasonMessage(finishReason string) string {
 	switch finishReason {
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"time"
 )
 
 // GeminiAPIClient holds the client for direct Gemini API
@@ -71,6 +72,30 @@ func (c *GeminiAPIClient) CountTokens(ctx context.Context, modelName string, con
 	}, nil
 }
 
+// BatchEmbedContents calls the batchEmbedContents of Gemini API and returns embeddings in the order of requests.
+func (c *GeminiAPIClient) BatchEmbedContents(ctx context.Context, modelName string, requests []EmbedContentRequest) ([][]float32, error) {
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:batchEmbedContents?key=%s", modelName, c.APIKey)
+	resp, err := c.makeAPIRequest(ctx, url, BatchEmbedContentsRequest{Requests: requests}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response BatchEmbedContentsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode API response: %w", err)
+	}
+	if len(response.Embeddings) != len(requests) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(requests), len(response.Embeddings))
+	}
+
+	embeddings := make([][]float32, len(response.Embeddings))
+	for i, embedding := range response.Embeddings {
+		embeddings[i] = embedding.Values
+	}
+	return embeddings, nil
+}
+
 // GenerateContent calls the non-streaming generateContent endpoint
 func (c *GeminiAPIClient) GenerateContent(ctx context.Context, modelName string, request GenerateContentRequest) (*GenerateContentResponse, error) {
 	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", modelName, c.APIKey)
@@ -87,3 +112,41 @@ func (c *GeminiAPIClient) GenerateContent(ctx context.Context, modelName string,
 
 	return &response, nil
 }
+
+// CreateCachedContent creates a new cached content.
+func (c *GeminiAPIClient) CreateCachedContent(ctx context.Context, cachedContent CachedContent) (*CachedContent, error) {
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/cachedContents?key=%s", c.APIKey)
+	return c.cachedContentRequest(ctx, "POST", url, cachedContent)
+}
+
+// UpdateCachedContentTTL extends the expiration of a cached content.
+// The name is of the form "cachedContents/...".
+func (c *GeminiAPIClient) UpdateCachedContentTTL(ctx context.Context, name string, ttl time.Duration) (*CachedContent, error) {
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/%s?updateMask=ttl&key=%s", name, c.APIKey)
+	return c.cachedContentRequest(ctx, "PATCH", url, CachedContent{TTL: fmt.Sprintf("%ds", int(ttl.Seconds()))})
+}
+
+// DeleteCachedContent deletes a cached content before its expiration.
+func (c *GeminiAPIClient) DeleteCachedContent(ctx context.Context, name string) error {
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/%s?key=%s", name, c.APIKey)
+	resp, err := c.MakeAPIRequestWithMethod(ctx, "DELETE", url, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *GeminiAPIClient) cachedContentRequest(ctx context.Context, method, url string, reqBody CachedContent) (*CachedContent, error) {
+	resp, err := c.MakeAPIRequestWithMethod(ctx, method, url, reqBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response CachedContent
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode API response: %w", err)
+	}
+	return &response, nil
+}
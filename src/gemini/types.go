@@ -875,10 +875,32 @@ type GenerateContentResponse struct {
 
 	// Only in Vertex API:
 	CreateTime string `json:"createTime,omitempty"`
+
+	// Error reported in the middle of a stream, in place of a response
+	Error *ErrorStatus `json:"error,omitempty"`
 }
 
 type CaGenerateContentResponse struct {
 	Response GenerateContentResponse `json:"response"`
+	Error    *ErrorStatus            `json:"error,omitempty"`
+}
+
+// CachedContent is a prefix of contents cached by the Gemini API, to be referred by GenerateContentRequest.CachedContent
+type CachedContent struct {
+	Name              string                      `json:"name,omitempty"`  // "cachedContents/..."
+	Model             string                      `json:"model,omitempty"` // "models/..."
+	DisplayName       string                      `json:"displayName,omitempty"`
+	Contents          []Content                   `json:"contents,omitempty"`
+	SystemInstruction *Content                    `json:"systemInstruction,omitempty"`
+	Tools             []Tool                      `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig                 `json:"toolConfig,omitempty"`
+	TTL               string                      `json:"ttl,omitempty"`        // e.g. "300s"; input only
+	ExpireTime        string                      `json:"expireTime,omitempty"` // RFC 3339
+	UsageMetadata     *CachedContentUsageMetadata `json:"usageMetadata,omitempty"`
+}
+
+type CachedContentUsageMetadata struct {
+	TotalTokenCount int `json:"totalTokenCount,omitempty"`
 }
 
 type CountTokenRequest struct {
@@ -886,6 +908,26 @@ type CountTokenRequest struct {
 	Contents []Content `json:"contents"`
 }
 
+// EmbedContentRequest is a single request of batchEmbedContents
+type EmbedContentRequest struct {
+	Model                string  `json:"model"` // "models/..."
+	Content              Content `json:"content"`
+	TaskType             string  `json:"taskType,omitempty"` // e.g. "RETRIEVAL_DOCUMENT" or "RETRIEVAL_QUERY"
+	OutputDimensionality int     `json:"outputDimensionality,omitempty"`
+}
+
+type BatchEmbedContentsRequest struct {
+	Requests []EmbedContentRequest `json:"requests"`
+}
+
+type ContentEmbedding struct {
+	Values []float32 `json:"values"`
+}
+
+type BatchEmbedContentsResponse struct {
+	Embeddings []ContentEmbedding `json:"embeddings"`
+}
+
 type CaCountTokenRequest struct {
 	Request CountTokenRequest `json:"request"`
 }
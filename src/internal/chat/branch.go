@@ -519,6 +519,12 @@ func ConfirmBranch(
 
 		// Construct the function response for denial
 		functionName, _, _ := strings.Cut(lastMessage.Text, "\n")
+		deniedCall := FunctionCall{Name: functionName}
+		if lastMessage.Type == TypeFunctionCall {
+			_ = json.Unmarshal([]byte(lastMessage.Text), &deniedCall)
+		}
+		tool.RecordDenial(db.Database, deniedCall, tool.HandlerParams{SessionId: db.SessionId(), BranchId: branchId})
+
 		denialResponseMap := map[string]interface{}{"error": "User denied tool execution"}
 		fr := FunctionResponse{Name: functionName, Response: denialResponseMap}
 		frJson, err := json.Marshal(fr)
@@ -568,16 +574,46 @@ func ConfirmBranch(
 	// If modifiedData is provided, update the function call arguments
 	maps.Copy(fc.Args, modifiedData)
 
-	// Re-execute the tool function with confirmationReceived = true
-	toolResults, err := tools.Call(ctx, fc, tool.HandlerParams{
+	return executeFunctionCall(ctx, db, models, ga, tools, config, ew, session, mc, branchId, lastMessage, fc, true)
+}
+
+// executeFunctionCall executes the function call at the end of the branch, saves its response
+// and resumes streaming from there. confirmed is set when the user has already approved the call.
+func executeFunctionCall(
+	ctx context.Context, db *database.SessionDatabase, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	ew EventWriter, session Session, mc *database.MessageChain, branchId string, lastMessage *Message, fc FunctionCall, confirmed bool,
+) error {
+	// Execute the tool function, with confirmationReceived = true if the user has approved it.
+	// The call is registered so that it can be cancelled and resumed like streamLLMResponse.
+	callCtx, cancel := context.WithCancel(ctx)
+	if err := startCall(db.SessionId(), cancel); err != nil {
+		cancel()
+		return err
+	}
+	recordActiveCall(db, branchId)
+	toolResults, err := tools.Call(callCtx, fc, tool.HandlerParams{
 		ModelName:            lastMessage.Model,
 		SessionId:            db.SessionId(),
 		BranchId:             branchId,
-		ConfirmationReceived: true,
+		ConfirmationReceived: confirmed,
 	})
+	completeCall(db.SessionId())
+	clearActiveCall(db)
+	cancel()
+	var timeoutErr *tool.TimeoutError
+	var pendingConfirmation *tool.PendingConfirmation
+	if errors.As(err, &timeoutErr) {
+		toolResults.Value = timeoutErr.Response()
+		err = nil
+	} else if errors.As(err, &pendingConfirmation) {
+		ew.Acquire()
+		defer ew.Release()
+		handlePendingConfirmation(db, ew, InitialState{SessionId: db.SessionId(), PrimaryBranchID: branchId}, pendingConfirmation)
+		return nil
+	}
 	if err != nil {
-		log.Printf("confirmBranchHandler: Error re-executing function %s after confirmation: %v", fc.Name, err)
-		// If re-execution fails, send an error event and stop streaming
+		log.Printf("executeFunctionCall: Error executing function %s: %v", fc.Name, err)
+		// If execution fails, send an error event and stop streaming
 		ew.Acquire()
 		defer ew.Release()
 		ew.Broadcast(EventError, fmt.Sprintf("Tool re-execution failed: %v", err))
@@ -588,7 +624,7 @@ func ConfirmBranch(
 	fr := FunctionResponse{Name: fc.Name, Response: toolResults.Value}
 	frJson, err := json.Marshal(fr)
 	if err != nil { // Check error from json.Marshal(fr)
-		log.Printf("confirmBranchHandler: Failed to marshal function response for frontend: %v", err)
+		log.Printf("executeFunctionCall: Failed to marshal function response for frontend: %v", err)
 		// If marshaling fails, create a basic error JSON
 		frJson = []byte(fmt.Sprintf(`{"error": "%v"}`, err))
 	}
@@ -601,7 +637,7 @@ func ConfirmBranch(
 		Attachments: toolResults.Attachments,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to save function response message after confirmation: %w", err)
+		return fmt.Errorf("failed to save function response message: %w", err)
 	}
 
 	// Send EventFunctionResponse to frontend
@@ -613,7 +649,7 @@ func ConfirmBranch(
 		Attachments: toolResults.Attachments,
 	})
 	if err != nil {
-		log.Printf("confirmBranchHandler: Failed to marshal function response value for SSE: %v", err)
+		log.Printf("executeFunctionCall: Failed to marshal function response value for SSE: %v", err)
 		functionResponseValueJson = fmt.Appendf(nil, `{"response": {"error": "%v"}}`, err)
 	}
 	formattedData := fmt.Sprintf("%d\n%s\n%s", functionResponseMsg.ID, fc.Name, string(functionResponseValueJson))
@@ -625,7 +661,7 @@ func ConfirmBranch(
 	// Retrieve session history from DB for LLM (full context)
 	fullFrontendHistoryForLLM, err := database.GetSessionHistoryContext(db, branchId)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve full session history for LLM after confirmation: %w", err)
+		return fmt.Errorf("failed to retrieve full session history for LLM after function response: %w", err)
 	}
 
 	var roots []string
@@ -647,7 +683,7 @@ func ConfirmBranch(
 
 	// Resume streaming from the point after the function response
 	if err := streamLLMResponse(db, models, ga, tools, config, initialState, ew, mc, false, time.Now(), fullFrontendHistoryForLLM, -1); err != nil {
-		return fmt.Errorf("error streaming LLM response after confirmation: %w", err)
+		return fmt.Errorf("error streaming LLM response after function response: %w", err)
 	}
 	return nil
 }
@@ -13,6 +13,13 @@ type Call struct {
 	SessionID  string             `json:"sessionId"`
 	CancelFunc context.CancelFunc `json:"-"` // context.CancelFunc cannot be marshaled to JSON
 	StartTime  time.Time          `json:"startTime"`
+
+	// handingOver is set when the call has finished but a queued message is about to be sent,
+	// so that the session stays active and the following call can take over its place.
+	handingOver bool
+
+	// steeringNotes are user notes waiting for the next function response of the call.
+	steeringNotes []string
 }
 
 var (
@@ -25,7 +32,7 @@ func startCall(sessionId string, cancelFunc context.CancelFunc) error {
 	callsMutex.Lock()
 	defer callsMutex.Unlock()
 
-	if _, ok := activeCalls[sessionId]; ok {
+	if call, ok := activeCalls[sessionId]; ok && !call.handingOver {
 		return fmt.Errorf("a call for session ID %s is already active", sessionId)
 	}
 
@@ -70,7 +77,11 @@ func CancelCall(sessionId string) error {
 func completeCall(sessionId string) {
 	callsMutex.Lock()
 	defer callsMutex.Unlock()
+	completeCallUnsafe(sessionId)
+}
 
+// completeCallUnsafe is completeCall without locking (must be called with callsMutex held)
+func completeCallUnsafe(sessionId string) {
 	delete(activeCalls, sessionId)
 
 	subsessionPrefix := sessionId + "."
@@ -81,11 +92,43 @@ func completeCall(sessionId string) {
 	}
 }
 
+// SteerCall posts a steering note to the active call of the session without cancelling it.
+// The note is delivered to the model along with the next function response.
+func SteerCall(sessionId string, note string) error {
+	callsMutex.Lock()
+	defer callsMutex.Unlock()
+
+	call, ok := activeCalls[sessionId]
+	if !ok || call.handingOver {
+		return notFoundError("no active call found for session ID: %s", sessionId)
+	}
+	call.steeringNotes = append(call.steeringNotes, note)
+	return nil
+}
+
+// takeSteeringNotes removes and returns all pending steering notes of the active call.
+func takeSteeringNotes(sessionId string) []string {
+	callsMutex.Lock()
+	defer callsMutex.Unlock()
+
+	call, ok := activeCalls[sessionId]
+	if !ok {
+		return nil
+	}
+	notes := call.steeringNotes
+	call.steeringNotes = nil
+	return notes
+}
+
 // HasActiveCall checks if there is an active call for the given session ID or any of its subagents.
 func HasActiveCall(sessionId string) bool {
 	callsMutex.Lock()
 	defer callsMutex.Unlock()
+	return hasActiveCallUnsafe(sessionId)
+}
 
+// hasActiveCallUnsafe is HasActiveCall without locking (must be called with callsMutex held)
+func hasActiveCallUnsafe(sessionId string) bool {
 	// Check main session
 	if _, ok := activeCalls[sessionId]; ok {
 		return true
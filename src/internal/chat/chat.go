@@ -32,6 +32,24 @@ type InitialState struct {
 	PendingConfirmation    string            `json:"pendingConfirmation,omitempty"`
 	EnvChanged             *env.EnvChanged   `json:"envChanged,omitempty"`
 	Archived               bool              `json:"archived,omitempty"`
+	QueuedMessages         []QueuedMessage   `json:"queuedMessages,omitempty"`
+	Interrupted            *InterruptedTurn  `json:"interrupted,omitempty"`
+}
+
+// NewPromptData returns the data for evaluating prompt templates in the workspace, including its memories.
+func NewPromptData(db *database.Database, workspaceID, workspaceName string) prompts.PromptData {
+	return prompts.NewPromptData(workspaceName).WithMemories(func() []string {
+		memories, err := database.GetMemories(db, workspaceID)
+		if err != nil {
+			log.Printf("Failed to load memories of workspace %s: %v", workspaceID, err)
+			return nil
+		}
+		var contents []string
+		for _, memory := range memories {
+			contents = append(contents, memory.Content)
+		}
+		return contents
+	})
 }
 
 func NewSessionAndMessage(
@@ -48,8 +66,9 @@ func NewSessionAndMessage(
 		workspaceName = workspace.Name
 	}
 
-	// Evaluate system prompt
-	data := prompts.NewPromptData(workspaceName)
+	// Evaluate system prompt. This happens only once per session, so that the prompt stays stable
+	// (and cacheable) across turns; memories stored later are only seen by new sessions.
+	data := NewPromptData(db, workspaceId, workspaceName)
 	systemPrompt, err := data.EvaluatePrompt(systemPrompt)
 	if err != nil {
 		return fmt.Errorf("failed to evaluate system prompt: %w", err)
@@ -160,9 +179,36 @@ func NewSessionAndMessage(
 	return nil
 }
 
+// NewChatMessage sends a new user message to the session.
+// If the session already has an active call, the message is queued instead and sent after the call finishes.
 func NewChatMessage(
 	ctx context.Context, db *database.SessionDatabase, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
 	ew EventWriter, userMessage string, attachments []FileAttachment, modelToUse string, fetchLimit int,
+) error {
+	queued, err := queueIfActive(db, userMessage, attachments, modelToUse)
+	if err != nil {
+		return fmt.Errorf("failed to queue user message: %w", err)
+	}
+	if queued {
+		payload, err := QueuedMessagesPayload(db)
+		if err != nil {
+			return err
+		}
+		// The requesting client is not subscribed to the session, so it gets the queue directly
+		ew.Broadcast(EventQueueChanged, payload)
+		ew.Send(EventQueueChanged, payload)
+		ew.Send(EventFinish, "")
+		return nil
+	}
+	return sendChatMessage(ctx, db, models, ga, tools, config, ew, userMessage, attachments, modelToUse, fetchLimit, -1)
+}
+
+// sendChatMessage adds a user message to the session and streams the response.
+// queuedMessageID is the ID of the queued message being sent, or -1 if the message was sent directly.
+// Queued messages are sent without a requesting client, so every event is broadcast instead.
+func sendChatMessage(
+	ctx context.Context, db *database.SessionDatabase, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	ew EventWriter, userMessage string, attachments []FileAttachment, modelToUse string, fetchLimit int, queuedMessageID int,
 ) error {
 	session, err := database.GetSession(db)
 	if err != nil {
@@ -265,11 +311,17 @@ func NewChatMessage(
 	defer ew.Release()
 
 	if envChangedEventPayload != "" {
-		ew.Send(EventGenerationChanged, envChangedEventPayload)
+		if queuedMessageID >= 0 {
+			ew.Broadcast(EventGenerationChanged, envChangedEventPayload)
+		} else {
+			ew.Send(EventGenerationChanged, envChangedEventPayload)
+		}
 	}
 
 	// Send acknowledgement for user message ID to frontend
-	ew.Send(EventAcknowledge, fmt.Sprintf("%d", userMsg.ID))
+	if queuedMessageID < 0 {
+		ew.Send(EventAcknowledge, fmt.Sprintf("%d", userMsg.ID))
+	}
 
 	// Retrieve session history from DB for LLM (full context)
 	fullFrontendHistoryForLLM, err := database.GetSessionHistoryContext(db, primaryBranchID)
@@ -299,12 +351,25 @@ func NewChatMessage(
 		Roots:           roots,
 	}
 
-	// Send initial state as a single SSE event (Event type 0: active call, broadcasting will start)
-	initialStateJSON, err := json.Marshal(initialState)
-	if err != nil {
-		return fmt.Errorf("failed to marshal initial state: %w", err)
+	if queuedMessageID >= 0 {
+		// Every client already has the initial state, so only the new user message is broadcast
+		var userFrontendMsg FrontendMessage
+		if n := len(frontendHistoryForInitialState); n > 0 {
+			userFrontendMsg = frontendHistoryForInitialState[n-1]
+		}
+		userFrontendMsgJSON, err := json.Marshal(userFrontendMsg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal queued user message: %w", err)
+		}
+		ew.Broadcast(EventQueuedMessageSent, fmt.Sprintf("%d\n%s", queuedMessageID, userFrontendMsgJSON))
+	} else {
+		// Send initial state as a single SSE event (Event type 0: active call, broadcasting will start)
+		initialStateJSON, err := json.Marshal(initialState)
+		if err != nil {
+			return fmt.Errorf("failed to marshal initial state: %w", err)
+		}
+		ew.Send(EventInitialState, string(initialStateJSON))
 	}
-	ew.Send(EventInitialState, string(initialStateJSON))
 
 	if err := streamLLMResponse(db, models, ga, tools, config, initialState, ew, mc, false, time.Now(), fullFrontendHistoryForLLM, -1); err != nil {
 		return fmt.Errorf("failed to stream LLM response: %w", err)
@@ -421,6 +486,18 @@ func LoadChatSession(ctx context.Context, db *database.SessionDatabase, ew Event
 		initialState.PendingConfirmation = *branch.PendingConfirmation
 	}
 
+	initialState.QueuedMessages, err = database.GetQueuedMessages(db)
+	if err != nil {
+		err = fmt.Errorf("failed to get queued messages: %w", err)
+		return
+	}
+
+	initialState.Interrupted, err = getInterruptedTurn(db, actualBranchID)
+	if err != nil {
+		err = fmt.Errorf("failed to check interrupted turn: %w", err)
+		return
+	}
+
 	// If it's an SSE request, handle streaming. Otherwise, send regular JSON response.
 	if ew != nil {
 		if callStartTime, ok := GetCallStartTime(db.SessionId()); ok {
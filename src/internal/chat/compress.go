@@ -2,7 +2,6 @@ package chat
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -13,7 +12,6 @@ import (
 	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/database"
 	"github.com/lifthrasiir/angel/internal/llm"
-	"github.com/lifthrasiir/angel/internal/prompts"
 	. "github.com/lifthrasiir/angel/internal/types"
 )
 
@@ -23,12 +21,19 @@ const (
 	COMPRESSION_PRESERVE_THRESHOLD = 0.3
 )
 
+// AutoCompressionThresholdConfigName is the app config key overriding COMPRESSION_TOKEN_THRESHOLD,
+// the fraction of the model's context window above which the history is compressed before each LLM call.
+// Zero disables automatic compression.
+const AutoCompressionThresholdConfigName = "auto_compression_threshold"
+
 type CompressResult struct {
 	OriginalTokenCount      int
 	NewTokenCount           int
 	CompressionMsgID        int
 	CompressedUpToMessageID int
 	ExtractedSummary        string
+	Strategy                string // Compression strategy used
+	TokensSaved             int    // OriginalTokenCount - NewTokenCount
 }
 
 var stateSnapshotPattern = regexp.MustCompile(`(?s)<state_snapshot>(.*?)</state_snapshot>`)
@@ -42,17 +47,81 @@ func extractStateSnapshotContent(xmlContent string) string {
 	return xmlContent // Fallback to full XML if tags not found
 }
 
+// GetAutoCompressionThreshold returns the fraction of the context window that triggers automatic compression.
+func GetAutoCompressionThreshold(db *database.Database) float64 {
+	value, err := database.GetAppConfig(db, AutoCompressionThresholdConfigName)
+	if err != nil {
+		log.Printf("Failed to load automatic compression threshold: %v", err)
+		return COMPRESSION_TOKEN_THRESHOLD
+	}
+	if value == nil {
+		return COMPRESSION_TOKEN_THRESHOLD
+	}
+	threshold, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		log.Printf("Invalid automatic compression threshold %q: %v", value, err)
+		return COMPRESSION_TOKEN_THRESHOLD
+	}
+	return threshold
+}
+
+// SetAutoCompressionThreshold sets the fraction of the context window that triggers automatic compression.
+func SetAutoCompressionThreshold(db *database.Database, threshold float64) error {
+	if threshold < 0 || threshold >= 1 {
+		return MakeBadRequestError("automatic compression threshold should be at least 0 and less than 1")
+	}
+	return database.SetAppConfig(db, AutoCompressionThresholdConfigName, []byte(strconv.FormatFloat(threshold, 'g', -1, 64)))
+}
+
+// shouldAutoCompress returns whether the history with given token count should be compressed before the next LLM call.
+func shouldAutoCompress(db *database.Database, tokenCount int, maxTokens int) bool {
+	if tokenCount <= 0 || maxTokens <= 0 {
+		return false
+	}
+	threshold := GetAutoCompressionThreshold(db)
+	return threshold > 0 && float64(tokenCount) > threshold*float64(maxTokens)
+}
+
+// autoCompress compresses the branch of the message chain in the middle of a call and notifies clients.
+// Subsequent messages in the chain will follow the compression message.
+// Failures are only logged, as the call can still proceed with the uncompressed history.
+func autoCompress(ctx context.Context, db *database.SessionDatabase, models *llm.Models, ew EventWriter, mc *database.MessageChain) (CompressResult, bool) {
+	result, err := compressBranch(ctx, db, models, mc.LastMessageModel, mc.BranchID, ResolveCompressionStrategy(db))
+	if err != nil || result.CompressionMsgID == 0 {
+		log.Printf("Automatic compression failed for session %s: %v", db.SessionId(), err)
+		return result, false
+	}
+	log.Printf("Automatically compressed session %s from %d to %d tokens with %s strategy", db.SessionId(), result.OriginalTokenCount, result.NewTokenCount, result.Strategy)
+
+	mc.LastMessageID = result.CompressionMsgID
+	ew.Broadcast(EventCompression, fmt.Sprintf("%d\n%d\n%d\n%d\n%s",
+		result.CompressionMsgID, result.OriginalTokenCount, result.NewTokenCount, result.CompressedUpToMessageID, result.ExtractedSummary))
+	return result, true
+}
+
+// CompressSession compresses the history of the primary branch of the session with its compression strategy.
 func CompressSession(ctx context.Context, db *database.SessionDatabase, models *llm.Models, modelName string) (result CompressResult, err error) {
-	// 1. Load session and all messages from the database for the given sessionID.
 	session, err := database.GetSession(db)
 	if err != nil {
 		err = fmt.Errorf("failed to get session %s: %w", db.SessionId(), err)
 		return
 	}
+	return compressBranch(ctx, db, models, modelName, session.PrimaryBranchID, ResolveCompressionStrategy(db))
+}
+
+// compressBranch replaces the older part of the branch history with a compression message appended to the branch,
+// built by the given compression strategy.
+// Compressed messages are kept in the branch and only hidden from the history sent to LLMs.
+func compressBranch(ctx context.Context, db *database.SessionDatabase, models *llm.Models, modelName string, branchID string, strategy string) (result CompressResult, err error) {
+	compress, ok := compressionStrategies[strategy]
+	if !ok {
+		err = fmt.Errorf("unknown compression strategy: %s", strategy)
+		return
+	}
 
-	// Get all messages for the session, including thoughts, to accurately represent history for compression.
-	// We'll filter thoughts later if needed for the context sent to the LLM for summarization.
-	allMessages, err := database.GetSessionHistory(db, session.PrimaryBranchID)
+	// 1. Load the history as seen by LLMs, which starts with the summary of the last compression if any.
+	// Thoughts are already discarded.
+	allMessages, err := database.GetSessionHistoryContext(db, branchID)
 	if err != nil {
 		err = fmt.Errorf("failed to get session history for %s: %w", db.SessionId(), err)
 		return
@@ -64,11 +133,10 @@ func CompressSession(ctx context.Context, db *database.SessionDatabase, models *
 
 	// Convert FrontendMessage to Content for LLM interaction
 	var curatedHistory []Content
+	var curatedMessages []FrontendMessage // Messages corresponding to curatedHistory
 	for _, msg := range allMessages {
 		// Only include user and model messages for compression context, similar to gemini-cli's behavior
 		// where it curates history before compression.
-		// We'll filter thoughts later if needed for the context sent to the LLM for summarization.
-		// For now, assuming simple text content.
 		if msg.Type.Curated() {
 			// Inline validation for TypeModelText messages
 			if msg.Type == TypeModelText {
@@ -80,6 +148,7 @@ func CompressSession(ctx context.Context, db *database.SessionDatabase, models *
 				Role:  msg.Type.Role(),
 				Parts: msg.Parts,
 			})
+			curatedMessages = append(curatedMessages, msg)
 		}
 	}
 
@@ -102,16 +171,8 @@ func CompressSession(ctx context.Context, db *database.SessionDatabase, models *
 	}
 	originalTokenCount := originalTokenResp.TotalTokens
 
-	// 3. Apply COMPRESSION_TOKEN_THRESHOLD.
-	// Forcing compression for now, similar to gemini-cli's `tryCompressChat(..., true)`
-	// In a real scenario, we might check if originalTokenCount exceeds a threshold.
-	// modelMaxTokens := provider.MaxTokens() // Need to get max tokens for the model
-	// if float64(originalTokenCount) < COMPRESSION_TOKEN_THRESHOLD * float64(modelMaxTokens) {
-	// 	sendJSONResponse(w, map[string]string{"status": "success", "message": "History is below compression threshold"})
-	// 	return
-	// }
-
-	// 4. Implement findIndexAfterFraction and split history.
+	// 3. Implement findIndexAfterFraction and split history.
+	// Whether the history is large enough to be compressed is up to the caller (see shouldAutoCompress).
 	compressBeforeIndex := findIndexAfterFraction(curatedHistory, 1-COMPRESSION_PRESERVE_THRESHOLD)
 
 	// Adjust compressBeforeIndex to ensure historyToKeep starts with a user message or non-model/non-function-response turn.
@@ -125,63 +186,89 @@ func CompressSession(ctx context.Context, db *database.SessionDatabase, models *
 		compressBeforeIndex++ // Advance to the next message
 	}
 
-	historyToCompress := curatedHistory[:compressBeforeIndex]
-
-	var compressedUpToMessageID *int
-	if len(historyToCompress) > 0 {
-		var parsedID int
-		parsedID, err = strconv.Atoi(allMessages[compressBeforeIndex-1].ID) // Get the last FrontendMessage that was compressed
-		if err != nil {
-			err = fmt.Errorf("failed to parse last message ID in historyToMessage: %w", err)
-			return
+	// Tool loops have no such turn after the initial user message. Keep the last function call and
+	// its response at least, so that the model can continue from the compressed history.
+	if compressBeforeIndex == len(curatedHistory) {
+		for i := len(curatedHistory) - 1; i > 0; i-- {
+			if parts := curatedHistory[i].Parts; len(parts) > 0 && parts[0].FunctionCall != nil {
+				compressBeforeIndex = i
+				break
+			}
 		}
-		compressedUpToMessageID = &parsedID
 	}
 
-	var compressionMsgParentID *int
-	if len(allMessages) > 0 {
-		var parsedID int
-		parsedID, err = strconv.Atoi(allMessages[len(allMessages)-1].ID) // Get the ID of the last message in allMessages
-		if err != nil {
-			err = fmt.Errorf("failed to parse parent message ID for compression message: %w", err)
-			return
+	historyToCompress := curatedHistory[:compressBeforeIndex]
+	historyToKeep := curatedHistory[compressBeforeIndex:]
+
+	// The last compressed message, excluding the summary of the previous compression which always comes first
+	compressedUpToMessageID := -1
+	for i := compressBeforeIndex - 1; i >= 0; i-- {
+		if curatedMessages[i].Type != TypeCompression {
+			compressedUpToMessageID, err = strconv.Atoi(curatedMessages[i].ID)
+			if err != nil {
+				err = fmt.Errorf("failed to parse last message ID in historyToCompress: %w", err)
+				return
+			}
+			break
 		}
-		compressionMsgParentID = &parsedID
-	}
-
-	// 5. Construct LLM request with historyToCompress and getCompressionPrompt().
-	systemPrompt := prompts.ExecuteTemplate("compression-prompt.md", nil)
-	triggerPrompt := prompts.ExecuteTemplate("compression-trigger.md", nil)
-	llmRequestContents := historyToCompress // Start with the history to compress
-	llmRequestContents = append(llmRequestContents, Content{
-		Role: RoleUser,
-		Parts: []Part{
-			{Text: triggerPrompt},
-		},
-	})
-
-	// 6. Call LLM to get summary (XML format) using GenerateContentOneShot.
-	oneShotResult, err := modelProvider.GenerateContentOneShot(ctx, llm.SessionParams{
-		Contents:        llmRequestContents,
-		SystemPrompt:    systemPrompt,
-		IncludeThoughts: false,
-	})
+	}
+	if compressedUpToMessageID < 0 {
+		err = fmt.Errorf("compression failed: no messages to compress")
+		return
+	}
+
+	// The compression message follows the last message in the branch
+	compressionMsgParentID, err := strconv.Atoi(allMessages[len(allMessages)-1].ID)
 	if err != nil {
-		err = fmt.Errorf("GenerateContentOneShot API call failed for compression: %w", err)
+		err = fmt.Errorf("failed to parse parent message ID for compression message: %w", err)
 		return
 	}
-	if oneShotResult.Text == "" {
-		err = fmt.Errorf("LLM returned empty summary")
+
+	// 4. Build the compression message with the strategy.
+	// The previous compression message, if any, is handed separately so that strategies can build upon it.
+	in := compressionInput{db: db, provider: modelProvider, messages: curatedMessages[:compressBeforeIndex], contents: historyToCompress}
+	var previousAttachments []FileAttachment
+	if in.messages[0].Type == TypeCompression {
+		if len(in.messages[0].Parts) > 0 {
+			in.previous = in.messages[0].Parts[0].Text
+		}
+		previousAttachments = in.messages[0].Attachments
+		in.messages = in.messages[1:]
+		in.contents = in.contents[1:]
+	}
+	output, err := compress(ctx, in)
+	if err != nil {
 		return
 	}
+	// Blobs referred by the previous compression message remain recallable
+	for _, att := range previousAttachments {
+		output.attachments = appendOmittedAttachment(output.attachments, att)
+	}
+	extractedSummary := output.text
 
-	// Define extractedSummary by extracting content from <state_snapshot>
-	extractedSummary := extractStateSnapshotContent(oneShotResult.Text)
+	// 5. Count tokens of the compressed history, which is the compression message followed by the kept history.
+	compressionParts := []Part{{Text: extractedSummary}}
+	for _, att := range output.attachments {
+		compressionParts = append(compressionParts, unprocessedBinaryPart(att.Hash))
+	}
+	compressedHistory := append([]Content{{
+		Role:  RoleUser, // Compression message role is "user"
+		Parts: compressionParts,
+	}}, historyToKeep...)
+	newTokenResp, err := modelProvider.CountTokens(ctx, compressedHistory)
+	if err != nil {
+		err = fmt.Errorf("CountTokens API call failed for combined history: %w", err)
+		return
+	}
+	newTotalTokenCount := newTokenResp.TotalTokens
 
-	// 7. Parse the XML summary (optional, but good for validation/extraction if needed).
-	// For now, we'll store the raw XML in the message text.
+	// 6. Validate: If newTokenCount > originalTokenCount, indicate failure.
+	if newTotalTokenCount > originalTokenCount {
+		err = fmt.Errorf("compression failed: inflated token count from %d to %d", originalTokenCount, newTotalTokenCount)
+		return
+	}
 
-	// 8. Database Update:
+	// 7. Database Update:
 	//    a. Create a new MessageTypeCompression type message.
 	//    b. Store summary XML in the Text field of the new message.
 	//    c. Update parent_message_id and chosen_next_id to link messages correctly.
@@ -194,21 +281,16 @@ func CompressSession(ctx context.Context, db *database.SessionDatabase, models *
 	}
 	defer tx.Rollback() // Rollback on error
 
-	// Find the last message in the current branch to link the new compression message
-	if err != nil {
-		err = fmt.Errorf("failed to get last message in branch: %w", err)
-		return
-	}
-
 	// Create the new compression message
 	compressionMsg := Message{
 		LocalSessionID:  db.LocalSessionId(),
-		BranchID:        session.PrimaryBranchID,
+		BranchID:        branchID,
 		Type:            TypeCompression,
-		Text:            fmt.Sprintf("%d\n%s", *compressedUpToMessageID, extractedSummary),
-		ParentMessageID: compressionMsgParentID,
+		Text:            fmt.Sprintf("%d\n%s", compressedUpToMessageID, extractedSummary),
+		Attachments:     output.attachments,
+		ParentMessageID: &compressionMsgParentID,
 		Model:           modelName,
-		// CumulTokenCount will be updated after adding the message
+		CumulTokenCount: &newTotalTokenCount,
 	}
 
 	newCompressionMsgID, err := database.AddMessageToSession(ctx, tx, compressionMsg)
@@ -218,165 +300,9 @@ func CompressSession(ctx context.Context, db *database.SessionDatabase, models *
 	}
 
 	// Update the chosen_next_id of the message *before* the compressed block
-	if compressionMsgParentID != nil {
-		err = database.UpdateMessageChosenNextID(tx, *compressionMsgParentID, &newCompressionMsgID)
-		if err != nil {
-			err = fmt.Errorf("failed to update chosen_next_id for message %d: %w", *compressionMsgParentID, err)
-			return
-		}
-	}
-
-	// Combine compression message content and subsequent messages for a single token count
-	var combinedContentForTokenCount []Content
-
-	// Add compression message content
-	combinedContentForTokenCount = append(combinedContentForTokenCount, Content{
-		Role:  RoleUser, // Compression message role is "user"
-		Parts: []Part{{Text: extractedSummary}},
-	})
-
-	// Find the index of the newCompressionMsgID in allMessages
-	startIndex := -1
-	for i, msg := range allMessages {
-		if strconv.Itoa(newCompressionMsgID) == msg.ID {
-			startIndex = i + 1 // Start from the message after the compression message
-			break
-		}
-		// If the message is the compression message itself, and it's the first message in allMessages,
-		// then startIndex should be 0, and we should include all messages from allMessages.
-		if i == 0 && msg.Type == TypeCompression && strconv.Itoa(newCompressionMsgID) == msg.ID {
-			startIndex = 0
-			break
-		}
-	}
-
-	if startIndex != -1 {
-		for i := startIndex; i < len(allMessages); i++ {
-			msg := allMessages[i]
-
-			var contentParts []Part
-
-			switch msg.Type {
-			case TypeFunctionCall:
-				var fc FunctionCall
-				// Assuming FunctionCall is stored as JSON in msg.Parts[0].Text
-				if len(msg.Parts) > 0 && msg.Parts[0].Text != "" {
-					if err := json.Unmarshal([]byte(msg.Parts[0].Text), &fc); err != nil {
-						log.Printf("Failed to unmarshal FunctionCall for message %s: %v", msg.ID, err)
-						continue // Skip if malformed
-					}
-					if fc.Name == llm.GeminiCodeExecutionToolName {
-						var ec ExecutableCode
-						if err := json.Unmarshal([]byte(fmt.Sprintf("%v", fc.Args)), &ec); err != nil {
-							log.Printf("Failed to unmarshal ExecutableCode from FunctionCall args for message %s: %v", msg.ID, err)
-							contentParts = append(contentParts, Part{FunctionCall: &fc}) // Fallback
-						} else {
-							contentParts = append(contentParts, Part{ExecutableCode: &ec})
-						}
-					} else {
-						contentParts = append(contentParts, Part{FunctionCall: &fc})
-					}
-				} else {
-					log.Printf("Warning: Malformed function_call message %s: no text part", msg.ID)
-					continue
-				}
-			case TypeFunctionResponse:
-				var fr FunctionResponse
-				// Assuming FunctionResponse is stored as JSON in msg.Parts[0].Text
-				if len(msg.Parts) > 0 && msg.Parts[0].Text != "" {
-					if err := json.Unmarshal([]byte(msg.Parts[0].Text), &fr); err != nil {
-						log.Printf("Failed to unmarshal FunctionResponse for message %s: %v", msg.ID, err)
-						continue // Skip if malformed
-					}
-					if fr.Name == llm.GeminiCodeExecutionToolName {
-						var cer CodeExecutionResult
-						responseBytes, err := json.Marshal(fr.Response)
-						if err != nil {
-							log.Printf("Failed to marshal FunctionResponse.Response to JSON for message %s: %v", msg.ID, err)
-							contentParts = append(contentParts, Part{FunctionResponse: &fr}) // Fallback
-						} else if err := json.Unmarshal(responseBytes, &cer); err != nil {
-							log.Printf("Failed to unmarshal CodeExecutionResult from FunctionResponse.Response for message %s: %v", msg.ID, err)
-							contentParts = append(contentParts, Part{FunctionResponse: &fr}) // Fallback
-						} else {
-							contentParts = append(contentParts, Part{CodeExecutionResult: &cer})
-						}
-					} else {
-						contentParts = append(contentParts, Part{FunctionResponse: &fr})
-					}
-				} else {
-					log.Printf("Warning: Malformed function_response message %s: no text part", msg.ID)
-					continue
-				}
-			case TypeCompression:
-				// For compression messages, the text is in the format "<CompressedUpToMessageId>\n<XMLSummary>"
-				if len(msg.Parts) > 0 && msg.Parts[0].Text != "" {
-					_, textAfter, found := strings.Cut(msg.Parts[0].Text, "\n")
-					if found {
-						contentParts = []Part{{Text: textAfter}} // XMLSummary is the second part
-					} else {
-						log.Printf("Warning: Malformed compression message text for message %s: %s", msg.ID, msg.Parts[0].Text)
-						continue // Skip if malformed
-					}
-				} else {
-					log.Printf("Warning: Malformed compression message %s: no text part", msg.ID)
-					continue
-				}
-			case TypeThought, TypeModelError:
-				continue // Ignore these types
-			default: // Handles "user", "model" and other types
-				// Handle text parts from msg.Parts
-				if len(msg.Parts) > 0 {
-					for _, part := range msg.Parts {
-						if part.Text != "" {
-							contentParts = append(contentParts, Part{Text: part.Text})
-						}
-					}
-				}
-				// Handle attachments from msg.Attachments
-				for _, attachment := range msg.Attachments {
-					if attachment.Hash != "" {
-						blobData, err := database.GetBlob(db, attachment.Hash) // Use the db connection
-						if err != nil {
-							log.Printf("Warning: Failed to retrieve blob for hash %s: %v", attachment.Hash, err)
-							continue // Skip if blob cannot be retrieved
-						}
-						encodedData := base64.StdEncoding.EncodeToString(blobData)
-						contentParts = append(contentParts, Part{InlineData: &InlineData{MimeType: attachment.MimeType, Data: encodedData}})
-					}
-				}
-			}
-
-			if len(contentParts) > 0 {
-				combinedContentForTokenCount = append(combinedContentForTokenCount, Content{
-					Role:  msg.Type.Role(),
-					Parts: contentParts,
-				})
-			}
-		}
-	}
-
-	// Perform a single CountTokens call for the combined content
-	newTokenResp, err := modelProvider.CountTokens(ctx, combinedContentForTokenCount)
-	if err != nil {
-		err = fmt.Errorf("CountTokens API call failed for combined history: %w", err)
-		return
-	}
-	newTotalTokenCount := newTokenResp.TotalTokens
-
-	// Update the cumul_token_count for the new compression message
-	err = database.UpdateMessageTokens(tx, newCompressionMsgID, newTotalTokenCount)
+	err = database.UpdateMessageChosenNextID(tx, compressionMsgParentID, &newCompressionMsgID)
 	if err != nil {
-		err = fmt.Errorf("failed to update token count for compression message: %w", err)
-		return
-	}
-
-	result.NewTokenCount = newTotalTokenCount
-
-	// 7. Validate: If newTokenCount > originalTokenCount, revert and indicate failure.
-	if newTotalTokenCount > originalTokenCount {
-		// Rollback the transaction as compression was counterproductive
-		tx.Rollback() // Defer will handle the rollback if an error occurs before this.
-		err = fmt.Errorf("compression failed: inflated token count from %d to %d", originalTokenCount, newTotalTokenCount)
+		err = fmt.Errorf("failed to update chosen_next_id for message %d: %w", compressionMsgParentID, err)
 		return
 	}
 
@@ -389,8 +315,10 @@ func CompressSession(ctx context.Context, db *database.SessionDatabase, models *
 	result.OriginalTokenCount = originalTokenCount
 	result.NewTokenCount = newTotalTokenCount
 	result.CompressionMsgID = newCompressionMsgID
-	result.CompressedUpToMessageID = *compressedUpToMessageID
+	result.CompressedUpToMessageID = compressedUpToMessageID
 	result.ExtractedSummary = extractedSummary
+	result.Strategy = strategy
+	result.TokensSaved = originalTokenCount - newTotalTokenCount
 	return
 }
 
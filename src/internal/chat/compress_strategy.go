@@ -0,0 +1,323 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/prompts"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// Names of compression strategies, selectable per session, workspace or globally.
+const (
+	// CompressionStrategySummary summarizes the compressed messages, including the previous summary, into a state snapshot.
+	CompressionStrategySummary = "summary"
+	// CompressionStrategyDropResults keeps a transcript of the compressed messages but drops function responses.
+	CompressionStrategyDropResults = "drop_results"
+	// CompressionStrategyBlobResults keeps a transcript of the compressed messages,
+	// replacing large function responses with blobs that can be retrieved with `recall`.
+	CompressionStrategyBlobResults = "blob_results"
+	// CompressionStrategyRolling summarizes only the messages since the previous compression,
+	// appending the summary to previous ones and merging older summaries into higher-level summaries.
+	CompressionStrategyRolling = "rolling"
+)
+
+// CompressionStrategyConfigName is the config key for the compression strategy,
+// used in session, workspace and app configs in the order of precedence.
+const CompressionStrategyConfigName = "compression_strategy"
+
+// compressionInput is the part of the history to be replaced by a compression message.
+type compressionInput struct {
+	db       *database.SessionDatabase
+	provider llm.ModelProvider
+	previous string            // Text of the previous compression message, if the compressed part starts with it
+	messages []FrontendMessage // Compressed messages, excluding the previous compression message
+	contents []Content         // Contents corresponding to messages
+}
+
+// compressionOutput is the content of a compression message.
+type compressionOutput struct {
+	text        string
+	attachments []FileAttachment // Omitted attachments which the model can recall by hash
+}
+
+// compressionStrategy builds a compression message out of the compressed part of the history.
+type compressionStrategy func(ctx context.Context, in compressionInput) (compressionOutput, error)
+
+var compressionStrategies = map[string]compressionStrategy{
+	CompressionStrategySummary:     compressBySummary,
+	CompressionStrategyDropResults: compressByDroppingResults,
+	CompressionStrategyBlobResults: compressByOffloadingResults,
+	CompressionStrategyRolling:     compressByRollingSummaries,
+}
+
+// CompressionStrategies returns the names of all available compression strategies.
+func CompressionStrategies() []string {
+	names := make([]string, 0, len(compressionStrategies))
+	for name := range compressionStrategies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ValidateCompressionStrategy checks if the strategy name is known.
+// An empty name is also accepted, meaning that the strategy is inherited.
+func ValidateCompressionStrategy(name string) error {
+	if _, ok := compressionStrategies[name]; !ok && name != "" {
+		return MakeBadRequestError("unknown compression strategy %q (should be one of %s)", name, strings.Join(CompressionStrategies(), ", "))
+	}
+	return nil
+}
+
+// GetDefaultCompressionStrategy returns the compression strategy used when neither a session nor a workspace chooses one.
+func GetDefaultCompressionStrategy(db *database.Database) string {
+	value, err := database.GetAppConfig(db, CompressionStrategyConfigName)
+	if err != nil {
+		log.Printf("Failed to load default compression strategy: %v", err)
+	}
+	if _, ok := compressionStrategies[string(value)]; !ok {
+		return CompressionStrategySummary
+	}
+	return string(value)
+}
+
+// ResolveCompressionStrategy returns the compression strategy of the session,
+// falling back to those of its workspace and the global default.
+func ResolveCompressionStrategy(db *database.SessionDatabase) string {
+	value, err := database.GetSessionConfig(db, CompressionStrategyConfigName)
+	if err != nil {
+		log.Printf("Failed to load compression strategy of session %s: %v", db.SessionId(), err)
+	}
+	if _, ok := compressionStrategies[string(value)]; ok {
+		return string(value)
+	}
+
+	session, err := database.GetSession(db)
+	if err != nil {
+		log.Printf("Failed to get session %s: %v", db.SessionId(), err)
+	} else if session.WorkspaceID != "" {
+		value, err = database.GetWorkspaceConfig(db.Database, session.WorkspaceID, CompressionStrategyConfigName)
+		if err != nil {
+			log.Printf("Failed to load compression strategy of workspace %s: %v", session.WorkspaceID, err)
+		}
+		if _, ok := compressionStrategies[string(value)]; ok {
+			return string(value)
+		}
+	}
+
+	return GetDefaultCompressionStrategy(db.Database)
+}
+
+// summarize asks the model to summarize contents into a state snapshot.
+func summarize(ctx context.Context, in compressionInput, contents []Content) (string, error) {
+	systemPrompt := prompts.ExecuteTemplate("compression-prompt.md", nil)
+	triggerPrompt := prompts.ExecuteTemplate("compression-trigger.md", nil)
+	llmRequestContents := slices.Clone(contents)
+	llmRequestContents = append(llmRequestContents, Content{
+		Role: RoleUser,
+		Parts: []Part{
+			{Text: triggerPrompt},
+		},
+	})
+
+	oneShotResult, err := in.provider.GenerateContentOneShot(ctx, llm.SessionParams{
+		Contents:        llmRequestContents,
+		SystemPrompt:    systemPrompt,
+		IncludeThoughts: false,
+	})
+	if err != nil {
+		return "", fmt.Errorf("GenerateContentOneShot API call failed for compression: %w", err)
+	}
+	llm.RecordTokenUsage(in.db.Database, in.db.SessionId(), in.provider.Name(), TokenUsageCompression, oneShotResult.UsageMetadata)
+	if oneShotResult.Text == "" {
+		return "", fmt.Errorf("LLM returned empty summary")
+	}
+
+	return extractStateSnapshotContent(oneShotResult.Text), nil
+}
+
+// compressBySummary implements CompressionStrategySummary.
+func compressBySummary(ctx context.Context, in compressionInput) (compressionOutput, error) {
+	contents := in.contents
+	if in.previous != "" {
+		contents = append([]Content{{Role: RoleUser, Parts: []Part{{Text: in.previous}}}}, contents...)
+	}
+	summary, err := summarize(ctx, in, contents)
+	return compressionOutput{text: summary}, err
+}
+
+// compressByDroppingResults implements CompressionStrategyDropResults.
+func compressByDroppingResults(ctx context.Context, in compressionInput) (compressionOutput, error) {
+	return renderTranscript(in, func(fr *FunctionResponse, out *compressionOutput) (string, bool) {
+		return fmt.Sprintf("Result of `%s` omitted.", fr.Name), false
+	}), nil
+}
+
+// blobResultMinSize is the size of the JSON-encoded function response above which
+// CompressionStrategyBlobResults moves the response to a blob.
+const blobResultMinSize = 1024
+
+// compressByOffloadingResults implements CompressionStrategyBlobResults.
+func compressByOffloadingResults(ctx context.Context, in compressionInput) (compressionOutput, error) {
+	return renderTranscript(in, func(fr *FunctionResponse, out *compressionOutput) (string, bool) {
+		payload, err := json.Marshal(fr.Response)
+		if err != nil {
+			return fmt.Sprintf("Result of `%s` omitted.", fr.Name), false
+		}
+		if len(payload) <= blobResultMinSize {
+			return fmt.Sprintf("Result of `%s`: %s", fr.Name, payload), true
+		}
+		hash := database.BlobHash(payload)
+		out.attachments = appendOmittedAttachment(out.attachments, FileAttachment{
+			FileName: fr.Name + "-result.json",
+			MimeType: "application/json",
+			Hash:     hash,
+			Data:     payload, // Saved as a blob when the compression message is added
+			Omitted:  true,
+		})
+		return fmt.Sprintf("Result of `%s` (%d bytes) moved to blob %s.", fr.Name, len(payload), hash), true
+	}), nil
+}
+
+// renderTranscript renders the compressed messages into a plain text transcript following the previous compression.
+// Function responses are rendered by renderResult, which may add attachments to the output and
+// returns whether the result is kept. Attachments of other messages and kept results become omitted attachments.
+func renderTranscript(in compressionInput, renderResult func(fr *FunctionResponse, out *compressionOutput) (string, bool)) compressionOutput {
+	var out compressionOutput
+	var sb strings.Builder
+	if in.previous != "" {
+		sb.WriteString(in.previous)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("<compressed_history>\n")
+	for _, msg := range in.messages {
+		var line string
+		keepAttachments := true
+		switch {
+		case msg.Type == TypeFunctionCall && len(msg.Parts) > 0 && msg.Parts[0].FunctionCall != nil:
+			fc := msg.Parts[0].FunctionCall
+			args, _ := json.Marshal(fc.Args)
+			line = fmt.Sprintf("[model] Called `%s` with %s", fc.Name, args)
+		case msg.Type == TypeFunctionResponse && len(msg.Parts) > 0 && msg.Parts[0].FunctionResponse != nil:
+			var result string
+			result, keepAttachments = renderResult(msg.Parts[0].FunctionResponse, &out)
+			line = "[tool] " + result
+		case len(msg.Parts) > 0 && msg.Parts[0].Text != "":
+			line = fmt.Sprintf("[%s] %s", msg.Type.Role(), msg.Parts[0].Text)
+		case len(msg.Attachments) > 0:
+			line = fmt.Sprintf("[%s]", msg.Type.Role())
+		default:
+			continue
+		}
+		if keepAttachments {
+			for _, att := range msg.Attachments {
+				if att.Hash == "" {
+					continue
+				}
+				line += fmt.Sprintf(" [Attachment %s with hash %s]", att.FileName, att.Hash)
+				out.attachments = appendOmittedAttachment(out.attachments, att)
+			}
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("</compressed_history>")
+	out.text = sb.String()
+	return out
+}
+
+// appendOmittedAttachment appends an omitted copy of the attachment unless the same hash is already present.
+func appendOmittedAttachment(attachments []FileAttachment, att FileAttachment) []FileAttachment {
+	for _, existing := range attachments {
+		if existing.Hash == att.Hash {
+			return attachments
+		}
+	}
+	att.Omitted = true
+	return append(attachments, att)
+}
+
+// rollingSummaryFanout is the number of summaries at the same level merged into a summary at the next level.
+const rollingSummaryFanout = 4
+
+var rollingSummaryPattern = regexp.MustCompile(`(?s)<summary level="(\d+)">\n(.*?)\n</summary>`)
+
+type rollingSummary struct {
+	level int
+	text  string
+}
+
+// parseRollingSummaries parses the text of a compression message made by CompressionStrategyRolling.
+// The text from other strategies is regarded as a single summary.
+func parseRollingSummaries(text string) []rollingSummary {
+	var summaries []rollingSummary
+	for _, m := range rollingSummaryPattern.FindAllStringSubmatch(text, -1) {
+		level, err := strconv.Atoi(m[1])
+		if err != nil || level < 1 {
+			level = 1
+		}
+		summaries = append(summaries, rollingSummary{level: level, text: m[2]})
+	}
+	if len(summaries) == 0 && strings.TrimSpace(text) != "" {
+		summaries = append(summaries, rollingSummary{level: 1, text: text})
+	}
+	return summaries
+}
+
+// formatRollingSummaries formats summaries from the oldest to the newest.
+func formatRollingSummaries(summaries []rollingSummary) string {
+	var sb strings.Builder
+	for i, s := range summaries {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "<summary level=\"%d\">\n%s\n</summary>", s.level, s.text)
+	}
+	return sb.String()
+}
+
+// compressByRollingSummaries implements CompressionStrategyRolling.
+// Previous summaries are kept as is, so that older parts of the history are not repeatedly summarized.
+// Once rollingSummaryFanout summaries at the same level accumulate, they are merged into a summary at the next level.
+func compressByRollingSummaries(ctx context.Context, in compressionInput) (compressionOutput, error) {
+	summary, err := summarize(ctx, in, in.contents)
+	if err != nil {
+		return compressionOutput{}, err
+	}
+	summaries := append(parseRollingSummaries(in.previous), rollingSummary{level: 1, text: summary})
+
+	for {
+		n := len(summaries)
+		level := summaries[n-1].level
+		count := 0
+		for count < n && summaries[n-1-count].level == level {
+			count++
+		}
+		if count < rollingSummaryFanout {
+			break
+		}
+
+		merged := summaries[n-rollingSummaryFanout:]
+		var parts []Part
+		for _, s := range merged {
+			parts = append(parts, Part{Text: s.text})
+		}
+		summary, err := summarize(ctx, in, []Content{{Role: RoleUser, Parts: parts}})
+		if err != nil {
+			return compressionOutput{}, err
+		}
+		summaries = append(summaries[:n-rollingSummaryFanout], rollingSummary{level: level + 1, text: summary})
+	}
+
+	return compressionOutput{text: formatRollingSummaries(summaries)}, nil
+}
@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron-like schedule, see ParseSchedule.
+type Schedule struct {
+	minutes, hours, days, months, weekdays uint64 // Bit sets of matching values
+	anyDay, anyWeekday                     bool   // Whether the field was `*`, which affects how days are matched
+}
+
+// scheduleMacros are shorthands for common schedules.
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a standard five-field cron expression (minute, hour, day of month, month and day of week)
+// or one of macros like @daily. Each field accepts `*`, numbers, ranges (`a-b`), steps (`*/n`, `a-b/n`) and
+// comma-separated lists of them. Day of week is 0 to 7 where both 0 and 7 are Sunday.
+// As in Vixie cron, a day matches if either day of month or day of week matches when both are restricted.
+func ParseSchedule(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := scheduleMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("expected 5 fields in schedule %q, got %d", expr, len(fields))
+	}
+
+	var s Schedule
+	var err error
+	if s.minutes, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return Schedule{}, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if s.hours, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return Schedule{}, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if s.days, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return Schedule{}, fmt.Errorf("invalid day of month field: %w", err)
+	}
+	if s.months, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return Schedule{}, fmt.Errorf("invalid month field: %w", err)
+	}
+	if s.weekdays, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return Schedule{}, fmt.Errorf("invalid day of week field: %w", err)
+	}
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1 // Sunday
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeekday = fields[4] == "*"
+	return s, nil
+}
+
+// parseScheduleField parses a comma-separated list of ranges into a bit set.
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(loPart); err != nil {
+				return 0, fmt.Errorf("invalid value %q", loPart)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiPart); err != nil {
+					return 0, fmt.Errorf("invalid value %q", hiPart)
+				}
+			} else if hasStep {
+				hi = max // `a/n` means from a to the maximum
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("range %q out of bounds %d-%d", rangePart, min, max)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matchesDay reports whether the date of t matches the day fields.
+func (s Schedule) matchesDay(t time.Time) bool {
+	dayMatches := s.days&(1<<uint(t.Day())) != 0
+	weekdayMatches := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return dayMatches && weekdayMatches
+	}
+	return dayMatches || weekdayMatches
+}
+
+// Next returns the first time strictly after t which matches the schedule, in the location of t.
+// It returns the zero time if there is no such time within five years (e.g. `0 0 30 2 *`).
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -15,8 +15,24 @@ import (
 	. "github.com/lifthrasiir/angel/internal/types"
 )
 
+// unprocessedBinaryPart returns a part telling the model to recall an omitted binary.
+func unprocessedBinaryPart(hash string) Part {
+	return Part{Text: fmt.Sprintf("[Binary with hash %s is currently **UNPROCESSED**. You **MUST** use recall(query='%[1]s') to gain access to its content for internal analysis. **Until recalled, you have NO information about this binary's content, and any attempt to describe or act upon it will be pure guesswork.**]", hash)}
+}
+
+// steeringPart returns a part delivering a steering note posted by the user during a tool loop.
+func steeringPart(note string) Part {
+	return Part{Text: fmt.Sprintf("[The user has sent the following note while you are working. Take it into account from now on, without abandoning the current task unless asked to.]\n%s", note)}
+}
+
 func AppendAttachmentParts(db *database.SessionDatabase, toolResults tool.HandlerResults, partsForContent []Part) []Part {
 	for _, attachment := range toolResults.Attachments {
+		// Omitted attachments (e.g. offloaded tool results) are only referred by hash
+		if attachment.Omitted {
+			partsForContent = append(partsForContent, unprocessedBinaryPart(attachment.Hash))
+			continue
+		}
+
 		// Retrieve blob data from DB using hash
 		blobData, err := database.GetBlob(db, attachment.Hash)
 		if err != nil {
@@ -48,6 +64,20 @@ func ConvertFrontendMessagesToContent(db *database.SessionDatabase, frontendMess
 			continue // Command messages are only visible to users
 		}
 
+		// Steering notes are delivered as a part of the preceding function response
+		if fm.Type == TypeSteering {
+			if len(fm.Parts) == 0 || fm.Parts[0].Text == "" {
+				continue
+			}
+			part := steeringPart(fm.Parts[0].Text)
+			if n := len(contents); n > 0 && contents[n-1].Role == RoleUser {
+				contents[n-1].Parts = append(contents[n-1].Parts, part)
+			} else {
+				contents = append(contents, Content{Role: RoleUser, Parts: []Part{part}})
+			}
+			continue
+		}
+
 		// Add text part if present
 		if len(fm.Parts) > 0 && fm.Parts[0].Text != "" {
 			parts = append(parts, Part{
@@ -62,9 +92,7 @@ func ConvertFrontendMessagesToContent(db *database.SessionDatabase, frontendMess
 			if att.Hash != "" { // Only process if hash exists
 				if att.Omitted {
 					// Attachment was omitted due to clearblobs command
-					parts = append(parts,
-						Part{Text: fmt.Sprintf("[Binary with hash %s is currently **UNPROCESSED**. You **MUST** use recall(query='%[1]s') to gain access to its content for internal analysis. **Until recalled, you have NO information about this binary's content, and any attempt to describe or act upon it will be pure guesswork.**]", att.Hash)},
-					)
+					parts = append(parts, unprocessedBinaryPart(att.Hash))
 				} else {
 					// Normal blob processing
 					blobData, err := database.GetBlob(db, att.Hash)
@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/env"
+	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// queueIfActive queues a user message if the session has an active call.
+// The check and the insertion are done atomically with respect to finishCall,
+// so that a queued message is never left behind after the call finishes.
+func queueIfActive(db *database.SessionDatabase, text string, attachments []FileAttachment, model string) (bool, error) {
+	callsMutex.Lock()
+	defer callsMutex.Unlock()
+
+	if !hasActiveCallUnsafe(db.SessionId()) {
+		return false, nil
+	}
+	if _, err := database.AddQueuedMessage(db, text, attachments, model); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// QueuedMessagesPayload returns the payload of EventQueueChanged for the current queue of the session.
+func QueuedMessagesPayload(db *database.SessionDatabase) (string, error) {
+	messages, err := database.GetQueuedMessages(db)
+	if err != nil {
+		return "", fmt.Errorf("failed to get queued messages: %w", err)
+	}
+	payload, err := json.Marshal(messages)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal queued messages: %w", err)
+	}
+	return string(payload), nil
+}
+
+// finishCall marks an API call as completed like completeCall, unless a message is queued for the session.
+// In that case the queued message is removed from the queue and returned,
+// and the call is kept active until sendQueuedMessage takes over.
+func finishCall(db *database.SessionDatabase) *QueuedMessage {
+	callsMutex.Lock()
+	defer callsMutex.Unlock()
+
+	sessionId := db.SessionId()
+	queueSteeringNotesUnsafe(db)
+	next, err := database.PopQueuedMessage(db)
+	if err != nil {
+		log.Printf("Failed to get queued message for session %s: %v", sessionId, err)
+	}
+	if call, ok := activeCalls[sessionId]; ok && next != nil {
+		call.handingOver = true
+		return next
+	}
+	completeCallUnsafe(sessionId)
+	clearActiveCall(db)
+	return nil
+}
+
+// abortCall marks an API call which has stopped in the middle as completed.
+// Queued messages are kept until the next call finishes.
+// Unlike an interrupted call, an aborted call can't be resumed.
+func abortCall(db *database.SessionDatabase) {
+	callsMutex.Lock()
+	defer callsMutex.Unlock()
+
+	queueSteeringNotesUnsafe(db)
+	completeCallUnsafe(db.SessionId())
+	clearActiveCall(db)
+}
+
+// queueSteeringNotesUnsafe queues steering notes which had no function response to go along with,
+// so that they are sent as ordinary messages instead (must be called with callsMutex held)
+func queueSteeringNotesUnsafe(db *database.SessionDatabase) {
+	call, ok := activeCalls[db.SessionId()]
+	if !ok {
+		return
+	}
+	for _, note := range call.steeringNotes {
+		if _, err := database.AddQueuedMessage(db, note, nil, ""); err != nil {
+			log.Printf("Failed to queue steering note for session %s: %v", db.SessionId(), err)
+		}
+	}
+	call.steeringNotes = nil
+}
+
+// sendQueuedMessage sends a message popped by finishCall as a new turn of the session.
+func sendQueuedMessage(
+	db *database.SessionDatabase, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	ew EventWriter, queued *QueuedMessage,
+) error {
+	if payload, err := QueuedMessagesPayload(db); err != nil {
+		log.Printf("Failed to broadcast queued messages for session %s: %v", db.SessionId(), err)
+	} else {
+		ew.Broadcast(EventQueueChanged, payload)
+	}
+
+	err := sendChatMessage(context.Background(), db, models, ga, tools, config, ew, queued.Text, queued.Attachments, queued.Model, 1, queued.ID)
+	if err != nil {
+		// If the call has not been taken over yet, nobody else will finish it or tell clients about the error
+		callsMutex.Lock()
+		call, ok := activeCalls[db.SessionId()]
+		handingOver := ok && call.handingOver
+		if handingOver {
+			completeCallUnsafe(db.SessionId())
+			clearActiveCall(db)
+		}
+		callsMutex.Unlock()
+		if handingOver {
+			broadcastAndFinish(ew, EventError, fmt.Sprintf("Failed to send queued message: %v", err))
+		}
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/env"
+	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// InterruptedTurn describes an agent turn which was still running when the server stopped.
+type InterruptedTurn struct {
+	BranchID string `json:"branchId"`
+
+	// PendingFunction is the name of the function call without a response, which is re-run on resume.
+	// If empty, the LLM loop is simply continued.
+	PendingFunction string `json:"pendingFunction,omitempty"`
+}
+
+// recordActiveCall persists the call state so that an interrupted call can be resumed after a restart.
+func recordActiveCall(db *database.SessionDatabase, branchID string) {
+	if err := database.RecordActiveCall(db, branchID); err != nil {
+		log.Printf("Failed to record active call for session %s: %v", db.SessionId(), err)
+	}
+}
+
+// clearActiveCall removes the call state persisted by recordActiveCall.
+func clearActiveCall(db *database.SessionDatabase) {
+	if err := database.ClearActiveCall(db); err != nil {
+		log.Printf("Failed to clear active call for session %s: %v", db.SessionId(), err)
+	}
+}
+
+// getInterruptedTurn returns the interrupted turn of the branch, or nil if there is none.
+// A turn is interrupted if its call was recorded as active but is no longer running in this process.
+func getInterruptedTurn(db *database.SessionDatabase, branchID string) (*InterruptedTurn, error) {
+	if HasActiveCall(db.SessionId()) {
+		return nil, nil
+	}
+	recordedBranchID, err := database.GetRecordedCallBranch(db)
+	if err != nil || recordedBranchID != branchID {
+		return nil, err
+	}
+
+	turn := &InterruptedTurn{BranchID: branchID}
+	lastMessageID, _, _, err := database.GetLastMessageInBranch(db, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last message of branch %s: %w", branchID, err)
+	}
+	lastMessage, err := database.GetMessageByID(db, lastMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last message %d: %w", lastMessageID, err)
+	}
+	if lastMessage.Type == TypeFunctionCall {
+		var fc FunctionCall
+		if err := json.Unmarshal([]byte(lastMessage.Text), &fc); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal function call from message %d: %w", lastMessage.ID, err)
+		}
+		// Code execution is done by the provider, so it can't be re-run here
+		if fc.Name != llm.GeminiCodeExecutionToolName {
+			turn.PendingFunction = fc.Name
+		}
+	}
+	return turn, nil
+}
+
+type interruptedCallsJob struct {
+	db        *database.Database
+	startedAt time.Time
+}
+
+// InterruptedCallsJob returns a housekeeping job that finds calls interrupted by the last shutdown on startup.
+// Interrupted turns are kept so that they can be resumed, but their shell commands are marked as failed,
+// as their processes are gone and could never finish.
+func InterruptedCallsJob(db *database.Database) HousekeepingJob {
+	return &interruptedCallsJob{db: db, startedAt: time.Now()}
+}
+
+func (job *interruptedCallsJob) Name() string     { return "Interrupted call detection" }
+func (job *interruptedCallsJob) First() error     { return job.scan() }
+func (job *interruptedCallsJob) Sometimes() error { return nil }
+func (job *interruptedCallsJob) Last() error      { return nil }
+
+// scan looks into every writable session DB for calls and shell commands left by the previous process.
+func (job *interruptedCallsJob) scan() error {
+	sessionIDs, err := database.GetUnarchivedMainSessionIDs(job.db)
+	if err != nil {
+		return err
+	}
+
+	turns, commands := 0, int64(0)
+	for _, sessionID := range sessionIDs {
+		sdb, err := job.db.WithWritableSession(sessionID)
+		if err != nil {
+			log.Printf("Skipping session %s while looking for interrupted calls: %v", sessionID, err)
+			continue
+		}
+
+		calls, err := database.GetRecordedCalls(sdb)
+		if err != nil {
+			log.Printf("Failed to get recorded calls of session %s: %v", sessionID, err)
+		}
+		for _, call := range calls {
+			// The call may have been started by this process after startup
+			if !HasActiveCall(call.SessionID) {
+				log.Printf("Found an interrupted turn in session %s, branch %s", call.SessionID, call.BranchID)
+				turns++
+			}
+		}
+
+		n, err := database.CleanupStaleSessionShellCommands(sdb, job.startedAt)
+		if err != nil {
+			log.Printf("Failed to clean up shell commands of session %s: %v", sessionID, err)
+		}
+		commands += n
+		sdb.Close()
+	}
+
+	if turns > 0 || commands > 0 {
+		log.Printf("Found %d interrupted turn(s) and %d interrupted shell command(s)", turns, commands)
+	}
+	return nil
+}
+
+// ResumeBranch resumes the interrupted turn of a branch.
+// The pending function call is re-run if any, and the LLM loop continues from there.
+func ResumeBranch(
+	ctx context.Context, db *database.SessionDatabase, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	ew EventWriter, branchId string,
+) error {
+	turn, err := getInterruptedTurn(db, branchId)
+	if err != nil {
+		return err
+	}
+	if turn == nil {
+		return notFoundError("no interrupted turn found for branch %s", branchId)
+	}
+
+	session, err := database.GetSession(db)
+	if err != nil {
+		return fmt.Errorf("failed to get session %s: %w", db.SessionId(), err)
+	}
+	if session.PrimaryBranchID != branchId {
+		return badRequestError("branch %s is not the primary branch", branchId)
+	}
+
+	mc, err := database.NewMessageChain(ctx, db, branchId)
+	if err != nil {
+		return fmt.Errorf("failed to create message chain for session %s and branch %s: %w", db.SessionId(), branchId, err)
+	}
+	lastMessage, err := database.GetMessageByID(db, mc.LastMessageID)
+	if err != nil {
+		return fmt.Errorf("failed to get last message details for ID %d: %w", mc.LastMessageID, err)
+	}
+
+	if turn.PendingFunction != "" {
+		var fc FunctionCall
+		if err := json.Unmarshal([]byte(lastMessage.Text), &fc); err != nil {
+			return fmt.Errorf("failed to unmarshal function call from message %d: %w", lastMessage.ID, err)
+		}
+		return executeFunctionCall(ctx, db, models, ga, tools, config, ew, session, mc, branchId, lastMessage, fc, false)
+	}
+
+	// A partially streamed model message is continued in place
+	appendToMessageID := -1
+	if lastMessage.Type == TypeModelText {
+		appendToMessageID = lastMessage.ID
+	}
+
+	fullFrontendHistoryForLLM, err := database.GetSessionHistoryContext(db, branchId)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve full session history for LLM: %w", err)
+	}
+
+	var roots []string
+	roots, mc.LastMessageGeneration, err = database.GetLatestSessionEnv(db)
+	if err != nil {
+		return fmt.Errorf("failed to get latest session environment for session %s: %w", db.SessionId(), err)
+	}
+
+	ew.Acquire()
+	defer ew.Release()
+
+	// Prepare initial state for streaming (only for passing session details, not for sending EventInitialState)
+	initialState := InitialState{
+		SessionId:       db.SessionId(),
+		History:         []FrontendMessage{},
+		SystemPrompt:    session.SystemPrompt,
+		WorkspaceID:     session.WorkspaceID,
+		PrimaryBranchID: branchId,
+		Roots:           roots,
+	}
+
+	// Send WorkspaceID hint to frontend
+	ew.Send(EventWorkspaceHint, session.WorkspaceID)
+
+	if err := streamLLMResponse(db, models, ga, tools, config, initialState, ew, mc, false, time.Now(), fullFrontendHistoryForLLM, appendToMessageID); err != nil {
+		return fmt.Errorf("error streaming LLM response on resume: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/env"
+	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// defaultRunSystemPrompt is used for headless runs when neither the request nor the workspace specifies one.
+const defaultRunSystemPrompt = "{{.Builtin.SystemPrompt}}"
+
+// RunResult is the outcome of a headless run.
+type RunResult struct {
+	SessionID   string           `json:"sessionId"`
+	Text        string           `json:"text"` // Model text after the last tool call
+	ToolCalls   []RunToolCall    `json:"toolCalls"`
+	Attachments []FileAttachment `json:"attachments"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// RunToolCall is a tool call made during a headless run, along with its response.
+type RunToolCall struct {
+	Name     string                 `json:"name"`
+	Args     map[string]interface{} `json:"args"`
+	Response interface{}            `json:"response,omitempty"`
+}
+
+// BroadcastFunc sends an event to all clients watching the session.
+type BroadcastFunc func(sessionId string, eventType EventType, data string)
+
+// runResultCollector implements EventWriter to collect the outcome of a headless run.
+// Events may be broadcast from other goroutines (e.g. session name inference), hence the mutex.
+type runResultCollector struct {
+	mu        sync.Mutex
+	text      strings.Builder
+	result    RunResult
+	sessionId string
+	broadcast BroadcastFunc // Also receives broadcast events if not nil
+}
+
+// Send implements EventWriter.Send
+func (rc *runResultCollector) Send(eventType EventType, payload string) {
+	rc.processEvent(eventType, payload)
+}
+
+// Broadcast implements EventWriter.Broadcast
+func (rc *runResultCollector) Broadcast(eventType EventType, payload string) {
+	rc.processEvent(eventType, payload)
+	if rc.broadcast != nil {
+		rc.broadcast(rc.sessionId, eventType, payload)
+	}
+}
+
+// Acquire implements EventWriter.Acquire (no-op for headless runs)
+func (rc *runResultCollector) Acquire() {}
+
+// Release implements EventWriter.Release (no-op for headless runs)
+func (rc *runResultCollector) Release() {}
+
+// Close implements EventWriter.Close (no-op for headless runs)
+func (rc *runResultCollector) Close() {}
+
+// HeadersSent implements EventWriter.HeadersSent (always false for headless runs)
+func (rc *runResultCollector) HeadersSent() bool {
+	return false
+}
+
+// processEvent collects the final text, tool calls and attachments from events
+func (rc *runResultCollector) processEvent(eventType EventType, payload string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	switch eventType {
+	case EventModelMessage:
+		// [Message ID, text]
+		if _, text, found := strings.Cut(payload, "\n"); found {
+			rc.text.WriteString(text)
+		}
+	case EventFunctionCall:
+		// [Message ID, function name, arguments JSON]
+		parts := strings.SplitN(payload, "\n", 3)
+		if len(parts) < 3 {
+			return
+		}
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(parts[2]), &args); err != nil {
+			log.Printf("Failed to parse function call args: %v", err)
+		}
+		rc.result.ToolCalls = append(rc.result.ToolCalls, RunToolCall{Name: parts[1], Args: args})
+		rc.text.Reset() // Only the text after the last tool call is the final answer
+	case EventFunctionResponse:
+		// [Message ID, function name, FunctionResponsePayload JSON]
+		parts := strings.SplitN(payload, "\n", 3)
+		if len(parts) < 3 {
+			return
+		}
+		var response FunctionResponsePayload
+		if err := json.Unmarshal([]byte(parts[2]), &response); err != nil {
+			log.Printf("Failed to parse function response: %v", err)
+			return
+		}
+		rc.result.Attachments = append(rc.result.Attachments, response.Attachments...)
+		for i := len(rc.result.ToolCalls) - 1; i >= 0; i-- {
+			if call := &rc.result.ToolCalls[i]; call.Name == parts[1] && call.Response == nil {
+				call.Response = response.Response
+				break
+			}
+		}
+	case EventInlineData:
+		var inlineData InlineDataPayload
+		if err := json.Unmarshal([]byte(payload), &inlineData); err == nil {
+			rc.result.Attachments = append(rc.result.Attachments, inlineData.Attachments...)
+		}
+	case EventPendingConfirmation:
+		rc.result.Error = "Tool execution requires user confirmation"
+	case EventError:
+		rc.result.Error = payload
+	}
+}
+
+// finish returns the collected result, given the error returned by the run.
+func (rc *runResultCollector) finish(err error) (RunResult, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	result := rc.result
+	result.SessionID = rc.sessionId
+	result.Text = rc.text.String()
+	if result.ToolCalls == nil {
+		result.ToolCalls = []RunToolCall{}
+	}
+	if result.Attachments == nil {
+		result.Attachments = []FileAttachment{}
+	}
+	if err != nil && result.Error != "" {
+		// The error has been reported as a part of the run, which is still worth returning
+		log.Printf("Headless run of session %s failed: %v", rc.sessionId, err)
+		err = nil
+	}
+	return result, err
+}
+
+// RunSession creates a new session with the given message and waits for the agent to finish.
+// If systemPrompt is empty, the default system prompt of the workspace is used.
+func RunSession(
+	ctx context.Context, db *database.Database, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	message string, systemPrompt string, workspaceId string, modelToUse string, initialRoots []string,
+) (RunResult, error) {
+	return runSession(ctx, db, models, ga, tools, config, nil, message, systemPrompt, workspaceId, modelToUse, initialRoots)
+}
+
+func runSession(
+	ctx context.Context, db *database.Database, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	broadcast BroadcastFunc, message string, systemPrompt string, workspaceId string, modelToUse string, initialRoots []string,
+) (RunResult, error) {
+	if systemPrompt == "" {
+		systemPrompt = defaultRunSystemPrompt
+		if workspaceId != "" {
+			workspace, err := database.GetWorkspace(db, workspaceId)
+			if err != nil {
+				return RunResult{}, notFoundError("workspace %s not found", workspaceId)
+			}
+			if workspace.DefaultSystemPrompt != "" {
+				systemPrompt = workspace.DefaultSystemPrompt
+			}
+		}
+	}
+
+	collector := &runResultCollector{sessionId: database.GenerateID(), broadcast: broadcast}
+	err := NewSessionAndMessage(
+		ctx, db, models, ga, tools, config,
+		collector, message, systemPrompt, nil,
+		collector.sessionId, workspaceId, modelToUse, 0, initialRoots,
+	)
+	return collector.finish(err)
+}
@@ -0,0 +1,43 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/env"
+	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// RunScheduledPrompt runs a scheduled prompt once and waits for the agent to finish.
+// The prompt is sent to its session if any, or to a new session otherwise, and only its tools are made available.
+// Broadcast events are also sent with broadcast, so that clients watching the session can follow the run.
+func RunScheduledPrompt(
+	ctx context.Context, db *database.Database, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	broadcast BroadcastFunc, sp ScheduledPrompt,
+) (RunResult, error) {
+	if len(sp.Tools) > 0 {
+		tools = tools.Restrict(sp.Tools)
+	}
+
+	if sp.SessionID == "" {
+		return runSession(ctx, db, models, ga, tools, config, broadcast, sp.Prompt, sp.SystemPrompt, sp.WorkspaceID, sp.Model, nil)
+	}
+
+	// The prompt would be queued otherwise, and its outcome couldn't be collected
+	if HasActiveCall(sp.SessionID) {
+		return RunResult{SessionID: sp.SessionID}, fmt.Errorf("session %s has an active call", sp.SessionID)
+	}
+
+	sdb, err := db.WithWritableSession(sp.SessionID)
+	if err != nil {
+		return RunResult{SessionID: sp.SessionID}, fmt.Errorf("failed to open session %s: %w", sp.SessionID, err)
+	}
+	defer sdb.Close()
+
+	collector := &runResultCollector{sessionId: sp.SessionID, broadcast: broadcast}
+	err = NewChatMessage(ctx, sdb, models, ga, tools, config, collector, sp.Prompt, nil, sp.Model, 0)
+	return collector.finish(err)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"regexp"
 	"strings"
@@ -16,11 +17,40 @@ import (
 	"github.com/lifthrasiir/angel/internal/database"
 	"github.com/lifthrasiir/angel/internal/env"
 	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/llm/spec"
 	"github.com/lifthrasiir/angel/internal/prompts"
 	"github.com/lifthrasiir/angel/internal/tool"
 	. "github.com/lifthrasiir/angel/internal/types"
 )
 
+// providerAux returns the aux field recording which provider answered the stream, if known
+func providerAux(closer io.Closer) string {
+	reporter, ok := closer.(llm.ProviderReporter)
+	if !ok || reporter.AnsweringProvider() == "" {
+		return ""
+	}
+	aux, _ := json.Marshal(map[string]string{"provider": reporter.AnsweringProvider()})
+	return string(aux)
+}
+
+// recordCallUsage records the token usage of an LLM call, attaching it to the last model message produced by the call
+func recordCallUsage(db *database.SessionDatabase, modelName string, messageID int, usageMetadata *UsageMetadata) {
+	kind := TokenUsageChat
+	if IsSubsessionId(db.SessionId()) {
+		kind = TokenUsageSubagent
+	}
+	usage := llm.MakeTokenUsage(db.SessionId(), modelName, kind, usageMetadata)
+	if messageID >= 0 {
+		usage.MessageID = messageID
+		if err := database.UpdateMessageUsage(db, messageID, usage); err != nil {
+			log.Printf("Failed to update usage of message %d: %v", messageID, err)
+		}
+	}
+	if _, err := database.InsertTokenUsage(db.Database, usage); err != nil {
+		log.Printf("Failed to record token usage for session %s: %v", db.SessionId(), err)
+	}
+}
+
 var thoughtPattern = regexp.MustCompile(`^\*\*(.*?)\*\*\n+(.*)\n*$`)
 
 // broadcastAndFinish broadcasts an event and then sends EventFinish
@@ -29,6 +59,24 @@ func broadcastAndFinish(ew EventWriter, eventType EventType, data string) {
 	ew.Broadcast(EventFinish, "")
 }
 
+// loadSessionGenParams loads the generation parameter overrides of a session.
+// Invalid or missing overrides are ignored so that the model preset is used as is.
+func loadSessionGenParams(db *database.SessionDatabase) spec.GenerationParams {
+	var genParams spec.GenerationParams
+	paramsJSON, err := database.GetSessionGenParams(db)
+	if err != nil {
+		log.Printf("Failed to load generation params for session %s: %v", db.SessionId(), err)
+		return genParams
+	}
+	if paramsJSON != "" {
+		if err := json.Unmarshal([]byte(paramsJSON), &genParams); err != nil {
+			log.Printf("Invalid generation params for session %s: %v", db.SessionId(), err)
+			return spec.GenerationParams{}
+		}
+	}
+	return genParams
+}
+
 // Helper function to stream LLM response
 // appendToMessageID, if >= 0, specifies an existing message ID to append to instead of creating a new message
 func streamLLMResponse(
@@ -58,12 +106,13 @@ func streamLLMResponse(
 		broadcastAndFinish(ew, EventError, err.Error())
 		return err
 	}
+	recordActiveCall(db, initialState.PrimaryBranchID)
 
 	// Ensure call is removed when function exits, using flag to avoid duplicate cleanup
 	callCompleted := false
 	defer func() {
 		if !callCompleted {
-			completeCall(initialState.SessionId)
+			abortCall(db)
 		}
 	}()
 
@@ -87,6 +136,17 @@ func streamLLMResponse(
 	if err != nil {
 		return err
 	}
+	genParams := loadSessionGenParams(db)
+
+	// The number of tokens in the history as of the last LLM call, which triggers automatic compression
+	lastTokenCount := 0
+	for i := len(fullHistoryForLLM) - 1; i >= 0; i-- {
+		if count := fullHistoryForLLM[i].CumulTokenCount; count != nil {
+			lastTokenCount = *count
+			break
+		}
+	}
+	autoCompressionFailed := false
 
 	var firstFinishReason string
 	for {
@@ -95,10 +155,27 @@ func streamLLMResponse(
 			return err
 		}
 
+		// Compress the history before it overflows the context window. This is not done while
+		// appending to a model message, which would otherwise continue before the compression message.
+		if !autoCompressionFailed && modelMessageID < 0 && shouldAutoCompress(db.Database, lastTokenCount, modelProvider.MaxTokens()) {
+			if result, ok := autoCompress(ctx, db, models, ew, mc); ok {
+				lastTokenCount = result.NewTokenCount
+				if history, err := database.GetSessionHistoryContext(db, mc.BranchID); err != nil {
+					log.Printf("Failed to reload compressed history for session %s: %v", db.SessionId(), err)
+				} else {
+					currentHistory = ConvertFrontendMessagesToContent(db, history)
+				}
+			} else {
+				autoCompressionFailed = true // Do not retry for every remaining call
+			}
+		}
+
 		seq, closer, err := modelProvider.SendMessageStream(ctx, llm.SessionParams{
 			Contents:        currentHistory,
 			SystemPrompt:    initialState.SystemPrompt,
 			IncludeThoughts: true,
+			GenParams:       genParams,
+			SessionId:       initialState.SessionId,
 		})
 		if err != nil {
 			// Save a model_error message to the database
@@ -123,18 +200,36 @@ func streamLLMResponse(
 		defer closer.Close() // This closes the server-initiated API request.
 
 		hasFunctionCall := false
+		var callUsage *UsageMetadata
+		callMessageID := -1 // The last model message produced by this call
 
+		var streamErr error
 		for caResp := range seq {
+			if caResp.Error != nil {
+				streamErr = caResp.Error
+				break
+			}
+
 			// Log UsageMetadata if available
 			if caResp.UsageMetadata != nil {
 				lastUsageMetadata = caResp.UsageMetadata
+				callUsage = caResp.UsageMetadata
 
 				// Update last user message's cumul_token_count with PromptTokenCount
 				if lastUsageMetadata.PromptTokenCount > 0 && mc.LastMessageID != 0 {
 					if err := database.UpdateMessageTokens(db, mc.LastMessageID, lastUsageMetadata.PromptTokenCount); err != nil {
 						log.Printf("Failed to update cumul_token_count for user message %d: %v", mc.LastMessageID, err)
 					}
-					ew.Broadcast(EventCumulTokenCount, fmt.Sprintf("%d\n%d", mc.LastMessageID, lastUsageMetadata.PromptTokenCount))
+					payload := fmt.Sprintf("%d\n%d", mc.LastMessageID, lastUsageMetadata.PromptTokenCount)
+
+					// Tokens served from a context cache, if any, are a part of the prompt tokens
+					if cached := lastUsageMetadata.CachedContentTokenCount; cached > 0 {
+						if err := database.UpdateMessageCachedTokens(db, mc.LastMessageID, cached); err != nil {
+							log.Printf("Failed to update cached token count for user message %d: %v", mc.LastMessageID, err)
+						}
+						payload += fmt.Sprintf("\n%d", cached)
+					}
+					ew.Broadcast(EventCumulTokenCount, payload)
 				}
 			}
 
@@ -173,10 +268,11 @@ func streamLLMResponse(
 					hasFunctionCall = true
 
 					fcJson, _ := json.Marshal(fc)
-					newMessage, err := mc.Add(Message{Type: TypeFunctionCall, Text: string(fcJson), State: state})
+					newMessage, err := mc.Add(Message{Type: TypeFunctionCall, Text: string(fcJson), State: state, Aux: providerAux(closer)})
 					if err != nil {
 						return logAndErrorf(err, "Failed to save function call message")
 					}
+					callMessageID = newMessage.ID
 
 					argsJson, _ := json.Marshal(fc.Args)
 					formattedData := fmt.Sprintf("%d\n%s\n%s", newMessage.ID, fc.Name, string(argsJson))
@@ -191,8 +287,11 @@ func streamLLMResponse(
 						log.Printf("Error executing function %s: %v", fc.Name, err)
 
 						var pendingConfirmation *tool.PendingConfirmation
+						var timeoutErr *tool.TimeoutError
 						if errors.As(err, &pendingConfirmation) {
 							return handlePendingConfirmation(db, ew, initialState, pendingConfirmation)
+						} else if errors.As(err, &timeoutErr) {
+							toolResults.Value = timeoutErr.Response()
 						} else {
 							toolResults.Value = map[string]interface{}{"error": err.Error()}
 						}
@@ -229,10 +328,22 @@ func streamLLMResponse(
 					formattedData = fmt.Sprintf("%d\n%s\n%s", newMessage.ID, fc.Name, string(payloadJson))
 					ew.Broadcast(EventFunctionResponse, formattedData)
 
+					frParts := AppendAttachmentParts(db, toolResults, []Part{{FunctionResponse: &fr}})
+
+					// Steering notes posted during the call go along with the function response
+					for _, note := range takeSteeringNotes(initialState.SessionId) {
+						newMessage, err = mc.Add(Message{Type: TypeSteering, Text: note})
+						if err != nil {
+							return logAndErrorf(err, "Failed to save steering message")
+						}
+						ew.Broadcast(EventSteering, fmt.Sprintf("%d\n%s", newMessage.ID, note))
+						frParts = append(frParts, steeringPart(note))
+					}
+
 					// Add to current history for later execution
 					currentHistory = append(currentHistory,
 						Content{Role: RoleModel, Parts: []Part{{FunctionCall: &fc, ThoughtSignature: state}}},
-						Content{Role: RoleUser, Parts: AppendAttachmentParts(db, toolResults, []Part{{FunctionResponse: &fr}})},
+						Content{Role: RoleUser, Parts: frParts},
 					)
 					continue // Continue processing other parts in the same caResp
 				} else if part.ExecutableCode != nil {
@@ -253,10 +364,11 @@ func streamLLMResponse(
 						Args: argsMap,
 					}
 					fcJson, _ := json.Marshal(fc)
-					newMessage, err := mc.Add(Message{Type: TypeFunctionCall, Text: string(fcJson), State: state})
+					newMessage, err := mc.Add(Message{Type: TypeFunctionCall, Text: string(fcJson), State: state, Aux: providerAux(closer)})
 					if err != nil {
 						return logAndErrorf(err, "Failed to save executable code message")
 					}
+					callMessageID = newMessage.ID
 					formattedData := fmt.Sprintf("%d\n%s\n%s", newMessage.ID, fc.Name, string(argsBytes))
 					ew.Broadcast(EventFunctionCall, formattedData)
 
@@ -325,11 +437,13 @@ func streamLLMResponse(
 						Text:        "", // Empty text for inlineData messages
 						State:       state,
 						Attachments: []FileAttachment{attachment},
+						Aux:         providerAux(closer),
 					})
 					if err != nil {
 						log.Printf("Failed to save inlineData message: %v", err)
 						continue
 					}
+					callMessageID = newMessage.ID
 
 					// Use the attachment from newMessage which should have the hash set
 					var attachmentToSend FileAttachment
@@ -380,6 +494,8 @@ func streamLLMResponse(
 					newMessage, err := mc.Add(Message{Type: TypeThought, Text: thoughtText, State: state})
 					if err != nil {
 						log.Printf("Failed to save thought message: %v", err)
+					} else {
+						callMessageID = newMessage.ID
 					}
 					// Broadcast thought immediately
 					ew.Broadcast(EventThought, fmt.Sprintf("%d\n%s", newMessage.ID, thoughtText))
@@ -395,12 +511,13 @@ func streamLLMResponse(
 						// Initialize agentResponseText for the new model message
 						agentResponseText = ""
 						// Add the initial model message to DB with empty text
-						newMessage, err := mc.Add(Message{Type: TypeModelText, Text: "", State: state})
+						newMessage, err := mc.Add(Message{Type: TypeModelText, Text: "", State: state, Aux: providerAux(closer)})
 						if err != nil {
 							return logAndErrorf(err, "Failed to add new model message to DB")
 						}
 						modelMessageID = newMessage.ID
 					}
+					callMessageID = modelMessageID
 
 					agentResponseText += part.Text // Accumulate text for DB update
 
@@ -415,6 +532,12 @@ func streamLLMResponse(
 			}
 		}
 
+		// Usage is reported at most once per call, usually with the last chunk
+		if callUsage != nil {
+			recordCallUsage(db, mc.LastMessageModel, callMessageID, callUsage)
+			lastTokenCount = max(callUsage.TotalTokenCount, callUsage.PromptTokenCount)
+		}
+
 		addCancelErrorMessage := func() {
 			// Add a separate error message to the database
 			if _, err := mc.Add(Message{Type: TypeModelError, Text: "user canceled request"}); err != nil {
@@ -427,6 +550,21 @@ func streamLLMResponse(
 			return err
 		}
 
+		// The stream has failed in the middle and no provider could take it over
+		if streamErr != nil {
+			if modelMessageID >= 0 {
+				if err := database.UpdateMessageContent(db, modelMessageID, agentResponseText, true); err != nil {
+					log.Printf("Failed to finalize model message before stream error: %v", err)
+				}
+			}
+			errorMessage := fmt.Sprintf("LLM call failed: %v", streamErr)
+			if _, err := mc.Add(Message{Type: TypeModelError, Text: errorMessage}); err != nil {
+				log.Printf("Failed to add model error message to DB: %v", err)
+			}
+			broadcastAndFinish(ew, EventError, errorMessage)
+			return fmt.Errorf("LLM stream failed: %w", streamErr)
+		}
+
 		// Model has generated all messages and nothing to ask
 		if !hasFunctionCall {
 			break
@@ -504,9 +642,12 @@ func streamLLMResponse(
 		ew.Broadcast(EventCumulTokenCount, fmt.Sprintf("%d\n%d", modelMessageID, *finalTotalTokenCount))
 	}
 
-	completeCall(initialState.SessionId) // Mark the call as completed and remove from active calls
-	callCompleted = true                 // Prevent defer from calling completeCall again
+	queued := finishCall(db) // Mark the call as completed unless a queued message continues it
+	callCompleted = true     // Prevent defer from calling completeCall again
 	inferWg.Wait()
+	if queued != nil {
+		return sendQueuedMessage(db, models, ga, tools, config, ew, queued)
+	}
 	ew.Broadcast(EventFinish, "")
 	return nil
 }
@@ -643,6 +784,7 @@ func inferAndSetSessionName(
 		log.Printf("Failed to infer session name for %s: %v", db.SessionId(), err)
 		return // inferredName remains empty
 	}
+	llm.RecordTokenUsage(db.Database, db.SessionId(), modelProvider.Name(), TokenUsageSessionName, oneShotResult.UsageMetadata)
 
 	llmInferredNameText := strings.TrimSpace(oneShotResult.Text)
 	if len(llmInferredNameText) > 100 || strings.Contains(llmInferredNameText, "\n") {
@@ -11,14 +11,17 @@ import (
 	. "github.com/lifthrasiir/angel/internal/types"
 )
 
+// BlobHash returns the SHA-512/256 hash of the data, which is used as a blob ID.
+func BlobHash(data []byte) string {
+	hash := sha512.Sum512_256(data)
+	return hex.EncodeToString(hash[:])
+}
+
 // SaveBlob saves a blob to the blobs table. This function ensures the blob data exists.
 // It sets ref_count = 0 for new blobs, and triggers will manage counting when messages are saved.
 // It returns the SHA-512/256 hash of the data.
 func SaveBlob(ctx context.Context, db SessionDbOrTx, data []byte) (string, error) {
-	hasher := sha512.New512_256()
-	hasher.Write(data)
-	hash := hasher.Sum(nil)
-	hashStr := hex.EncodeToString(hash)
+	hashStr := BlobHash(data)
 
 	// Insert blob with ref_count = 0 if it doesn't exist
 	// Triggers will increment ref_count when the message is actually saved
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// hasActiveCallsTable checks if the session DB has the active_calls table.
+// Older session DBs may not have the table yet.
+func hasActiveCallsTable(db *SessionDatabase) (bool, error) {
+	var tableExists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM S.sqlite_master WHERE type = 'table' AND name = 'active_calls'").Scan(&tableExists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check active_calls table: %w", err)
+	}
+	return tableExists, nil
+}
+
+// RecordActiveCall persists that a call is active on the given branch of the session,
+// so that the call can be detected as interrupted if the server stops before it finishes.
+func RecordActiveCall(db *SessionDatabase, branchID string) error {
+	if _, err := db.Exec(createActiveCallsSQL); err != nil {
+		return fmt.Errorf("failed to create active_calls table: %w", err)
+	}
+	_, err := db.Exec("INSERT OR REPLACE INTO S.active_calls (session_id, branch_id) VALUES (?, ?)", db.LocalSessionId(), branchID)
+	if err != nil {
+		return fmt.Errorf("failed to record active call: %w", err)
+	}
+	return nil
+}
+
+// ClearActiveCall removes the record of the active call of the session, if any.
+func ClearActiveCall(db *SessionDatabase) error {
+	if exists, err := hasActiveCallsTable(db); err != nil || !exists {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM S.active_calls WHERE session_id = ?", db.LocalSessionId()); err != nil {
+		return fmt.Errorf("failed to clear active call: %w", err)
+	}
+	return nil
+}
+
+// GetRecordedCallBranch returns the branch ID of the call recorded by RecordActiveCall.
+// Returns an empty string if no call is recorded for the session.
+func GetRecordedCallBranch(db *SessionDatabase) (string, error) {
+	if exists, err := hasActiveCallsTable(db); err != nil || !exists {
+		return "", err
+	}
+
+	var branchID string
+	err := db.QueryRow("SELECT branch_id FROM S.active_calls WHERE session_id = ?", db.LocalSessionId()).Scan(&branchID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get recorded call: %w", err)
+	}
+	return branchID, nil
+}
+
+// RecordedCall is a call recorded by RecordActiveCall.
+type RecordedCall struct {
+	SessionID string // Full session ID, including the subsession suffix if any
+	BranchID  string
+}
+
+// GetRecordedCalls returns all calls recorded in the session DB, including those of subsessions.
+func GetRecordedCalls(db *SessionDatabase) ([]RecordedCall, error) {
+	if exists, err := hasActiveCallsTable(db); err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT session_id, branch_id FROM S.active_calls")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recorded calls: %w", err)
+	}
+	defer rows.Close()
+
+	mainSessionID, _ := SplitSessionId(db.SessionId())
+	var calls []RecordedCall
+	for rows.Next() {
+		var localSessionID string
+		var call RecordedCall
+		if err := rows.Scan(&localSessionID, &call.BranchID); err != nil {
+			return nil, fmt.Errorf("failed to scan recorded call: %w", err)
+		}
+		call.SessionID = ToFullSessionID(mainSessionID, localSessionID)
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
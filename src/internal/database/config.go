@@ -101,6 +101,76 @@ func SetAppConfig(db *Database, key string, value []byte) error {
 	return nil
 }
 
+// GetWorkspaceConfig retrieves a configuration value of a workspace from the workspace_configs table.
+func GetWorkspaceConfig(db *Database, workspaceID, key string) ([]byte, error) {
+	var value []byte
+	err := db.QueryRow("SELECT value FROM workspace_configs WHERE workspace_id = ? AND key = ?", workspaceID, key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Key not found, not an error
+		}
+		return nil, fmt.Errorf("failed to get workspace config for key %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetWorkspaceConfig saves a configuration value of a workspace to the workspace_configs table.
+// A nil value removes the configuration.
+func SetWorkspaceConfig(db *Database, workspaceID, key string, value []byte) error {
+	var err error
+	if value == nil {
+		_, err = db.Exec("DELETE FROM workspace_configs WHERE workspace_id = ? AND key = ?", workspaceID, key)
+	} else {
+		_, err = db.Exec("INSERT OR REPLACE INTO workspace_configs (workspace_id, key, value) VALUES (?, ?, ?)", workspaceID, key, value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set workspace config for key %s: %w", key, err)
+	}
+	return nil
+}
+
+// GetSessionConfig retrieves a configuration value of a session from the session_configs table.
+func GetSessionConfig(db *SessionDatabase, key string) ([]byte, error) {
+	// Older session DBs may not have the table yet
+	var tableExists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM S.sqlite_master WHERE type = 'table' AND name = 'session_configs'").Scan(&tableExists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session_configs table: %w", err)
+	}
+	if !tableExists {
+		return nil, nil
+	}
+
+	var value []byte
+	err = db.QueryRow("SELECT value FROM S.session_configs WHERE session_id = ? AND key = ?", db.LocalSessionId(), key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Key not found, not an error
+		}
+		return nil, fmt.Errorf("failed to get session config for key %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSessionConfig saves a configuration value of a session to the session_configs table.
+// A nil value removes the configuration.
+func SetSessionConfig(db *SessionDatabase, key string, value []byte) error {
+	if _, err := db.Exec(createSessionConfigsSQL); err != nil {
+		return fmt.Errorf("failed to create session_configs table: %w", err)
+	}
+
+	var err error
+	if value == nil {
+		_, err = db.Exec("DELETE FROM S.session_configs WHERE session_id = ? AND key = ?", db.LocalSessionId(), key)
+	} else {
+		_, err = db.Exec("INSERT OR REPLACE INTO S.session_configs (session_id, key, value) VALUES (?, ?, ?)", db.LocalSessionId(), key, value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set session config for key %s: %w", key, err)
+	}
+	return nil
+}
+
 // SaveMCPServerConfig saves an MCP server configuration to the database.
 func SaveMCPServerConfig(db *Database, config MCPServerConfig) error {
 	_, err := db.Exec(`
@@ -155,6 +225,60 @@ func DeleteMCPServerConfig(db *Database, name string) error {
 	return nil
 }
 
+// SaveScriptToolConfig saves a script tool configuration to the database.
+func SaveScriptToolConfig(db *Database, config ScriptToolConfig) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO script_tools (name, description, parameters_json, command, timeout, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, config.Name, config.Description, string(config.Parameters), config.Command, config.Timeout, config.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to save script tool config: %w", err)
+	}
+	return nil
+}
+
+// GetScriptToolConfigs retrieves all script tool configurations from the database.
+func GetScriptToolConfigs(db *Database) ([]ScriptToolConfig, error) {
+	rows, err := db.Query("SELECT name, description, parameters_json, command, timeout, enabled FROM script_tools ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query script tool configs: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []ScriptToolConfig
+	for rows.Next() {
+		var config ScriptToolConfig
+		var parametersJSON string
+		if err := rows.Scan(&config.Name, &config.Description, &parametersJSON, &config.Command, &config.Timeout, &config.Enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan script tool config: %w", err)
+		}
+		config.Parameters = json.RawMessage(parametersJSON)
+		configs = append(configs, config)
+	}
+	if configs == nil {
+		return []ScriptToolConfig{}, nil
+	}
+	return configs, nil
+}
+
+// DeleteScriptToolConfig deletes a script tool configuration from the database.
+func DeleteScriptToolConfig(db *Database, name string) error {
+	result, err := db.Exec("DELETE FROM script_tools WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete script tool config: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return MakeNotFoundError("script tool with name %s not found", name)
+	}
+	return nil
+}
+
 // getHighestOAuthTokenID returns the highest existing ID in oauth_tokens table
 // Returns 0 if table is empty
 func getHighestOAuthTokenID(db *Database) (int, error) {
@@ -419,9 +543,9 @@ func GetOAuthToken(db *Database, id int) (*OAuthToken, error) {
 // SaveOpenAIConfig saves an OpenAI configuration to the database.
 func SaveOpenAIConfig(db *Database, config OpenAIConfig) error {
 	_, err := db.Exec(`
-		INSERT OR REPLACE INTO openai_configs (id, name, endpoint, api_key, enabled, updated_at)
-		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`, config.ID, config.Name, config.Endpoint, config.APIKey, config.Enabled)
+		INSERT OR REPLACE INTO openai_configs (id, name, endpoint, api_key, api_mode, enabled, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, config.ID, config.Name, config.Endpoint, config.APIKey, config.APIMode, config.Enabled)
 	if err != nil {
 		return fmt.Errorf("failed to save OpenAI config: %w", err)
 	}
@@ -430,7 +554,7 @@ func SaveOpenAIConfig(db *Database, config OpenAIConfig) error {
 
 // GetOpenAIConfigs retrieves all OpenAI configurations from the database.
 func GetOpenAIConfigs(db *Database) ([]OpenAIConfig, error) {
-	rows, err := db.Query("SELECT id, name, endpoint, api_key, enabled, created_at, updated_at FROM openai_configs ORDER BY created_at DESC")
+	rows, err := db.Query("SELECT id, name, endpoint, api_key, api_mode, enabled, created_at, updated_at FROM openai_configs ORDER BY created_at DESC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query OpenAI configs: %w", err)
 	}
@@ -439,7 +563,7 @@ func GetOpenAIConfigs(db *Database) ([]OpenAIConfig, error) {
 	var configs []OpenAIConfig
 	for rows.Next() {
 		var config OpenAIConfig
-		err := rows.Scan(&config.ID, &config.Name, &config.Endpoint, &config.APIKey, &config.Enabled, &config.CreatedAt, &config.UpdatedAt)
+		err := rows.Scan(&config.ID, &config.Name, &config.Endpoint, &config.APIKey, &config.APIMode, &config.Enabled, &config.CreatedAt, &config.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan OpenAI config: %w", err)
 		}
@@ -454,8 +578,8 @@ func GetOpenAIConfigs(db *Database) ([]OpenAIConfig, error) {
 // GetOpenAIConfig retrieves a single OpenAI configuration by its ID.
 func GetOpenAIConfig(db *Database, id string) (*OpenAIConfig, error) {
 	var config OpenAIConfig
-	err := db.QueryRow("SELECT id, name, endpoint, api_key, enabled, created_at, updated_at FROM openai_configs WHERE id = ?", id).
-		Scan(&config.ID, &config.Name, &config.Endpoint, &config.APIKey, &config.Enabled, &config.CreatedAt, &config.UpdatedAt)
+	err := db.QueryRow("SELECT id, name, endpoint, api_key, api_mode, enabled, created_at, updated_at FROM openai_configs WHERE id = ?", id).
+		Scan(&config.ID, &config.Name, &config.Endpoint, &config.APIKey, &config.APIMode, &config.Enabled, &config.CreatedAt, &config.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("OpenAI config with id %s not found", id)
@@ -641,6 +765,57 @@ func DeleteGeminiAPIConfig(db *Database, id string) error {
 	return nil
 }
 
+// SaveAnthropicConfig saves an Anthropic configuration to the database.
+func SaveAnthropicConfig(db *Database, config AnthropicConfig) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO anthropic_configs (id, name, endpoint, api_key, enabled, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, config.ID, config.Name, config.Endpoint, config.APIKey, config.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to save Anthropic config: %w", err)
+	}
+	return nil
+}
+
+// GetAnthropicConfigs retrieves all Anthropic configurations from the database, oldest first.
+func GetAnthropicConfigs(db *Database) ([]AnthropicConfig, error) {
+	rows, err := db.Query("SELECT id, name, endpoint, api_key, enabled, created_at, updated_at FROM anthropic_configs ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Anthropic configs: %w", err)
+	}
+	defer rows.Close()
+
+	configs := []AnthropicConfig{}
+	for rows.Next() {
+		var config AnthropicConfig
+		err := rows.Scan(&config.ID, &config.Name, &config.Endpoint, &config.APIKey, &config.Enabled, &config.CreatedAt, &config.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan Anthropic config: %w", err)
+		}
+		configs = append(configs, config)
+	}
+	return configs, rows.Err()
+}
+
+// DeleteAnthropicConfig deletes an Anthropic configuration from the database.
+func DeleteAnthropicConfig(db *Database, id string) error {
+	result, err := db.Exec("DELETE FROM anthropic_configs WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete Anthropic config: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		//lint:ignore ST1005 Anthropic is a proper noun
+		return MakeNotFoundError("Anthropic config with id %s not found", id)
+	}
+	return nil
+}
+
 // marshalTimeMap converts a map of time.Time to JSON (uses default serialization)
 func marshalTimeMap(m map[string]time.Time) ([]byte, error) {
 	return json.Marshal(m)
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// GetContentCache retrieves the context cache of a session for the given provider config and model.
+// Returns nil if there is no cache.
+func GetContentCache(db *SessionDatabase, configID, model string) (*ContentCache, error) {
+	// Older session DBs may not have the table yet
+	var tableExists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM S.sqlite_master WHERE type = 'table' AND name = 'session_content_caches'").Scan(&tableExists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session_content_caches table: %w", err)
+	}
+	if !tableExists {
+		return nil, nil
+	}
+
+	cache := ContentCache{ConfigID: configID, Model: model}
+	err = db.QueryRow(`
+		SELECT name, prefix_hash, content_count, token_count, expire_at
+		FROM S.session_content_caches WHERE session_id = ? AND config_id = ? AND model = ?`,
+		db.LocalSessionId(), configID, model,
+	).Scan(&cache.Name, &cache.PrefixHash, &cache.ContentCount, &cache.TokenCount, &cache.ExpireAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get content cache: %w", err)
+	}
+	return &cache, nil
+}
+
+// SaveContentCache records the context cache of a session, replacing any previous cache for the same config and model.
+func SaveContentCache(db *SessionDatabase, cache ContentCache) error {
+	if _, err := db.Exec(createSessionContentCachesSQL); err != nil {
+		return fmt.Errorf("failed to create session_content_caches table: %w", err)
+	}
+
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO S.session_content_caches
+			(session_id, config_id, model, name, prefix_hash, content_count, token_count, expire_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		db.LocalSessionId(), cache.ConfigID, cache.Model, cache.Name, cache.PrefixHash,
+		cache.ContentCount, cache.TokenCount, cache.ExpireAt)
+	if err != nil {
+		return fmt.Errorf("failed to save content cache: %w", err)
+	}
+	return nil
+}
+
+// DeleteContentCache forgets the context cache of a session for the given provider config and model.
+func DeleteContentCache(db *SessionDatabase, configID, model string) error {
+	if _, err := db.Exec(createSessionContentCachesSQL); err != nil {
+		return fmt.Errorf("failed to create session_content_caches table: %w", err)
+	}
+
+	_, err := db.Exec("DELETE FROM S.session_content_caches WHERE session_id = ? AND config_id = ? AND model = ?",
+		db.LocalSessionId(), configID, model)
+	if err != nil {
+		return fmt.Errorf("failed to delete content cache: %w", err)
+	}
+	return nil
+}
+
+// UpdateMessageCachedTokens records the number of tokens served from a context cache
+// for the request ending at the message, as "cachedTokenCount" in its aux field.
+func UpdateMessageCachedTokens(db SessionDbOrTx, messageID int, cachedTokenCount int) error {
+	_, err := db.Exec(`
+		UPDATE S.messages
+		SET aux = CASE
+		        WHEN aux = '' THEN json_object('cachedTokenCount', ?1)
+		        ELSE json_set(aux, '$.cachedTokenCount', ?1)
+		    END
+		WHERE id = ?2`, cachedTokenCount, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to update message cached tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// MessageEmbeddingsIndexConfigName is the app config recording which embedding model
+// the message_embeddings table was computed with. Embeddings from different models are not comparable.
+const MessageEmbeddingsIndexConfigName = "message_embeddings_index"
+
+// maxEmbeddingTextLength limits the number of characters embedded per message, as embedding models accept short inputs
+const maxEmbeddingTextLength = 8000
+
+// SearchableMessage is an entry of messages_searchable whose embedding is to be computed
+type SearchableMessage struct {
+	ID   int
+	Text string
+}
+
+// serializeEmbedding converts an embedding into the little-endian float32 array expected by sqlite-vec
+func serializeEmbedding(embedding []float32) []byte {
+	data := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+// messageEmbeddingsExist returns whether the message_embeddings table exists
+func messageEmbeddingsExist(db *Database) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE name = 'message_embeddings'").Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check message_embeddings table: %w", err)
+	}
+	return exists, nil
+}
+
+// HasMessageEmbeddings returns whether message_embeddings holds embeddings computed for the given index
+func HasMessageEmbeddings(db *Database, index string) (bool, error) {
+	value, err := GetAppConfig(db, MessageEmbeddingsIndexConfigName)
+	if err != nil || string(value) != index {
+		return false, err
+	}
+	return messageEmbeddingsExist(db)
+}
+
+// resetMessageEmbeddings drops all embeddings, so that they can be recomputed with another model
+func resetMessageEmbeddings(db *Database) error {
+	if _, err := db.Exec("DELETE FROM stale_message_embeddings"); err != nil {
+		return fmt.Errorf("failed to clear stale message embeddings: %w", err)
+	}
+	if _, err := db.Exec("DROP TABLE IF EXISTS message_embeddings"); err != nil {
+		return fmt.Errorf("failed to drop message_embeddings table: %w", err)
+	}
+	return SetAppConfig(db, MessageEmbeddingsIndexConfigName, []byte{})
+}
+
+// GetUnembeddedMessages returns up to limit non-empty entries of messages_searchable, newest first,
+// that have no embeddings computed for the given index. Embeddings computed for another index are discarded.
+func GetUnembeddedMessages(db *Database, index string, limit int) ([]SearchableMessage, error) {
+	ready, err := HasMessageEmbeddings(db, index)
+	if err != nil {
+		return nil, err
+	}
+	if !ready {
+		if err := resetMessageEmbeddings(db); err != nil {
+			return nil, err
+		}
+	} else if err := discardStaleMessageEmbeddings(db); err != nil {
+		return nil, err
+	}
+
+	// Convert SI/SO back to angle brackets
+	query := `
+		SELECT id, replace(replace(substr(text, 1, ?), '\x0e', '<'), '\x0f', '>')
+		FROM messages_searchable
+		WHERE trim(text) != ''`
+	if ready {
+		query += " AND id NOT IN (SELECT rowid FROM message_embeddings)"
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+
+	rows, err := db.Query(query, maxEmbeddingTextLength, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unembedded messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []SearchableMessage
+	for rows.Next() {
+		var message SearchableMessage
+		if err := rows.Scan(&message.ID, &message.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan unembedded message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// discardStaleMessageEmbeddings deletes embeddings of messages edited since they were computed.
+// Edited messages are recorded by a trigger, as vec0 tables can't be modified from triggers themselves.
+func discardStaleMessageEmbeddings(db *Database) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM message_embeddings WHERE rowid IN (SELECT id FROM stale_message_embeddings)"); err != nil {
+		return fmt.Errorf("failed to discard stale message embeddings: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM stale_message_embeddings"); err != nil {
+		return fmt.Errorf("failed to clear stale message embeddings: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SaveMessageEmbeddings stores embeddings of messages_searchable entries computed for the given index.
+// The message_embeddings table is (re)created with the dimensions of given embeddings if it was computed for another index.
+func SaveMessageEmbeddings(db *Database, index string, ids []int, embeddings [][]float32) error {
+	if len(ids) != len(embeddings) {
+		return fmt.Errorf("expected %d embeddings, got %d", len(ids), len(embeddings))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	dimensions := len(embeddings[0])
+	for _, embedding := range embeddings {
+		if len(embedding) != dimensions || dimensions == 0 {
+			return fmt.Errorf("embeddings have inconsistent dimensions")
+		}
+	}
+
+	ready, err := HasMessageEmbeddings(db, index)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		if err := resetMessageEmbeddings(db); err != nil {
+			return err
+		}
+		_, err = db.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE message_embeddings USING vec0(embedding float[%d] distance_metric=cosine)", dimensions))
+		if err != nil {
+			return fmt.Errorf("failed to create message_embeddings table: %w", err)
+		}
+		if err := SetAppConfig(db, MessageEmbeddingsIndexConfigName, []byte(index)); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		// vec0 tables do not support upserts
+		if _, err := tx.Exec("DELETE FROM message_embeddings WHERE rowid = ?", id); err != nil {
+			return fmt.Errorf("failed to delete message embedding: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO message_embeddings(rowid, embedding) VALUES (?, ?)", id, serializeEmbedding(embeddings[i])); err != nil {
+			return fmt.Errorf("failed to insert message embedding: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// PruneMessageEmbeddings deletes embeddings of entries no longer in messages_searchable
+func PruneMessageEmbeddings(db *Database) (int64, error) {
+	exists, err := messageEmbeddingsExist(db)
+	if err != nil || !exists {
+		return 0, err
+	}
+	result, err := db.Exec("DELETE FROM message_embeddings WHERE rowid NOT IN (SELECT id FROM messages_searchable)")
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune message embeddings: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -145,6 +145,22 @@ func GetShellCommandByID(db SessionDbOrTx, id string) (*ShellCommand, error) {
 	return &cmd, nil
 }
 
+// CleanupStaleSessionShellCommands marks commands in the session DB which were running before the given time as failed.
+// Commands started later are left alone, as they may be run by the current process.
+func CleanupStaleSessionShellCommands(db *SessionDatabase, before time.Time) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE S.shell_commands
+		SET status = 'failed_on_startup',
+		    end_time = ?,
+		    error_message = 'Command failed because Angel restarted.'
+		WHERE status = 'running' AND start_time < ?`,
+		time.Now().Unix(), before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to update stale shell commands: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 // CleanupStaleShellCommands marks any previously running commands as failed on startup.
 // This is used to clean up commands that were running when Angel restarted.
 func CleanupStaleShellCommands(db *Database, now time.Time) error {
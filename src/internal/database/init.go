@@ -282,12 +282,28 @@ func createTables(db *sql.DB) error {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	CREATE TABLE IF NOT EXISTS workspace_configs (
+		workspace_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value BLOB,
+		PRIMARY KEY (workspace_id, key)
+	);
+
 	CREATE TABLE IF NOT EXISTS mcp_configs (
 		name TEXT PRIMARY KEY,
 		config_json TEXT NOT NULL,
 		enabled BOOLEAN NOT NULL
 	);
 
+	CREATE TABLE IF NOT EXISTS script_tools (
+		name TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		parameters_json TEXT NOT NULL DEFAULT '{}',
+		command TEXT NOT NULL,
+		timeout REAL NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL
+	);
+
 	CREATE TABLE IF NOT EXISTS blobs (
 		id TEXT PRIMARY KEY, -- SHA-512/256 hash of the data
 		data BLOB NOT NULL,
@@ -363,6 +379,7 @@ func createTables(db *sql.DB) error {
 		name TEXT NOT NULL UNIQUE,
 		endpoint TEXT NOT NULL,
 		api_key TEXT,
+		api_mode TEXT NOT NULL DEFAULT 'chat',
 		enabled BOOLEAN NOT NULL DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
@@ -378,6 +395,16 @@ func createTables(db *sql.DB) error {
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	CREATE TABLE IF NOT EXISTS anthropic_configs (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		endpoint TEXT NOT NULL DEFAULT '',
+		api_key TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
 	CREATE TABLE IF NOT EXISTS shell_commands (
 		id TEXT PRIMARY KEY,
 		branch_id TEXT NOT NULL,
@@ -396,6 +423,75 @@ func createTables(db *sql.DB) error {
 		FOREIGN KEY (branch_id) REFERENCES branches(id) ON DELETE CASCADE
 	);
 
+	CREATE TABLE IF NOT EXISTS tool_call_audits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		branch_id TEXT NOT NULL,
+		tool_name TEXT NOT NULL,
+		args_digest TEXT NOT NULL,
+		started_at INTEGER NOT NULL, -- Unix milliseconds
+		duration_ms INTEGER NOT NULL,
+		result_size INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		confirmation TEXT NOT NULL DEFAULT '' -- '', 'pending', 'approved' or 'denied'
+	);
+	CREATE INDEX IF NOT EXISTS idx_tool_call_audits_started_at ON tool_call_audits(started_at);
+	CREATE INDEX IF NOT EXISTS idx_tool_call_audits_session_id ON tool_call_audits(session_id);
+	CREATE INDEX IF NOT EXISTS idx_tool_call_audits_tool_name ON tool_call_audits(tool_name);
+
+	CREATE TABLE IF NOT EXISTS workspace_memories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace_id TEXT NOT NULL,
+		content TEXT NOT NULL,
+		session_id TEXT NOT NULL DEFAULT '', -- '' if stored by users
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_workspace_memories_workspace_id ON workspace_memories(workspace_id);
+
+	CREATE TABLE IF NOT EXISTS scheduled_prompts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		schedule TEXT NOT NULL, -- Five-field cron expression or a macro like @daily
+		prompt TEXT NOT NULL,
+		workspace_id TEXT NOT NULL DEFAULT '',
+		session_id TEXT NOT NULL DEFAULT '', -- '' to create a new session for each run
+		model TEXT NOT NULL DEFAULT '',
+		system_prompt TEXT NOT NULL DEFAULT '',
+		tools TEXT NOT NULL DEFAULT '[]', -- JSON array of tool names, all tools if empty
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS scheduled_prompt_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scheduled_prompt_id INTEGER NOT NULL,
+		session_id TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL, -- 'running', 'succeeded' or 'failed'
+		error TEXT NOT NULL DEFAULT '',
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME,
+		FOREIGN KEY (scheduled_prompt_id) REFERENCES scheduled_prompts(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_prompt_runs_prompt_id ON scheduled_prompt_runs(scheduled_prompt_id);
+
+	CREATE TABLE IF NOT EXISTS token_usages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		workspace_id TEXT NOT NULL DEFAULT '',
+		message_id INTEGER NOT NULL DEFAULT 0,
+		model TEXT NOT NULL,
+		kind TEXT NOT NULL, -- 'chat', 'subagent', 'compression', 'session_name' or 'web_fetch'
+		prompt_tokens INTEGER NOT NULL DEFAULT 0, -- Includes cached_tokens
+		candidates_tokens INTEGER NOT NULL DEFAULT 0,
+		thoughts_tokens INTEGER NOT NULL DEFAULT 0,
+		cached_tokens INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL -- Unix milliseconds
+	);
+	CREATE INDEX IF NOT EXISTS idx_token_usages_created_at ON token_usages(created_at);
+	CREATE INDEX IF NOT EXISTS idx_token_usages_session_id ON token_usages(session_id);
+	CREATE INDEX IF NOT EXISTS idx_token_usages_workspace_id ON token_usages(workspace_id);
+
 	CREATE TABLE IF NOT EXISTS session_envs (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		session_id TEXT NOT NULL,
@@ -407,10 +503,14 @@ func createTables(db *sql.DB) error {
 	);
 
 	CREATE TABLE IF NOT EXISTS messages_searchable (
-		id INTEGER PRIMARY KEY,
+		id INTEGER PRIMARY KEY AUTOINCREMENT, -- Shared as rowid by FTS tables and message_embeddings, never reused
 		text TEXT NOT NULL,
 		session_id TEXT NOT NULL,
-		workspace_id TEXT
+		workspace_id TEXT,
+		message_id INTEGER NOT NULL, -- ID in the session DB, only unique within the session DB
+		type TEXT NOT NULL DEFAULT '',
+		created_at DATETIME,
+		UNIQUE(session_id, message_id)
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_messages_searchable_session_id ON messages_searchable(session_id);
@@ -428,6 +528,10 @@ func createTables(db *sql.DB) error {
 		workspace_id UNINDEXED,
 		tokenize='trigram remove_diacritics 1'
 	);
+
+	CREATE TABLE IF NOT EXISTS stale_message_embeddings (
+		id INTEGER PRIMARY KEY -- messages_searchable.id edited after its embedding was computed
+	);
 	`
 	_, err := db.Exec(createTableSQL)
 	if err != nil {
@@ -436,6 +540,19 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
+// reindexMessagesTriggerSQL removes FTS rows of edited messages, which are then inserted again by syncSessionFTSTables,
+// and marks their embeddings as stale. FTS5 tables can't be updated in place, so they would keep the old text otherwise.
+const reindexMessagesTriggerSQL = `
+	CREATE TRIGGER IF NOT EXISTS reindex_edited_messages
+		AFTER UPDATE ON messages_searchable
+		WHEN NEW.text != OLD.text OR NEW.session_id != OLD.session_id OR NEW.workspace_id IS NOT OLD.workspace_id
+	BEGIN
+		DELETE FROM message_stems WHERE rowid = OLD.id;
+		DELETE FROM message_trigrams WHERE rowid = OLD.id;
+		INSERT OR IGNORE INTO stale_message_embeddings (id) SELECT OLD.id WHERE NEW.text != OLD.text;
+	END;
+`
+
 // migrateDB handles database schema migrations.
 func migrateDB(ctx context.Context, db *sql.DB) error {
 	// Migration 1: Convert messages_searchable from VIEW to table for split-db architecture
@@ -520,6 +637,50 @@ func migrateDB(ctx context.Context, db *sql.DB) error {
 		log.Println("FTS tables recreated (population deferred)")
 	}
 
+	// Migration 6: Key messages_searchable by session and message IDs, as message IDs are only unique within a session DB.
+	// This has to precede the split-DB migration which populates the table.
+	var messageIDExists bool
+	err = db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('messages_searchable') WHERE name = 'message_id'").Scan(&messageIDExists)
+	if err != nil {
+		log.Printf("Warning: Failed to check message_id column: %v", err)
+	} else if !messageIDExists {
+		log.Println("Migrating messages_searchable table: keying by session and message IDs...")
+
+		// Entries are rebuilt by SessionWatcher when it tracks existing session DBs
+		_, err = db.Exec("DROP TABLE messages_searchable")
+		if err != nil {
+			return fmt.Errorf("failed to drop messages_searchable table: %w", err)
+		}
+		_, err = db.Exec(`CREATE TABLE messages_searchable (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			text TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			workspace_id TEXT,
+			message_id INTEGER NOT NULL,
+			type TEXT NOT NULL DEFAULT '',
+			created_at DATETIME,
+			UNIQUE(session_id, message_id)
+		)`)
+		if err != nil {
+			return fmt.Errorf("failed to create messages_searchable table: %w", err)
+		}
+		_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_searchable_session_id ON messages_searchable(session_id)")
+		if err != nil {
+			log.Printf("Warning: Failed to create index: %v", err)
+		}
+		_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_searchable_workspace_id ON messages_searchable(workspace_id)")
+		if err != nil {
+			log.Printf("Warning: Failed to create index: %v", err)
+		}
+
+		for _, table := range []string{"message_stems", "message_trigrams"} {
+			if _, err = db.Exec("DELETE FROM " + table); err != nil {
+				log.Printf("Warning: Failed to clear %s: %v", table, err)
+			}
+		}
+		log.Println("messages_searchable table migration completed")
+	}
+
 	// Migration 2: Split-DB architecture migration
 	// Check if migration is needed (main DB has messages but no session DBs)
 	var messageCount int
@@ -584,6 +745,40 @@ func migrateDB(ctx context.Context, db *sql.DB) error {
 		log.Println("Sessions table archived column added")
 	}
 
+	// Migration 5: Add api_mode column to openai_configs table
+	var apiModeExists bool
+	err = db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('openai_configs') WHERE name = 'api_mode'").Scan(&apiModeExists)
+	if err != nil {
+		log.Printf("Warning: Failed to check api_mode column: %v", err)
+	} else if !apiModeExists {
+		log.Println("Migrating openai_configs table: adding api_mode column...")
+		_, err = db.Exec("ALTER TABLE openai_configs ADD COLUMN api_mode TEXT NOT NULL DEFAULT 'chat'")
+		if err != nil {
+			return fmt.Errorf("failed to add api_mode column: %w", err)
+		}
+		log.Println("OpenAI configs table api_mode column added")
+	}
+
+	// Migration 7: Re-index edited messages. Triggers are dropped along with messages_searchable,
+	// so this has to follow any migration that recreates the table.
+	if _, err = db.Exec(reindexMessagesTriggerSQL); err != nil {
+		return fmt.Errorf("failed to create messages_searchable trigger: %w", err)
+	}
+
+	// Migration 8: Add timeout column to script_tools table
+	var scriptTimeoutExists bool
+	err = db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('script_tools') WHERE name = 'timeout'").Scan(&scriptTimeoutExists)
+	if err != nil {
+		log.Printf("Warning: Failed to check script_tools timeout column: %v", err)
+	} else if !scriptTimeoutExists {
+		log.Println("Migrating script_tools table: adding timeout column...")
+		_, err = db.Exec("ALTER TABLE script_tools ADD COLUMN timeout REAL NOT NULL DEFAULT 0")
+		if err != nil {
+			return fmt.Errorf("failed to add timeout column: %w", err)
+		}
+		log.Println("Script tools table timeout column added")
+	}
+
 	return nil
 }
 
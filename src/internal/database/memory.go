@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// AddMemory stores a new memory of the workspace. sessionID is empty if the memory is stored by users.
+func AddMemory(db *Database, workspaceID, content, sessionID string) (Memory, error) {
+	result, err := db.Exec("INSERT INTO workspace_memories (workspace_id, content, session_id) VALUES (?, ?, ?)",
+		workspaceID, content, sessionID)
+	if err != nil {
+		return Memory{}, fmt.Errorf("failed to add memory: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Memory{}, fmt.Errorf("failed to get memory ID: %w", err)
+	}
+	return GetMemory(db, int(id))
+}
+
+// GetMemory retrieves a memory by its ID. Returns sql.ErrNoRows (wrapped) if there is no such memory.
+func GetMemory(db *Database, id int) (Memory, error) {
+	var m Memory
+	err := db.QueryRow(`
+		SELECT id, workspace_id, content, session_id, created_at, updated_at
+		FROM workspace_memories WHERE id = ?`, id,
+	).Scan(&m.ID, &m.WorkspaceID, &m.Content, &m.SessionID, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return m, fmt.Errorf("failed to get memory %d: %w", id, err)
+	}
+	return m, nil
+}
+
+// GetMemories retrieves all memories of the workspace in the order of creation.
+func GetMemories(db *Database, workspaceID string) ([]Memory, error) {
+	rows, err := db.Query(`
+		SELECT id, workspace_id, content, session_id, created_at, updated_at
+		FROM workspace_memories WHERE workspace_id = ? ORDER BY id`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memories: %w", err)
+	}
+	defer rows.Close()
+
+	memories := []Memory{}
+	for rows.Next() {
+		var m Memory
+		if err := rows.Scan(&m.ID, &m.WorkspaceID, &m.Content, &m.SessionID, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan memory: %w", err)
+		}
+		memories = append(memories, m)
+	}
+	return memories, rows.Err()
+}
+
+// UpdateMemory replaces the content of a memory.
+func UpdateMemory(db *Database, id int, content string) error {
+	result, err := db.Exec("UPDATE workspace_memories SET content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", content, id)
+	if err != nil {
+		return fmt.Errorf("failed to update memory %d: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to update memory %d: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// DeleteMemory deletes a memory.
+func DeleteMemory(db *Database, id int) error {
+	result, err := db.Exec("DELETE FROM workspace_memories WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete memory %d: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to delete memory %d: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
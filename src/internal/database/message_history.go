@@ -54,6 +54,7 @@ func getSessionHistoryInternal(
 
 	// History alteration flags
 	var compressUpToID int = 0
+	var compressionSeen bool = false
 	var clearSeen bool = false
 	var clearblobsSeen bool = false
 
@@ -143,7 +144,8 @@ func getSessionHistoryInternal(
 					if found {
 						parsedID, err := strconv.Atoi(before)
 						if err == nil {
-							compressUpToID = parsedID
+							// Later compressions cover earlier ones
+							compressUpToID = max(compressUpToID, parsedID)
 						} else {
 							log.Printf("Warning: Failed to parse CompressedUpToMessageId from compression message %d: %v", m.ID, err)
 						}
@@ -204,8 +206,14 @@ func getSessionHistoryInternal(
 					}
 
 					// Apply filtering based on current flags (processed in reverse order)
-					// Skip messages before compression (except the compression message itself)
-					if msgID <= compressUpToID && msg.Type != TypeCompression {
+					// Skip messages before compression (except the last compression message itself,
+					// whose summary covers earlier compressions)
+					if msg.Type == TypeCompression {
+						if compressionSeen {
+							continue
+						}
+						compressionSeen = true
+					} else if msgID <= compressUpToID {
 						continue
 					}
 
@@ -677,8 +677,11 @@ func PopulateSearchIndex(mainDB *sql.DB, sessionDB *sql.DB, sessionIDs []string)
 
 	// Prepare insert statement for search index
 	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO messages_searchable (id, text, session_id, workspace_id)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO messages_searchable (text, session_id, workspace_id, message_id, type, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(session_id, message_id) DO UPDATE SET
+			text = excluded.text, workspace_id = excluded.workspace_id,
+			type = excluded.type, created_at = excluded.created_at
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare insert statement: %w", err)
@@ -730,10 +733,12 @@ func PopulateSearchIndex(mainDB *sql.DB, sessionDB *sql.DB, sessionIDs []string)
 
 		// Insert into search index with full session ID
 		_, err = stmt.Exec(
-			id,
 			nullString(text),
 			fullSessionID,
 			nullString(workspaceID),
+			id,
+			nullString(msgType),
+			nullString(createdAt),
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert search index entry for message %d: %w", id, err)
@@ -757,6 +762,22 @@ func PopulateSearchIndex(mainDB *sql.DB, sessionDB *sql.DB, sessionIDs []string)
 	return nil
 }
 
+// syncSessionFTSTables adds messages_searchable entries of a session and its sub-sessions missing from FTS5 virtual tables.
+func syncSessionFTSTables(db *Database, mainSessionID string) error {
+	for _, table := range []string{"message_stems", "message_trigrams"} {
+		_, err := db.Exec(fmt.Sprintf(`
+			INSERT INTO %[1]s(rowid, text, session_id, workspace_id)
+			SELECT id, text, session_id, workspace_id FROM messages_searchable
+			WHERE (session_id = ? OR session_id LIKE ? || '.%%')
+				AND NOT EXISTS (SELECT 1 FROM %[1]s WHERE rowid = messages_searchable.id)
+		`, table), mainSessionID, mainSessionID)
+		if err != nil {
+			return fmt.Errorf("failed to sync %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
 // syncFTSTables syncs the messages_searchable with FTS5 virtual tables.
 func syncFTSTables(mainDB *sql.DB) error {
 	// Insert into message_stems
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// hasQueuedMessagesTable checks if the session DB has the queued_messages table.
+// Older session DBs may not have the table yet.
+func hasQueuedMessagesTable(db *SessionDatabase) (bool, error) {
+	var tableExists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM S.sqlite_master WHERE type = 'table' AND name = 'queued_messages'").Scan(&tableExists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check queued_messages table: %w", err)
+	}
+	return tableExists, nil
+}
+
+// AddQueuedMessage appends a user message to the queue of the session.
+// Attachment data is kept in the queue until the message gets actually sent.
+func AddQueuedMessage(db *SessionDatabase, text string, attachments []FileAttachment, model string) (QueuedMessage, error) {
+	if _, err := db.Exec(createQueuedMessagesSQL); err != nil {
+		return QueuedMessage{}, fmt.Errorf("failed to create queued_messages table: %w", err)
+	}
+
+	for i := range attachments {
+		if attachments[i].Data != nil {
+			attachments[i].Hash = BlobHash(attachments[i].Data)
+		}
+	}
+	var attachmentsJSON sql.NullString
+	if len(attachments) > 0 {
+		encoded, err := json.Marshal(attachments)
+		if err != nil {
+			return QueuedMessage{}, fmt.Errorf("failed to marshal attachments: %w", err)
+		}
+		attachmentsJSON = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	result, err := db.Exec("INSERT INTO S.queued_messages (session_id, text, attachments, model) VALUES (?, ?, ?, ?)",
+		db.LocalSessionId(), text, attachmentsJSON, model)
+	if err != nil {
+		return QueuedMessage{}, fmt.Errorf("failed to add queued message: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return QueuedMessage{}, fmt.Errorf("failed to get queued message ID: %w", err)
+	}
+	return getQueuedMessage(db, int(id))
+}
+
+// scanQueuedMessage scans a row of queued_messages. Attachment data is only kept if withData is true.
+func scanQueuedMessage(scan func(dest ...any) error, withData bool) (QueuedMessage, error) {
+	var m QueuedMessage
+	var attachmentsJSON sql.NullString
+	if err := scan(&m.ID, &m.Text, &attachmentsJSON, &m.Model, &m.CreatedAt); err != nil {
+		return m, err
+	}
+	if attachmentsJSON.Valid {
+		if err := json.Unmarshal([]byte(attachmentsJSON.String), &m.Attachments); err != nil {
+			return m, fmt.Errorf("failed to unmarshal attachments of queued message %d: %w", m.ID, err)
+		}
+	}
+	if !withData {
+		for i := range m.Attachments {
+			m.Attachments[i].Data = nil
+		}
+	}
+	return m, nil
+}
+
+// getQueuedMessage retrieves a queued message without attachment data.
+func getQueuedMessage(db *SessionDatabase, id int) (QueuedMessage, error) {
+	row := db.QueryRow("SELECT id, text, attachments, model, created_at FROM S.queued_messages WHERE session_id = ? AND id = ?",
+		db.LocalSessionId(), id)
+	m, err := scanQueuedMessage(row.Scan, false)
+	if err != nil {
+		return m, fmt.Errorf("failed to get queued message %d: %w", id, err)
+	}
+	return m, nil
+}
+
+// GetQueuedMessages retrieves all queued messages of the session in the order of sending.
+// Attachments are returned without their data.
+func GetQueuedMessages(db *SessionDatabase) ([]QueuedMessage, error) {
+	messages := []QueuedMessage{}
+	if exists, err := hasQueuedMessagesTable(db); err != nil || !exists {
+		return messages, err
+	}
+
+	rows, err := db.Query("SELECT id, text, attachments, model, created_at FROM S.queued_messages WHERE session_id = ? ORDER BY id",
+		db.LocalSessionId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queued messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanQueuedMessage(rows.Scan, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan queued message: %w", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// UpdateQueuedMessage replaces the text of a queued message.
+// Returns sql.ErrNoRows (wrapped) if the message is not queued anymore.
+func UpdateQueuedMessage(db *SessionDatabase, id int, text string) (QueuedMessage, error) {
+	if exists, err := hasQueuedMessagesTable(db); err != nil {
+		return QueuedMessage{}, err
+	} else if !exists {
+		return QueuedMessage{}, fmt.Errorf("failed to update queued message %d: %w", id, sql.ErrNoRows)
+	}
+
+	result, err := db.Exec("UPDATE S.queued_messages SET text = ? WHERE session_id = ? AND id = ?", text, db.LocalSessionId(), id)
+	if err != nil {
+		return QueuedMessage{}, fmt.Errorf("failed to update queued message %d: %w", id, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return QueuedMessage{}, fmt.Errorf("failed to update queued message %d: %w", id, sql.ErrNoRows)
+	}
+	return getQueuedMessage(db, id)
+}
+
+// DeleteQueuedMessage cancels a queued message.
+// Returns sql.ErrNoRows (wrapped) if the message is not queued anymore.
+func DeleteQueuedMessage(db *SessionDatabase, id int) error {
+	if exists, err := hasQueuedMessagesTable(db); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("failed to delete queued message %d: %w", id, sql.ErrNoRows)
+	}
+
+	result, err := db.Exec("DELETE FROM S.queued_messages WHERE session_id = ? AND id = ?", db.LocalSessionId(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete queued message %d: %w", id, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("failed to delete queued message %d: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// PopQueuedMessage removes the first queued message of the session and returns it with attachment data.
+// Returns nil if there is no queued message.
+func PopQueuedMessage(db *SessionDatabase) (*QueuedMessage, error) {
+	if exists, err := hasQueuedMessagesTable(db); err != nil || !exists {
+		return nil, err
+	}
+
+	row := db.QueryRow("SELECT id, text, attachments, model, created_at FROM S.queued_messages WHERE session_id = ? ORDER BY id LIMIT 1",
+		db.LocalSessionId())
+	m, err := scanQueuedMessage(row.Scan, true)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get next queued message: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM S.queued_messages WHERE id = ?", m.ID); err != nil {
+		return nil, fmt.Errorf("failed to remove queued message %d: %w", m.ID, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+const scheduledPromptColumns = "id, name, schedule, prompt, workspace_id, session_id, model, system_prompt, tools, enabled, created_at"
+
+const scheduledPromptRunColumns = "id, scheduled_prompt_id, session_id, status, error, started_at, COALESCE(finished_at, '')"
+
+func scanScheduledPrompt(row interface{ Scan(...any) error }) (ScheduledPrompt, error) {
+	var sp ScheduledPrompt
+	var toolsJSON string
+	err := row.Scan(&sp.ID, &sp.Name, &sp.Schedule, &sp.Prompt, &sp.WorkspaceID, &sp.SessionID,
+		&sp.Model, &sp.SystemPrompt, &toolsJSON, &sp.Enabled, &sp.CreatedAt)
+	if err != nil {
+		return sp, err
+	}
+	if err := json.Unmarshal([]byte(toolsJSON), &sp.Tools); err != nil {
+		return sp, fmt.Errorf("failed to unmarshal tools of scheduled prompt %d: %w", sp.ID, err)
+	}
+	return sp, nil
+}
+
+func scanScheduledPromptRun(row interface{ Scan(...any) error }) (ScheduledPromptRun, error) {
+	var run ScheduledPromptRun
+	err := row.Scan(&run.ID, &run.ScheduledPromptID, &run.SessionID, &run.Status, &run.Error, &run.StartedAt, &run.FinishedAt)
+	return run, err
+}
+
+func marshalTools(tools []string) string {
+	if tools == nil {
+		tools = []string{}
+	}
+	toolsJSON, _ := json.Marshal(tools)
+	return string(toolsJSON)
+}
+
+// AddScheduledPrompt stores a new scheduled prompt. The schedule should have been validated by the caller.
+func AddScheduledPrompt(db *Database, sp ScheduledPrompt) (ScheduledPrompt, error) {
+	result, err := db.Exec(`
+		INSERT INTO scheduled_prompts (name, schedule, prompt, workspace_id, session_id, model, system_prompt, tools, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sp.Name, sp.Schedule, sp.Prompt, sp.WorkspaceID, sp.SessionID, sp.Model, sp.SystemPrompt, marshalTools(sp.Tools), sp.Enabled)
+	if err != nil {
+		return ScheduledPrompt{}, fmt.Errorf("failed to add scheduled prompt: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return ScheduledPrompt{}, fmt.Errorf("failed to get scheduled prompt ID: %w", err)
+	}
+	return GetScheduledPrompt(db, int(id))
+}
+
+// GetScheduledPrompt retrieves a scheduled prompt by its ID. Returns sql.ErrNoRows (wrapped) if there is no such prompt.
+func GetScheduledPrompt(db *Database, id int) (ScheduledPrompt, error) {
+	sp, err := scanScheduledPrompt(db.QueryRow("SELECT "+scheduledPromptColumns+" FROM scheduled_prompts WHERE id = ?", id))
+	if err != nil {
+		return sp, fmt.Errorf("failed to get scheduled prompt %d: %w", id, err)
+	}
+	return sp, nil
+}
+
+// GetScheduledPrompts retrieves all scheduled prompts in the order of creation.
+func GetScheduledPrompts(db *Database) ([]ScheduledPrompt, error) {
+	rows, err := db.Query("SELECT " + scheduledPromptColumns + " FROM scheduled_prompts ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled prompts: %w", err)
+	}
+	defer rows.Close()
+
+	prompts := []ScheduledPrompt{}
+	for rows.Next() {
+		sp, err := scanScheduledPrompt(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled prompt: %w", err)
+		}
+		prompts = append(prompts, sp)
+	}
+	return prompts, rows.Err()
+}
+
+// UpdateScheduledPrompt replaces all user-editable fields of a scheduled prompt.
+func UpdateScheduledPrompt(db *Database, sp ScheduledPrompt) error {
+	result, err := db.Exec(`
+		UPDATE scheduled_prompts
+		SET name = ?, schedule = ?, prompt = ?, workspace_id = ?, session_id = ?, model = ?, system_prompt = ?, tools = ?, enabled = ?
+		WHERE id = ?`,
+		sp.Name, sp.Schedule, sp.Prompt, sp.WorkspaceID, sp.SessionID, sp.Model, sp.SystemPrompt, marshalTools(sp.Tools), sp.Enabled, sp.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update scheduled prompt %d: %w", sp.ID, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to update scheduled prompt %d: %w", sp.ID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// DeleteScheduledPrompt deletes a scheduled prompt along with its run history.
+func DeleteScheduledPrompt(db *Database, id int) error {
+	result, err := db.Exec("DELETE FROM scheduled_prompts WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled prompt %d: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to delete scheduled prompt %d: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// AddScheduledPromptRun records the start of a run of the scheduled prompt.
+func AddScheduledPromptRun(db *Database, scheduledPromptID int) (ScheduledPromptRun, error) {
+	result, err := db.Exec("INSERT INTO scheduled_prompt_runs (scheduled_prompt_id, status) VALUES (?, ?)",
+		scheduledPromptID, ScheduledRunRunning)
+	if err != nil {
+		return ScheduledPromptRun{}, fmt.Errorf("failed to add run of scheduled prompt %d: %w", scheduledPromptID, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return ScheduledPromptRun{}, fmt.Errorf("failed to get scheduled prompt run ID: %w", err)
+	}
+	return GetScheduledPromptRun(db, int(id))
+}
+
+// GetScheduledPromptRun retrieves a run of a scheduled prompt by its ID.
+func GetScheduledPromptRun(db *Database, id int) (ScheduledPromptRun, error) {
+	run, err := scanScheduledPromptRun(db.QueryRow("SELECT "+scheduledPromptRunColumns+" FROM scheduled_prompt_runs WHERE id = ?", id))
+	if err != nil {
+		return run, fmt.Errorf("failed to get scheduled prompt run %d: %w", id, err)
+	}
+	return run, nil
+}
+
+// FinishScheduledPromptRun records the outcome of a run. The run has failed if errorMessage is not empty.
+func FinishScheduledPromptRun(db *Database, id int, sessionID string, errorMessage string) (ScheduledPromptRun, error) {
+	status := ScheduledRunSucceeded
+	if errorMessage != "" {
+		status = ScheduledRunFailed
+	}
+	_, err := db.Exec(`
+		UPDATE scheduled_prompt_runs SET session_id = ?, status = ?, error = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, sessionID, status, errorMessage, id)
+	if err != nil {
+		return ScheduledPromptRun{}, fmt.Errorf("failed to finish scheduled prompt run %d: %w", id, err)
+	}
+	return GetScheduledPromptRun(db, id)
+}
+
+// GetScheduledPromptRuns retrieves up to limit most recent runs of the scheduled prompt, newest first.
+func GetScheduledPromptRuns(db *Database, scheduledPromptID int, limit int) ([]ScheduledPromptRun, error) {
+	rows, err := db.Query(
+		"SELECT "+scheduledPromptRunColumns+" FROM scheduled_prompt_runs WHERE scheduled_prompt_id = ? ORDER BY id DESC LIMIT ?",
+		scheduledPromptID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runs of scheduled prompt %d: %w", scheduledPromptID, err)
+	}
+	defer rows.Close()
+
+	runs := []ScheduledPromptRun{}
+	for rows.Next() {
+		run, err := scanScheduledPromptRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled prompt run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// CleanupStaleScheduledPromptRuns marks runs left running by a previous process as failed.
+func CleanupStaleScheduledPromptRuns(db *Database) error {
+	_, err := db.Exec(`
+		UPDATE scheduled_prompt_runs SET status = ?, error = 'interrupted by a server restart', finished_at = CURRENT_TIMESTAMP
+		WHERE status = ?`, ScheduledRunFailed, ScheduledRunRunning)
+	if err != nil {
+		return fmt.Errorf("failed to clean up stale scheduled prompt runs: %w", err)
+	}
+	return nil
+}
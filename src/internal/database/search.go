@@ -2,12 +2,14 @@ package database
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 // SearchResult represents a single search result
 type SearchResult struct {
-	MessageID   int    `json:"message_id"`
+	MessageID   int    `json:"message_id"` // ID of the search index entry, unique across sessions
 	SessionID   string `json:"session_id"`
 	Excerpt     string `json:"excerpt"`
 	Type        string `json:"type"`
@@ -16,6 +18,19 @@ type SearchResult struct {
 	WorkspaceID string `json:"workspace_id,omitempty"`
 }
 
+// ftsExcerptFormat is the excerpt of a match in the FTS table given as %[1]s.
+// SI/SO are converted back to HTML tags, which are then escaped for safe display.
+const ftsExcerptFormat = `replace(
+				replace(
+					replace(
+						snippet(%[1]s, 0, '<mark>', '</mark>', '...', 64),
+						'&', '&amp;'
+					),
+					'\x0e', '&lt;'
+				),
+				'\x0f', '&gt;'
+			)`
+
 // SearchMessages searches for messages matching the query using FTS5 tables
 func SearchMessages(db *Database, query string, maxID int, limit int, workspaceID string) ([]SearchResult, bool, error) {
 	// Validate query
@@ -38,17 +53,7 @@ func SearchMessages(db *Database, query string, maxID int, limit int, workspaceI
 			rowid as id,
 			session_id,
 			workspace_id,
-			-- Convert SI/SO back to HTML tags, then escape for safe display
-			replace(
-				replace(
-					replace(
-						snippet(%s, 0, '<mark>', '</mark>', '...', 64),
-						'&', '&amp;'
-					),
-					'\x0e', '&lt;'
-				),
-				'\x0f', '&gt;'
-			) as excerpt,
+			` + ftsExcerptFormat + ` as excerpt,
 			%d as source_order -- Add source order to identify which table this came from (stems=0, trigrams=1)
 		FROM %[1]s WHERE %[1]s MATCH ?
 	`
@@ -77,10 +82,10 @@ func SearchMessages(db *Database, query string, maxID int, limit int, workspaceI
 			m.session_id,
 			fts.excerpt,
 			m.type,
-			m.created_at,
+			COALESCE(m.created_at, '') as created_at,
 			COALESCE(s.name, '') as session_name,
-			fts.workspace_id
-		FROM messages m
+			COALESCE(m.workspace_id, '') as workspace_id
+		FROM messages_searchable m
 		JOIN sessions s ON m.session_id = s.id
 		JOIN (` + searchSubQuery + `) fts ON m.id = fts.id
 	`
@@ -128,3 +133,221 @@ func SearchMessages(db *Database, query string, maxID int, limit int, workspaceI
 
 	return results, hasMore, nil
 }
+
+// Parameters of reciprocal rank fusion in SearchMessagesHybrid
+const (
+	hybridRankConstant  = 60  // Dampens the weight of top ranks in each ranking
+	hybridMinCandidates = 100 // Minimum number of candidates taken from each ranking
+)
+
+// hybridExcerptFormat is the excerpt of an entry in messages_searchable given as %[1]s, used when no keywords match
+const hybridExcerptFormat = `replace(
+				replace(
+					replace(
+						substr(replace(replace(%[1]s.text, '\x0e', '<'), '\x0f', '>'), 1, 256),
+						'&', '&amp;'
+					),
+					'<', '&lt;'
+				),
+				'>', '&gt;'
+			) || CASE WHEN length(%[1]s.text) > 256 THEN '...' ELSE '' END`
+
+// hybridFTSQuery converts a free-form query into an FTS5 query matching any of its words
+func hybridFTSQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, word := range words {
+		words[i] = `"` + word + `"`
+	}
+	return strings.Join(words, " OR ")
+}
+
+// queryRanking returns IDs in the order returned by the query
+func queryRanking(db *Database, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SearchMessagesHybrid searches for messages by combining the keyword rankings of FTS5 tables
+// and, if embedding is given, the semantic ranking of message_embeddings computed for the given index
+// with reciprocal rank fusion. Results are ordered by relevance, so pages are given by offset.
+func SearchMessagesHybrid(db *Database, query string, index string, embedding []float32, offset int, limit int, workspaceID string) ([]SearchResult, bool, error) {
+	// Validate query
+	if strings.TrimSpace(query) == "" {
+		return nil, false, fmt.Errorf("search query cannot be empty")
+	}
+
+	// Set default limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100 // Cap at 100 for performance
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	candidates := max(hybridMinCandidates, offset+limit+1)
+
+	var rankings [][]int
+	ftsQuery := hybridFTSQuery(query)
+	if ftsQuery != "" {
+		for _, table := range []string{"message_stems", "message_trigrams"} {
+			rankingQuery := fmt.Sprintf("SELECT rowid FROM %[1]s WHERE %[1]s MATCH ?", table)
+			args := []interface{}{ftsQuery}
+			if workspaceID != "" {
+				rankingQuery += " AND workspace_id = ?"
+				args = append(args, workspaceID)
+			}
+			ranking, err := queryRanking(db, rankingQuery+" ORDER BY rank LIMIT ?", append(args, candidates)...)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to search messages: %w", err)
+			}
+			rankings = append(rankings, ranking)
+		}
+	}
+
+	if embedding != nil {
+		ready, err := HasMessageEmbeddings(db, index)
+		if err != nil {
+			return nil, false, err
+		}
+		if ready {
+			rankingQuery := "SELECT rowid FROM message_embeddings WHERE embedding MATCH ? AND k = ?"
+			args := []interface{}{serializeEmbedding(embedding), candidates}
+			if workspaceID != "" {
+				rankingQuery += " AND rowid IN (SELECT id FROM messages_searchable WHERE workspace_id = ?)"
+				args = append(args, workspaceID)
+			}
+			ranking, err := queryRanking(db, rankingQuery+" ORDER BY distance", args...)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to search message embeddings: %w", err)
+			}
+			rankings = append(rankings, ranking)
+		}
+	}
+
+	scores := make(map[int]float64)
+	for _, ranking := range rankings {
+		for rank, id := range ranking {
+			scores[id] += 1.0 / float64(hybridRankConstant+rank+1)
+		}
+	}
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+
+	hasMore := len(ids) > offset+limit
+	if offset >= len(ids) {
+		return nil, hasMore, nil
+	}
+	ids = ids[offset:min(offset+limit, len(ids))]
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	idArgs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		idArgs[i] = id
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			m.id,
+			m.session_id,
+			`+fmt.Sprintf(hybridExcerptFormat, "m")+` as excerpt,
+			m.type,
+			COALESCE(m.created_at, '') as created_at,
+			COALESCE(s.name, '') as session_name,
+			COALESCE(m.workspace_id, '') as workspace_id
+		FROM messages_searchable m
+		JOIN sessions s ON m.session_id = s.id
+		WHERE m.id IN (`+placeholders+`)`, idArgs...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	found := make(map[int]*SearchResult)
+	for rows.Next() {
+		var result SearchResult
+		err := rows.Scan(
+			&result.MessageID,
+			&result.SessionID,
+			&result.Excerpt,
+			&result.Type,
+			&result.CreatedAt,
+			&result.SessionName,
+			&result.WorkspaceID,
+		)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		found[result.MessageID] = &result
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	// Prefer keyword snippets from stems over trigrams, as SearchMessages does
+	if ftsQuery != "" {
+		highlighted := make(map[int]bool)
+		for _, table := range []string{"message_stems", "message_trigrams"} {
+			snippetRows, err := db.Query(fmt.Sprintf("SELECT rowid, "+ftsExcerptFormat+" FROM %[1]s WHERE %[1]s MATCH ? AND rowid IN (", table)+placeholders+")",
+				append([]interface{}{ftsQuery}, idArgs...)...)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to get search excerpts: %w", err)
+			}
+			for snippetRows.Next() {
+				var id int
+				var excerpt string
+				if err := snippetRows.Scan(&id, &excerpt); err != nil {
+					snippetRows.Close()
+					return nil, false, fmt.Errorf("failed to scan search excerpt: %w", err)
+				}
+				if result := found[id]; result != nil && !highlighted[id] {
+					result.Excerpt = excerpt
+					highlighted[id] = true
+				}
+			}
+			snippetRows.Close()
+		}
+	}
+
+	results := make([]SearchResult, 0, len(ids))
+	for _, id := range ids {
+		if result := found[id]; result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results, hasMore, nil
+}
+
+// GetSearchResultMessage returns the session ID and the message ID in the session DB
+// for the message ID of a search result, which is unique across sessions.
+func GetSearchResultMessage(db *Database, searchMessageID int) (sessionID string, messageID int, err error) {
+	err = db.QueryRow("SELECT session_id, message_id FROM messages_searchable WHERE id = ?", searchMessageID).Scan(&sessionID, &messageID)
+	if err != nil {
+		err = fmt.Errorf("failed to get search result message %d: %w", searchMessageID, err)
+	}
+	return
+}
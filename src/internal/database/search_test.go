@@ -0,0 +1,215 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSearchIndexAcrossSessions tests that messages with the same ID in different session DBs are indexed separately.
+func TestSearchIndexAcrossSessions(t *testing.T) {
+	db, err := InitTestDB(t.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	tempDir := t.TempDir()
+	for _, session := range []struct{ id, text string }{
+		{"session1", "The <b>quick</b> brown fox"},
+		{"session2", "A quick sort of the list"},
+	} {
+		path := filepath.Join(tempDir, session.id+".db")
+		createTestSessionDBWithMessage(t, path, "workspace1", "", "user", session.text)
+		sessionDB, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatalf("Failed to open session database: %v", err)
+		}
+		_, err = sessionDB.Exec("INSERT INTO sessions (id, workspace_id) VALUES ('', 'workspace1')")
+		sessionDB.Close()
+		if err != nil {
+			t.Fatalf("Failed to insert session: %v", err)
+		}
+		// Sync twice, as the session watcher does on every change
+		for range 2 {
+			if err := syncSessionToMainDB(db, session.id, path); err != nil {
+				t.Fatalf("Failed to sync %s: %v", session.id, err)
+			}
+		}
+	}
+
+	results, hasMore, err := SearchMessages(db, "quick", 0, 10, "")
+	if err != nil {
+		t.Fatalf("SearchMessages failed: %v", err)
+	}
+	if len(results) != 2 || hasMore {
+		t.Fatalf("Expected 2 results, got %+v (hasMore=%v)", results, hasMore)
+	}
+	if results[0].SessionID != "session2" || results[1].SessionID != "session1" {
+		t.Errorf("Expected newest results first, got %+v", results)
+	}
+	if results[1].Type != "user" || results[1].CreatedAt == "" || results[1].WorkspaceID != "workspace1" {
+		t.Errorf("Unexpected result metadata: %+v", results[1])
+	}
+	if !strings.Contains(results[1].Excerpt, "&lt;b&gt;<mark>quick</mark>&lt;/b&gt;") {
+		t.Errorf("Expected an escaped excerpt, got %q", results[1].Excerpt)
+	}
+}
+
+// TestSearchIndexAfterEdit tests that edited messages are indexed and embedded again.
+func TestSearchIndexAfterEdit(t *testing.T) {
+	db, err := InitTestDB(t.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "session1.db")
+	createTestSessionDBWithMessage(t, path, "workspace1", "", "user", "Tell me about elephants")
+	if err := syncSessionToMainDB(db, "session1", path); err != nil {
+		t.Fatalf("Failed to sync session: %v", err)
+	}
+	pending, err := GetUnembeddedMessages(db, "model-a", 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected 1 unembedded message, got %+v (%v)", pending, err)
+	}
+	if err := SaveMessageEmbeddings(db, "model-a", []int{pending[0].ID}, [][]float32{{1, 0}}); err != nil {
+		t.Fatalf("SaveMessageEmbeddings failed: %v", err)
+	}
+
+	sessionDB, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open session database: %v", err)
+	}
+	_, err = sessionDB.Exec("INSERT INTO sessions (id, workspace_id) VALUES ('', 'workspace1')")
+	if err == nil {
+		_, err = sessionDB.Exec("UPDATE messages SET text = 'Tell me about giraffes'")
+	}
+	sessionDB.Close()
+	if err != nil {
+		t.Fatalf("Failed to edit message: %v", err)
+	}
+	if err := syncSessionToMainDB(db, "session1", path); err != nil {
+		t.Fatalf("Failed to sync session: %v", err)
+	}
+
+	for _, query := range []string{"giraffes", "giraf"} {
+		results, _, err := SearchMessages(db, query, 0, 10, "")
+		if err != nil {
+			t.Fatalf("SearchMessages failed: %v", err)
+		}
+		if len(results) != 1 || !strings.Contains(results[0].Excerpt, "<mark>giraf") {
+			t.Errorf("Expected the edited message for %q, got %+v", query, results)
+		}
+	}
+	if results, _, err := SearchMessages(db, "elephants", 0, 10, ""); err != nil || len(results) != 0 {
+		t.Errorf("Expected no results for the old text, got %+v (%v)", results, err)
+	}
+
+	pending, err = GetUnembeddedMessages(db, "model-a", 10)
+	if err != nil || len(pending) != 1 || pending[0].Text != "Tell me about giraffes" {
+		t.Errorf("Expected the edited message to be embedded again, got %+v (%v)", pending, err)
+	}
+}
+
+func TestSearchMessagesHybrid(t *testing.T) {
+	db, err := InitTestDB(t.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT INTO sessions (id, name, workspace_id) VALUES ('s1', 'Pets', 'w1'), ('s2', 'Cooking', 'w2')"); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	texts := []struct {
+		sessionID, workspaceID, text string
+	}{
+		{"s1", "w1", "My cat likes to sleep on the sofa"},
+		{"s1", "w1", "Dogs need a walk every day"},
+		{"s2", "w2", "Boil the pasta for ten minutes"},
+		{"s1", "w1", "   "},
+	}
+	for i, m := range texts {
+		_, err := db.Exec("INSERT INTO messages_searchable (text, session_id, workspace_id, message_id, type, created_at) VALUES (?, ?, ?, ?, 'user', '2025-01-01 00:00:00')",
+			m.text, m.sessionID, m.workspaceID, i+1)
+		if err != nil {
+			t.Fatalf("Failed to insert message: %v", err)
+		}
+	}
+	for _, sessionID := range []string{"s1", "s2"} {
+		if err := syncSessionFTSTables(db, sessionID); err != nil {
+			t.Fatalf("Failed to sync FTS tables: %v", err)
+		}
+	}
+
+	// Without embeddings, only keywords are ranked
+	results, _, err := SearchMessagesHybrid(db, "cat nap", "model-a", []float32{1, 0, 0}, 0, 10, "")
+	if err != nil {
+		t.Fatalf("SearchMessagesHybrid failed: %v", err)
+	}
+	if len(results) != 1 || results[0].MessageID != 1 || !strings.Contains(results[0].Excerpt, "<mark>cat</mark>") {
+		t.Fatalf("Expected the keyword match only, got %+v", results)
+	}
+
+	// Blank messages are not embedded
+	pending, err := GetUnembeddedMessages(db, "model-a", 10)
+	if err != nil {
+		t.Fatalf("GetUnembeddedMessages failed: %v", err)
+	}
+	if len(pending) != 3 || pending[0].ID != 3 || pending[2].Text != texts[0].text {
+		t.Fatalf("Unexpected unembedded messages: %+v", pending)
+	}
+	embeddings := map[int][]float32{1: {1, 0, 0}, 2: {0.8, 0.6, 0}, 3: {0, 0, 1}}
+	for _, m := range pending {
+		if err := SaveMessageEmbeddings(db, "model-a", []int{m.ID}, [][]float32{embeddings[m.ID]}); err != nil {
+			t.Fatalf("SaveMessageEmbeddings failed: %v", err)
+		}
+	}
+	if pending, err := GetUnembeddedMessages(db, "model-a", 10); err != nil || len(pending) != 0 {
+		t.Fatalf("Expected no unembedded messages, got %+v (%v)", pending, err)
+	}
+
+	// A semantic match without keywords is ranked after the keyword match, and unrelated messages are ranked last
+	results, hasMore, err := SearchMessagesHybrid(db, "cat nap", "model-a", []float32{0.9, 0.4, 0}, 0, 2, "")
+	if err != nil {
+		t.Fatalf("SearchMessagesHybrid failed: %v", err)
+	}
+	if len(results) != 2 || results[0].MessageID != 1 || results[1].MessageID != 2 || !hasMore {
+		t.Fatalf("Unexpected hybrid results: %+v (hasMore=%v)", results, hasMore)
+	}
+	if results[1].Excerpt != "Dogs need a walk every day" || results[1].SessionName != "Pets" {
+		t.Errorf("Unexpected semantic match: %+v", results[1])
+	}
+	results, hasMore, err = SearchMessagesHybrid(db, "cat nap", "model-a", []float32{0.9, 0.4, 0}, 2, 2, "")
+	if err != nil || len(results) != 1 || results[0].MessageID != 3 || hasMore {
+		t.Fatalf("Unexpected second page: %+v (hasMore=%v, %v)", results, hasMore, err)
+	}
+
+	// Workspaces filter both rankings
+	results, _, err = SearchMessagesHybrid(db, "pasta", "model-a", []float32{1, 0, 0}, 0, 10, "w1")
+	if err != nil || len(results) != 2 || results[0].MessageID != 1 {
+		t.Fatalf("Unexpected results in a workspace: %+v (%v)", results, err)
+	}
+
+	// Embeddings from another model are ignored, and discarded once embedding resumes
+	results, _, err = SearchMessagesHybrid(db, "sleep", "model-b", []float32{0, 0, 1}, 0, 10, "")
+	if err != nil || len(results) != 1 || results[0].MessageID != 1 {
+		t.Fatalf("Expected embeddings of another model to be ignored, got %+v (%v)", results, err)
+	}
+	if pending, err := GetUnembeddedMessages(db, "model-b", 10); err != nil || len(pending) != 3 {
+		t.Fatalf("Expected all messages to be embedded again, got %+v (%v)", pending, err)
+	}
+	if err := SaveMessageEmbeddings(db, "model-b", []int{1, 2}, [][]float32{{1, 0}, {0, 1}}); err != nil {
+		t.Fatalf("SaveMessageEmbeddings failed: %v", err)
+	}
+
+	// Embeddings of removed messages are pruned
+	if _, err := db.Exec("DELETE FROM messages_searchable WHERE id = 2"); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if pruned, err := PruneMessageEmbeddings(db); err != nil || pruned != 1 {
+		t.Errorf("Expected 1 pruned embedding, got %d (%v)", pruned, err)
+	}
+}
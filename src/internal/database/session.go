@@ -437,6 +437,24 @@ func DeleteWorkspace(db *Database, workspaceID string) error {
 		return fmt.Errorf("failed to delete sessions for workspace %s: %w", workspaceID, err)
 	}
 
+	// Delete memories of the workspace
+	_, err = tx.Exec("DELETE FROM workspace_memories WHERE workspace_id = ?", workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete memories for workspace %s: %w", workspaceID, err)
+	}
+
+	// Delete scheduled prompts of the workspace, whose runs are deleted by ON DELETE CASCADE
+	_, err = tx.Exec("DELETE FROM scheduled_prompts WHERE workspace_id = ?", workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled prompts for workspace %s: %w", workspaceID, err)
+	}
+
+	// Delete workspace configurations
+	_, err = tx.Exec("DELETE FROM workspace_configs WHERE workspace_id = ?", workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete configs for workspace %s: %w", workspaceID, err)
+	}
+
 	// Delete the workspace itself
 	_, err = tx.Exec("DELETE FROM workspaces WHERE id = ?", workspaceID)
 	if err != nil {
@@ -573,6 +591,48 @@ func UpdateSessionWorkspace(db *SessionDatabase, workspaceID string) error {
 	return nil
 }
 
+// GetSessionGenParams retrieves the generation parameter overrides of a session as JSON.
+// Returns an empty string if the session has no overrides.
+func GetSessionGenParams(db *SessionDatabase) (string, error) {
+	// Older session DBs may not have the table yet
+	var tableExists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM S.sqlite_master WHERE type = 'table' AND name = 'session_gen_params'").Scan(&tableExists)
+	if err != nil {
+		return "", fmt.Errorf("failed to check session_gen_params table: %w", err)
+	}
+	if !tableExists {
+		return "", nil
+	}
+
+	var params string
+	err = db.QueryRow("SELECT params FROM S.session_gen_params WHERE session_id = ?", db.LocalSessionId()).Scan(&params)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get session generation params: %w", err)
+	}
+	return params, nil
+}
+
+// UpdateSessionGenParams sets the generation parameter overrides of a session as JSON.
+// An empty string removes the overrides.
+func UpdateSessionGenParams(db *SessionDatabase, params string) error {
+	if _, err := db.Exec(createSessionGenParamsSQL); err != nil {
+		return fmt.Errorf("failed to create session_gen_params table: %w", err)
+	}
+
+	var err error
+	if params == "" {
+		_, err = db.Exec("DELETE FROM S.session_gen_params WHERE session_id = ?", db.LocalSessionId())
+	} else {
+		_, err = db.Exec("INSERT OR REPLACE INTO S.session_gen_params (session_id, params) VALUES (?, ?)", db.LocalSessionId(), params)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update session generation params: %w", err)
+	}
+	return nil
+}
+
 // GetWorkspaceAndSessions retrieves a workspace and all its sessions.
 func GetWorkspaceAndSessions(db *Database, workspaceID string) (*WorkspaceWithSessions, error) {
 	var wsWithSessions WorkspaceWithSessions
@@ -808,6 +868,31 @@ func CleanupOldTemporarySessions(db *Database, olderThan time.Duration, sandboxB
 	return nil
 }
 
+// GetUnarchivedMainSessionIDs returns IDs of all unarchived main sessions, including temporary ones.
+// Each of them corresponds to a session DB which can be opened with WithWritableSession.
+func GetUnarchivedMainSessionIDs(db *Database) ([]string, error) {
+	rows, err := db.Query("SELECT id FROM sessions WHERE archived = 0 ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unarchived sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var mainSessionIDs []string
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, fmt.Errorf("failed to scan session ID: %w", err)
+		}
+		mainSessionID, _ := SplitSessionId(sessionID)
+		if !seen[mainSessionID] {
+			seen[mainSessionID] = true
+			mainSessionIDs = append(mainSessionIDs, mainSessionID)
+		}
+	}
+	return mainSessionIDs, rows.Err()
+}
+
 // GetSessionsWithDetails retrieves sessions with additional details including first message date and last message preview.
 // Filters by workspace if workspaceID is provided.
 func GetSessionsWithDetails(db *Database, workspaceID string) ([]SessionWithDetails, error) {
@@ -139,6 +139,66 @@ const createSessionSchemaSQL = `
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(session_id, generation)
 	);
+` + createSessionGenParamsSQL + createSessionContentCachesSQL + createSessionConfigsSQL + createQueuedMessagesSQL + createActiveCallsSQL
+
+// createSessionGenParamsSQL is the SQL schema for per-session generation parameter overrides.
+// It was added after the initial session schema, so it is also created on demand for older session DBs.
+const createSessionGenParamsSQL = `
+	CREATE TABLE IF NOT EXISTS S.session_gen_params (
+		session_id TEXT PRIMARY KEY,
+		params TEXT NOT NULL
+	);
+`
+
+// createSessionContentCachesSQL is the SQL schema for provider-side context caches of a session.
+// It was added after the initial session schema, so it is also created on demand for older session DBs.
+const createSessionContentCachesSQL = `
+	CREATE TABLE IF NOT EXISTS S.session_content_caches (
+		session_id TEXT NOT NULL,
+		config_id TEXT NOT NULL,
+		model TEXT NOT NULL,
+		name TEXT NOT NULL,
+		prefix_hash TEXT NOT NULL,
+		content_count INTEGER NOT NULL,
+		token_count INTEGER NOT NULL DEFAULT 0,
+		expire_at INTEGER NOT NULL,
+		PRIMARY KEY (session_id, config_id, model)
+	);
+`
+
+// createSessionConfigsSQL is the SQL schema for per-session configuration values.
+// It was added after the initial session schema, so it is also created on demand for older session DBs.
+const createSessionConfigsSQL = `
+	CREATE TABLE IF NOT EXISTS S.session_configs (
+		session_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value BLOB,
+		PRIMARY KEY (session_id, key)
+	);
+`
+
+// createQueuedMessagesSQL is the SQL schema for user messages waiting for the active call to finish.
+// It was added after the initial session schema, so it is also created on demand for older session DBs.
+const createQueuedMessagesSQL = `
+	CREATE TABLE IF NOT EXISTS S.queued_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		text TEXT NOT NULL,
+		attachments TEXT,
+		model TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+// createActiveCallsSQL is the SQL schema for calls which were active as of the last update.
+// A row remaining while no call is active in memory means that the call was interrupted by a server restart.
+// It was added after the initial session schema, so it is also created on demand for older session DBs.
+const createActiveCallsSQL = `
+	CREATE TABLE IF NOT EXISTS S.active_calls (
+		session_id TEXT PRIMARY KEY,
+		branch_id TEXT NOT NULL,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 `
 
 // InitSessionDBForMigration initializes a SQLite database connection for a session DB.
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// Groupings supported by GetTokenUsageSummaries
+const (
+	TokenUsageBySession   = "session"
+	TokenUsageByWorkspace = "workspace"
+	TokenUsageByModel     = "model"
+	TokenUsageByDay       = "day"
+	TokenUsageByKind      = "kind"
+)
+
+// tokenUsageKeyExprs maps each grouping to the SQL expression of its key.
+// Sessions are grouped by session_id here and merged into their main sessions afterwards.
+var tokenUsageKeyExprs = map[string]string{
+	TokenUsageBySession:   "session_id",
+	TokenUsageByWorkspace: "workspace_id",
+	TokenUsageByModel:     "model",
+	TokenUsageByDay:       "date(created_at / 1000, 'unixepoch', 'localtime')",
+	TokenUsageByKind:      "kind",
+}
+
+// TokenCostFunc returns the estimated cost in USD of the given token counts for a model,
+// or false if the price of the model is unknown.
+type TokenCostFunc func(model string, promptTokens, candidatesTokens, thoughtsTokens, cachedTokens int64) (float64, bool)
+
+// InsertTokenUsage records the token usage of an LLM call.
+// The workspace is taken from the (main) session if not given.
+func InsertTokenUsage(db *Database, usage TokenUsage) (int64, error) {
+	if usage.CreatedAt == 0 {
+		usage.CreatedAt = time.Now().UnixMilli()
+	}
+	mainSessionId, _ := SplitSessionId(usage.SessionID)
+
+	result, err := db.Exec(`
+		INSERT INTO token_usages (
+			session_id, workspace_id, message_id, model, kind,
+			prompt_tokens, candidates_tokens, thoughts_tokens, cached_tokens, created_at
+		) VALUES (?, COALESCE(NULLIF(?, ''), (SELECT workspace_id FROM sessions WHERE id = ?), ''), ?, ?, ?, ?, ?, ?, ?, ?)`,
+		usage.SessionID, usage.WorkspaceID, mainSessionId, usage.MessageID, usage.Model, usage.Kind,
+		usage.PromptTokens, usage.CandidatesTokens, usage.ThoughtsTokens, usage.CachedTokens, usage.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert token usage: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// UpdateMessageUsage stores the token counts of the LLM call that produced a model message in its aux.usage.
+func UpdateMessageUsage(db SessionDbOrTx, messageID int, usage TokenUsage) error {
+	usageJson, err := json.Marshal(map[string]int64{
+		"promptTokens":     usage.PromptTokens,
+		"candidatesTokens": usage.CandidatesTokens,
+		"thoughtsTokens":   usage.ThoughtsTokens,
+		"cachedTokens":     usage.CachedTokens,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message usage: %w", err)
+	}
+	_, err = db.Exec(`
+		UPDATE S.messages
+		SET aux = CASE
+		        WHEN aux = '' THEN json_object('usage', json(?1))
+		        ELSE json_set(aux, '$.usage', json(?1))
+		    END
+		WHERE id = ?2`, string(usageJson), messageID)
+	if err != nil {
+		return fmt.Errorf("failed to update message usage: %w", err)
+	}
+	return nil
+}
+
+// tokenUsageWhere builds a WHERE clause for the given filter.
+func tokenUsageWhere(filter TokenUsageFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if filter.SessionID != "" {
+		conds = append(conds, "(session_id = ? OR session_id LIKE ? ESCAPE '\\')")
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.SessionID)
+		args = append(args, filter.SessionID, escaped+".%")
+	}
+	if filter.WorkspaceID != "" {
+		conds = append(conds, "workspace_id = ?")
+		args = append(args, filter.WorkspaceID)
+	}
+	if filter.Model != "" {
+		conds = append(conds, "model = ?")
+		args = append(args, filter.Model)
+	}
+	if filter.Kind != "" {
+		conds = append(conds, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if filter.Since > 0 {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Until > 0 {
+		conds = append(conds, "created_at < ?")
+		args = append(args, filter.Until)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// GetTokenUsageSummaries aggregates token usages matching the filter by the given grouping.
+// Subsessions are counted towards their main sessions. Costs are estimated per model with costOf, which may be nil.
+// Days are sorted in chronological order and other groupings by descending cost and token counts.
+func GetTokenUsageSummaries(db *Database, groupBy string, filter TokenUsageFilter, costOf TokenCostFunc) ([]TokenUsageSummary, error) {
+	keyExpr, ok := tokenUsageKeyExprs[groupBy]
+	if !ok {
+		return nil, MakeBadRequestError("invalid grouping: %s", groupBy)
+	}
+	where, args := tokenUsageWhere(filter)
+
+	rows, err := db.Query(`
+		SELECT `+keyExpr+` AS group_key, model, COUNT(*),
+			SUM(prompt_tokens), SUM(candidates_tokens), SUM(thoughts_tokens), SUM(cached_tokens)
+		FROM token_usages`+where+`
+		GROUP BY group_key, model`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query token usages: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]*TokenUsageSummary)
+	for rows.Next() {
+		var key, model string
+		var calls int
+		var prompt, candidates, thoughts, cached int64
+		if err := rows.Scan(&key, &model, &calls, &prompt, &candidates, &thoughts, &cached); err != nil {
+			return nil, fmt.Errorf("failed to scan token usage: %w", err)
+		}
+		if groupBy == TokenUsageBySession {
+			key, _ = SplitSessionId(key)
+		}
+
+		summary := summaries[key]
+		if summary == nil {
+			summary = &TokenUsageSummary{Key: key}
+			summaries[key] = summary
+		}
+		summary.Calls += calls
+		summary.PromptTokens += prompt
+		summary.CandidatesTokens += candidates
+		summary.ThoughtsTokens += thoughts
+		summary.CachedTokens += cached
+
+		cost, priced := 0.0, false
+		if costOf != nil {
+			cost, priced = costOf(model, prompt, candidates, thoughts, cached)
+		}
+		if priced {
+			summary.Cost += cost
+		} else {
+			summary.UnpricedCalls += calls
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]TokenUsageSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if groupBy != TokenUsageByDay {
+			if a.Cost != b.Cost {
+				return a.Cost > b.Cost
+			}
+			if ta, tb := a.PromptTokens+a.CandidatesTokens+a.ThoughtsTokens, b.PromptTokens+b.CandidatesTokens+b.ThoughtsTokens; ta != tb {
+				return ta > tb
+			}
+		}
+		return a.Key < b.Key
+	})
+	return result, nil
+}
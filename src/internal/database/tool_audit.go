@@ -0,0 +1,170 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// DefaultToolCallAuditLimit is the number of audits returned when the filter has no limit.
+const DefaultToolCallAuditLimit = 100
+
+// InsertToolCallAudit records a tool invocation.
+func InsertToolCallAudit(db *Database, audit ToolCallAudit) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO tool_call_audits (
+			session_id, branch_id, tool_name, args_digest, started_at, duration_ms, result_size, error, confirmation
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		audit.SessionID, audit.BranchID, audit.ToolName, audit.ArgsDigest, audit.StartedAt,
+		audit.DurationMs, audit.ResultSize, audit.Error, audit.Confirmation)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert tool call audit: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// toolCallAuditWhere builds a WHERE clause for the given filter.
+func toolCallAuditWhere(filter ToolCallAuditFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if filter.SessionID != "" {
+		conds = append(conds, "(session_id = ? OR session_id LIKE ? ESCAPE '\\')")
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.SessionID)
+		args = append(args, filter.SessionID, escaped+".%")
+	}
+	if filter.BranchID != "" {
+		conds = append(conds, "branch_id = ?")
+		args = append(args, filter.BranchID)
+	}
+	if filter.ToolName != "" {
+		conds = append(conds, "tool_name = ?")
+		args = append(args, filter.ToolName)
+	}
+	if filter.ErrorsOnly {
+		conds = append(conds, "error != ''")
+	}
+	if filter.Since > 0 {
+		conds = append(conds, "started_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Until > 0 {
+		conds = append(conds, "started_at < ?")
+		args = append(args, filter.Until)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// GetToolCallAudits retrieves tool call audits matching the filter, most recent first.
+func GetToolCallAudits(db *Database, filter ToolCallAuditFilter) ([]ToolCallAudit, error) {
+	where, args := toolCallAuditWhere(filter)
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultToolCallAuditLimit
+	}
+	args = append(args, limit, max(filter.Offset, 0))
+
+	rows, err := db.Query(`
+		SELECT id, session_id, branch_id, tool_name, args_digest, started_at, duration_ms, result_size, error, confirmation
+		FROM tool_call_audits`+where+`
+		ORDER BY started_at DESC, id DESC
+		LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tool call audits: %w", err)
+	}
+	defer rows.Close()
+
+	audits := []ToolCallAudit{}
+	for rows.Next() {
+		var audit ToolCallAudit
+		if err := rows.Scan(
+			&audit.ID, &audit.SessionID, &audit.BranchID, &audit.ToolName, &audit.ArgsDigest,
+			&audit.StartedAt, &audit.DurationMs, &audit.ResultSize, &audit.Error, &audit.Confirmation,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan tool call audit: %w", err)
+		}
+		audits = append(audits, audit)
+	}
+	return audits, rows.Err()
+}
+
+// GetToolCallStats computes per-tool statistics over tool call audits matching the filter.
+// Calls awaiting or denied confirmation are counted but excluded from failure rate and latency,
+// as the tool did not actually run. Limit, offset and ErrorsOnly are ignored.
+func GetToolCallStats(db *Database, filter ToolCallAuditFilter) ([]ToolCallStats, error) {
+	filter.ErrorsOnly = false
+	where, args := toolCallAuditWhere(filter)
+
+	rows, err := db.Query(`
+		SELECT tool_name, duration_ms, result_size, error, confirmation
+		FROM tool_call_audits`+where+`
+		ORDER BY tool_name, duration_ms`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tool call audits: %w", err)
+	}
+	defer rows.Close()
+
+	type toolDurations struct {
+		stats      ToolCallStats
+		durations  []int64 // Sorted in ascending order by the query
+		resultSize int64
+	}
+	var tools []*toolDurations
+	for rows.Next() {
+		var name, errMsg, confirmation string
+		var duration, resultSize int64
+		if err := rows.Scan(&name, &duration, &resultSize, &errMsg, &confirmation); err != nil {
+			return nil, fmt.Errorf("failed to scan tool call audit: %w", err)
+		}
+		if len(tools) == 0 || tools[len(tools)-1].stats.ToolName != name {
+			tools = append(tools, &toolDurations{stats: ToolCallStats{ToolName: name}})
+		}
+		t := tools[len(tools)-1]
+
+		t.stats.Calls++
+		switch confirmation {
+		case ConfirmationPending:
+			continue
+		case ConfirmationDenied:
+			t.stats.Denials++
+			continue
+		}
+		if errMsg != "" {
+			t.stats.Failures++
+		}
+		t.durations = append(t.durations, duration)
+		t.resultSize += resultSize
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := make([]ToolCallStats, 0, len(tools))
+	for _, t := range tools {
+		if n := len(t.durations); n > 0 {
+			var total int64
+			for _, d := range t.durations {
+				total += d
+			}
+			t.stats.FailureRate = float64(t.stats.Failures) / float64(n)
+			t.stats.AvgDurationMs = float64(total) / float64(n)
+			t.stats.AvgResultSize = float64(t.resultSize) / float64(n)
+			t.stats.P95DurationMs = percentile(t.durations, 0.95)
+			t.stats.MaxDurationMs = t.durations[n-1]
+		}
+		stats = append(stats, t.stats)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Calls > stats[j].Calls })
+	return stats, nil
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
@@ -587,18 +587,25 @@ func syncSessionToMainDB(db *Database, mainSessionID, sessionDBPath string) erro
 	}
 
 	// Sync to messages_searchable table (only user/model messages for FTS)
+	// Existing entries are updated in place, so that their IDs shared with FTS tables and embeddings remain valid.
 	_, err = db.Exec(fmt.Sprintf(`
-		INSERT OR REPLACE INTO messages_searchable (id, text, session_id, workspace_id)
-		SELECT id, replace(replace(text, '<', '\x0e'), '>', '\x0f'), ? || CASE
+		INSERT INTO messages_searchable (text, session_id, workspace_id, message_id, type, created_at)
+		SELECT replace(replace(text, '<', '\x0e'), '>', '\x0f'), ? || CASE
 			WHEN session_id = '' THEN ''
 			ELSE '.' || session_id
-		END, ?
+		END, ?, id, type, created_at
 		FROM %s.messages
 		WHERE type IN ('user', 'model')
+		ON CONFLICT(session_id, message_id) DO UPDATE SET
+			text = excluded.text, workspace_id = excluded.workspace_id,
+			type = excluded.type, created_at = excluded.created_at
 	`, attachAlias), mainSessionID, workspaceID)
 	if err != nil {
 		return fmt.Errorf("failed to sync messages_searchable to main DB: %w", err)
 	}
+	if err := syncSessionFTSTables(db, mainSessionID); err != nil {
+		return err
+	}
 
 	// Sync sessions table with first_message_at, last_message_text, and archived
 	_, err = db.Exec(fmt.Sprintf(`
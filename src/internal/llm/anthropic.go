@@ -0,0 +1,792 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"net/http"
+	"strings"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// Ensure AnthropicProvider implements LLMProvider
+var _ LLMProvider = (*AnthropicProvider)(nil)
+
+const (
+	AnthropicDefaultEndpoint = "https://api.anthropic.com/v1"
+	AnthropicAPIVersion      = "2023-06-01"
+
+	// Model names with this suffix enable extended thinking, e.g. "claude-sonnet-4-5-thinking"
+	anthropicThinkingSuffix = "-thinking"
+
+	anthropicMaxOutputTokens      = 32000 // Used unless MaxOutputTokens is given
+	anthropicThinkingBudgetTokens = 16000
+	anthropicMinThinkingBudget    = 1024
+
+	// Thinking blocks preceding a tool use are stored in the ThoughtSignature of the function call part,
+	// because they have to be sent back verbatim while the tool loop continues.
+	anthropicThinkingStatePrefix = "anthropic-thinking:"
+)
+
+// AnthropicMessagesRequest represents the request to /v1/messages endpoint
+type AnthropicMessagesRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens,omitempty"`
+	System        string             `json:"system,omitempty"`
+	Messages      []AnthropicMessage `json:"messages"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
+	Thinking      *AnthropicThinking `json:"thinking,omitempty"`
+	Temperature   *float32           `json:"temperature,omitempty"`
+	TopP          *float32           `json:"top_p,omitempty"`
+	TopK          *int32             `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+// AnthropicMessage represents a message in the Messages API
+type AnthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+// AnthropicContentBlock represents any content block in the Messages API
+type AnthropicContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image, document
+	Source *AnthropicSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+
+	// thinking, redacted_thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+// AnthropicSource represents base64-encoded data for image and document blocks
+type AnthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// AnthropicTool represents a tool definition for the Messages API
+type AnthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// AnthropicThinking configures extended thinking
+type AnthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// AnthropicUsage represents token usage reported by the Messages API
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// AnthropicStreamEvent represents a server-sent event from streaming /v1/messages
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message *struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	ContentBlock *AnthropicContentBlock `json:"content_block,omitempty"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta,omitempty"`
+	Usage *AnthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// AnthropicClient calls the Anthropic Messages API with a single configuration
+type AnthropicClient struct {
+	config     *AnthropicConfig
+	httpClient *http.Client
+}
+
+// NewAnthropicClient creates a new Anthropic client
+func NewAnthropicClient(config *AnthropicConfig) *AnthropicClient {
+	return &AnthropicClient{config: config, httpClient: &http.Client{}}
+}
+
+// post sends a JSON request to the given API path and returns the successful response
+func (c *AnthropicClient) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := c.config.Endpoint
+	if endpoint == "" {
+		endpoint = AnthropicDefaultEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("x-api-key", c.config.APIKey)
+	req.Header.Set("anthropic-version", AnthropicAPIVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: resp.Status, Response: string(respBody), RetryAfter: resp.Header.Get("Retry-After")}
+	}
+	return resp, nil
+}
+
+// StreamMessages sends a streaming request to /v1/messages and returns the SSE response body
+func (c *AnthropicClient) StreamMessages(ctx context.Context, request AnthropicMessagesRequest) (io.ReadCloser, error) {
+	request.Stream = true
+	resp, err := c.post(ctx, "/messages", request)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// CountTokens calls /v1/messages/count_tokens
+func (c *AnthropicClient) CountTokens(ctx context.Context, request AnthropicMessagesRequest) (int, error) {
+	request.MaxTokens = 0 // Not accepted by the endpoint
+	request.Stream = false
+	resp, err := c.post(ctx, "/messages/count_tokens", request)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.InputTokens, nil
+}
+
+// AnthropicProvider handles the "anthropic" provider type
+type AnthropicProvider struct{}
+
+// NewAnthropicProvider creates a new AnthropicProvider
+func NewAnthropicProvider() *AnthropicProvider {
+	return &AnthropicProvider{}
+}
+
+// enabledAnthropicConfigs returns enabled Anthropic configurations in the order they should be tried
+func enabledAnthropicConfigs(ctx context.Context) ([]AnthropicConfig, error) {
+	db, err := database.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := database.GetAnthropicConfigs(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Anthropic configs: %w", err)
+	}
+
+	var enabled []AnthropicConfig
+	for _, config := range configs {
+		if config.Enabled {
+			enabled = append(enabled, config)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil, fmt.Errorf("no Anthropic API configuration is enabled")
+	}
+	return enabled, nil
+}
+
+// SendMessageStream calls the Messages API and returns an iter.Seq of responses
+func (p *AnthropicProvider) SendMessageStream(ctx context.Context, modelName string, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+	if modelName == "" {
+		return nil, nil, fmt.Errorf("model name cannot be empty")
+	}
+
+	tools, err := tool.FromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	configs, err := enabledAnthropicConfigs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request := convertSessionParamsToAnthropicRequest(tools, modelName, params)
+
+	var lastErr error
+	for _, config := range configs {
+		body, err := NewAnthropicClient(&config).StreamMessages(ctx, request)
+		if err != nil {
+			log.Printf("AnthropicProvider.SendMessageStream: Request with config %s failed: %v", config.Name, err)
+			lastErr = err
+			continue
+		}
+		return streamAnthropicResponse(body), body, nil
+	}
+	return nil, nil, lastErr
+}
+
+// GenerateContentOneShot calls the Messages API and returns a single response
+func (p *AnthropicProvider) GenerateContentOneShot(ctx context.Context, modelName string, params SessionParams) (OneShotResult, error) {
+	seq, closer, err := p.SendMessageStream(ctx, modelName, params)
+	if err != nil {
+		return OneShotResult{}, err
+	}
+	defer closer.Close()
+
+	var fullResponse strings.Builder
+	var finishMessage string
+	var usageMetadata *UsageMetadata
+	for resp := range seq {
+		if resp.UsageMetadata != nil {
+			usageMetadata = resp.UsageMetadata
+		}
+		if len(resp.Candidates) == 0 {
+			continue
+		}
+		candidate := resp.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			if part.Text != "" && !part.Thought {
+				fullResponse.WriteString(part.Text)
+			}
+		}
+		if candidate.FinishMessage != "" {
+			finishMessage = candidate.FinishMessage
+		}
+	}
+
+	if fullResponse.Len() > 0 {
+		return OneShotResult{Text: fullResponse.String(), UsageMetadata: usageMetadata}, nil
+	}
+	if finishMessage != "" {
+		return OneShotResult{}, fmt.Errorf("no text content found in LLM response: %s", finishMessage)
+	}
+	return OneShotResult{}, fmt.Errorf("no text content found in LLM response")
+}
+
+// CountTokens counts input tokens with the Messages API
+func (p *AnthropicProvider) CountTokens(ctx context.Context, modelName string, contents []Content) (*CaCountTokenResponse, error) {
+	if modelName == "" {
+		return nil, fmt.Errorf("model name cannot be empty")
+	}
+
+	configs, err := enabledAnthropicConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	apiModelName, _ := strings.CutSuffix(modelName, anthropicThinkingSuffix)
+	request := AnthropicMessagesRequest{
+		Model:    apiModelName,
+		Messages: convertGeminiToAnthropicMessages(contents),
+	}
+
+	var lastErr error
+	for _, config := range configs {
+		tokens, err := NewAnthropicClient(&config).CountTokens(ctx, request)
+		if err == nil {
+			return &CaCountTokenResponse{TotalTokens: tokens}, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// MaxTokens returns the context window of Claude models
+func (p *AnthropicProvider) MaxTokens(modelName string) int {
+	return 200000
+}
+
+// convertSessionParamsToAnthropicRequest converts SessionParams to a Messages API request
+func convertSessionParamsToAnthropicRequest(toolRegistry *tool.Tools, modelName string, params SessionParams) AnthropicMessagesRequest {
+	apiModelName, thinking := strings.CutSuffix(modelName, anthropicThinkingSuffix)
+
+	// The Messages API has no seed or penalties
+	genParams := params.GenParams
+	request := AnthropicMessagesRequest{
+		Model:         apiModelName,
+		MaxTokens:     anthropicMaxOutputTokens,
+		System:        params.SystemPrompt,
+		Messages:      convertGeminiToAnthropicMessages(params.Contents),
+		StopSequences: genParams.StopSequences,
+	}
+	if genParams.MaxOutputTokens > 0 {
+		request.MaxTokens = int(genParams.MaxOutputTokens)
+	}
+
+	// The thinking budget has to be smaller than max_tokens, so thinking is disabled if there is no room for it
+	budgetTokens := min(anthropicThinkingBudgetTokens, request.MaxTokens-1)
+	if thinking && budgetTokens >= anthropicMinThinkingBudget {
+		request.Thinking = &AnthropicThinking{Type: "enabled", BudgetTokens: budgetTokens}
+	} else {
+		// Sampling parameters can't be changed while thinking; unset or negative ones are left to the server defaults
+		if genParams.Temperature != nil && *genParams.Temperature >= 0 {
+			request.Temperature = genParams.Temperature
+		}
+		if genParams.TopP != nil && *genParams.TopP >= 0 {
+			request.TopP = genParams.TopP
+		}
+		if genParams.TopK != nil && *genParams.TopK >= 0 {
+			request.TopK = genParams.TopK
+		}
+	}
+
+	// The Messages API has no native structured output, so the schema is given as an instruction
+	if params.ResponseMimeType == "application/json" {
+		instruction := "Respond only with a single JSON value, without any surrounding text or code fences."
+		if params.ResponseSchema != nil {
+			schemaJSON, _ := json.Marshal(convertGeminiSchemaToJSONSchema(params.ResponseSchema))
+			instruction = fmt.Sprintf("Respond only with a single JSON value conforming to the following JSON schema, without any surrounding text or code fences.\n\n%s", schemaJSON)
+		}
+		if request.System != "" {
+			request.System += "\n\n"
+		}
+		request.System += instruction
+	}
+
+	// Same convention as Gemini: an empty key in ToolConfig removes the default tool list
+	if _, noDefaultTools := params.ToolConfig[""]; !noDefaultTools && toolRegistry != nil {
+		for _, t := range toolRegistry.ForGemini() {
+			for _, decl := range t.FunctionDeclarations {
+				inputSchema := convertGeminiSchemaToJSONSchema(decl.Parameters)
+				if inputSchema == nil {
+					inputSchema = map[string]interface{}{}
+				}
+				if _, ok := inputSchema["type"]; !ok {
+					inputSchema["type"] = "object"
+				}
+				request.Tools = append(request.Tools, AnthropicTool{
+					Name:        decl.Name,
+					Description: decl.Description,
+					InputSchema: inputSchema,
+				})
+			}
+		}
+	}
+
+	return request
+}
+
+// convertGeminiToAnthropicMessages converts Gemini contents to Anthropic messages.
+// Consecutive contents of the same role are merged, and function calls and responses
+// are paired by ID (or by name and order when IDs are missing) as required by the Messages API.
+func convertGeminiToAnthropicMessages(contents []Content) []AnthropicMessage {
+	var messages []AnthropicMessage
+	var pendingToolUses []AnthropicContentBlock // tool_use blocks without a tool_result yet
+	nextToolUseID := 0
+
+	for _, content := range contents {
+		var role string
+		switch content.Role {
+		case RoleUser:
+			role = "user"
+		case RoleModel:
+			role = "assistant"
+		default:
+			continue
+		}
+
+		var blocks, thinkingBlocks []AnthropicContentBlock
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+				// Thoughts are only replayed from the state of function calls below
+			case part.FunctionCall != nil:
+				fc := part.FunctionCall
+				id := fc.Id
+				if id == "" {
+					nextToolUseID++
+					id = fmt.Sprintf("toolu_angel_%d", nextToolUseID)
+				}
+				input, err := json.Marshal(fc.Args)
+				if err != nil || fc.Args == nil {
+					input = []byte("{}")
+				}
+				block := AnthropicContentBlock{Type: "tool_use", ID: id, Name: fc.Name, Input: input}
+				blocks = append(blocks, block)
+				pendingToolUses = append(pendingToolUses, block)
+				if thinking := decodeAnthropicThinkingState(part.ThoughtSignature); thinking != nil {
+					thinkingBlocks = append(thinkingBlocks, thinking...)
+				}
+			case part.FunctionResponse != nil:
+				blocks = append(blocks, anthropicToolResultBlock(part.FunctionResponse, &pendingToolUses))
+			case part.InlineData != nil:
+				blocks = append(blocks, anthropicInlineDataBlock(part.InlineData))
+			case part.ExecutableCode != nil:
+				blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("```%s\n%s\n```", strings.ToLower(part.ExecutableCode.Language), part.ExecutableCode.Code)})
+			case part.CodeExecutionResult != nil:
+				blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("Code execution result (%s):\n%s", part.CodeExecutionResult.Outcome, part.CodeExecutionResult.Output)})
+			case strings.TrimSpace(part.Text) != "":
+				blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: part.Text})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		n := len(messages)
+		switch {
+		case role == "assistant" && thinkingBlocks == nil && onlyBlocksOfType(blocks, "tool_use") &&
+			n >= 2 && onlyBlocksOfType(messages[n-1].Content, "tool_result") && startsWithThinking(messages[n-2].Content):
+			// Parallel function calls are stored as separate call-response pairs,
+			// but with extended thinking they must share the assistant message bearing the thinking blocks.
+			messages[n-2].Content = append(messages[n-2].Content, blocks...)
+		case n > 0 && messages[n-1].Role == role:
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		default:
+			messages = append(messages, AnthropicMessage{Role: role, Content: blocks})
+		}
+		if thinkingBlocks != nil {
+			last := &messages[len(messages)-1]
+			last.Content = append(thinkingBlocks, last.Content...)
+		}
+	}
+
+	// Tool results have to come first in user messages
+	for i := range messages {
+		if messages[i].Role == "user" {
+			content := messages[i].Content
+			sorted := make([]AnthropicContentBlock, 0, len(content))
+			for _, block := range content {
+				if block.Type == "tool_result" {
+					sorted = append(sorted, block)
+				}
+			}
+			for _, block := range content {
+				if block.Type != "tool_result" {
+					sorted = append(sorted, block)
+				}
+			}
+			messages[i].Content = sorted
+		}
+	}
+
+	// The conversation has to start with a user message, which is not the case
+	// when it begins with the system prompt recorded as a function call.
+	if len(messages) > 0 && messages[0].Role != "user" {
+		messages = append([]AnthropicMessage{{
+			Role:    "user",
+			Content: []AnthropicContentBlock{{Type: "text", Text: "(The conversation continues.)"}},
+		}}, messages...)
+	}
+
+	return messages
+}
+
+// anthropicToolResultBlock converts a function response to a tool_result block matching a pending tool_use.
+// A response without any matching tool_use is converted to a text block instead.
+func anthropicToolResultBlock(fr *FunctionResponse, pendingToolUses *[]AnthropicContentBlock) AnthropicContentBlock {
+	result, err := json.Marshal(fr.Response)
+	if err != nil {
+		result = []byte(fmt.Sprintf(`{"error": %q}`, err.Error()))
+	}
+
+	matched := -1
+	for i, toolUse := range *pendingToolUses {
+		if (fr.Id != "" && toolUse.ID == fr.Id) || (fr.Id == "" && toolUse.Name == fr.Name) {
+			matched = i
+			break
+		}
+	}
+	if matched < 0 {
+		return AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("Result of %s:\n%s", fr.Name, result)}
+	}
+	toolUse := (*pendingToolUses)[matched]
+	*pendingToolUses = append((*pendingToolUses)[:matched], (*pendingToolUses)[matched+1:]...)
+
+	block := AnthropicContentBlock{Type: "tool_result", ToolUseID: toolUse.ID, Content: string(result)}
+	if response, ok := fr.Response.(map[string]interface{}); ok && len(response) == 1 && response["error"] != nil {
+		block.IsError = true
+	}
+	return block
+}
+
+// anthropicInlineDataBlock converts inline data to an image or document block, if supported
+func anthropicInlineDataBlock(inlineData *InlineData) AnthropicContentBlock {
+	source := &AnthropicSource{Type: "base64", MediaType: inlineData.MimeType, Data: inlineData.Data}
+	switch inlineData.MimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return AnthropicContentBlock{Type: "image", Source: source}
+	case "application/pdf":
+		return AnthropicContentBlock{Type: "document", Source: source}
+	default:
+		return AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("[Attachment of type %s is not supported by this model]", inlineData.MimeType)}
+	}
+}
+
+func onlyBlocksOfType(blocks []AnthropicContentBlock, blockType string) bool {
+	for _, block := range blocks {
+		if block.Type != blockType {
+			return false
+		}
+	}
+	return len(blocks) > 0
+}
+
+func startsWithThinking(blocks []AnthropicContentBlock) bool {
+	return len(blocks) > 0 && (blocks[0].Type == "thinking" || blocks[0].Type == "redacted_thinking")
+}
+
+// encodeAnthropicThinkingState encodes thinking blocks into a ThoughtSignature
+func encodeAnthropicThinkingState(blocks []AnthropicContentBlock) string {
+	if len(blocks) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		return ""
+	}
+	return anthropicThinkingStatePrefix + base64.StdEncoding.EncodeToString(data)
+}
+
+// decodeAnthropicThinkingState decodes thinking blocks from a ThoughtSignature, or returns nil
+func decodeAnthropicThinkingState(state string) []AnthropicContentBlock {
+	encoded, ok := strings.CutPrefix(state, anthropicThinkingStatePrefix)
+	if !ok {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		log.Printf("Failed to decode Anthropic thinking state: %v", err)
+		return nil
+	}
+	var blocks []AnthropicContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		log.Printf("Failed to unmarshal Anthropic thinking state: %v", err)
+		return nil
+	}
+	return blocks
+}
+
+// anthropicFinishReason maps an Anthropic stop reason to a Gemini finish reason
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "tool_use", "stop_sequence", "pause_turn":
+		return FinishReasonStop
+	case "max_tokens", "model_context_window_exceeded":
+		return FinishReasonMaxTokens
+	case "refusal":
+		return FinishReasonSafety
+	default:
+		return FinishReasonOther
+	}
+}
+
+// anthropicUsageMetadata converts Anthropic usage to Gemini usage metadata
+func anthropicUsageMetadata(usage AnthropicUsage) *UsageMetadata {
+	prompt := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return &UsageMetadata{
+		PromptTokenCount:        prompt,
+		CandidatesTokenCount:    usage.OutputTokens,
+		TotalTokenCount:         prompt + usage.OutputTokens,
+		CachedContentTokenCount: usage.CacheReadInputTokens,
+	}
+}
+
+// anthropicErrorStatusCode returns the HTTP status code corresponding to an Anthropic error type
+func anthropicErrorStatusCode(errorType string) int {
+	switch errorType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return 529
+	default: // api_error
+		return http.StatusInternalServerError
+	}
+}
+
+// streamAnthropicResponse converts server-sent events from the Messages API to Gemini responses.
+// Text is streamed as it arrives, while thinking and tool use blocks are yielded once complete.
+func streamAnthropicResponse(body io.Reader) iter.Seq[GenerateContentResponse] {
+	return func(yield func(GenerateContentResponse) bool) {
+		yieldParts := func(finishReason, finishMessage string, usage *UsageMetadata, parts ...Part) bool {
+			resp := GenerateContentResponse{UsageMetadata: usage}
+			if len(parts) > 0 || finishReason != "" {
+				resp.Candidates = []Candidate{{
+					Content:       Content{Role: RoleModel, Parts: parts},
+					FinishReason:  finishReason,
+					FinishMessage: finishMessage,
+				}}
+			}
+			return yield(resp)
+		}
+
+		var usage AnthropicUsage
+		blocks := make(map[int]*AnthropicContentBlock) // Blocks being streamed, by index
+		inputJSON := make(map[int]*strings.Builder)
+		var thinkingBlocks []AnthropicContentBlock // Completed thinking blocks not yet attached to a tool use
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue // Event names are repeated in the data, and blank lines separate events
+			}
+
+			var event AnthropicStreamEvent
+			if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+				log.Printf("Failed to parse Anthropic stream event: %v, data: %s", err, data)
+				continue
+			}
+
+			switch event.Type {
+			case "message_start":
+				if event.Message != nil {
+					usage = event.Message.Usage
+					if !yieldParts("", "", anthropicUsageMetadata(usage)) {
+						return
+					}
+				}
+
+			case "content_block_start":
+				if event.ContentBlock != nil {
+					block := *event.ContentBlock
+					blocks[event.Index] = &block
+					if block.Type == "tool_use" {
+						inputJSON[event.Index] = &strings.Builder{}
+					}
+				}
+
+			case "content_block_delta":
+				block := blocks[event.Index]
+				if block == nil || event.Delta == nil {
+					continue
+				}
+				switch event.Delta.Type {
+				case "text_delta":
+					if event.Delta.Text != "" && !yieldParts("", "", nil, Part{Text: event.Delta.Text}) {
+						return
+					}
+				case "thinking_delta":
+					block.Thinking += event.Delta.Thinking
+				case "signature_delta":
+					block.Signature += event.Delta.Signature
+				case "input_json_delta":
+					inputJSON[event.Index].WriteString(event.Delta.PartialJSON)
+				}
+
+			case "content_block_stop":
+				block := blocks[event.Index]
+				delete(blocks, event.Index)
+				if block == nil {
+					continue
+				}
+				switch block.Type {
+				case "thinking":
+					thinkingBlocks = append(thinkingBlocks, *block)
+					if block.Thinking != "" && !yieldParts("", "", nil, Part{Text: block.Thinking, Thought: true}) {
+						return
+					}
+				case "redacted_thinking":
+					thinkingBlocks = append(thinkingBlocks, *block)
+				case "tool_use":
+					args := make(map[string]interface{})
+					if input := inputJSON[event.Index].String(); input != "" {
+						if err := json.Unmarshal([]byte(input), &args); err != nil {
+							log.Printf("Failed to parse tool input for %s as JSON: %v, treating as raw string", block.Name, err)
+							args = map[string]interface{}{"raw_arguments": input}
+						}
+					}
+					delete(inputJSON, event.Index)
+
+					part := Part{
+						FunctionCall:     &FunctionCall{Name: block.Name, Args: args, Id: block.ID},
+						ThoughtSignature: encodeAnthropicThinkingState(thinkingBlocks),
+					}
+					thinkingBlocks = nil
+					if !yieldParts("", "", nil, part) {
+						return
+					}
+				}
+
+			case "message_delta":
+				if event.Usage != nil {
+					usage.OutputTokens = event.Usage.OutputTokens
+				}
+				if event.Delta != nil && event.Delta.StopReason != "" {
+					reason := anthropicFinishReason(event.Delta.StopReason)
+					var message string
+					if reason != FinishReasonStop {
+						message = fmt.Sprintf("Anthropic API stopped with reason %s", event.Delta.StopReason)
+					}
+					if !yieldParts(reason, message, anthropicUsageMetadata(usage)) {
+						return
+					}
+				}
+
+			case "message_stop":
+				return
+
+			case "error":
+				status := &ErrorStatus{Code: http.StatusInternalServerError, Message: "unknown error"}
+				if event.Error != nil {
+					status.Code = anthropicErrorStatusCode(event.Error.Type)
+					status.Status = event.Error.Type
+					status.Message = event.Error.Message
+				}
+				log.Printf("Anthropic stream error: %v", status)
+				yield(GenerateContentResponse{Error: status})
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			log.Printf("Anthropic stream scanner error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm/spec"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+func TestConvertGeminiToAnthropicMessages(t *testing.T) {
+	thinking := encodeAnthropicThinkingState([]AnthropicContentBlock{
+		{Type: "thinking", Thinking: "Let me look.", Signature: "sig"},
+	})
+
+	contents := []Content{
+		{Role: RoleModel, Parts: []Part{{FunctionCall: &FunctionCall{Name: "new_system_prompt", Args: map[string]interface{}{}}}}},
+		{Role: RoleUser, Parts: []Part{{FunctionResponse: &FunctionResponse{Name: "new_system_prompt", Response: map[string]interface{}{}}}}},
+		{Role: RoleUser, Parts: []Part{
+			{Text: "Describe this."},
+			{InlineData: &InlineData{MimeType: "image/png", Data: "aGVsbG8="}},
+		}},
+		{Role: RoleModel, Parts: []Part{{Text: "I should list files first.", Thought: true}}},
+		{Role: RoleModel, Parts: []Part{{
+			FunctionCall:     &FunctionCall{Name: "list_directory", Args: map[string]interface{}{"path": "."}, Id: "toolu_1"},
+			ThoughtSignature: thinking,
+		}}},
+		{Role: RoleUser, Parts: []Part{{FunctionResponse: &FunctionResponse{Name: "list_directory", Response: map[string]interface{}{"files": []interface{}{"a.png"}}}}}},
+		{Role: RoleModel, Parts: []Part{{FunctionCall: &FunctionCall{Name: "read_file", Args: map[string]interface{}{"path": "a.png"}, Id: "toolu_2"}}}},
+		{Role: RoleUser, Parts: []Part{{FunctionResponse: &FunctionResponse{Name: "read_file", Response: map[string]interface{}{"error": "not found"}}}}},
+		{Role: RoleModel, Parts: []Part{{Text: "The file is missing."}}},
+	}
+
+	got := convertGeminiToAnthropicMessages(contents)
+	want := []AnthropicMessage{
+		{Role: "user", Content: []AnthropicContentBlock{
+			{Type: "text", Text: "(The conversation continues.)"},
+		}},
+		{Role: "assistant", Content: []AnthropicContentBlock{
+			{Type: "tool_use", ID: "toolu_angel_1", Name: "new_system_prompt", Input: json.RawMessage(`{}`)},
+		}},
+		{Role: "user", Content: []AnthropicContentBlock{
+			{Type: "tool_result", ToolUseID: "toolu_angel_1", Content: `{}`},
+			{Type: "text", Text: "Describe this."},
+			{Type: "image", Source: &AnthropicSource{Type: "base64", MediaType: "image/png", Data: "aGVsbG8="}},
+		}},
+		{Role: "assistant", Content: []AnthropicContentBlock{
+			{Type: "thinking", Thinking: "Let me look.", Signature: "sig"},
+			{Type: "tool_use", ID: "toolu_1", Name: "list_directory", Input: json.RawMessage(`{"path":"."}`)},
+			{Type: "tool_use", ID: "toolu_2", Name: "read_file", Input: json.RawMessage(`{"path":"a.png"}`)},
+		}},
+		{Role: "user", Content: []AnthropicContentBlock{
+			{Type: "tool_result", ToolUseID: "toolu_1", Content: `{"files":["a.png"]}`},
+			{Type: "tool_result", ToolUseID: "toolu_2", Content: `{"error":"not found"}`, IsError: true},
+		}},
+		{Role: "assistant", Content: []AnthropicContentBlock{
+			{Type: "text", Text: "The file is missing."},
+		}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("Unexpected messages:\ngot:  %s\nwant: %s", gotJSON, wantJSON)
+	}
+}
+
+func TestAnthropicProviderSendMessageStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-5","usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"The user wants "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"the weather."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"c2ln"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Checking"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":" now."}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_01","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\": "}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"Seoul\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":42}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	var received AnthropicMessagesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("Unexpected API key: %q", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != AnthropicAPIVersion {
+			t.Errorf("Unexpected API version: %q", got)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var typed struct{ Type string }
+			json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}))
+	defer server.Close()
+
+	db, err := database.InitTestDB(t.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+	defer db.Close()
+
+	// A disabled config is skipped and a failing one falls through to the next
+	configs := []AnthropicConfig{
+		{ID: "a", Name: "disabled", Endpoint: "http://127.0.0.1:1", APIKey: "x", Enabled: false},
+		{ID: "b", Name: "test", Endpoint: server.URL + "/v1", APIKey: "test-key", Enabled: true},
+	}
+	for _, config := range configs {
+		if err := database.SaveAnthropicConfig(db, config); err != nil {
+			t.Fatalf("Failed to save Anthropic config: %v", err)
+		}
+	}
+
+	ctx := database.ContextWith(context.Background(), db)
+	ctx = tool.ContextWith(ctx, tool.NewTools())
+
+	provider := NewAnthropicProvider()
+	seq, closer, err := provider.SendMessageStream(ctx, "claude-sonnet-4-5-thinking", SessionParams{
+		SystemPrompt: "You are helpful.",
+		Contents:     []Content{{Role: RoleUser, Parts: []Part{{Text: "Weather in Seoul?"}}}},
+	})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+	defer closer.Close()
+
+	var thoughts, text strings.Builder
+	var calls []Part
+	var finishReason string
+	var usage *UsageMetadata
+	for resp := range seq {
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+		if len(resp.Candidates) == 0 {
+			continue
+		}
+		candidate := resp.Candidates[0]
+		if candidate.FinishReason != "" {
+			finishReason = candidate.FinishReason
+		}
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.Thought:
+				thoughts.WriteString(part.Text)
+			case part.FunctionCall != nil:
+				calls = append(calls, part)
+			default:
+				text.WriteString(part.Text)
+			}
+		}
+	}
+
+	if received.Model != "claude-sonnet-4-5" {
+		t.Errorf("Expected model name without suffix, got %q", received.Model)
+	}
+	if received.Thinking == nil || received.Thinking.Type != "enabled" || received.Thinking.BudgetTokens >= received.MaxTokens {
+		t.Errorf("Unexpected thinking config: %+v (max_tokens %d)", received.Thinking, received.MaxTokens)
+	}
+	if received.System != "You are helpful." {
+		t.Errorf("Unexpected system prompt: %q", received.System)
+	}
+
+	if got := thoughts.String(); got != "The user wants the weather." {
+		t.Errorf("Unexpected thoughts: %q", got)
+	}
+	if got := text.String(); got != "Checking now." {
+		t.Errorf("Unexpected text: %q", got)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 function call, got %d", len(calls))
+	}
+	fc := calls[0].FunctionCall
+	if fc.Name != "get_weather" || fc.Id != "toolu_01" || !reflect.DeepEqual(fc.Args, map[string]interface{}{"city": "Seoul"}) {
+		t.Errorf("Unexpected function call: %+v", fc)
+	}
+	wantThinking := []AnthropicContentBlock{{Type: "thinking", Thinking: "The user wants the weather.", Signature: "c2ln"}}
+	if got := decodeAnthropicThinkingState(calls[0].ThoughtSignature); !reflect.DeepEqual(got, wantThinking) {
+		t.Errorf("Unexpected thinking state: %+v", got)
+	}
+	if finishReason != FinishReasonStop {
+		t.Errorf("Expected finish reason %s, got %s", FinishReasonStop, finishReason)
+	}
+	if usage == nil || usage.PromptTokenCount != 15 || usage.CachedContentTokenCount != 5 || usage.CandidatesTokenCount != 42 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+}
+
+func TestAnthropicProviderAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"Slow down"}}`)
+	}))
+	defer server.Close()
+
+	db, err := database.InitTestDB(t.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+	defer db.Close()
+	if err := database.SaveAnthropicConfig(db, AnthropicConfig{ID: "a", Name: "test", Endpoint: server.URL, APIKey: "k", Enabled: true}); err != nil {
+		t.Fatalf("Failed to save Anthropic config: %v", err)
+	}
+
+	ctx := database.ContextWith(context.Background(), db)
+	ctx = tool.ContextWith(ctx, tool.NewTools())
+
+	_, _, err = NewAnthropicProvider().SendMessageStream(ctx, "claude-haiku-4-5", SessionParams{
+		Contents: []Content{{Role: RoleUser, Parts: []Part{{Text: "Hi"}}}},
+	})
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("Expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || !strings.Contains(apiErr.Response, "rate_limit_error") {
+		t.Errorf("Unexpected API error: %+v", apiErr)
+	}
+}
+
+func TestConvertSessionParamsToAnthropicRequest(t *testing.T) {
+	temperature := float32(0)
+	topK := int32(-1)
+
+	// Unset parameters fall back to the defaults
+	request := convertSessionParamsToAnthropicRequest(nil, "claude-haiku-4-5", SessionParams{})
+	if request.MaxTokens != anthropicMaxOutputTokens {
+		t.Errorf("Expected default max_tokens %d, got %d", anthropicMaxOutputTokens, request.MaxTokens)
+	}
+	if request.Temperature != nil || request.TopP != nil || request.TopK != nil || request.StopSequences != nil {
+		t.Errorf("Expected no sampling parameters, got %+v", request)
+	}
+
+	genParams := spec.GenerationParams{
+		Temperature:     &temperature,
+		TopK:            &topK,
+		MaxOutputTokens: 4096,
+		StopSequences:   []string{"END"},
+	}
+	request = convertSessionParamsToAnthropicRequest(nil, "claude-haiku-4-5", SessionParams{GenParams: genParams})
+	if request.MaxTokens != 4096 {
+		t.Errorf("Expected max_tokens 4096, got %d", request.MaxTokens)
+	}
+	if request.Temperature == nil || *request.Temperature != 0 {
+		t.Errorf("Expected zero temperature to be sent, got %v", request.Temperature)
+	}
+	if request.TopK != nil {
+		t.Errorf("Expected negative top_k to be left to the server default, got %d", *request.TopK)
+	}
+	if !reflect.DeepEqual(request.StopSequences, []string{"END"}) {
+		t.Errorf("Expected stop sequences [END], got %v", request.StopSequences)
+	}
+
+	// Thinking has to fit in max_tokens, and sampling parameters are not allowed with it
+	request = convertSessionParamsToAnthropicRequest(nil, "claude-haiku-4-5-thinking", SessionParams{GenParams: genParams})
+	if request.Thinking == nil || request.Thinking.BudgetTokens >= request.MaxTokens {
+		t.Errorf("Expected thinking budget below max_tokens %d, got %+v", request.MaxTokens, request.Thinking)
+	}
+	if request.Temperature != nil {
+		t.Errorf("Expected no temperature with thinking, got %v", *request.Temperature)
+	}
+
+	genParams.MaxOutputTokens = 512
+	request = convertSessionParamsToAnthropicRequest(nil, "claude-haiku-4-5-thinking", SessionParams{GenParams: genParams})
+	if request.Thinking != nil {
+		t.Errorf("Expected thinking to be disabled without enough max_tokens, got %+v", request.Thinking)
+	}
+}
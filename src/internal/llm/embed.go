@@ -0,0 +1,210 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lifthrasiir/angel/internal/database"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// Embedding tasks, following the task types of Gemini API
+const (
+	EmbedTaskDocument = "RETRIEVAL_DOCUMENT"
+	EmbedTaskQuery    = "RETRIEVAL_QUERY"
+)
+
+// EmbeddingSettingsConfigName is the app config holding EmbeddingSettings as JSON
+const EmbeddingSettingsConfigName = "embedding_settings"
+
+const (
+	embeddingBatchSize  = 100  // Maximum number of texts per embedding request
+	embeddingMaxPerRun  = 5000 // Maximum number of messages embedded per housekeeping run
+	embeddingLogBatches = 10   // Progress is logged every this many batches
+)
+
+// EmbedParams holds parameters for computing embeddings.
+type EmbedParams struct {
+	Texts      []string
+	Task       string // EmbedTaskDocument or EmbedTaskQuery, ignored by providers without task types
+	Dimensions int    // Zero for the model default
+}
+
+// Embedder is implemented by LLM providers that can compute text embeddings.
+type Embedder interface {
+	Embed(ctx context.Context, modelName string, params EmbedParams) ([][]float32, error)
+}
+
+// ErrEmbeddingUnsupported is returned when the provider cannot compute embeddings
+var ErrEmbeddingUnsupported = errors.New("provider does not support embeddings")
+
+// EmbeddingModel computes embeddings with the provider and model selected by EmbeddingSettings
+type EmbeddingModel struct {
+	embedder Embedder
+	settings EmbeddingSettings
+}
+
+// Index identifies embeddings computed by this model, which are not comparable to those from other models
+func (m *EmbeddingModel) Index() string {
+	return fmt.Sprintf("%s|%s|%d", m.settings.Provider, m.settings.Model, m.settings.Dimensions)
+}
+
+// Embed returns an embedding for each text
+func (m *EmbeddingModel) Embed(ctx context.Context, task string, texts []string) ([][]float32, error) {
+	embeddings, err := m.embedder.Embed(ctx, m.settings.Model, EmbedParams{
+		Texts:      texts,
+		Task:       task,
+		Dimensions: m.settings.Dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddings))
+	}
+	return embeddings, nil
+}
+
+// SetEmbeddingSettings sets the embedding model used for semantic search
+func (r *Models) SetEmbeddingSettings(settings EmbeddingSettings) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.embeddingSettings = settings
+}
+
+// EmbeddingSettings returns the current embedding settings
+func (r *Models) EmbeddingSettings() EmbeddingSettings {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.embeddingSettings
+}
+
+// ResolveEmbeddingModel returns the embedding model for given settings, or nil if embeddings are disabled
+func (r *Models) ResolveEmbeddingModel(settings EmbeddingSettings) (*EmbeddingModel, error) {
+	if settings.Provider == "" {
+		return nil, nil
+	}
+	if settings.Model == "" {
+		return nil, MakeBadRequestError("embedding model is required")
+	}
+	if settings.Dimensions < 0 {
+		return nil, MakeBadRequestError("embedding dimensions cannot be negative")
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	provider, ok := r.llmProviders[settings.Provider]
+	if !ok {
+		return nil, MakeBadRequestError("unknown embedding provider: %s", settings.Provider)
+	}
+	embedder, ok := r.wrapLLMProviderUnsafe(provider).(Embedder)
+	if !ok {
+		return nil, MakeBadRequestError("%s: %s", ErrEmbeddingUnsupported.Error(), settings.Provider)
+	}
+	return &EmbeddingModel{embedder: embedder, settings: settings}, nil
+}
+
+// GetEmbeddingModel returns the current embedding model, or nil if embeddings are disabled
+func (r *Models) GetEmbeddingModel() (*EmbeddingModel, error) {
+	return r.ResolveEmbeddingModel(r.EmbeddingSettings())
+}
+
+// IndexMessageEmbeddings computes embeddings of up to maxMessages messages in the search index
+// that have none, newest first, and returns the number of embedded messages.
+func IndexMessageEmbeddings(ctx context.Context, db *database.Database, models *Models, maxMessages int) (int, error) {
+	model, err := models.GetEmbeddingModel()
+	if err != nil || model == nil {
+		return 0, err
+	}
+	index := model.Index()
+
+	if pruned, err := database.PruneMessageEmbeddings(db); err != nil {
+		return 0, err
+	} else if pruned > 0 {
+		log.Printf("Pruned %d embeddings of removed messages", pruned)
+	}
+
+	embedded := 0
+	for batch := 1; embedded < maxMessages; batch++ {
+		messages, err := database.GetUnembeddedMessages(db, index, min(embeddingBatchSize, maxMessages-embedded))
+		if err != nil {
+			return embedded, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		ids := make([]int, len(messages))
+		texts := make([]string, len(messages))
+		for i, message := range messages {
+			ids[i] = message.ID
+			texts[i] = message.Text
+		}
+		embeddings, err := model.Embed(ctx, EmbedTaskDocument, texts)
+		if err != nil {
+			return embedded, fmt.Errorf("failed to embed messages: %w", err)
+		}
+		if err := database.SaveMessageEmbeddings(db, index, ids, embeddings); err != nil {
+			return embedded, err
+		}
+
+		embedded += len(messages)
+		if batch%embeddingLogBatches == 0 {
+			log.Printf("Embedded %d messages so far", embedded)
+		}
+	}
+	return embedded, nil
+}
+
+// SearchMessagesHybrid searches the chat history by keywords and, once messages are embedded, semantic similarity.
+// It falls back to keywords alone if the query cannot be embedded.
+func SearchMessagesHybrid(ctx context.Context, db *database.Database, models *Models, query string, offset, limit int, workspaceID string) ([]database.SearchResult, bool, error) {
+	var index string
+	var embedding []float32
+
+	model, err := models.GetEmbeddingModel()
+	if err != nil {
+		log.Printf("Embedding model is unavailable, searching by keywords only: %v", err)
+	} else if model != nil {
+		if ready, err := database.HasMessageEmbeddings(db, model.Index()); err != nil {
+			return nil, false, err
+		} else if ready {
+			embeddings, err := model.Embed(ctx, EmbedTaskQuery, []string{query})
+			if err != nil {
+				log.Printf("Failed to embed search query, searching by keywords only: %v", err)
+			} else {
+				index = model.Index()
+				embedding = embeddings[0]
+			}
+		}
+	}
+
+	return database.SearchMessagesHybrid(db, query, index, embedding, offset, limit, workspaceID)
+}
+
+type embeddingJob struct {
+	db     *database.Database
+	models *Models
+}
+
+// EmbeddingJob returns a housekeeping job that embeds new messages for semantic search.
+func EmbeddingJob(db *database.Database, models *Models) HousekeepingJob {
+	return &embeddingJob{db: db, models: models}
+}
+
+func (job *embeddingJob) Name() string { return "Message embedding" }
+func (job *embeddingJob) First() error { return job.Sometimes() }
+func (job *embeddingJob) Sometimes() error {
+	ctx := database.ContextWith(context.Background(), job.db)
+	embedded, err := IndexMessageEmbeddings(ctx, job.db, job.models, embeddingMaxPerRun)
+	if embedded > 0 {
+		log.Printf("Message embedding: embedded %d message(s)", embedded)
+	}
+	return err
+}
+func (job *embeddingJob) Last() error { return nil }
@@ -26,6 +26,7 @@ import (
 // Ensure providers implement LLMProvider
 var _ LLMProvider = (*GeminiAPIProvider)(nil)
 var _ LLMProvider = (*CodeAssistProvider)(nil)
+var _ Embedder = (*GeminiAPIProvider)(nil)
 
 // Reserved names for Gemini's internal tools.
 const (
@@ -88,8 +89,16 @@ func (p *GeminiAPIProvider) SendMessageStream(ctx context.Context, apiModelName
 
 		// Convert SessionParams to GenerateContentRequest
 		request := convertSessionParamsToGenerateRequest(tools, model, params)
+		applyContextCache(ctx, db, client, config.ID, apiModelName, params.SessionId, &request)
 
 		respBody, err := client.StreamGenerateContent(ctx, apiModelName, request)
+		if apiErr, ok := err.(*APIError); ok && request.CachedContent != "" && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != 429 {
+			// The cache may have been deleted or expired early; retry without it
+			log.Printf("GeminiAPIProvider.SendMessageStream: Request with context cache %s failed, retrying without it: %v", request.CachedContent, err)
+			forgetContextCache(db, config.ID, apiModelName, params.SessionId)
+			request = convertSessionParamsToGenerateRequest(tools, model, params)
+			respBody, err = client.StreamGenerateContent(ctx, apiModelName, request)
+		}
 		if err != nil {
 			lastErr = err
 
@@ -97,7 +106,7 @@ func (p *GeminiAPIProvider) SendMessageStream(ctx context.Context, apiModelName
 			if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == 429 {
 				// Handle rate limit
 				go func() {
-					retryAfter := parseRetryAfter("")
+					retryAfter := parseRetryAfter(apiErr.RetryAfter)
 					database.HandleModelRateLimit(db, config.ID, apiModelName, retryAfter)
 					log.Printf("Rate limit detected for Gemini API config %s, model %s", config.ID, apiModelName)
 				}()
@@ -123,6 +132,7 @@ func (p *GeminiAPIProvider) SendMessageStream(ctx context.Context, apiModelName
 				var geminiResp GenerateContentResponse
 				if err := dec.Decode(&geminiResp); err != nil {
 					log.Printf("GeminiAPIProvider.SendMessageStream: Failed to decode JSON object from stream: %v", err)
+					yieldStreamInterrupted(ctx, yield, err)
 					return
 				}
 
@@ -150,8 +160,12 @@ func (p *GeminiAPIProvider) GenerateContentOneShot(ctx context.Context, modelNam
 	var fullResponse strings.Builder
 	var urlContextMeta *URLContextMetadata
 	var groundingMetadata *GroundingMetadata
+	var usageMetadata *UsageMetadata
 
 	for resp := range seq {
+		if resp.UsageMetadata != nil {
+			usageMetadata = resp.UsageMetadata
+		}
 		if len(resp.Candidates) > 0 {
 			candidate := resp.Candidates[0]
 			if len(candidate.Content.Parts) > 0 {
@@ -175,6 +189,7 @@ func (p *GeminiAPIProvider) GenerateContentOneShot(ctx context.Context, modelNam
 			Text:               fullResponse.String(),
 			URLContextMetadata: urlContextMeta,
 			GroundingMetadata:  groundingMetadata,
+			UsageMetadata:      usageMetadata,
 		}, nil
 	}
 
@@ -221,7 +236,68 @@ func (p *GeminiAPIProvider) CountTokens(ctx context.Context, apiModelName string
 		// Check rate limit
 		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == 429 {
 			go func() {
-				retryAfter := parseRetryAfter("")
+				retryAfter := parseRetryAfter(apiErr.RetryAfter)
+				database.HandleModelRateLimit(db, config.ID, apiModelName, retryAfter)
+				log.Printf("Rate limit detected for Gemini API config %s, model %s", config.ID, apiModelName)
+			}()
+		}
+	}
+
+	return nil, lastErr
+}
+
+// Embed calls the batchEmbedContents of Gemini API, trying each enabled API key in turn
+func (p *GeminiAPIProvider) Embed(ctx context.Context, apiModelName string, params EmbedParams) ([][]float32, error) {
+	if apiModelName == "" {
+		return nil, fmt.Errorf("model name cannot be empty")
+	}
+
+	db, err := database.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := database.GetGeminiAPIConfigs(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Gemini API configs: %w", err)
+	}
+
+	// Sort configs by last_used for this model (oldest first)
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].LastUsedByModel[apiModelName].Before(configs[j].LastUsedByModel[apiModelName])
+	})
+
+	requests := make([]EmbedContentRequest, len(params.Texts))
+	for i, text := range params.Texts {
+		requests[i] = EmbedContentRequest{
+			Model:                "models/" + apiModelName,
+			Content:              Content{Parts: []Part{{Text: text}}},
+			TaskType:             params.Task,
+			OutputDimensionality: params.Dimensions,
+		}
+	}
+
+	lastErr := fmt.Errorf("no enabled Gemini API config")
+	for _, config := range configs {
+		if !config.Enabled {
+			continue
+		}
+
+		clientProvider := NewGeminiAPIHTTPClientProvider(config.APIKey)
+		client := NewGeminiAPIClient(clientProvider, config.APIKey)
+
+		database.UpdateModelLastUsed(db, config.ID, apiModelName)
+
+		result, err := client.BatchEmbedContents(ctx, apiModelName, requests)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+
+		// Check rate limit
+		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == 429 {
+			go func() {
+				retryAfter := parseRetryAfter(apiErr.RetryAfter)
 				database.HandleModelRateLimit(db, config.ID, apiModelName, retryAfter)
 				log.Printf("Rate limit detected for Gemini API config %s, model %s", config.ID, apiModelName)
 			}()
@@ -326,7 +402,7 @@ func (p *CodeAssistProvider) SendMessageStream(ctx context.Context, apiModelName
 			// Check rate limit
 			if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == 429 {
 				go func() {
-					retryAfter := parseRetryAfter("")
+					retryAfter := parseRetryAfter(apiErr.RetryAfter)
 					database.HandleOAuthRateLimit(db, token.ID, apiModelName, retryAfter)
 					log.Printf("Rate limit detected for OAuth token %d, model %s", token.ID, apiModelName)
 				}()
@@ -351,8 +427,12 @@ func (p *CodeAssistProvider) SendMessageStream(ctx context.Context, apiModelName
 				var caResp CaGenerateContentResponse
 				if err := dec.Decode(&caResp); err != nil {
 					log.Printf("CodeAssistProvider.SendMessageStream: Failed to decode JSON object from stream: %v", err)
+					yieldStreamInterrupted(ctx, yield, err)
 					return
 				}
+				if caResp.Error != nil {
+					caResp.Response.Error = caResp.Error
+				}
 
 				if !yield(caResp.Response) {
 					return
@@ -378,8 +458,12 @@ func (p *CodeAssistProvider) GenerateContentOneShot(ctx context.Context, modelNa
 	var fullResponse strings.Builder
 	var urlContextMeta *URLContextMetadata
 	var groundingMetadata *GroundingMetadata
+	var usageMetadata *UsageMetadata
 
 	for resp := range seq {
+		if resp.UsageMetadata != nil {
+			usageMetadata = resp.UsageMetadata
+		}
 		if len(resp.Candidates) > 0 {
 			candidate := resp.Candidates[0]
 			if len(candidate.Content.Parts) > 0 {
@@ -403,6 +487,7 @@ func (p *CodeAssistProvider) GenerateContentOneShot(ctx context.Context, modelNa
 			Text:               fullResponse.String(),
 			URLContextMetadata: urlContextMeta,
 			GroundingMetadata:  groundingMetadata,
+			UsageMetadata:      usageMetadata,
 		}, nil
 	}
 
@@ -470,7 +555,7 @@ func (p *CodeAssistProvider) CountTokens(ctx context.Context, apiModelName strin
 
 		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == 429 {
 			go func() {
-				retryAfter := parseRetryAfter("")
+				retryAfter := parseRetryAfter(apiErr.RetryAfter)
 				database.HandleOAuthRateLimit(db, token.ID, apiModelName, retryAfter)
 				log.Printf("Rate limit detected for OAuth token %d, model %s", token.ID, apiModelName)
 			}()
@@ -486,6 +571,14 @@ func (p *CodeAssistProvider) MaxTokens(apiModelName string) int {
 	return 1048576
 }
 
+// yieldStreamInterrupted reports a stream that ended abruptly, unless it was canceled
+func yieldStreamInterrupted(ctx context.Context, yield func(GenerateContentResponse) bool, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	yield(GenerateContentResponse{Error: &ErrorStatus{Message: fmt.Sprintf("stream interrupted: %v", err)}})
+}
+
 // parseRetryAfter parses Retry-After header
 func parseRetryAfter(retryAfter string) time.Duration {
 	if retryAfter == "" {
@@ -524,7 +617,7 @@ func (p *geminiAPIHTTPClientProvider) Client(ctx context.Context) *http.Client {
 // convertSessionParamsToGenerateRequest converts SessionParams to GenerateContentRequest
 func convertSessionParamsToGenerateRequest(toolRegistry *tool.Tools, model *Model, params SessionParams) GenerateContentRequest {
 	// Determine generation params source
-	// Priority: model.GenParams > defaults
+	// Priority: params.GenParams > model.GenParams > defaults
 	var ignoreSystemPrompt bool
 	var toolSupported bool
 	var thoughtEnabled bool
@@ -546,6 +639,7 @@ func convertSessionParamsToGenerateRequest(toolRegistry *tool.Tools, model *Mode
 		responseModalities = []string{"TEXT"}
 		genParams = spec.GenerationParams{}
 	}
+	genParams = genParams.Merge(params.GenParams)
 
 	var systemInstruction *Content
 	if params.SystemPrompt != "" && !ignoreSystemPrompt {
@@ -584,14 +678,18 @@ func convertSessionParamsToGenerateRequest(toolRegistry *tool.Tools, model *Mode
 
 	var temperature, topP *float32
 	var topK *int32
-	if genParams.Temperature >= 0 {
-		temperature = &genParams.Temperature
+	if genParams.Temperature != nil && *genParams.Temperature >= 0 {
+		temperature = genParams.Temperature
+	}
+	if genParams.TopP != nil && *genParams.TopP >= 0 {
+		topP = genParams.TopP
 	}
-	if genParams.TopP >= 0 {
-		topP = &genParams.TopP
+	if genParams.TopK != nil && *genParams.TopK >= 0 {
+		topK = genParams.TopK
 	}
-	if genParams.TopK >= 0 {
-		topK = &genParams.TopK
+	var maxOutputTokens *int32
+	if genParams.MaxOutputTokens > 0 {
+		maxOutputTokens = &genParams.MaxOutputTokens
 	}
 
 	return GenerateContentRequest{
@@ -603,7 +701,15 @@ func convertSessionParamsToGenerateRequest(toolRegistry *tool.Tools, model *Mode
 			Temperature:        temperature,
 			TopP:               topP,
 			TopK:               topK,
+			MaxOutputTokens:    maxOutputTokens,
+			StopSequences:      genParams.StopSequences,
+			PresencePenalty:    genParams.PresencePenalty,
+			FrequencyPenalty:   genParams.FrequencyPenalty,
+			Seed:               genParams.Seed,
 			ResponseModalities: responseModalities,
+			MediaResolution:    genParams.MediaResolution,
+			ResponseMimeType:   params.ResponseMimeType,
+			ResponseSchema:     params.ResponseSchema,
 		},
 	}
 }
@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+const (
+	// Estimated number of tokens in a stable prefix before it is worth caching
+	geminiCacheMinTokens = 32768
+	// Estimated number of uncached tokens after the cached prefix before the cache is recreated with a longer prefix
+	geminiCacheRefreshTokens = 32768
+	// Lifetime of a context cache, extended when it is used past half of its lifetime
+	geminiCacheTTL = 15 * time.Minute
+	// Caches expiring sooner than this are not used, as the request may reach the server after the expiry
+	geminiCacheExpiryMargin = time.Minute
+)
+
+// geminiContextCache manages the context cache for the stable prefix of a session's requests.
+// Everything but the last content is considered stable, because earlier contents of a branch never change.
+type geminiContextCache struct {
+	client    *GeminiAPIClient
+	db        *database.SessionDatabase
+	configID  string
+	modelName string
+}
+
+// applyContextCache makes the request refer to a context cache for its stable prefix when worthwhile,
+// creating or refreshing the cache as needed. Failures are logged and leave the request uncached.
+func applyContextCache(ctx context.Context, db *database.Database, client *GeminiAPIClient, configID, modelName, sessionId string, request *GenerateContentRequest) {
+	if sessionId == "" || len(request.Contents) < 2 {
+		return
+	}
+
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		log.Printf("applyContextCache: Failed to open session %s: %v", sessionId, err)
+		return
+	}
+	defer sdb.Close()
+
+	cc := &geminiContextCache{client: client, db: sdb, configID: configID, modelName: modelName}
+	recorded, err := database.GetContentCache(sdb, configID, modelName)
+	if err != nil {
+		log.Printf("applyContextCache: Failed to get context cache: %v", err)
+	}
+	var cache *ContentCache
+	if recorded != nil && cc.matches(recorded, request) {
+		cache = recorded
+	}
+	if cache != nil {
+		tail := request.Contents[cache.ContentCount : len(request.Contents)-1]
+		if estimateContentsTokens(tail) < geminiCacheRefreshTokens {
+			cc.extend(ctx, cache)
+			useContextCache(request, cache)
+			return
+		}
+	}
+
+	stable := len(request.Contents) - 1
+	prefixTokens := estimateContentsTokens(request.Contents[:stable])
+	if request.SystemInstruction != nil {
+		prefixTokens += estimateContentsTokens([]Content{*request.SystemInstruction})
+	}
+	if prefixTokens < geminiCacheMinTokens {
+		return
+	}
+
+	newCache, err := cc.create(ctx, request, stable)
+	if err != nil {
+		log.Printf("applyContextCache: Failed to create context cache for session %s: %v", sessionId, err)
+		if cache != nil {
+			cc.extend(ctx, cache)
+			useContextCache(request, cache)
+		}
+		return
+	}
+	if recorded != nil && time.Now().Before(time.Unix(recorded.ExpireAt, 0)) {
+		if err := client.DeleteCachedContent(ctx, recorded.Name); err != nil {
+			log.Printf("applyContextCache: Failed to delete superseded context cache %s: %v", recorded.Name, err)
+		}
+	}
+	useContextCache(request, newCache)
+}
+
+// forgetContextCache removes the recorded cache, so that a new one is created next time
+func forgetContextCache(db *database.Database, configID, modelName, sessionId string) {
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		log.Printf("forgetContextCache: Failed to open session %s: %v", sessionId, err)
+		return
+	}
+	defer sdb.Close()
+	if err := database.DeleteContentCache(sdb, configID, modelName); err != nil {
+		log.Printf("forgetContextCache: %v", err)
+	}
+}
+
+// matches returns true if the cache is still alive and matches the prefix of the request
+func (cc *geminiContextCache) matches(cache *ContentCache, request *GenerateContentRequest) bool {
+	return time.Unix(cache.ExpireAt, 0).After(time.Now().Add(geminiCacheExpiryMargin)) &&
+		cache.ContentCount < len(request.Contents) &&
+		cache.PrefixHash == contextCachePrefixHash(request, cache.ContentCount)
+}
+
+// create caches the first count contents of the request along with its system instruction and tools
+func (cc *geminiContextCache) create(ctx context.Context, request *GenerateContentRequest, count int) (*ContentCache, error) {
+	created, err := cc.client.CreateCachedContent(ctx, CachedContent{
+		Model:             "models/" + cc.modelName,
+		Contents:          request.Contents[:count],
+		SystemInstruction: request.SystemInstruction,
+		Tools:             request.Tools,
+		ToolConfig:        request.ToolConfig,
+		TTL:               fmt.Sprintf("%ds", int(geminiCacheTTL.Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &ContentCache{
+		ConfigID:     cc.configID,
+		Model:        cc.modelName,
+		Name:         created.Name,
+		PrefixHash:   contextCachePrefixHash(request, count),
+		ContentCount: count,
+		ExpireAt:     parseCacheExpireTime(created.ExpireTime),
+	}
+	if created.UsageMetadata != nil {
+		cache.TokenCount = created.UsageMetadata.TotalTokenCount
+	}
+	if err := database.SaveContentCache(cc.db, *cache); err != nil {
+		log.Printf("applyContextCache: Failed to save context cache %s: %v", cache.Name, err)
+	}
+	log.Printf("Created context cache %s for %d contents (%d tokens)", cache.Name, count, cache.TokenCount)
+	return cache, nil
+}
+
+// extend refreshes the lifetime of the cache once half of it has passed
+func (cc *geminiContextCache) extend(ctx context.Context, cache *ContentCache) {
+	if time.Until(time.Unix(cache.ExpireAt, 0)) > geminiCacheTTL/2 {
+		return
+	}
+
+	updated, err := cc.client.UpdateCachedContentTTL(ctx, cache.Name, geminiCacheTTL)
+	if err != nil {
+		log.Printf("applyContextCache: Failed to extend context cache %s: %v", cache.Name, err)
+		return
+	}
+	cache.ExpireAt = parseCacheExpireTime(updated.ExpireTime)
+	if err := database.SaveContentCache(cc.db, *cache); err != nil {
+		log.Printf("applyContextCache: Failed to save context cache %s: %v", cache.Name, err)
+	}
+}
+
+// useContextCache replaces the cached part of the request with a reference to the cache.
+// Cached requests cannot have their own system instruction, tools or tool config.
+func useContextCache(request *GenerateContentRequest, cache *ContentCache) {
+	request.CachedContent = cache.Name
+	request.Contents = request.Contents[cache.ContentCount:]
+	request.SystemInstruction = nil
+	request.Tools = nil
+	request.ToolConfig = nil
+}
+
+// contextCachePrefixHash returns a digest of everything that would be cached for the first count contents
+func contextCachePrefixHash(request *GenerateContentRequest, count int) string {
+	data, _ := json.Marshal(CachedContent{
+		Contents:          request.Contents[:count],
+		SystemInstruction: request.SystemInstruction,
+		Tools:             request.Tools,
+		ToolConfig:        request.ToolConfig,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseCacheExpireTime parses the expiry of a cache, assuming the default lifetime if missing
+func parseCacheExpireTime(expireTime string) int64 {
+	t, err := time.Parse(time.RFC3339Nano, expireTime)
+	if err != nil {
+		return time.Now().Add(geminiCacheTTL).Unix()
+	}
+	return t.Unix()
+}
+
+// estimateContentsTokens estimates the number of tokens in contents without calling the API.
+// Gemini's vocabulary is not public, so this counts with the embedded o200k vocabulary instead.
+func estimateContentsTokens(contents []Content) int {
+	text, images := renderContentsForTokenCount(contents)
+	count, err := countTokensLocally("", text)
+	if err != nil {
+		count = len(text) / 4 // Last resort only; the embedded vocabulary should always load
+	}
+	return count + images*openAITokensPerImage
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/tool"
+)
+
+// redirectClientProvider sends all requests to a test server regardless of the requested host
+type redirectClientProvider struct {
+	target *url.URL
+}
+
+func (p redirectClientProvider) Client(ctx context.Context) *http.Client {
+	return &http.Client{Transport: p}
+}
+
+func (p redirectClientProvider) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = p.target.Scheme
+	req.URL.Host = p.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestApplyContextCache(t *testing.T) {
+	var creates, deletes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/v1beta/cachedContents":
+			var cachedContent CachedContent
+			if err := json.NewDecoder(r.Body).Decode(&cachedContent); err != nil {
+				t.Errorf("Failed to decode cached content: %v", err)
+			}
+			if cachedContent.Model != "models/gemini-test" || cachedContent.SystemInstruction == nil {
+				t.Errorf("Unexpected cached content: model %q, system instruction %v", cachedContent.Model, cachedContent.SystemInstruction)
+			}
+			name := "cachedContents/c" + string(rune('0'+len(creates)))
+			creates = append(creates, name)
+			json.NewEncoder(w).Encode(CachedContent{
+				Name:          name,
+				ExpireTime:    time.Now().Add(geminiCacheTTL).UTC().Format(time.RFC3339),
+				UsageMetadata: &CachedContentUsageMetadata{TotalTokenCount: 50000},
+			})
+		case r.Method == "DELETE":
+			deletes = append(deletes, strings.TrimPrefix(r.URL.Path, "/v1beta/"))
+			w.Write([]byte("{}"))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	db, err := database.InitTestDB(t.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+	defer db.Close()
+	sdb, _, err := database.CreateSession(db, "session", "system", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	sdb.Close()
+
+	target, _ := url.Parse(server.URL)
+	client := NewGeminiAPIClient(redirectClientProvider{target: target}, "key")
+	ctx := context.Background()
+
+	userText := func(text string) Content { return Content{Role: "user", Parts: []Part{{Text: text}}} }
+	modelText := func(text string) Content { return Content{Role: "model", Parts: []Part{{Text: text}}} }
+	newRequest := func(system string, contents ...Content) *GenerateContentRequest {
+		return &GenerateContentRequest{
+			Contents:          contents,
+			SystemInstruction: &Content{Parts: []Part{{Text: system}}},
+		}
+	}
+	long := userText(strings.Repeat("context ", 40000))
+
+	// Short prefixes are not cached
+	request := newRequest("system", userText("hello"), modelText("hi"), userText("bye"))
+	applyContextCache(ctx, db, client, "config", "gemini-test", "session", request)
+	if request.CachedContent != "" || len(creates) != 0 {
+		t.Fatalf("Expected a short prefix not to be cached, got %q", request.CachedContent)
+	}
+
+	// A long stable prefix is cached, except for the last content
+	request = newRequest("system", long, modelText("ok"), userText("question 1"))
+	applyContextCache(ctx, db, client, "config", "gemini-test", "session", request)
+	if request.CachedContent != "cachedContents/c0" || len(request.Contents) != 1 || request.SystemInstruction != nil {
+		t.Fatalf("Expected the prefix to be cached, got %q with %d contents", request.CachedContent, len(request.Contents))
+	}
+
+	// A later turn with the same prefix reuses the cache
+	request = newRequest("system", long, modelText("ok"), userText("question 1"), modelText("answer 1"), userText("question 2"))
+	applyContextCache(ctx, db, client, "config", "gemini-test", "session", request)
+	if request.CachedContent != "cachedContents/c0" || len(request.Contents) != 3 || len(creates) != 1 {
+		t.Fatalf("Expected the cache to be reused, got %q with %d contents after %d creations", request.CachedContent, len(request.Contents), len(creates))
+	}
+
+	// Caches are separate for each API config
+	request = newRequest("system", long, modelText("ok"), userText("question 1"))
+	applyContextCache(ctx, db, client, "other", "gemini-test", "session", request)
+	if request.CachedContent != "cachedContents/c1" {
+		t.Fatalf("Expected a new cache for another config, got %q", request.CachedContent)
+	}
+
+	// A changed prefix replaces the cache
+	request = newRequest("changed system", long, modelText("ok"), userText("question 1"))
+	applyContextCache(ctx, db, client, "config", "gemini-test", "session", request)
+	if request.CachedContent != "cachedContents/c2" {
+		t.Fatalf("Expected a new cache for a changed prefix, got %q", request.CachedContent)
+	}
+	if len(deletes) != 1 || deletes[0] != "cachedContents/c0" {
+		t.Errorf("Expected the superseded cache to be deleted, got %v", deletes)
+	}
+
+	// Requests without a session are never cached
+	request = newRequest("system", long, modelText("ok"), userText("question 1"))
+	applyContextCache(ctx, db, client, "config", "gemini-test", "", request)
+	if request.CachedContent != "" {
+		t.Errorf("Expected no cache without a session, got %q", request.CachedContent)
+	}
+}
+
+func TestContextCachePrefixHashWithTools(t *testing.T) {
+	tools := tool.NewTools()
+	for _, name := range []string{"read_file", "write_file", "list_directory", "run_command", "web_fetch", "recall"} {
+		tools.Register(tool.Definition{Name: name, Description: "Tool " + name, Parameters: &Schema{Type: TypeObject}})
+	}
+
+	newRequest := func() *GenerateContentRequest {
+		return &GenerateContentRequest{
+			Contents:          []Content{{Role: "user", Parts: []Part{{Text: "question"}}}},
+			SystemInstruction: &Content{Parts: []Part{{Text: "system"}}},
+			Tools:             tools.ForGemini(),
+		}
+	}
+
+	// The tool list is built from maps, so the hash would differ if the order were not stable
+	expected := contextCachePrefixHash(newRequest(), 1)
+	for i := 0; i < 20; i++ {
+		if hash := contextCachePrefixHash(newRequest(), 1); hash != expected {
+			t.Fatalf("Expected the prefix hash to be stable across tool lists, got %s and %s", expected, hash)
+		}
+	}
+}
@@ -7,4 +7,7 @@ require (
 	github.com/lifthrasiir/angel/internal/database v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/llm/spec v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/types v0.0.0-00010101000000-000000000000
+	github.com/tiktoken-go/tokenizer v0.7.0
 )
+
+require github.com/dlclark/regexp2 v1.11.5 // indirect
@@ -2,9 +2,15 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"iter"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
 
 	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/llm/spec"
@@ -16,6 +22,12 @@ type SessionParams struct {
 	SystemPrompt    string
 	IncludeThoughts bool
 	ToolConfig      map[string]interface{}
+	GenParams       spec.GenerationParams // Per-session overrides, merged over the model preset
+	SessionId       string                // Used for provider-side state like context caches, may be empty
+
+	// Structured output: ResponseSchema constrains the response when ResponseMimeType is "application/json"
+	ResponseMimeType string
+	ResponseSchema   *Schema
 }
 
 // OneShotResult holds result of a single-shot content generation,
@@ -24,6 +36,7 @@ type OneShotResult struct {
 	Text               string
 	URLContextMetadata *URLContextMetadata // Assuming this struct will be defined in gemini_types.go or similar
 	GroundingMetadata  *GroundingMetadata  // Assuming this struct will be defined in gemini_types.go or similar
+	UsageMetadata      *UsageMetadata      // Token usage of the call, if reported
 }
 
 // LLMProvider defines the interface for interacting with an LLM.
@@ -43,9 +56,15 @@ type ModelProvider interface {
 	Name() string
 }
 
+// ProviderReporter is implemented by stream closers that know which provider is answering the stream
+type ProviderReporter interface {
+	AnsweringProvider() string
+}
+
 // modelProviderImpl is the default implementation of ModelProvider that wraps LLMProvider
 type modelProviderImpl struct {
 	llm                LLMProvider
+	providerType       string
 	modelName          string
 	maxTokens          int
 	genParams          spec.GenerationParams
@@ -57,11 +76,13 @@ type modelProviderImpl struct {
 
 // SendMessageStream calls the underlying provider with the stored model name
 func (mp *modelProviderImpl) SendMessageStream(ctx context.Context, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+	params.GenParams = mp.genParams.Merge(params.GenParams)
 	return mp.llm.SendMessageStream(ctx, mp.modelName, params)
 }
 
 // GenerateContentOneShot calls the underlying provider with the stored model name
 func (mp *modelProviderImpl) GenerateContentOneShot(ctx context.Context, params SessionParams) (OneShotResult, error) {
+	params.GenParams = mp.genParams.Merge(params.GenParams)
 	return mp.llm.GenerateContentOneShot(ctx, mp.modelName, params)
 }
 
@@ -80,6 +101,11 @@ func (mp *modelProviderImpl) Name() string {
 	return mp.modelName
 }
 
+// ProviderName returns the provider type and model name, e.g. "geminicli::gemini-3-flash-preview"
+func (mp *modelProviderImpl) ProviderName() string {
+	return mp.providerType + "::" + mp.modelName
+}
+
 // GetModelConfig returns the model configuration for providers that need it
 func (mp *modelProviderImpl) GetModelConfig() *Model {
 	return &Model{
@@ -95,7 +121,7 @@ func (mp *modelProviderImpl) GetModelConfig() *Model {
 }
 
 // newModelProvider creates a new ModelProvider from an LLMProvider, model name, and model spec
-func newModelProviderWithSpec(provider LLMProvider, modelName string, modelSpec *spec.ModelSpec) ModelProvider {
+func newModelProviderWithSpec(provider LLMProvider, providerType, modelName string, modelSpec *spec.ModelSpec) ModelProvider {
 	var genParams spec.GenerationParams
 	var maxTokens int
 	var toolSupported, thoughtEnabled, ignoreSystemPrompt bool
@@ -120,6 +146,7 @@ func newModelProviderWithSpec(provider LLMProvider, modelName string, modelSpec
 
 	return &modelProviderImpl{
 		llm:                provider,
+		providerType:       providerType,
 		modelName:          modelName,
 		maxTokens:          maxTokens,
 		genParams:          genParams,
@@ -133,7 +160,7 @@ func newModelProviderWithSpec(provider LLMProvider, modelName string, modelSpec
 // newModelProvider creates a new ModelProvider from an LLMProvider and model name
 // Uses default model configuration
 func newModelProvider(provider LLMProvider, modelName string) ModelProvider {
-	return newModelProviderWithSpec(provider, modelName, nil)
+	return newModelProviderWithSpec(provider, "", modelName, nil)
 }
 
 // ModelProviderChain chains multiple ModelProviders with ordered fallback
@@ -150,30 +177,73 @@ func NewModelProviderChain(providers []ModelProvider, modelName string) ModelPro
 	}
 }
 
-// SendMessageStream tries each provider in order until one succeeds
+// SendMessageStream tries each provider in order until one succeeds.
+// Retryable errors are retried with back-off, and errors inside the stream fail over as well
+// as long as no content has been emitted yet.
 func (c *ModelProviderChain) SendMessageStream(ctx context.Context, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
-	var lastErr error
-	for _, provider := range c.providers {
-		seq, closer, err := provider.SendMessageStream(ctx, params)
-		if err == nil {
-			return seq, closer, nil
-		}
-		lastErr = err
+	cur := &chainCursor{providers: c.providers}
+	seq, closer, err := cur.openStream(ctx, params)
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil, nil, lastErr
+
+	stream := &chainStream{}
+	stream.set(closer, cur.providerName())
+
+	return func(yield func(GenerateContentResponse) bool) {
+		for {
+			var streamErr error
+			emitted := false
+			for resp := range seq {
+				if resp.Error != nil && !emitted {
+					streamErr = resp.Error
+					break
+				}
+				if len(resp.Candidates) > 0 {
+					emitted = true
+				}
+				if !yield(resp) {
+					return
+				}
+			}
+			if emitted || ctx.Err() != nil || stream.isClosed() {
+				return
+			}
+			if streamErr == nil {
+				streamErr = errEmptyResponse
+			}
+
+			// Nothing was emitted, so the whole request can be sent again
+			stream.set(nil, "")
+			if !cur.next(ctx, streamErr) {
+				yield(GenerateContentResponse{Error: toErrorStatus(streamErr)})
+				return
+			}
+			seq, closer, err = cur.openStream(ctx, params)
+			if err != nil {
+				yield(GenerateContentResponse{Error: toErrorStatus(err)})
+				return
+			}
+			stream.set(closer, cur.providerName())
+		}
+	}, stream, nil
 }
 
 // GenerateContentOneShot tries each provider in order until one succeeds
 func (c *ModelProviderChain) GenerateContentOneShot(ctx context.Context, params SessionParams) (OneShotResult, error) {
-	var lastErr error
-	for _, provider := range c.providers {
-		result, err := provider.GenerateContentOneShot(ctx, params)
+	cur := &chainCursor{providers: c.providers}
+	if len(cur.providers) == 0 {
+		return OneShotResult{}, errNoProviders
+	}
+	for {
+		result, err := cur.providers[cur.index].GenerateContentOneShot(ctx, params)
 		if err == nil {
 			return result, nil
 		}
-		lastErr = err
+		if !cur.next(ctx, err) {
+			return OneShotResult{}, err
+		}
 	}
-	return OneShotResult{}, lastErr
 }
 
 // CountTokens tries each provider in order until one succeeds
@@ -202,6 +272,166 @@ func (c *ModelProviderChain) Name() string {
 	return c.modelName
 }
 
+const (
+	// Maximum number of attempts for each provider in a chain when errors are retryable
+	maxProviderAttempts = 3
+	// Longest delay to wait before retrying the same provider; longer delays fail over instead
+	retryMaxDelay = 30 * time.Second
+)
+
+var (
+	// Back-off before the first retry, doubled for each further retry (variable for testing)
+	retryBaseDelay = time.Second
+
+	errNoProviders   = errors.New("no providers available")
+	errEmptyResponse = &ErrorStatus{Message: "empty response"}
+)
+
+// retryDelay returns how long to wait before retrying after err, and whether the same provider should be retried.
+// Rate limits, server errors and interrupted streams are retryable, honouring Retry-After when present.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var code int
+	var retryAfter string
+	var apiErr *APIError
+	var status *ErrorStatus
+	switch {
+	case errors.As(err, &apiErr):
+		code, retryAfter = apiErr.StatusCode, apiErr.RetryAfter
+	case errors.As(err, &status):
+		code = status.Code
+	default:
+		return 0, false
+	}
+	if code != 0 && code != http.StatusTooManyRequests && code < 500 {
+		return 0, false
+	}
+
+	// Exponential back-off with jitter, between a half and the full delay
+	delay := retryBaseDelay << attempt
+	delay = delay/2 + rand.N(delay/2)
+	if retryAfter != "" {
+		delay = max(delay, parseRetryAfter(retryAfter))
+	}
+	return delay, delay <= retryMaxDelay
+}
+
+// toErrorStatus converts an error to an ErrorStatus to be reported inside a stream
+func toErrorStatus(err error) *ErrorStatus {
+	var status *ErrorStatus
+	if errors.As(err, &status) {
+		return status
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return &ErrorStatus{Code: apiErr.StatusCode, Message: apiErr.Error()}
+	}
+	return &ErrorStatus{Message: err.Error()}
+}
+
+// chainCursor tracks the provider and attempt being tried by a ModelProviderChain
+type chainCursor struct {
+	providers []ModelProvider
+	index     int
+	attempt   int
+}
+
+// providerName returns a description of the current provider
+func (cur *chainCursor) providerName() string {
+	provider := cur.providers[cur.index]
+	if named, ok := provider.(interface{ ProviderName() string }); ok {
+		return named.ProviderName()
+	}
+	return provider.Name()
+}
+
+// next moves to the next attempt after err, waiting for a back-off if the same provider is retried.
+// It returns false when no attempts are left or the context is done.
+func (cur *chainCursor) next(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if delay, ok := retryDelay(err, cur.attempt); ok && cur.attempt+1 < maxProviderAttempts {
+		log.Printf("Retrying %s in %v: %v", cur.providerName(), delay, err)
+		cur.attempt++
+		select {
+		case <-time.After(delay):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if cur.index+1 >= len(cur.providers) {
+		return false
+	}
+	log.Printf("Failing over from %s: %v", cur.providerName(), err)
+	cur.index++
+	cur.attempt = 0
+	return true
+}
+
+// openStream opens a stream with the current provider, moving on to further attempts on errors
+func (cur *chainCursor) openStream(ctx context.Context, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+	if len(cur.providers) == 0 {
+		return nil, nil, errNoProviders
+	}
+	for {
+		seq, closer, err := cur.providers[cur.index].SendMessageStream(ctx, params)
+		if err == nil {
+			return seq, closer, nil
+		}
+		if !cur.next(ctx, err) {
+			return nil, nil, err
+		}
+	}
+}
+
+// chainStream closes the stream of whichever provider is currently answering
+type chainStream struct {
+	mu       sync.Mutex
+	closer   io.Closer
+	provider string
+	closed   bool
+}
+
+// set replaces the current stream, closing the previous one
+func (s *chainStream) set(closer io.Closer, provider string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closer != nil {
+		s.closer.Close()
+	}
+	s.closer = closer
+	s.provider = provider
+}
+
+func (s *chainStream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Close implements io.Closer
+func (s *chainStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.closer == nil {
+		return nil
+	}
+	err := s.closer.Close()
+	s.closer = nil
+	return err
+}
+
+// AnsweringProvider implements ProviderReporter
+func (s *chainStream) AnsweringProvider() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.provider
+}
+
 // Well-known tasks for subagents.
 const (
 	SubagentCompressionTask      = "compression"
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"iter"
+	"testing"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// scriptedProvider returns a model provider whose n-th stream yields the n-th script entry
+func scriptedProvider(providerType, modelName string, calls *int, scripts ...[]GenerateContentResponse) ModelProvider {
+	mock := &MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			script := scripts[min(*calls, len(scripts)-1)]
+			*calls++
+			return func(yield func(GenerateContentResponse) bool) {
+				for _, resp := range script {
+					if !yield(resp) {
+						return
+					}
+				}
+			}, nopCloser{}, nil
+		},
+	}
+	return newModelProviderWithSpec(mock, providerType, modelName, nil)
+}
+
+func textResponse(text string) GenerateContentResponse {
+	return GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: "model", Parts: []Part{{Text: text}}}}}}
+}
+
+func errorResponse(code int) GenerateContentResponse {
+	return GenerateContentResponse{Error: &ErrorStatus{Code: code, Message: "failed"}}
+}
+
+func TestModelProviderChainFailover(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	tests := []struct {
+		name          string
+		first, second [][]GenerateContentResponse
+		wantText      string
+		wantError     bool
+		wantProvider  string
+		wantCalls     [2]int
+	}{
+		{
+			name:         "in-stream client error fails over",
+			first:        [][]GenerateContentResponse{{errorResponse(400)}},
+			second:       [][]GenerateContentResponse{{textResponse("hello")}},
+			wantText:     "hello",
+			wantProvider: "b::model-b",
+			wantCalls:    [2]int{1, 1},
+		},
+		{
+			name:         "rate limit is retried on the same provider",
+			first:        [][]GenerateContentResponse{{errorResponse(429)}, {textResponse("hello")}},
+			second:       [][]GenerateContentResponse{{textResponse("unused")}},
+			wantText:     "hello",
+			wantProvider: "a::model-a",
+			wantCalls:    [2]int{2, 0},
+		},
+		{
+			name:         "empty responses fail over after retries",
+			first:        [][]GenerateContentResponse{{}},
+			second:       [][]GenerateContentResponse{{textResponse("hello")}},
+			wantText:     "hello",
+			wantProvider: "b::model-b",
+			wantCalls:    [2]int{maxProviderAttempts, 1},
+		},
+		{
+			name:         "error after content is passed through",
+			first:        [][]GenerateContentResponse{{textResponse("partial"), errorResponse(503)}},
+			second:       [][]GenerateContentResponse{{textResponse("unused")}},
+			wantText:     "partial",
+			wantError:    true,
+			wantProvider: "a::model-a",
+			wantCalls:    [2]int{1, 0},
+		},
+		{
+			name:      "error is reported when all providers fail",
+			first:     [][]GenerateContentResponse{{errorResponse(400)}},
+			second:    [][]GenerateContentResponse{{errorResponse(401)}},
+			wantError: true,
+			wantCalls: [2]int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls [2]int
+			chain := NewModelProviderChain([]ModelProvider{
+				scriptedProvider("a", "model-a", &calls[0], tt.first...),
+				scriptedProvider("b", "model-b", &calls[1], tt.second...),
+			}, "chain")
+
+			seq, closer, err := chain.SendMessageStream(context.Background(), SessionParams{})
+			if err != nil {
+				t.Fatalf("SendMessageStream failed: %v", err)
+			}
+			defer closer.Close()
+
+			var text string
+			var gotError bool
+			for resp := range seq {
+				if resp.Error != nil {
+					gotError = true
+					continue
+				}
+				for _, cand := range resp.Candidates {
+					for _, part := range cand.Content.Parts {
+						text += part.Text
+					}
+				}
+			}
+
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if gotError != tt.wantError {
+				t.Errorf("got error = %v, want %v", gotError, tt.wantError)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if tt.wantProvider != "" {
+				reporter, ok := closer.(ProviderReporter)
+				if !ok {
+					t.Fatalf("closer does not implement ProviderReporter")
+				}
+				if got := reporter.AnsweringProvider(); got != tt.wantProvider {
+					t.Errorf("answering provider = %q, want %q", got, tt.wantProvider)
+				}
+			}
+		})
+	}
+}
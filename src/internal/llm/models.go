@@ -85,6 +85,12 @@ type Models struct {
 
 	openAIEndpoints map[string]*OpenAIEndpoint // config hash -> endpoint
 
+	// Wraps every LLMProvider when model providers are built, if set
+	providerWrapper func(LLMProvider) LLMProvider
+
+	// Embedding model for semantic search, disabled if the provider is empty
+	embeddingSettings EmbeddingSettings
+
 	// Thread safety
 	mutex sync.RWMutex
 }
@@ -180,6 +186,7 @@ func (r *Models) validate() error {
 // The provider type can be:
 // - "geminicli" for Gemini Code Assist API
 // - "antigravity" for custom Gemini endpoint
+// - "anthropic" for the Anthropic Messages API
 // - An endpoint URL for OpenAI-compatible providers
 // - "" (empty string) for wildcard providers that match any provider
 func (r *Models) SetLLMProvider(providerType string, provider LLMProvider) {
@@ -192,6 +199,24 @@ func (r *Models) SetLLMProvider(providerType string, provider LLMProvider) {
 	r.rebuildModelProvidersUnsafe()
 }
 
+// SetLLMProviderWrapper sets a function wrapping every LLMProvider used by models,
+// for example to record or replay LLM calls. It should be set before OpenAI-compatible endpoints are initialized.
+func (r *Models) SetLLMProviderWrapper(wrap func(LLMProvider) LLMProvider) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.providerWrapper = wrap
+	r.rebuildModelProvidersUnsafe()
+}
+
+// wrapLLMProviderUnsafe applies the provider wrapper if any (internal use, no mutex)
+func (r *Models) wrapLLMProviderUnsafe(provider LLMProvider) LLMProvider {
+	if r.providerWrapper == nil {
+		return provider
+	}
+	return r.providerWrapper(provider)
+}
+
 // rebuildModelProvidersUnsafe rebuilds the model providers map (internal use, no mutex)
 func (r *Models) rebuildModelProvidersUnsafe() {
 	// Clear existing model providers for spec-based models
@@ -239,7 +264,7 @@ func (r *Models) buildModelProviderForSpecUnsafe(externalName string) {
 		}
 
 		// Create ModelProvider with the internal model name and spec
-		providers = append(providers, newModelProviderWithSpec(llmProvider, tuple.ModelName, modelSpec))
+		providers = append(providers, newModelProviderWithSpec(r.wrapLLMProviderUnsafe(llmProvider), tuple.ProviderType, tuple.ModelName, modelSpec))
 	}
 
 	if len(providers) > 0 {
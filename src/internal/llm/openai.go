@@ -12,6 +12,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +25,7 @@ import (
 
 // Ensure OpenAIClient implements LLMProvider
 var _ LLMProvider = (*OpenAIClient)(nil)
+var _ Embedder = (*OpenAIClient)(nil)
 
 // OpenAIClient implements the LLMProvider interface for OpenAI-compatible APIs
 type OpenAIClient struct {
@@ -33,6 +35,7 @@ type OpenAIClient struct {
 	cacheTime        time.Time
 	contextLengths   map[string]int
 	contextLengthsMu sync.RWMutex
+	tokenizer        openAITokenizer
 }
 
 // OpenAIModel represents a model from OpenAI-compatible API
@@ -51,20 +54,27 @@ type OpenAIModelsResponse struct {
 
 // OpenAIChatMessage represents a message in chat completion
 type OpenAIChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content"` // string, []OpenAIContentPart, or nil for tool calls only
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
 }
 
 // OpenAIChatRequest represents the request to /v1/chat/completions endpoint
 type OpenAIChatRequest struct {
-	Model       string              `json:"model"`
-	Messages    []OpenAIChatMessage `json:"messages"`
-	Temperature *float32            `json:"temperature,omitempty"`
-	MaxTokens   *int                `json:"max_tokens,omitempty"`
-	TopP        *float32            `json:"top_p,omitempty"`
-	Stream      bool                `json:"stream,omitempty"`
-	Tools       []OpenAITool        `json:"tools,omitempty"`
-	ToolChoice  interface{}         `json:"tool_choice,omitempty"`
+	Model            string              `json:"model"`
+	Messages         []OpenAIChatMessage `json:"messages"`
+	Temperature      *float32            `json:"temperature,omitempty"`
+	MaxTokens        *int                `json:"max_tokens,omitempty"`
+	TopP             *float32            `json:"top_p,omitempty"`
+	Stop             []string            `json:"stop,omitempty"`
+	Seed             *int64              `json:"seed,omitempty"`
+	PresencePenalty  *float32            `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32            `json:"frequency_penalty,omitempty"`
+	Stream           bool                `json:"stream,omitempty"`
+	Tools            []OpenAITool        `json:"tools,omitempty"`
+	ToolChoice       interface{}         `json:"tool_choice,omitempty"`
+	ResponseFormat   interface{}         `json:"response_format,omitempty"`
 }
 
 // OpenAIChatResponse represents the response from /v1/chat/completions endpoint
@@ -104,6 +114,43 @@ type OpenAIChatStreamChunk struct {
 		} `json:"delta"`
 		FinishReason *string `json:"finish_reason"`
 	} `json:"choices"`
+	Error *OpenAIStreamError `json:"error,omitempty"`
+}
+
+// OpenAIStreamError represents an error reported in the middle of a stream
+type OpenAIStreamError struct {
+	Message string      `json:"message"`
+	Type    string      `json:"type"`
+	Code    interface{} `json:"code"` // Either an HTTP status code or an error code string
+}
+
+// toErrorStatus converts the error to an ErrorStatus with an HTTP status code
+func (e *OpenAIStreamError) toErrorStatus() *ErrorStatus {
+	status := &ErrorStatus{Message: e.Message, Status: e.Type}
+	switch code := e.Code.(type) {
+	case float64:
+		status.Code = int(code)
+	case string:
+		status.Code = openAIErrorStatusCode(code)
+		status.Status = code
+	default:
+		status.Code = openAIErrorStatusCode(e.Type)
+	}
+	return status
+}
+
+// openAIErrorStatusCode returns the HTTP status code corresponding to an OpenAI error code or type
+func openAIErrorStatusCode(code string) int {
+	switch code {
+	case "rate_limit_exceeded", "insufficient_quota":
+		return http.StatusTooManyRequests
+	case "invalid_request_error", "invalid_prompt", "context_length_exceeded":
+		return http.StatusBadRequest
+	case "authentication_error", "invalid_api_key":
+		return http.StatusUnauthorized
+	default: // server_error and unknown errors
+		return http.StatusInternalServerError
+	}
 }
 
 // OpenAIContentPart represents content parts in OpenAI format
@@ -137,8 +184,9 @@ type OpenAIFunction struct {
 	Parameters  map[string]interface{} `json:"parameters,omitempty"`
 }
 
-// OpenAIToolCall represents a tool call in streaming
+// OpenAIToolCall represents a tool call in messages and streaming deltas
 type OpenAIToolCall struct {
+	Index    *int                `json:"index,omitempty"` // Only in streaming deltas
 	ID       string              `json:"id,omitempty"`
 	Type     string              `json:"type,omitempty"`
 	Function *OpenAIFunctionCall `json:"function,omitempty"`
@@ -157,59 +205,133 @@ type OllamaModelInfo struct {
 	ModelInfo  map[string]interface{} `json:"model_info"`
 }
 
-// convertGeminiToOpenAIContent converts Gemini Content to OpenAI message format
+// convertGeminiToOpenAIContent converts Gemini Content to OpenAI message format.
+// Function calls become assistant tool calls and function responses become tool messages,
+// paired by ID (or by name and order when IDs are missing).
 func convertGeminiToOpenAIContent(contents []Content) []OpenAIChatMessage {
 	var messages []OpenAIChatMessage
+	var pendingCalls []OpenAIToolCall // Tool calls without a tool message yet
+	nextCallID := 0
 
 	for _, content := range contents {
-		message := OpenAIChatMessage{
-			Role: content.Role,
+		var role string
+		switch content.Role {
+		case RoleUser:
+			role = "user"
+		case RoleModel:
+			role = "assistant"
+		default:
+			continue
 		}
 
-		// Handle different part types
-		if len(content.Parts) == 1 && content.Parts[0].Text != "" {
-			// Simple text content
-			message.Content = content.Parts[0].Text
-		} else {
-			// Complex content with multiple parts
-			var parts []OpenAIContentPart
-			for _, part := range content.Parts {
-				if part.Text != "" {
-					parts = append(parts, OpenAIContentPart{
-						Type: "text",
-						Text: part.Text,
-					})
-				} else if part.InlineData != nil {
-					// Convert InlineData to base64 data URL
-					dataURL := fmt.Sprintf("data:%s;base64,%s",
-						part.InlineData.MimeType,
-						base64.StdEncoding.EncodeToString([]byte(part.InlineData.Data)))
-					parts = append(parts, OpenAIContentPart{
-						Type:     "image_url",
-						ImageURL: &OpenAIImageURL{URL: dataURL},
-					})
-				} else if part.FunctionCall != nil {
-					// Handle function calls (will be processed separately)
-					parts = append(parts, OpenAIContentPart{
-						Type: "text",
-						Text: fmt.Sprintf("Function call: %s", part.FunctionCall.Name),
-					})
+		var parts []OpenAIContentPart
+		var toolCalls []OpenAIToolCall
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+				// Thoughts are not sent back to the model
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.Id
+				if id == "" {
+					nextCallID++
+					id = fmt.Sprintf("call_angel_%d", nextCallID)
+				}
+				args, err := json.Marshal(part.FunctionCall.Args)
+				if err != nil || part.FunctionCall.Args == nil {
+					args = []byte("{}")
+				}
+				toolCall := OpenAIToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: &OpenAIFunctionCall{Name: part.FunctionCall.Name, Arguments: string(args)},
+				}
+				toolCalls = append(toolCalls, toolCall)
+				pendingCalls = append(pendingCalls, toolCall)
+			case part.FunctionResponse != nil:
+				fr := part.FunctionResponse
+				result, err := json.Marshal(fr.Response)
+				if err != nil {
+					result = []byte(fmt.Sprintf(`{"error": %q}`, err.Error()))
 				}
+				if id, ok := takePendingToolCall(&pendingCalls, fr); ok {
+					messages = append(messages, OpenAIChatMessage{Role: "tool", ToolCallID: id, Content: string(result)})
+				} else {
+					parts = append(parts, OpenAIContentPart{Type: "text", Text: fmt.Sprintf("Result of %s:\n%s", fr.Name, result)})
+				}
+			case part.InlineData != nil:
+				// InlineData is already base64-encoded
+				dataURL := fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data)
+				parts = append(parts, OpenAIContentPart{
+					Type:     "image_url",
+					ImageURL: &OpenAIImageURL{URL: dataURL},
+				})
+			case part.Text != "":
+				parts = append(parts, OpenAIContentPart{Type: "text", Text: part.Text})
 			}
+		}
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
 
-			// Convert parts array to JSON string for content
-			if len(parts) > 0 {
-				partsJSON, _ := json.Marshal(parts)
-				message.Content = string(partsJSON)
-			}
+		var messageContent interface{}
+		if len(parts) == 1 && parts[0].Type == "text" {
+			// Simple text content
+			messageContent = parts[0].Text
+		} else if len(parts) > 0 {
+			messageContent = parts
 		}
 
-		messages = append(messages, message)
+		// Merge consecutive assistant contents, as text and function calls are stored separately
+		if n := len(messages); role == "assistant" && n > 0 && messages[n-1].Role == "assistant" {
+			last := &messages[n-1]
+			last.Content = mergeOpenAIContent(last.Content, messageContent)
+			last.ToolCalls = append(last.ToolCalls, toolCalls...)
+			continue
+		}
+		messages = append(messages, OpenAIChatMessage{Role: role, Content: messageContent, ToolCalls: toolCalls})
 	}
 
 	return messages
 }
 
+// takePendingToolCall removes the pending tool call answered by the function response and returns its ID
+func takePendingToolCall(pendingCalls *[]OpenAIToolCall, fr *FunctionResponse) (string, bool) {
+	for i, call := range *pendingCalls {
+		if (fr.Id != "" && call.ID == fr.Id) || (fr.Id == "" && call.Function.Name == fr.Name) {
+			*pendingCalls = append((*pendingCalls)[:i], (*pendingCalls)[i+1:]...)
+			return call.ID, true
+		}
+	}
+	return "", false
+}
+
+// mergeOpenAIContent concatenates two message contents, each being nil, a string or content parts
+func mergeOpenAIContent(a, b interface{}) interface{} {
+	toParts := func(c interface{}) []OpenAIContentPart {
+		switch c := c.(type) {
+		case string:
+			return []OpenAIContentPart{{Type: "text", Text: c}}
+		case []OpenAIContentPart:
+			return c
+		default:
+			return nil
+		}
+	}
+
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			return sa + sb
+		}
+	}
+	return append(toParts(a), toParts(b)...)
+}
+
 // convertOpenAIToGeminiContent converts OpenAI response to Gemini format
 func convertOpenAIToGeminiPart(text string) []Part {
 	var parts []Part
@@ -270,6 +392,9 @@ func convertGeminiToolsToOpenAI(tools []Tool) []OpenAITool {
 				// Convert parameters from Gemini schema to JSON schema format
 				if funcDecl.Parameters != nil {
 					openAIFunc.Parameters = convertGeminiSchemaToJSONSchema(funcDecl.Parameters)
+					if _, ok := openAIFunc.Parameters["type"]; !ok {
+						openAIFunc.Parameters["type"] = "object"
+					}
 				}
 
 				openAITools = append(openAITools, OpenAITool{
@@ -290,49 +415,132 @@ func convertGeminiSchemaToJSONSchema(geminiSchema *Schema) map[string]interface{
 	}
 
 	jsonSchema := make(map[string]interface{})
+	nullable := geminiSchema.Nullable != nil && *geminiSchema.Nullable
+
+	// Set type; Nullable becomes a union with "null"
+	typeName := geminiTypeToJSONSchemaType(geminiSchema.Type)
+	if typeName == "" && len(geminiSchema.AnyOf) == 0 {
+		switch {
+		case len(geminiSchema.Properties) > 0:
+			typeName = "object"
+		case geminiSchema.Items != nil:
+			typeName = "array"
+		case len(geminiSchema.Enum) > 0:
+			typeName = "string"
+		}
+	}
+	if typeName != "" {
+		if nullable && typeName != "null" {
+			jsonSchema["type"] = []string{typeName, "null"}
+		} else {
+			jsonSchema["type"] = typeName
+		}
+	}
 
-	// Set type
-	switch geminiSchema.Type {
-	case TypeString:
-		jsonSchema["type"] = "string"
-	case TypeNumber:
-		jsonSchema["type"] = "number"
-	case TypeInteger:
-		jsonSchema["type"] = "integer"
-	case TypeBoolean:
-		jsonSchema["type"] = "boolean"
-	case TypeArray:
-		jsonSchema["type"] = "array"
-	case TypeObject:
-		jsonSchema["type"] = "object"
-	default:
-		jsonSchema["type"] = "object"
+	if geminiSchema.Title != "" {
+		jsonSchema["title"] = geminiSchema.Title
+	}
+	if geminiSchema.Description != "" {
+		jsonSchema["description"] = geminiSchema.Description
+	}
+	if geminiSchema.Format != "" && geminiSchema.Format != "enum" {
+		jsonSchema["format"] = geminiSchema.Format
+	}
+	if geminiSchema.Pattern != "" {
+		jsonSchema["pattern"] = geminiSchema.Pattern
+	}
+	if len(geminiSchema.Enum) > 0 {
+		enum := make([]interface{}, 0, len(geminiSchema.Enum)+1)
+		for _, v := range geminiSchema.Enum {
+			enum = append(enum, v)
+		}
+		if nullable {
+			enum = append(enum, nil)
+		}
+		jsonSchema["enum"] = enum
+	}
+	if geminiSchema.Default != nil {
+		jsonSchema["default"] = geminiSchema.Default
+	}
+	if geminiSchema.Example != nil {
+		jsonSchema["examples"] = []interface{}{geminiSchema.Example}
+	}
+	if geminiSchema.Minimum != nil {
+		jsonSchema["minimum"] = *geminiSchema.Minimum
+	}
+	if geminiSchema.Maximum != nil {
+		jsonSchema["maximum"] = *geminiSchema.Maximum
+	}
+
+	// Gemini encodes int64 limits as strings
+	for key, value := range map[string]string{
+		"minLength":     geminiSchema.MinLength,
+		"maxLength":     geminiSchema.MaxLength,
+		"minItems":      geminiSchema.MinItems,
+		"maxItems":      geminiSchema.MaxItems,
+		"minProperties": geminiSchema.MinProperties,
+		"maxProperties": geminiSchema.MaxProperties,
+	} {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			jsonSchema[key] = n
+		}
 	}
 
-	// Set properties for object type
-	if geminiSchema.Type == TypeObject && len(geminiSchema.Properties) > 0 {
+	// Set properties and required fields
+	if len(geminiSchema.Properties) > 0 {
 		properties := make(map[string]interface{})
 		for key, propSchema := range geminiSchema.Properties {
 			properties[key] = convertGeminiSchemaToJSONSchema(propSchema)
 		}
 		jsonSchema["properties"] = properties
+	}
+	if len(geminiSchema.Required) > 0 {
+		jsonSchema["required"] = geminiSchema.Required
+	}
 
-		// Set required fields
-		if len(geminiSchema.Required) > 0 {
-			jsonSchema["required"] = geminiSchema.Required
-		}
+	// Set items; some OpenAI-compatible servers reject arrays without items
+	if geminiSchema.Items != nil {
+		jsonSchema["items"] = convertGeminiSchemaToJSONSchema(geminiSchema.Items)
+	} else if typeName == "array" {
+		jsonSchema["items"] = map[string]interface{}{}
 	}
 
-	// Set items for array type
-	if geminiSchema.Type == TypeArray {
-		// For arrays, we'd need item schema, but Gemini doesn't specify it in the same way
-		// For now, we'll leave it empty or set a generic object type
-		jsonSchema["items"] = map[string]interface{}{"type": "object"}
+	if len(geminiSchema.AnyOf) > 0 {
+		anyOf := make([]interface{}, 0, len(geminiSchema.AnyOf)+1)
+		for _, sub := range geminiSchema.AnyOf {
+			anyOf = append(anyOf, convertGeminiSchemaToJSONSchema(sub))
+		}
+		if nullable && typeName == "" {
+			anyOf = append(anyOf, map[string]interface{}{"type": "null"})
+		}
+		jsonSchema["anyOf"] = anyOf
 	}
 
 	return jsonSchema
 }
 
+// geminiTypeToJSONSchemaType converts Gemini type to JSON schema type, or "" if unspecified
+func geminiTypeToJSONSchemaType(geminiType Type) string {
+	switch geminiType {
+	case TypeString:
+		return "string"
+	case TypeNumber:
+		return "number"
+	case TypeInteger:
+		return "integer"
+	case TypeBoolean:
+		return "boolean"
+	case TypeArray:
+		return "array"
+	case TypeObject:
+		return "object"
+	case TypeNull:
+		return "null"
+	default:
+		return ""
+	}
+}
+
 // NewOpenAIClient creates a new OpenAI-compatible client
 func NewOpenAIClient(config *OpenAIConfig) *OpenAIClient {
 	// Create new client
@@ -477,19 +685,16 @@ func (c *OpenAIClient) RefreshModels(ctx context.Context) ([]OpenAIModel, error)
 
 // SendMessageStream implements the LLMProvider interface for streaming chat completions
 func (c *OpenAIClient) SendMessageStream(ctx context.Context, modelName string, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+	if c.config.APIMode == OpenAIAPIModeResponses {
+		return c.sendResponsesStream(ctx, modelName, params)
+	}
+
 	// Convert contents to OpenAI chat messages
 	messages := convertGeminiToOpenAIContent(params.Contents)
 
-	// Convert Gemini tools to OpenAI format
-	var openAITools []OpenAITool
-	if params.ToolConfig == nil {
-		// If no specific tool config, include all available tools
-		tools, err := tool.FromContext(ctx)
-		if err != nil {
-			return nil, nil, err
-		}
-		geminiTools := tools.ForGemini()
-		openAITools = convertGeminiToolsToOpenAI(geminiTools)
+	openAITools, err := openAIToolsForParams(ctx, params)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Prepare request
@@ -505,17 +710,78 @@ func (c *OpenAIClient) SendMessageStream(ctx context.Context, modelName string,
 		req.ToolChoice = "auto" // Let the model decide when to use tools
 	}
 
+	// Unset or negative sampling parameters are left to the server defaults
+	genParams := params.GenParams
+	if genParams.Temperature != nil && *genParams.Temperature >= 0 {
+		req.Temperature = genParams.Temperature
+	}
+	if genParams.TopP != nil && *genParams.TopP >= 0 {
+		req.TopP = genParams.TopP
+	}
+	if genParams.MaxOutputTokens > 0 {
+		maxTokens := int(genParams.MaxOutputTokens)
+		req.MaxTokens = &maxTokens
+	}
+	req.Stop = genParams.StopSequences
+	req.Seed = genParams.Seed
+	req.PresencePenalty = genParams.PresencePenalty
+	req.FrequencyPenalty = genParams.FrequencyPenalty
+
+	if format := openAIResponseFormat(params); format != nil {
+		req.ResponseFormat = format
+	}
+
+	resp, err := c.postStream(ctx, "/chat/completions", req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return streamOpenAIResponse(resp.Body), resp.Body, nil
+}
+
+// openAIResponseFormat returns the response_format for structured output, or nil if not requested
+func openAIResponseFormat(params SessionParams) map[string]interface{} {
+	if params.ResponseMimeType != "application/json" {
+		return nil
+	}
+	if params.ResponseSchema == nil {
+		return map[string]interface{}{"type": "json_object"}
+	}
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   "response",
+			"schema": convertGeminiSchemaToJSONSchema(params.ResponseSchema),
+		},
+	}
+}
+
+// openAIToolsForParams converts the available Gemini tools to OpenAI format
+func openAIToolsForParams(ctx context.Context, params SessionParams) ([]OpenAITool, error) {
+	if params.ToolConfig != nil {
+		return nil, nil
+	}
+
+	// If no specific tool config, include all available tools
+	tools, err := tool.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertGeminiToolsToOpenAI(tools.ForGemini()), nil
+}
+
+// postStream sends a streaming request to the given API path and returns the successful response
+func (c *OpenAIClient) postStream(ctx context.Context, path string, body interface{}) (*http.Response, error) {
 	// Convert request to JSON
-	jsonBody, err := json.Marshal(req)
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
-	url := strings.TrimSuffix(c.config.Endpoint, "/") + "/chat/completions"
+	url := strings.TrimSuffix(c.config.Endpoint, "/") + path
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	if c.config.APIKey != "" {
@@ -528,25 +794,81 @@ func (c *OpenAIClient) SendMessageStream(ctx context.Context, modelName string,
 	// Execute request
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, nil, fmt.Errorf("API error: %d %s, response: %s", resp.StatusCode, resp.Status, string(body))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: resp.Status, Response: string(body), RetryAfter: resp.Header.Get("Retry-After")}
 	}
+	return resp, nil
+}
 
-	// Create streaming response
-	seq := func(yield func(GenerateContentResponse) bool) {
-		scanner := bufio.NewScanner(resp.Body)
+// ongoingToolCall accumulates a streamed tool call
+type ongoingToolCall struct {
+	id         string
+	name       string
+	argsBuffer strings.Builder
+}
 
-		// Track ongoing function calls to accumulate arguments
-		type ongoingCall struct {
-			name       string
-			argsBuffer string
+// toFunctionCall converts the accumulated tool call to a Gemini function call
+func (call *ongoingToolCall) toFunctionCall() *FunctionCall {
+	funcCall := &FunctionCall{Name: call.name, Id: call.id, Args: map[string]interface{}{}}
+	if argsJSON := call.argsBuffer.String(); strings.TrimSpace(argsJSON) != "" {
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			// If JSON parsing fails, pass the raw string as a single argument
+			log.Printf("Failed to parse function arguments for %s as JSON: %v, treating as raw string", call.name, err)
+			funcCall.Args = map[string]interface{}{"raw_arguments": argsJSON}
+		} else if args != nil {
+			funcCall.Args = args
+		}
+	}
+	return funcCall
+}
+
+// streamOpenAIResponse converts a streaming chat completion to Gemini responses.
+// Tool call deltas are accumulated by index and yielded as function calls when the choice finishes.
+func streamOpenAIResponse(body io.Reader) iter.Seq[GenerateContentResponse] {
+	return func(yield func(GenerateContentResponse) bool) {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+		// Ongoing tool calls in the order of their first appearance
+		var calls []*ongoingToolCall
+		callsByIndex := make(map[int]*ongoingToolCall)
+		var legacyCall *ongoingToolCall
+
+		yieldParts := func(parts []Part) bool {
+			if len(parts) == 0 {
+				return true
+			}
+			return yield(GenerateContentResponse{
+				Candidates: []Candidate{
+					{
+						Content: Content{
+							Parts: parts,
+							Role:  RoleModel,
+						},
+					},
+				},
+			})
+		}
+
+		// flushCalls returns all accumulated function calls and resets them
+		flushCalls := func() []Part {
+			var parts []Part
+			for _, call := range calls {
+				if call.name != "" {
+					parts = append(parts, Part{FunctionCall: call.toFunctionCall()})
+				}
+			}
+			calls = nil
+			callsByIndex = make(map[int]*ongoingToolCall)
+			legacyCall = nil
+			return parts
 		}
-		currentCalls := make(map[string]*ongoingCall)
 
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -565,121 +887,87 @@ func (c *OpenAIClient) SendMessageStream(ctx context.Context, modelName string,
 				log.Printf("Failed to parse chunk: %v, line: %s", err, line)
 				continue
 			}
+			if chunk.Error != nil {
+				status := chunk.Error.toErrorStatus()
+				log.Printf("OpenAI stream error: %v", status)
+				yield(GenerateContentResponse{Error: status})
+				return
+			}
 
-			// Convert to CaGenerateContentResponse
-			if len(chunk.Choices) > 0 {
-				choice := chunk.Choices[0]
-				var parts []Part
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			choice := chunk.Choices[0]
+			var parts []Part
 
-				// Handle text content and inline images
-				if choice.Delta.Content != "" {
-					// Convert OpenAI content to Gemini parts
-					openAIParts := convertOpenAIToGeminiPart(choice.Delta.Content)
-					parts = append(parts, openAIParts...)
-				}
+			// Handle text content and inline images
+			if choice.Delta.Content != "" {
+				parts = append(parts, convertOpenAIToGeminiPart(choice.Delta.Content)...)
+			}
 
-				// Handle function calls (legacy format)
-				if choice.Delta.FunctionCall != nil {
-					if choice.Delta.FunctionCall.Name != "" {
-						// Start a new function call
-						if _, exists := currentCalls["legacy"]; !exists {
-							currentCalls["legacy"] = &ongoingCall{name: choice.Delta.FunctionCall.Name}
-						}
-					}
-					if choice.Delta.FunctionCall.Arguments != "" {
-						// Legacy format usually comes as complete JSON
-						if call, exists := currentCalls["legacy"]; exists {
-							call.argsBuffer = choice.Delta.FunctionCall.Arguments
-						}
-					}
+			// Handle function calls (legacy format)
+			if fc := choice.Delta.FunctionCall; fc != nil {
+				if legacyCall == nil {
+					legacyCall = &ongoingToolCall{}
+					calls = append(calls, legacyCall)
 				}
-
-				// Handle tool calls (current format)
-				for _, toolCall := range choice.Delta.ToolCalls {
-					if toolCall.Function != nil {
-						callKey := toolCall.ID
-						if callKey == "" {
-							callKey = fmt.Sprintf("call_%d", len(currentCalls))
-						}
-
-						// Get or create ongoing call
-						var call *ongoingCall
-						if existing, exists := currentCalls[callKey]; exists {
-							call = existing
-						} else {
-							call = &ongoingCall{}
-							currentCalls[callKey] = call
-						}
-
-						// Handle name (usually comes first)
-						if toolCall.Function.Name != "" {
-							call.name = toolCall.Function.Name
-						}
-
-						// Handle arguments (comes in chunks - just accumulate)
-						if toolCall.Function.Arguments != "" {
-							call.argsBuffer += toolCall.Function.Arguments
-						}
-					}
+				if fc.Name != "" {
+					legacyCall.name = fc.Name
 				}
+				legacyCall.argsBuffer.WriteString(fc.Arguments)
+			}
 
-				// When stream is ending, try to parse all accumulated function calls
-				if choice.FinishReason != nil && (*choice.FinishReason == "tool_calls" || *choice.FinishReason == "function_call" || *choice.FinishReason == "stop") {
-					for callKey, call := range currentCalls {
-						if call.name != "" && call.argsBuffer != "" {
-							funcCall := &FunctionCall{
-								Name: call.name,
-							}
-
-							// Try to parse accumulated arguments as JSON
-							var args map[string]interface{}
-							if err := json.Unmarshal([]byte(call.argsBuffer), &args); err != nil {
-								// If JSON parsing fails, pass the raw string as a single argument
-								log.Printf("Failed to parse function arguments for %s as JSON: %v, treating as raw string", call.name, err)
-								funcCall.Args = map[string]interface{}{
-									"raw_arguments": call.argsBuffer,
-								}
-							} else {
-								funcCall.Args = args
-							}
-
-							parts = append(parts, Part{FunctionCall: funcCall})
-						}
-						// Clear processed call
-						delete(currentCalls, callKey)
+			// Handle tool calls (current format); only the first delta of each call has its ID and name
+			for _, toolCall := range choice.Delta.ToolCalls {
+				var call *ongoingToolCall
+				switch {
+				case toolCall.Index != nil:
+					call = callsByIndex[*toolCall.Index]
+				case toolCall.ID == "" && len(calls) > 0:
+					// Some servers omit the index; a delta without ID continues the last call
+					call = calls[len(calls)-1]
+				}
+				if call == nil {
+					call = &ongoingToolCall{}
+					calls = append(calls, call)
+					if toolCall.Index != nil {
+						callsByIndex[*toolCall.Index] = call
 					}
 				}
 
-				// Only yield if we have parts to send
-				if len(parts) > 0 {
-					resp := GenerateContentResponse{
-						Candidates: []Candidate{
-							{
-								Content: Content{
-									Parts: parts,
-									Role:  "model",
-								},
-							},
-						},
-					}
-					if !yield(resp) {
-						return
+				if toolCall.ID != "" {
+					call.id = toolCall.ID
+				}
+				if toolCall.Function != nil {
+					if toolCall.Function.Name != "" {
+						call.name = toolCall.Function.Name
 					}
+					call.argsBuffer.WriteString(toolCall.Function.Arguments)
 				}
+			}
 
-				// Check for finish reason and end stream if present
-				if choice.FinishReason != nil {
-					return
-				}
+			// When the choice finishes, yield all accumulated function calls
+			if choice.FinishReason != nil {
+				parts = append(parts, flushCalls()...)
+			}
+
+			if !yieldParts(parts) {
+				return
+			}
+
+			// Check for finish reason and end stream if present
+			if choice.FinishReason != nil {
+				return
 			}
 		}
 
 		if err := scanner.Err(); err != nil {
 			log.Printf("Scanner error: %v", err)
 		}
-	}
 
-	return seq, resp.Body, nil
+		// Some servers end the stream without a finish reason
+		yieldParts(flushCalls())
+	}
 }
 
 // GenerateContentOneShot implements the LLMProvider interface for non-streaming completion
@@ -692,7 +980,11 @@ func (c *OpenAIClient) GenerateContentOneShot(ctx context.Context, modelName str
 
 	var fullResponse strings.Builder
 	var hasContent bool
+	var usageMetadata *UsageMetadata
 	for caResp := range seq {
+		if caResp.UsageMetadata != nil {
+			usageMetadata = caResp.UsageMetadata
+		}
 		if len(caResp.Candidates) > 0 {
 			candidate := caResp.Candidates[0]
 			if len(candidate.Content.Parts) > 0 {
@@ -713,34 +1005,61 @@ func (c *OpenAIClient) GenerateContentOneShot(ctx context.Context, modelName str
 
 	if hasContent {
 		return OneShotResult{
-			Text: fullResponse.String(),
+			Text:          fullResponse.String(),
+			UsageMetadata: usageMetadata,
 		}, nil
 	}
 
 	return OneShotResult{}, fmt.Errorf("no content found in response")
 }
 
-// CountTokens implements the LLMProvider interface
-// Note: OpenAI-compatible APIs may not support token counting, so we'll estimate
-func (c *OpenAIClient) CountTokens(ctx context.Context, modelName string, contents []Content) (*CaCountTokenResponse, error) {
-	// Simple token estimation (rough approximation: 1 token ≈ 4 characters)
-	totalChars := 0
-	for _, content := range contents {
-		for _, part := range content.Parts {
-			if part.Text != "" {
-				totalChars += len(part.Text)
-			}
-		}
+// OpenAIEmbeddingRequest represents a request to the embeddings API
+type OpenAIEmbeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+	EncodingFormat string   `json:"encoding_format"`
+}
+
+// OpenAIEmbeddingResponse represents a response from the embeddings API
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed implements the Embedder interface with the embeddings API. The task is not supported and ignored.
+func (c *OpenAIClient) Embed(ctx context.Context, modelName string, params EmbedParams) ([][]float32, error) {
+	resp, err := c.postStream(ctx, "/embeddings", OpenAIEmbeddingRequest{
+		Model:          modelName,
+		Input:          params.Texts,
+		Dimensions:     params.Dimensions,
+		EncodingFormat: "float",
+	})
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	estimatedTokens := totalChars / 4
-	if estimatedTokens < 1 {
-		estimatedTokens = 1
+	var embeddingResp OpenAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return &CaCountTokenResponse{
-		TotalTokens: estimatedTokens,
-	}, nil
+	embeddings := make([][]float32, len(params.Texts))
+	for _, data := range embeddingResp.Data {
+		if data.Index < 0 || data.Index >= len(embeddings) {
+			return nil, fmt.Errorf("unexpected embedding index %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	for i, embedding := range embeddings {
+		if embedding == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+	return embeddings, nil
 }
 
 // MaxTokens implements the LLMProvider interface
@@ -866,7 +1185,7 @@ func ReloadOpenAIProviders(db *database.Database, registry *Models) {
 			if validModels[model.ID] {
 				// Use the same client instance for all models from this config
 				registry.mutex.Lock()
-				registry.providers[model.ID] = newModelProvider(client, model.ID)
+				registry.providers[model.ID] = newModelProvider(registry.wrapLLMProviderUnsafe(client), model.ID)
 				registry.mutex.Unlock()
 				log.Printf("Registered/updated OpenAI model: %s (from config: %s)", model.ID, config.Name)
 
@@ -0,0 +1,423 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"strings"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// Reasoning items preceding a text or a function call are stored in the ThoughtSignature of that part,
+// because they have to be passed back verbatim (with their encrypted content) in subsequent requests.
+const openAIReasoningStatePrefix = "openai-reasoning:"
+
+// OpenAIResponsesRequest represents the request to /v1/responses endpoint
+type OpenAIResponsesRequest struct {
+	Model        string                    `json:"model"`
+	Instructions string                    `json:"instructions,omitempty"`
+	Input        []OpenAIResponsesItem     `json:"input"`
+	Tools        []OpenAIResponsesTool     `json:"tools,omitempty"`
+	ToolChoice   interface{}               `json:"tool_choice,omitempty"`
+	Reasoning    *OpenAIResponsesReasoning `json:"reasoning,omitempty"`
+	Include      []string                  `json:"include,omitempty"`
+	Store        *bool                     `json:"store,omitempty"`
+	Stream       bool                      `json:"stream,omitempty"`
+
+	Temperature     *float32 `json:"temperature,omitempty"`
+	TopP            *float32 `json:"top_p,omitempty"`
+	MaxOutputTokens *int     `json:"max_output_tokens,omitempty"`
+
+	Text *OpenAIResponsesText `json:"text,omitempty"`
+}
+
+// OpenAIResponsesText configures the text output of the Responses API
+type OpenAIResponsesText struct {
+	Format map[string]interface{} `json:"format,omitempty"`
+}
+
+// OpenAIResponsesReasoning configures reasoning for the Responses API
+type OpenAIResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// OpenAIResponsesItem represents an input or output item of the Responses API
+type OpenAIResponsesItem struct {
+	Type string `json:"type,omitempty"`
+	ID   string `json:"id,omitempty"`
+
+	// message
+	Role    string                       `json:"role,omitempty"`
+	Content []OpenAIResponsesContentPart `json:"content,omitempty"`
+
+	// function_call, function_call_output
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+
+	// reasoning
+	Summary          []OpenAIResponsesContentPart `json:"summary,omitempty"`
+	EncryptedContent string                       `json:"encrypted_content,omitempty"`
+}
+
+// OpenAIResponsesContentPart represents a content part of a message or a reasoning summary
+type OpenAIResponsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// OpenAIResponsesTool represents a function tool for the Responses API
+type OpenAIResponsesTool struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// OpenAIResponsesUsage represents token usage reported by the Responses API
+type OpenAIResponsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+// OpenAIResponsesStreamEvent represents a server-sent event from streaming /v1/responses
+type OpenAIResponsesStreamEvent struct {
+	Type     string               `json:"type"`
+	Delta    string               `json:"delta"`
+	Item     *OpenAIResponsesItem `json:"item,omitempty"`
+	Response *struct {
+		Status            string                `json:"status"`
+		Usage             *OpenAIResponsesUsage `json:"usage,omitempty"`
+		IncompleteDetails *struct {
+			Reason string `json:"reason"`
+		} `json:"incomplete_details,omitempty"`
+		Error *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error,omitempty"`
+	} `json:"response,omitempty"`
+
+	// error
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// sendResponsesStream calls /responses and returns an iter.Seq of responses
+func (c *OpenAIClient) sendResponsesStream(ctx context.Context, modelName string, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+	openAITools, err := openAIToolsForParams(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Reasoning items are passed back by their encrypted content instead of being stored by the server
+	store := false
+	req := OpenAIResponsesRequest{
+		Model:        modelName,
+		Instructions: params.SystemPrompt,
+		Input:        convertGeminiToResponsesInput(params.Contents),
+		Include:      []string{"reasoning.encrypted_content"},
+		Store:        &store,
+		Stream:       true,
+	}
+	if params.IncludeThoughts {
+		req.Reasoning = &OpenAIResponsesReasoning{Summary: "auto"}
+	}
+	// The Responses API has no stop sequences, seed or penalties
+	genParams := params.GenParams
+	if genParams.Temperature != nil && *genParams.Temperature >= 0 {
+		req.Temperature = genParams.Temperature
+	}
+	if genParams.TopP != nil && *genParams.TopP >= 0 {
+		req.TopP = genParams.TopP
+	}
+	if genParams.MaxOutputTokens > 0 {
+		maxOutputTokens := int(genParams.MaxOutputTokens)
+		req.MaxOutputTokens = &maxOutputTokens
+	}
+	// Unlike Chat Completions, json_schema options are given in the format itself
+	if params.ResponseMimeType == "application/json" {
+		format := map[string]interface{}{"type": "json_object"}
+		if params.ResponseSchema != nil {
+			format = map[string]interface{}{
+				"type":   "json_schema",
+				"name":   "response",
+				"schema": convertGeminiSchemaToJSONSchema(params.ResponseSchema),
+			}
+		}
+		req.Text = &OpenAIResponsesText{Format: format}
+	}
+	for _, t := range openAITools {
+		req.Tools = append(req.Tools, OpenAIResponsesTool{
+			Type:        "function",
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  t.Function.Parameters,
+		})
+	}
+	if len(req.Tools) > 0 {
+		req.ToolChoice = "auto"
+	}
+
+	resp, err := c.postStream(ctx, "/responses", req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return streamResponsesAPI(resp.Body), resp.Body, nil
+}
+
+// convertGeminiToResponsesInput converts Gemini contents to Responses API input items
+func convertGeminiToResponsesInput(contents []Content) []OpenAIResponsesItem {
+	var items []OpenAIResponsesItem
+	var pendingCalls []OpenAIToolCall // Function calls without an output yet
+	nextCallID := 0
+
+	for _, content := range contents {
+		var role, textType string
+		switch content.Role {
+		case RoleUser:
+			role, textType = "user", "input_text"
+		case RoleModel:
+			role, textType = "assistant", "output_text"
+		default:
+			continue
+		}
+
+		// Message content is accumulated until a non-message item has to be emitted
+		var message []OpenAIResponsesContentPart
+		flushMessage := func() {
+			if len(message) > 0 {
+				items = append(items, OpenAIResponsesItem{Type: "message", Role: role, Content: message})
+				message = nil
+			}
+		}
+
+		for _, part := range content.Parts {
+			if part.Thought {
+				continue // Reasoning is only replayed from the state of the following part
+			}
+			if reasoning := decodeOpenAIReasoningState(part.ThoughtSignature); reasoning != nil {
+				flushMessage()
+				items = append(items, reasoning...)
+			}
+
+			switch {
+			case part.FunctionCall != nil:
+				flushMessage()
+				id := part.FunctionCall.Id
+				if id == "" {
+					nextCallID++
+					id = fmt.Sprintf("call_angel_%d", nextCallID)
+				}
+				args, err := json.Marshal(part.FunctionCall.Args)
+				if err != nil || part.FunctionCall.Args == nil {
+					args = []byte("{}")
+				}
+				items = append(items, OpenAIResponsesItem{Type: "function_call", CallID: id, Name: part.FunctionCall.Name, Arguments: string(args)})
+				pendingCalls = append(pendingCalls, OpenAIToolCall{ID: id, Function: &OpenAIFunctionCall{Name: part.FunctionCall.Name}})
+			case part.FunctionResponse != nil:
+				fr := part.FunctionResponse
+				result, err := json.Marshal(fr.Response)
+				if err != nil {
+					result = []byte(fmt.Sprintf(`{"error": %q}`, err.Error()))
+				}
+				if id, ok := takePendingToolCall(&pendingCalls, fr); ok {
+					flushMessage()
+					items = append(items, OpenAIResponsesItem{Type: "function_call_output", CallID: id, Output: string(result)})
+				} else {
+					message = append(message, OpenAIResponsesContentPart{Type: textType, Text: fmt.Sprintf("Result of %s:\n%s", fr.Name, result)})
+				}
+			case part.InlineData != nil && role == "user":
+				// InlineData is already base64-encoded
+				message = append(message, OpenAIResponsesContentPart{
+					Type:     "input_image",
+					ImageURL: fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+				})
+			case part.Text != "":
+				message = append(message, OpenAIResponsesContentPart{Type: textType, Text: part.Text})
+			}
+		}
+		flushMessage()
+	}
+
+	return items
+}
+
+// encodeOpenAIReasoningState encodes reasoning items into a ThoughtSignature
+func encodeOpenAIReasoningState(items []OpenAIResponsesItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return ""
+	}
+	return openAIReasoningStatePrefix + base64.StdEncoding.EncodeToString(data)
+}
+
+// decodeOpenAIReasoningState decodes reasoning items from a ThoughtSignature, or returns nil
+func decodeOpenAIReasoningState(state string) []OpenAIResponsesItem {
+	encoded, ok := strings.CutPrefix(state, openAIReasoningStatePrefix)
+	if !ok {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		log.Printf("Failed to decode OpenAI reasoning state: %v", err)
+		return nil
+	}
+	var items []OpenAIResponsesItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		log.Printf("Failed to unmarshal OpenAI reasoning state: %v", err)
+		return nil
+	}
+	return items
+}
+
+// responsesUsageMetadata converts Responses API usage to Gemini usage metadata
+func responsesUsageMetadata(usage *OpenAIResponsesUsage) *UsageMetadata {
+	if usage == nil {
+		return nil
+	}
+	return &UsageMetadata{
+		PromptTokenCount:        usage.InputTokens,
+		CandidatesTokenCount:    usage.OutputTokens - usage.OutputTokensDetails.ReasoningTokens,
+		ThoughtsTokenCount:      usage.OutputTokensDetails.ReasoningTokens,
+		CachedContentTokenCount: usage.InputTokensDetails.CachedTokens,
+		TotalTokenCount:         usage.TotalTokens,
+	}
+}
+
+// streamResponsesAPI converts server-sent events from the Responses API to Gemini responses.
+// Text is streamed as it arrives, while reasoning summaries and function calls are yielded once complete.
+func streamResponsesAPI(body io.Reader) iter.Seq[GenerateContentResponse] {
+	return func(yield func(GenerateContentResponse) bool) {
+		yieldParts := func(finishReason, finishMessage string, usage *UsageMetadata, parts ...Part) bool {
+			resp := GenerateContentResponse{UsageMetadata: usage}
+			if len(parts) > 0 || finishReason != "" {
+				resp.Candidates = []Candidate{{
+					Content:       Content{Role: RoleModel, Parts: parts},
+					FinishReason:  finishReason,
+					FinishMessage: finishMessage,
+				}}
+			}
+			return yield(resp)
+		}
+
+		// Completed reasoning items not yet attached to a text or function call
+		var reasoningItems []OpenAIResponsesItem
+		takeReasoningState := func() string {
+			state := encodeOpenAIReasoningState(reasoningItems)
+			reasoningItems = nil
+			return state
+		}
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue // Event names are repeated in the data, and blank lines separate events
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				break
+			}
+
+			var event OpenAIResponsesStreamEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				log.Printf("Failed to parse Responses API event: %v, data: %s", err, data)
+				continue
+			}
+
+			switch event.Type {
+			case "response.output_text.delta":
+				if event.Delta != "" && !yieldParts("", "", nil, Part{Text: event.Delta, ThoughtSignature: takeReasoningState()}) {
+					return
+				}
+
+			case "response.output_item.done":
+				item := event.Item
+				if item == nil {
+					continue
+				}
+				switch item.Type {
+				case "reasoning":
+					var summary []string
+					for _, s := range item.Summary {
+						if s.Text != "" {
+							summary = append(summary, s.Text)
+						}
+					}
+					reasoningItems = append(reasoningItems, *item)
+					if len(summary) > 0 && !yieldParts("", "", nil, Part{Text: strings.Join(summary, "\n\n"), Thought: true}) {
+						return
+					}
+				case "function_call":
+					call := &ongoingToolCall{id: item.CallID, name: item.Name}
+					call.argsBuffer.WriteString(item.Arguments)
+					part := Part{FunctionCall: call.toFunctionCall(), ThoughtSignature: takeReasoningState()}
+					if !yieldParts("", "", nil, part) {
+						return
+					}
+				}
+
+			case "response.completed":
+				var usage *UsageMetadata
+				if event.Response != nil {
+					usage = responsesUsageMetadata(event.Response.Usage)
+				}
+				yieldParts(FinishReasonStop, "", usage)
+				return
+
+			case "response.incomplete":
+				reason, message := FinishReasonOther, "Response is incomplete"
+				var usage *UsageMetadata
+				if event.Response != nil {
+					usage = responsesUsageMetadata(event.Response.Usage)
+					if details := event.Response.IncompleteDetails; details != nil {
+						switch details.Reason {
+						case "max_output_tokens":
+							reason = FinishReasonMaxTokens
+						case "content_filter":
+							reason = FinishReasonSafety
+						}
+						message = fmt.Sprintf("Response is incomplete: %s", details.Reason)
+					}
+				}
+				yieldParts(reason, message, usage)
+				return
+
+			case "response.failed", "error":
+				streamErr := OpenAIStreamError{Message: event.Message, Code: event.Code}
+				if event.Response != nil && event.Response.Error != nil {
+					streamErr = OpenAIStreamError{Message: event.Response.Error.Message, Code: event.Response.Error.Code}
+				}
+				status := streamErr.toErrorStatus()
+				log.Printf("Responses API stream error: %v", status)
+				yield(GenerateContentResponse{Error: status})
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			log.Printf("Responses API stream scanner error: %v", err)
+		}
+	}
+}
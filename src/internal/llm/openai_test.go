@@ -0,0 +1,576 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestConvertGeminiSchemaRoundTrip(t *testing.T) {
+	yes := true
+	minimum := 0.5
+	maximum := 100.0
+
+	tests := []struct {
+		name   string
+		schema *Schema
+	}{
+		{
+			name: "Scalars",
+			schema: &Schema{
+				Type: TypeString, Title: "Name", Description: "A name", Format: "email",
+				Pattern: "^.+@.+$", MinLength: "3", MaxLength: "254",
+			},
+		},
+		{
+			name:   "Number",
+			schema: &Schema{Type: TypeNumber, Minimum: &minimum, Maximum: &maximum, Default: 1.0},
+		},
+		{
+			name:   "NullableEnum",
+			schema: &Schema{Type: TypeString, Enum: []string{"low", "high"}, Nullable: &yes},
+		},
+		{
+			name: "ArrayOfObjects",
+			schema: &Schema{
+				Type:     TypeArray,
+				MinItems: "1",
+				MaxItems: "8",
+				Items: &Schema{
+					Type: TypeObject,
+					Properties: map[string]*Schema{
+						"path": {Type: TypeString},
+						"tags": {Type: TypeArray, Items: &Schema{Type: TypeString}},
+					},
+					Required: []string{"path"},
+				},
+			},
+		},
+		{
+			name: "AnyOf",
+			schema: &Schema{
+				Description: "Either",
+				AnyOf:       []*Schema{{Type: TypeInteger}, {Type: TypeBoolean, Nullable: &yes}},
+			},
+		},
+		{
+			name: "NestedNullableObject",
+			schema: &Schema{
+				Type: TypeObject,
+				Properties: map[string]*Schema{
+					"options": {
+						Type:       TypeObject,
+						Nullable:   &yes,
+						Properties: map[string]*Schema{"verbose": {Type: TypeBoolean}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonSchema := convertGeminiSchemaToJSONSchema(tt.schema)
+			data, err := json.Marshal(jsonSchema)
+			if err != nil {
+				t.Fatalf("Failed to marshal JSON schema: %v", err)
+			}
+
+			roundTripped, err := tool.ParseJSONSchema(tt.name, data)
+			if err != nil {
+				t.Fatalf("Failed to parse JSON schema %s: %v", data, err)
+			}
+			if !reflect.DeepEqual(roundTripped, tt.schema) {
+				actualJSON, _ := json.Marshal(roundTripped)
+				expectedJSON, _ := json.Marshal(tt.schema)
+				t.Errorf("Round trip mismatch via %s:\n got: %s\nwant: %s", data, actualJSON, expectedJSON)
+			}
+		})
+	}
+}
+
+func TestConvertGeminiToolsToOpenAIParameters(t *testing.T) {
+	tools := []Tool{{FunctionDeclarations: []FunctionDeclaration{
+		{Name: "list", Parameters: &Schema{Type: TypeObject, Properties: map[string]*Schema{"ids": {Type: TypeArray}}}},
+		{Name: "empty", Parameters: &Schema{}},
+	}}}
+
+	openAITools := convertGeminiToolsToOpenAI(tools)
+	if len(openAITools) != 2 {
+		t.Fatalf("Expected 2 tools, got %d", len(openAITools))
+	}
+
+	ids := openAITools[0].Function.Parameters["properties"].(map[string]interface{})["ids"]
+	expectedIDs := map[string]interface{}{"type": "array", "items": map[string]interface{}{}}
+	if !reflect.DeepEqual(ids, expectedIDs) {
+		t.Errorf("Expected array without items to get empty items, got %v", ids)
+	}
+
+	if openAITools[1].Function.Parameters["type"] != "object" {
+		t.Errorf("Expected parameters to default to object type, got %v", openAITools[1].Function.Parameters)
+	}
+}
+
+func TestOpenAIResponseFormat(t *testing.T) {
+	if format := openAIResponseFormat(SessionParams{}); format != nil {
+		t.Errorf("Expected no response format without a MIME type, got %v", format)
+	}
+
+	format := openAIResponseFormat(SessionParams{ResponseMimeType: "application/json"})
+	if !reflect.DeepEqual(format, map[string]interface{}{"type": "json_object"}) {
+		t.Errorf("Expected json_object format without a schema, got %v", format)
+	}
+
+	format = openAIResponseFormat(SessionParams{
+		ResponseMimeType: "application/json",
+		ResponseSchema:   &Schema{Type: TypeObject, Properties: map[string]*Schema{"name": {Type: TypeString}}, Required: []string{"name"}},
+	})
+	expected := map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name": "response",
+			"schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+				"required":   []string{"name"},
+			},
+		},
+	}
+	if got, _ := json.Marshal(format); string(got) != mustMarshal(t, expected) {
+		t.Errorf("Unexpected json_schema format:\n got: %s\nwant: %s", got, mustMarshal(t, expected))
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	return string(data)
+}
+
+func TestOpenAIToolCallRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		contents     []Content
+		chunks       []string
+		wantMessages string // JSON of the messages sent to the endpoint
+		wantParts    []Part
+	}{
+		{
+			name:     "TextOnly",
+			contents: []Content{{Role: RoleUser, Parts: []Part{{Text: "Hello"}}}},
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":" there"},"finish_reason":"stop"}]}`,
+			},
+			wantMessages: `[{"role":"user","content":"Hello"}]`,
+			wantParts:    []Part{{Text: "Hi"}, {Text: " there"}},
+		},
+		{
+			name: "ToolCallHistory",
+			contents: []Content{
+				{Role: RoleUser, Parts: []Part{{Text: "List files"}}},
+				{Role: RoleModel, Parts: []Part{{Text: "Let me check.", Thought: true}}},
+				{Role: RoleModel, Parts: []Part{{Text: "Checking."}}},
+				{Role: RoleModel, Parts: []Part{{FunctionCall: &FunctionCall{Name: "list_directory", Args: map[string]interface{}{"path": "."}, Id: "call_1"}}}},
+				{Role: RoleUser, Parts: []Part{{FunctionResponse: &FunctionResponse{Name: "list_directory", Response: map[string]interface{}{"files": []interface{}{"a.txt"}}}}}},
+				{Role: RoleModel, Parts: []Part{{FunctionCall: &FunctionCall{Name: "read_file", Args: map[string]interface{}{"path": "a.txt"}}}}},
+				{Role: RoleUser, Parts: []Part{
+					{FunctionResponse: &FunctionResponse{Name: "read_file", Response: map[string]interface{}{"content": "hi"}}},
+					{Text: "Also summarize it."},
+				}},
+			},
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"content":"It says hi."},"finish_reason":"stop"}]}`,
+			},
+			wantMessages: `[
+				{"role":"user","content":"List files"},
+				{"role":"assistant","content":"Checking.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"list_directory","arguments":"{\"path\":\".\"}"}}]},
+				{"role":"tool","content":"{\"files\":[\"a.txt\"]}","tool_call_id":"call_1"},
+				{"role":"assistant","content":null,"tool_calls":[{"id":"call_angel_1","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"a.txt\"}"}}]},
+				{"role":"tool","content":"{\"content\":\"hi\"}","tool_call_id":"call_angel_1"},
+				{"role":"user","content":"Also summarize it."}
+			]`,
+			wantParts: []Part{{Text: "It says hi."}},
+		},
+		{
+			name: "ImageAndUnmatchedResponse",
+			contents: []Content{
+				{Role: RoleUser, Parts: []Part{
+					{FunctionResponse: &FunctionResponse{Name: "orphan", Response: map[string]interface{}{"ok": true}}},
+					{InlineData: &InlineData{MimeType: "image/png", Data: "aGVsbG8="}},
+				}},
+			},
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"content":"A picture."},"finish_reason":"stop"}]}`,
+			},
+			wantMessages: `[{"role":"user","content":[
+				{"type":"text","text":"Result of orphan:\n{\"ok\":true}"},
+				{"type":"image_url","image_url":{"url":"data:image/png;base64,aGVsbG8="}}
+			]}]`,
+			wantParts: []Part{{Text: "A picture."}},
+		},
+		{
+			name:     "ParallelToolCallDeltas",
+			contents: []Content{{Role: RoleUser, Parts: []Part{{Text: "Weather?"}}}},
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"get_time","arguments":""}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"{}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Seoul\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			},
+			wantMessages: `[{"role":"user","content":"Weather?"}]`,
+			wantParts: []Part{
+				{FunctionCall: &FunctionCall{Name: "get_weather", Args: map[string]interface{}{"city": "Seoul"}, Id: "call_a"}},
+				{FunctionCall: &FunctionCall{Name: "get_time", Args: map[string]interface{}{}, Id: "call_b"}},
+			},
+		},
+		{
+			name:     "ToolCallWithoutIndexOrFinishReason",
+			contents: []Content{{Role: RoleUser, Parts: []Part{{Text: "Run it"}}}},
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_x","function":{"name":"run_command","arguments":"{\"command\""}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"function":{"arguments":":\"ls\"}"}}]}}]}`,
+			},
+			wantMessages: `[{"role":"user","content":"Run it"}]`,
+			wantParts: []Part{
+				{FunctionCall: &FunctionCall{Name: "run_command", Args: map[string]interface{}{"command": "ls"}, Id: "call_x"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received OpenAIChatRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/chat/completions" {
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("Failed to decode request: %v", err)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, chunk := range tt.chunks {
+					fmt.Fprintf(w, "data: %s\n\n", chunk)
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+
+			client := NewOpenAIClient(&OpenAIConfig{Endpoint: server.URL + "/v1"})
+			ctx := tool.ContextWith(context.Background(), tool.NewTools())
+			seq, closer, err := client.SendMessageStream(ctx, "test-model", SessionParams{Contents: tt.contents})
+			if err != nil {
+				t.Fatalf("SendMessageStream failed: %v", err)
+			}
+			defer closer.Close()
+
+			var parts []Part
+			for resp := range seq {
+				for _, candidate := range resp.Candidates {
+					parts = append(parts, candidate.Content.Parts...)
+				}
+			}
+
+			var gotMessages, wantMessages interface{}
+			gotJSON, _ := json.Marshal(received.Messages)
+			json.Unmarshal(gotJSON, &gotMessages)
+			if err := json.Unmarshal([]byte(tt.wantMessages), &wantMessages); err != nil {
+				t.Fatalf("Invalid expected messages: %v", err)
+			}
+			if !reflect.DeepEqual(gotMessages, wantMessages) {
+				t.Errorf("Unexpected request messages:\n got: %s\nwant: %s", gotJSON, tt.wantMessages)
+			}
+
+			if !reflect.DeepEqual(parts, tt.wantParts) {
+				gotParts, _ := json.Marshal(parts)
+				wantParts, _ := json.Marshal(tt.wantParts)
+				t.Errorf("Unexpected parts:\n got: %s\nwant: %s", gotParts, wantParts)
+			}
+		})
+	}
+}
+
+func TestOpenAIResponsesAPIRoundTrip(t *testing.T) {
+	events := []string{
+		`{"type":"response.created","response":{"status":"in_progress"}}`,
+		`{"type":"response.output_item.added","output_index":0,"item":{"type":"reasoning","id":"rs_1","summary":[]}}`,
+		`{"type":"response.reasoning_summary_text.delta","item_id":"rs_1","delta":"Need the weather."}`,
+		`{"type":"response.output_item.done","output_index":0,"item":{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"Need the weather."}],"encrypted_content":"opaque"}}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","delta":"Let me"}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","delta":" check."}`,
+		`{"type":"response.output_item.added","output_index":2,"item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"get_weather","arguments":""}}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"{\"city\":\"Seoul\"}"}`,
+		`{"type":"response.output_item.done","output_index":2,"item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Seoul\"}"}}`,
+		`{"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":20,"input_tokens_details":{"cached_tokens":8},"output_tokens":30,"output_tokens_details":{"reasoning_tokens":12},"total_tokens":50}}}`,
+	}
+
+	var requests []OpenAIResponsesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		var req OpenAIResponsesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var typed struct{ Type string }
+			json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(&OpenAIConfig{Endpoint: server.URL + "/v1", APIMode: OpenAIAPIModeResponses})
+	ctx := tool.ContextWith(context.Background(), tool.NewTools())
+	contents := []Content{{Role: RoleUser, Parts: []Part{{Text: "Weather in Seoul?"}}}}
+
+	seq, closer, err := client.SendMessageStream(ctx, "test-model", SessionParams{
+		SystemPrompt:    "Be brief.",
+		Contents:        contents,
+		IncludeThoughts: true,
+	})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+
+	var parts []Part
+	var finishReason string
+	var usage *UsageMetadata
+	for resp := range seq {
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+		for _, candidate := range resp.Candidates {
+			parts = append(parts, candidate.Content.Parts...)
+			if candidate.FinishReason != "" {
+				finishReason = candidate.FinishReason
+			}
+		}
+	}
+	closer.Close()
+
+	if len(parts) != 4 {
+		t.Fatalf("Expected 4 parts, got %d: %+v", len(parts), parts)
+	}
+	if !parts[0].Thought || parts[0].Text != "Need the weather." {
+		t.Errorf("Expected reasoning summary as a thought part, got %+v", parts[0])
+	}
+	if parts[1].Text != "Let me" || parts[1].ThoughtSignature == "" {
+		t.Errorf("Expected first text part to carry the reasoning state, got %+v", parts[1])
+	}
+	if parts[2].Text != " check." || parts[2].ThoughtSignature != "" {
+		t.Errorf("Unexpected second text part: %+v", parts[2])
+	}
+	wantCall := &FunctionCall{Name: "get_weather", Args: map[string]interface{}{"city": "Seoul"}, Id: "call_1"}
+	if !reflect.DeepEqual(parts[3].FunctionCall, wantCall) {
+		t.Errorf("Unexpected function call: %+v", parts[3].FunctionCall)
+	}
+	if finishReason != FinishReasonStop {
+		t.Errorf("Expected finish reason %s, got %q", FinishReasonStop, finishReason)
+	}
+	if usage == nil || usage.PromptTokenCount != 20 || usage.CachedContentTokenCount != 8 || usage.ThoughtsTokenCount != 12 || usage.CandidatesTokenCount != 18 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	first := requests[0]
+	if first.Instructions != "Be brief." || first.Reasoning == nil || first.Store == nil || *first.Store {
+		t.Errorf("Unexpected request options: %+v", first)
+	}
+
+	// Send the history back as the chat layer would reconstruct it
+	contents = append(contents,
+		Content{Role: RoleModel, Parts: []Part{parts[0]}},
+		Content{Role: RoleModel, Parts: []Part{{Text: "Let me check.", ThoughtSignature: parts[1].ThoughtSignature}}},
+		Content{Role: RoleModel, Parts: []Part{parts[3]}},
+		Content{Role: RoleUser, Parts: []Part{{FunctionResponse: &FunctionResponse{Name: "get_weather", Response: map[string]interface{}{"weather": "sunny"}}}}},
+	)
+	seq, closer, err = client.SendMessageStream(ctx, "test-model", SessionParams{Contents: contents})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+	for range seq {
+	}
+	closer.Close()
+
+	gotInput, _ := json.Marshal(requests[1].Input)
+	var got, want interface{}
+	json.Unmarshal(gotInput, &got)
+	json.Unmarshal([]byte(`[
+		{"type":"message","role":"user","content":[{"type":"input_text","text":"Weather in Seoul?"}]},
+		{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"Need the weather."}],"encrypted_content":"opaque"},
+		{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Let me check."}]},
+		{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Seoul\"}"},
+		{"type":"function_call_output","call_id":"call_1","output":"{\"weather\":\"sunny\"}"}
+	]`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected input items on the second request:\n got: %s", gotInput)
+	}
+	if requests[1].Reasoning != nil {
+		t.Errorf("Expected no reasoning summary without IncludeThoughts, got %+v", requests[1].Reasoning)
+	}
+}
+
+func TestOpenAICountTokens(t *testing.T) {
+	contents := []Content{
+		{Role: RoleUser, Parts: []Part{{Text: "What is in this picture?"}, {InlineData: &InlineData{MimeType: "image/png", Data: "aGVsbG8="}}}},
+		{Role: RoleModel, Parts: []Part{{FunctionCall: &FunctionCall{Name: "describe_image", Args: map[string]interface{}{"detail": "high"}}}}},
+		{Role: RoleUser, Parts: []Part{{FunctionResponse: &FunctionResponse{Name: "describe_image", Response: map[string]interface{}{"description": "a cat"}}}}},
+	}
+	text, images := renderContentsForTokenCount(contents)
+	if images != 1 {
+		t.Errorf("Expected 1 image, got %d", images)
+	}
+	for _, want := range []string{"What is in this picture?", "describe_image", `"detail":"high"`, `"description":"a cat"`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected rendered text to contain %q, got %q", want, text)
+		}
+	}
+	overhead := openAITokensPerImage + len(contents)*openAITokensPerMessage
+
+	t.Run("ServerTokenize", func(t *testing.T) {
+		hits := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/tokenize" {
+				http.NotFound(w, r)
+				return
+			}
+			hits++
+			var req struct{ Content string }
+			json.NewDecoder(r.Body).Decode(&req)
+			tokens := make([]int, len(strings.Fields(req.Content)))
+			json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens})
+		}))
+		defer server.Close()
+
+		client := NewOpenAIClient(&OpenAIConfig{Endpoint: server.URL + "/v1"})
+		for i := 0; i < 2; i++ {
+			resp, err := client.CountTokens(context.Background(), "local-model", contents)
+			if err != nil {
+				t.Fatalf("CountTokens failed: %v", err)
+			}
+			if want := len(strings.Fields(text)) + overhead; resp.TotalTokens != want {
+				t.Errorf("Expected %d tokens, got %d", want, resp.TotalTokens)
+			}
+		}
+		if hits != 1 {
+			t.Errorf("Expected the second count to be cached, got %d tokenize calls", hits)
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		hits := 0
+		supported := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			if !supported || r.URL.Path != "/tokenize" {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"tokens": []int{1, 2, 3}})
+		}))
+		defer server.Close()
+
+		client := NewOpenAIClient(&OpenAIConfig{Endpoint: server.URL + "/v1"})
+		resp, err := client.CountTokens(context.Background(), "gpt-4", contents)
+		if err != nil {
+			t.Fatalf("CountTokens failed: %v", err)
+		}
+		local, err := countTokensLocally("gpt-4", text)
+		if err != nil {
+			t.Fatalf("countTokensLocally failed: %v", err)
+		}
+		if want := local + overhead; resp.TotalTokens != want {
+			t.Errorf("Expected %d tokens, got %d", want, resp.TotalTokens)
+		}
+
+		// Local counts are cached, but not as exact counts
+		sum := sha256.Sum256([]byte(text))
+		digest := hex.EncodeToString(sum[:])
+		if cached, ok := client.tokenizer.cached("gpt-4", digest); !ok || cached.exact || cached.count != local {
+			t.Errorf("Expected the local count %d to be cached as inexact, got %+v (cached: %v)", local, cached, ok)
+		}
+
+		// Unsupported endpoints are not probed again for other contents
+		probes := hits
+		if _, err := client.CountTokens(context.Background(), "gpt-4", contents[:1]); err != nil {
+			t.Fatalf("CountTokens failed: %v", err)
+		}
+		if hits != probes {
+			t.Errorf("Expected no further probes, got %d more requests", hits-probes)
+		}
+
+		// Once the server supports tokenization, its counts replace local ones
+		supported = true
+		client.tokenizer.mu.Lock()
+		client.tokenizer.probedAt = time.Time{}
+		client.tokenizer.mu.Unlock()
+		resp, err = client.CountTokens(context.Background(), "gpt-4", contents)
+		if err != nil {
+			t.Fatalf("CountTokens failed: %v", err)
+		}
+		if want := 3 + overhead; resp.TotalTokens != want {
+			t.Errorf("Expected %d tokens, got %d", want, resp.TotalTokens)
+		}
+		if cached, ok := client.tokenizer.cached("gpt-4", digest); !ok || !cached.exact || cached.count != 3 {
+			t.Errorf("Expected the server count to be cached as exact, got %+v (cached: %v)", cached, ok)
+		}
+	})
+}
+
+func TestCountTokensLocally(t *testing.T) {
+	// Expected values are reference cl100k_base token counts
+	tests := []struct {
+		text   string
+		tokens int
+	}{
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"antidisestablishmentarianism", 6},
+		{"12345678", 3},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		got, err := countTokensLocally("openai/gpt-4-turbo", tt.text)
+		if err != nil {
+			t.Fatalf("countTokensLocally(%q) failed: %v", tt.text, err)
+		}
+		if got != tt.tokens {
+			t.Errorf("countTokensLocally(%q) = %d, want %d", tt.text, got, tt.tokens)
+		}
+	}
+
+	for model, want := range map[string]tokenizer.Encoding{
+		"gpt-4":           tokenizer.Cl100kBase,
+		"gpt-3.5-turbo":   tokenizer.Cl100kBase,
+		"gpt-4o-mini":     tokenizer.O200kBase,
+		"gpt-4.1":         tokenizer.O200kBase,
+		"qwen3-coder:30b": tokenizer.O200kBase,
+	} {
+		if got := bpeEncodingForModel(model); got != want {
+			t.Errorf("bpeEncodingForModel(%q) = %s, want %s", model, got, want)
+		}
+	}
+}
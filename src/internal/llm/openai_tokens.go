@@ -0,0 +1,264 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+const (
+	// Tokens added by chat templates around each message, as in OpenAI's own accounting
+	openAITokensPerMessage = 4
+	// Flat estimate for an image; most vision models charge a few hundred to a thousand tokens per image
+	openAITokensPerImage = 765
+
+	// How long to wait before probing tokenize endpoints again when none of them worked
+	tokenizeReprobeInterval = time.Hour
+	// Maximum number of cached token counts per model
+	maxCachedTokenCounts = 256
+)
+
+// tokenizeEndpoint describes a server-side tokenization API, relative to the OpenAI-compatible endpoint
+type tokenizeEndpoint struct {
+	path    string
+	request func(modelName, text string) interface{}
+}
+
+var tokenizeEndpoints = []tokenizeEndpoint{
+	// llama.cpp server
+	{"../tokenize", func(modelName, text string) interface{} {
+		return map[string]interface{}{"content": text, "add_special": true}
+	}},
+	// Ollama, when built with tokenization support
+	{"../api/tokenize", func(modelName, text string) interface{} {
+		return map[string]interface{}{"model": modelName, "content": text}
+	}},
+}
+
+// openAITokenizer counts tokens for an OpenAI-compatible client, caching the results per model
+type openAITokenizer struct {
+	mu       sync.Mutex
+	endpoint *tokenizeEndpoint // Working tokenize endpoint, nil if unknown or unsupported
+	probedAt time.Time         // When tokenize endpoints were last probed without success
+	counts   map[string]map[string]tokenCount
+}
+
+// tokenCount is a cached token count
+type tokenCount struct {
+	count int
+	exact bool // Counted by the server; otherwise counted with an embedded BPE vocabulary
+}
+
+// cached returns a cached token count for the model and text digest
+func (t *openAITokenizer) cached(modelName, digest string) (tokenCount, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count, ok := t.counts[modelName][digest]
+	return count, ok
+}
+
+// store caches a token count for the model and text digest
+func (t *openAITokenizer) store(modelName, digest string, count tokenCount) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.counts == nil {
+		t.counts = make(map[string]map[string]tokenCount)
+	}
+	counts := t.counts[modelName]
+	if counts == nil || len(counts) >= maxCachedTokenCounts {
+		counts = make(map[string]tokenCount)
+		t.counts[modelName] = counts
+	}
+	counts[digest] = count
+}
+
+// CountTokens implements the LLMProvider interface.
+// It uses server-side tokenization when available, and otherwise falls back to an embedded BPE tokenizer.
+// Both are cached per model, but local counts are replaced once server-side tokenization becomes available.
+func (c *OpenAIClient) CountTokens(ctx context.Context, modelName string, contents []Content) (*CaCountTokenResponse, error) {
+	text, images := renderContentsForTokenCount(contents)
+	sum := sha256.Sum256([]byte(text))
+	digest := hex.EncodeToString(sum[:])
+
+	cached, ok := c.tokenizer.cached(modelName, digest)
+	textTokens := cached.count
+	if !ok || !cached.exact {
+		// This fails fast without a request unless the server is known to support tokenization or is due for probing
+		if count, err := c.tokenizeRemote(ctx, modelName, text); err == nil {
+			textTokens = count
+			c.tokenizer.store(modelName, digest, tokenCount{count: count, exact: true})
+		} else if !ok {
+			count, err := countTokensLocally(modelName, text)
+			if err != nil {
+				return nil, err
+			}
+			textTokens = count
+			c.tokenizer.store(modelName, digest, tokenCount{count: count})
+		}
+	}
+
+	return &CaCountTokenResponse{
+		TotalTokens: max(textTokens+images*openAITokensPerImage+len(contents)*openAITokensPerMessage, 1),
+	}, nil
+}
+
+// tokenizeRemote counts tokens with the server-side tokenization API, probing known endpoints if needed
+func (c *OpenAIClient) tokenizeRemote(ctx context.Context, modelName, text string) (int, error) {
+	c.tokenizer.mu.Lock()
+	endpoint := c.tokenizer.endpoint
+	probe := endpoint == nil && time.Since(c.tokenizer.probedAt) >= tokenizeReprobeInterval
+	c.tokenizer.mu.Unlock()
+
+	if endpoint != nil {
+		return c.callTokenize(ctx, endpoint, modelName, text)
+	}
+	if !probe {
+		return 0, fmt.Errorf("server-side tokenization is not available")
+	}
+
+	for i := range tokenizeEndpoints {
+		endpoint := &tokenizeEndpoints[i]
+		count, err := c.callTokenize(ctx, endpoint, modelName, text)
+		if err != nil {
+			continue
+		}
+		log.Printf("Using %s for token counting of %s", endpoint.path, c.config.Endpoint)
+		c.tokenizer.mu.Lock()
+		c.tokenizer.endpoint = endpoint
+		c.tokenizer.mu.Unlock()
+		return count, nil
+	}
+
+	c.tokenizer.mu.Lock()
+	c.tokenizer.probedAt = time.Now()
+	c.tokenizer.mu.Unlock()
+	return 0, fmt.Errorf("server-side tokenization is not available")
+}
+
+// callTokenize calls a tokenize endpoint and returns the number of tokens
+func (c *OpenAIClient) callTokenize(ctx context.Context, endpoint *tokenizeEndpoint, modelName, text string) (int, error) {
+	apiURL, err := url.JoinPath(c.config.Endpoint, endpoint.path)
+	if err != nil {
+		return 0, err
+	}
+	jsonBody, err := json.Marshal(endpoint.request(modelName, text))
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(jsonBody))
+	if err != nil {
+		return 0, err
+	}
+	if c.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("API error: %d %s, response: %s", resp.StatusCode, resp.Status, string(body))
+	}
+
+	var result struct {
+		Tokens []json.RawMessage `json:"tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if result.Tokens == nil {
+		return 0, fmt.Errorf("no tokens in response")
+	}
+	return len(result.Tokens), nil
+}
+
+// renderContentsForTokenCount renders contents as the text seen by the model, and counts images
+func renderContentsForTokenCount(contents []Content) (string, int) {
+	var sb strings.Builder
+	images := 0
+	for _, message := range convertGeminiToOpenAIContent(contents) {
+		sb.WriteString(message.Role)
+		sb.WriteString("\n")
+		switch content := message.Content.(type) {
+		case string:
+			sb.WriteString(content)
+		case []OpenAIContentPart:
+			for _, part := range content {
+				if part.ImageURL != nil {
+					images++
+				} else {
+					sb.WriteString(part.Text)
+				}
+			}
+		}
+		for _, call := range message.ToolCalls {
+			sb.WriteString("\n")
+			sb.WriteString(call.Function.Name)
+			sb.WriteString(call.Function.Arguments)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), images
+}
+
+var (
+	bpeCodecsMu sync.Mutex
+	bpeCodecs   = make(map[tokenizer.Encoding]tokenizer.Codec)
+)
+
+// bpeEncodingForModel picks the embedded BPE vocabulary for counting tokens of the model.
+// Local models have vocabularies of their own; o200k is the closest to recent ones, which are similarly large and multilingual.
+func bpeEncodingForModel(modelName string) tokenizer.Encoding {
+	name := strings.ToLower(modelName)
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:] // e.g. "openai/gpt-4"
+	}
+	isGPT4 := strings.HasPrefix(name, "gpt-4") && !strings.HasPrefix(name, "gpt-4o") && !strings.HasPrefix(name, "gpt-4.")
+	if isGPT4 || strings.HasPrefix(name, "gpt-3.5") || strings.HasPrefix(name, "gpt-35") {
+		return tokenizer.Cl100kBase
+	}
+	return tokenizer.O200kBase
+}
+
+// countTokensLocally counts tokens with an embedded BPE vocabulary, loaded on first use
+func countTokensLocally(modelName, text string) (int, error) {
+	encoding := bpeEncodingForModel(modelName)
+
+	bpeCodecsMu.Lock()
+	codec, ok := bpeCodecs[encoding]
+	if !ok {
+		var err error
+		codec, err = tokenizer.Get(encoding)
+		if err != nil {
+			bpeCodecsMu.Unlock()
+			return 0, fmt.Errorf("failed to load %s tokenizer: %w", encoding, err)
+		}
+		bpeCodecs[encoding] = codec
+	}
+	bpeCodecsMu.Unlock()
+
+	count, err := codec.Count(text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tokens with %s: %w", encoding, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,358 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/llm/spec"
+)
+
+// Methods of LLMProvider recorded in RecordedCall.Method
+const (
+	RecordedStream      = "stream"
+	RecordedOneShot     = "oneShot"
+	RecordedCountTokens = "countTokens"
+	RecordedEmbed       = "embed"
+)
+
+// recordedDatePattern matches dates as rendered in prompts, which are replaced so that recordings remain valid on later days
+var recordedDatePattern = regexp.MustCompile(`\b(January|February|March|April|May|June|July|August|September|October|November|December) [1-3]?[0-9], [0-9]{4}\b`)
+
+// replayMaxTokens is reported by ReplayProvider, as the maximum number of tokens is not a part of recordings
+const replayMaxTokens = 1048576
+
+// RecordedRequest is the normalised form of a request, used for matching recorded calls.
+// Anything that varies between otherwise identical runs (session IDs, thought signatures,
+// function call IDs, dates and surrounding whitespace) is removed.
+type RecordedRequest struct {
+	Method           string                 `json:"method"`
+	Model            string                 `json:"model"`
+	Contents         []Content              `json:"contents,omitempty"`
+	SystemPrompt     string                 `json:"systemPrompt,omitempty"`
+	IncludeThoughts  bool                   `json:"includeThoughts,omitempty"`
+	ToolConfig       map[string]interface{} `json:"toolConfig,omitempty"`
+	GenParams        spec.GenerationParams  `json:"genParams"`
+	ResponseMimeType string                 `json:"responseMimeType,omitempty"`
+	ResponseSchema   *Schema                `json:"responseSchema,omitempty"`
+
+	// For RecordedEmbed
+	Texts           []string `json:"texts,omitempty"`
+	EmbedTask       string   `json:"embedTask,omitempty"`
+	EmbedDimensions int      `json:"embedDimensions,omitempty"`
+}
+
+// RecordedCall is a single line of a recording, holding a request and its outcome
+type RecordedCall struct {
+	Hash    string                    `json:"hash"`
+	Request RecordedRequest           `json:"request"`
+	Chunks  []GenerateContentResponse `json:"chunks,omitempty"`  // For RecordedStream
+	Result  *OneShotResult            `json:"result,omitempty"`  // For RecordedOneShot
+	Tokens  *CaCountTokenResponse     `json:"tokens,omitempty"`  // For RecordedCountTokens
+	Vectors [][]float32               `json:"vectors,omitempty"` // For RecordedEmbed
+	Error   string                    `json:"error,omitempty"`   // Set if the call failed before returning anything
+}
+
+// newRecordedRequest normalises a request
+func newRecordedRequest(method, modelName string, params SessionParams) RecordedRequest {
+	return RecordedRequest{
+		Method:           method,
+		Model:            modelName,
+		Contents:         normalizeRecordedContents(params.Contents),
+		SystemPrompt:     normalizeRecordedText(params.SystemPrompt),
+		IncludeThoughts:  params.IncludeThoughts,
+		ToolConfig:       params.ToolConfig,
+		GenParams:        params.GenParams,
+		ResponseMimeType: params.ResponseMimeType,
+		ResponseSchema:   params.ResponseSchema,
+	}
+}
+
+// newRecordedEmbedRequest normalises an embedding request
+func newRecordedEmbedRequest(modelName string, params EmbedParams) RecordedRequest {
+	texts := make([]string, len(params.Texts))
+	for i, text := range params.Texts {
+		texts[i] = normalizeRecordedText(text)
+	}
+	return RecordedRequest{
+		Method:          RecordedEmbed,
+		Model:           modelName,
+		Texts:           texts,
+		EmbedTask:       params.Task,
+		EmbedDimensions: params.Dimensions,
+	}
+}
+
+// normalizeRecordedContents returns a copy of contents without run-specific details
+func normalizeRecordedContents(contents []Content) []Content {
+	normalized := make([]Content, len(contents))
+	for i, content := range contents {
+		parts := make([]Part, len(content.Parts))
+		for j, part := range content.Parts {
+			part.Text = normalizeRecordedText(part.Text)
+			part.ThoughtSignature = ""
+			if part.FunctionCall != nil {
+				fc := *part.FunctionCall
+				fc.Id = ""
+				part.FunctionCall = &fc
+			}
+			if part.FunctionResponse != nil {
+				fr := *part.FunctionResponse
+				fr.Id = ""
+				part.FunctionResponse = &fr
+			}
+			parts[j] = part
+		}
+		normalized[i] = Content{Role: content.Role, Parts: parts}
+	}
+	return normalized
+}
+
+// normalizeRecordedText trims the text and replaces dates with a placeholder
+func normalizeRecordedText(text string) string {
+	return recordedDatePattern.ReplaceAllString(strings.TrimSpace(text), "<date>")
+}
+
+// Hash returns the digest used to match recorded calls.
+// The request is hashed in the canonical JSON form, so that it is stable after being read back from a recording.
+func (req RecordedRequest) Hash() string {
+	data, _ := json.Marshal(req)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var canonical interface{}
+	if err := decoder.Decode(&canonical); err == nil {
+		data, _ = json.Marshal(canonical)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Recorder writes calls made through wrapped providers to a JSONL stream.
+// A single recorder can be shared by multiple providers.
+type Recorder struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewRecorder creates a recorder writing to w, one RecordedCall per line
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{encoder: json.NewEncoder(w)}
+}
+
+// Wrap returns a provider that forwards calls to provider and records them
+func (rec *Recorder) Wrap(provider LLMProvider) LLMProvider {
+	return &recordingProvider{inner: provider, recorder: rec}
+}
+
+func (rec *Recorder) write(call RecordedCall) {
+	call.Hash = call.Request.Hash()
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if err := rec.encoder.Encode(call); err != nil {
+		log.Printf("Failed to record LLM call: %v", err)
+	}
+}
+
+// recordingProvider wraps an LLMProvider and records every call to its recorder
+type recordingProvider struct {
+	inner    LLMProvider
+	recorder *Recorder
+}
+
+// SendMessageStream records the streamed chunks once the stream is exhausted or abandoned
+func (p *recordingProvider) SendMessageStream(ctx context.Context, modelName string, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+	call := RecordedCall{Request: newRecordedRequest(RecordedStream, modelName, params)}
+	seq, closer, err := p.inner.SendMessageStream(ctx, modelName, params)
+	if err != nil {
+		call.Error = err.Error()
+		p.recorder.write(call)
+		return nil, nil, err
+	}
+
+	return func(yield func(GenerateContentResponse) bool) {
+		defer func() { p.recorder.write(call) }()
+		for resp := range seq {
+			call.Chunks = append(call.Chunks, resp)
+			if !yield(resp) {
+				return
+			}
+		}
+	}, closer, nil
+}
+
+func (p *recordingProvider) GenerateContentOneShot(ctx context.Context, modelName string, params SessionParams) (OneShotResult, error) {
+	call := RecordedCall{Request: newRecordedRequest(RecordedOneShot, modelName, params)}
+	result, err := p.inner.GenerateContentOneShot(ctx, modelName, params)
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Result = &result
+	}
+	p.recorder.write(call)
+	return result, err
+}
+
+func (p *recordingProvider) CountTokens(ctx context.Context, modelName string, contents []Content) (*CaCountTokenResponse, error) {
+	call := RecordedCall{Request: newRecordedRequest(RecordedCountTokens, modelName, SessionParams{Contents: contents})}
+	resp, err := p.inner.CountTokens(ctx, modelName, contents)
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Tokens = resp
+	}
+	p.recorder.write(call)
+	return resp, err
+}
+
+// Embed records embeddings if the wrapped provider supports them
+func (p *recordingProvider) Embed(ctx context.Context, modelName string, params EmbedParams) ([][]float32, error) {
+	embedder, ok := p.inner.(Embedder)
+	if !ok {
+		return nil, ErrEmbeddingUnsupported
+	}
+	call := RecordedCall{Request: newRecordedEmbedRequest(modelName, params)}
+	vectors, err := embedder.Embed(ctx, modelName, params)
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Vectors = vectors
+	}
+	p.recorder.write(call)
+	return vectors, err
+}
+
+func (p *recordingProvider) MaxTokens(modelName string) int {
+	return p.inner.MaxTokens(modelName)
+}
+
+var _ LLMProvider = (*recordingProvider)(nil)
+var _ Embedder = (*recordingProvider)(nil)
+
+// ErrNoRecording is returned by ReplayProvider when no recorded call matches the request
+var ErrNoRecording = errors.New("no recorded call matches the request")
+
+// ReplayProvider answers requests from recorded calls matched by their normalised hashes.
+// Calls recorded multiple times for the same request are replayed in order, and the last one is repeated afterwards.
+type ReplayProvider struct {
+	mutex sync.Mutex
+	calls map[string][]RecordedCall
+	next  map[string]int
+}
+
+// NewReplayProvider reads recorded calls from a JSONL stream written by Recorder
+func NewReplayProvider(r io.Reader) (*ReplayProvider, error) {
+	p := &ReplayProvider{
+		calls: make(map[string][]RecordedCall),
+		next:  make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var call RecordedCall
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			return nil, fmt.Errorf("failed to parse recorded call at line %d: %w", line, err)
+		}
+		// Recompute the hash so that recordings can be edited by hand
+		hash := call.Request.Hash()
+		p.calls[hash] = append(p.calls[hash], call)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recorded calls: %w", err)
+	}
+	return p, nil
+}
+
+// LoadReplayProvider reads recorded calls from a JSONL file written by Recorder
+func LoadReplayProvider(path string) (*ReplayProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewReplayProvider(f)
+}
+
+// lookup returns the next recorded call for the request
+func (p *ReplayProvider) lookup(req RecordedRequest) (RecordedCall, error) {
+	hash := req.Hash()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	calls := p.calls[hash]
+	if len(calls) == 0 {
+		return RecordedCall{}, fmt.Errorf("%w (%s call to %s, hash %s)", ErrNoRecording, req.Method, req.Model, hash)
+	}
+	index := min(p.next[hash], len(calls)-1)
+	p.next[hash] = index + 1
+	call := calls[index]
+	if call.Error != "" {
+		return RecordedCall{}, errors.New(call.Error)
+	}
+	return call, nil
+}
+
+func (p *ReplayProvider) SendMessageStream(ctx context.Context, modelName string, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+	call, err := p.lookup(newRecordedRequest(RecordedStream, modelName, params))
+	if err != nil {
+		return nil, nil, err
+	}
+	return func(yield func(GenerateContentResponse) bool) {
+		for _, resp := range call.Chunks {
+			if ctx.Err() != nil || !yield(resp) {
+				return
+			}
+		}
+	}, io.NopCloser(nil), nil
+}
+
+func (p *ReplayProvider) GenerateContentOneShot(ctx context.Context, modelName string, params SessionParams) (OneShotResult, error) {
+	call, err := p.lookup(newRecordedRequest(RecordedOneShot, modelName, params))
+	if err != nil {
+		return OneShotResult{}, err
+	}
+	if call.Result == nil {
+		return OneShotResult{}, nil
+	}
+	return *call.Result, nil
+}
+
+func (p *ReplayProvider) CountTokens(ctx context.Context, modelName string, contents []Content) (*CaCountTokenResponse, error) {
+	call, err := p.lookup(newRecordedRequest(RecordedCountTokens, modelName, SessionParams{Contents: contents}))
+	if err != nil {
+		return nil, err
+	}
+	return call.Tokens, nil
+}
+
+func (p *ReplayProvider) Embed(ctx context.Context, modelName string, params EmbedParams) ([][]float32, error) {
+	call, err := p.lookup(newRecordedEmbedRequest(modelName, params))
+	if err != nil {
+		return nil, err
+	}
+	return call.Vectors, nil
+}
+
+func (p *ReplayProvider) MaxTokens(modelName string) int {
+	return replayMaxTokens
+}
+
+var _ LLMProvider = (*ReplayProvider)(nil)
+var _ Embedder = (*ReplayProvider)(nil)
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/lifthrasiir/angel/gemini"
+)
+
+// collectStream runs a stream to the end and returns all chunks
+func collectStream(t *testing.T, provider LLMProvider, params SessionParams) []GenerateContentResponse {
+	t.Helper()
+	seq, closer, err := provider.SendMessageStream(context.Background(), "model", params)
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+	defer closer.Close()
+	var chunks []GenerateContentResponse
+	for resp := range seq {
+		chunks = append(chunks, resp)
+	}
+	return chunks
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	call := FunctionCall{Name: "read_file", Args: map[string]interface{}{"path": "a.txt", "limit": 10}, Id: "call-1"}
+	var streams int
+	mock := &MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			streams++
+			var resp GenerateContentResponse
+			if len(params.Contents) == 1 {
+				resp = GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: "model", Parts: []Part{
+					{Text: "Reading", ThoughtSignature: "sig"}, {FunctionCall: &call},
+				}}}}}
+			} else {
+				resp = textResponse("Done")
+			}
+			return func(yield func(GenerateContentResponse) bool) { yield(resp) }, nopCloser{}, nil
+		},
+		GenerateContentOneShotFunc: func(ctx context.Context, modelName string, params SessionParams) (OneShotResult, error) {
+			return OneShotResult{}, errors.New("quota exceeded")
+		},
+	}
+
+	// A tool loop with two calls: the function call, then the answer after the function response
+	first := SessionParams{
+		SystemPrompt: "Today is March 4, 2025.",
+		Contents:     []Content{{Role: "user", Parts: []Part{{Text: "Read a.txt"}}}},
+		SessionId:    "session-1",
+	}
+	toolLoop := func(provider LLMProvider, first SessionParams, signature, callID string) [][]GenerateContentResponse {
+		chunks := collectStream(t, provider, first)
+		second := first
+		second.Contents = append(append([]Content{}, first.Contents...),
+			Content{Role: "model", Parts: []Part{{Text: "Reading", ThoughtSignature: signature}, {FunctionCall: &FunctionCall{Name: call.Name, Args: call.Args, Id: callID}}}},
+			Content{Role: "user", Parts: []Part{{FunctionResponse: &FunctionResponse{Name: call.Name, Response: map[string]interface{}{"content": "hello"}, Id: callID}}}},
+		)
+		return [][]GenerateContentResponse{chunks, collectStream(t, provider, second)}
+	}
+
+	var recording bytes.Buffer
+	recorded := toolLoop(NewRecorder(&recording).Wrap(mock), first, "sig", "call-1")
+	if _, err := NewRecorder(&recording).Wrap(mock).GenerateContentOneShot(context.Background(), "model", first); err == nil {
+		t.Fatal("Expected the one-shot call to fail")
+	}
+	if lines := strings.Count(recording.String(), "\n"); lines != 3 || streams != 2 {
+		t.Fatalf("Expected 3 recorded calls from 2 streams, got %d lines and %d streams", lines, streams)
+	}
+
+	replay, err := NewReplayProvider(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+
+	// Session IDs, thought signatures, function call IDs and dates do not affect matching
+	replayed := first
+	replayed.SessionId = "session-2"
+	replayed.SystemPrompt = "Today is October 18, 2026."
+	got := toolLoop(replay, replayed, "other-sig", "call-2")
+	if len(got) != 2 || len(got[0]) != 1 || len(got[1]) != 1 {
+		t.Fatalf("Unexpected replayed chunks: %+v", got)
+	}
+	if fc := got[0][0].Candidates[0].Content.Parts[1].FunctionCall; fc == nil || fc.Name != "read_file" || fc.Args["path"] != "a.txt" {
+		t.Errorf("Expected the function call to be replayed, got %+v", got[0][0])
+	}
+	if !reflect.DeepEqual(got[1], recorded[1]) {
+		t.Errorf("Expected %+v, got %+v", recorded[1], got[1])
+	}
+	if streams != 2 {
+		t.Errorf("Expected replay not to call the provider, got %d streams", streams)
+	}
+
+	// Recorded errors are replayed
+	if _, err := replay.GenerateContentOneShot(context.Background(), "model", first); err == nil || err.Error() != "quota exceeded" {
+		t.Errorf("Expected the recorded error, got %v", err)
+	}
+
+	// Requests that were never recorded are rejected
+	changed := first
+	changed.Contents = []Content{{Role: "user", Parts: []Part{{Text: "Read b.txt"}}}}
+	if _, _, err := replay.SendMessageStream(context.Background(), "model", changed); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("Expected ErrNoRecording, got %v", err)
+	}
+	if _, _, err := replay.SendMessageStream(context.Background(), "other-model", first); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("Expected ErrNoRecording for another model, got %v", err)
+	}
+}
+
+func TestReplayRepeatedRequests(t *testing.T) {
+	var answers int
+	mock := &MockLLMProvider{
+		GenerateContentOneShotFunc: func(ctx context.Context, modelName string, params SessionParams) (OneShotResult, error) {
+			answers++
+			return OneShotResult{Text: strings.Repeat("!", answers)}, nil
+		},
+	}
+	params := SessionParams{Contents: []Content{{Role: "user", Parts: []Part{{Text: "Hi"}}}}}
+
+	var recording bytes.Buffer
+	provider := NewRecorder(&recording).Wrap(mock)
+	for range 2 {
+		if _, err := provider.GenerateContentOneShot(context.Background(), "model", params); err != nil {
+			t.Fatalf("GenerateContentOneShot failed: %v", err)
+		}
+	}
+
+	replay, err := NewReplayProvider(&recording)
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	// Identical requests are answered in the recorded order, repeating the last answer afterwards
+	for _, expected := range []string{"!", "!!", "!!"} {
+		result, err := replay.GenerateContentOneShot(context.Background(), "model", params)
+		if err != nil || result.Text != expected {
+			t.Errorf("Expected %q, got %q (%v)", expected, result.Text, err)
+		}
+	}
+}
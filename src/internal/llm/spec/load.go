@@ -334,21 +334,7 @@ func (sr *SpecRegistry) convertToGenParams(raw interface{}) (GenerationParams, e
 	}
 
 	// Merge: overrideParams takes precedence
-	result := baseParams
-	if overrideParams.Temperature != 0 {
-		result.Temperature = overrideParams.Temperature
-	}
-	if overrideParams.TopK != 0 {
-		result.TopK = overrideParams.TopK
-	}
-	if overrideParams.TopP != 0 {
-		result.TopP = overrideParams.TopP
-	}
-	if overrideParams.Thinking != nil {
-		result.Thinking = overrideParams.Thinking
-	}
-
-	return result, nil
+	return baseParams.Merge(overrideParams), nil
 }
 
 // getRawModel retrieves the raw model definition for parsing
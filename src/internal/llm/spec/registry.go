@@ -79,6 +79,30 @@ func (sr *SpecRegistry) GetModelSpec(externalName string) *ModelSpec {
 	return nil
 }
 
+// GetPrice returns the price for a given external model name.
+// Prices are looked up along the inheritance chain, so that e.g. subagent models share the price of their base model.
+func (sr *SpecRegistry) GetPrice(externalName string) (Price, bool) {
+	if sr.Config == nil || len(sr.Config.Prices) == 0 {
+		return Price{}, false
+	}
+
+	baseName, _, _ := ParseExternalModelName(externalName)
+	if price, ok := sr.Config.Prices[baseName]; ok {
+		return price, true
+	}
+
+	modelSpec := sr.GetModelSpec(externalName)
+	if modelSpec == nil {
+		return Price{}, false
+	}
+	for _, name := range modelSpec.InheritanceChain {
+		if price, ok := sr.Config.Prices[name]; ok {
+			return price, true
+		}
+	}
+	return Price{}, false
+}
+
 // ValidateDisplayOrder validates that all models in displayOrder exist
 func (sr *SpecRegistry) ValidateDisplayOrder() []error {
 	var errors []error
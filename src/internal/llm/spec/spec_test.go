@@ -2,6 +2,7 @@ package spec
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -84,7 +85,12 @@ var minimalModelsJSON = []byte(`{
 		"gemini-3-pro+low",
 		"gemini-3-pro+high",
 		"gpt-oss:120b+medium"
-	]
+	],
+	"prices": {
+		"$base": {"input": 1, "output": 4},
+		"gemini-3-flash": {"input": 0.5, "output": 3, "cachedInput": 0.05},
+		"alias-target": {"input": 2, "output": 8}
+	}
 }`)
 
 func TestLoadSpecs(t *testing.T) {
@@ -437,6 +443,42 @@ func TestGetModelSpec(t *testing.T) {
 	}
 }
 
+func TestGetPrice(t *testing.T) {
+	registry, err := LoadSpecs(minimalModelsJSON)
+	if err != nil {
+		t.Fatalf("Failed to load specs: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected Price
+		found    bool
+	}{
+		{"gemini-3-flash", Price{Input: 0.5, Output: 3, CachedInput: 0.05}, true},
+		{"gemini-3-pro+low", Price{Input: 1, Output: 4}, true}, // Inherited from $base
+		{"alias-test", Price{Input: 2, Output: 8}, true},
+		{"gemini-2.5-flash", Price{}, false},
+		{"non-existent", Price{}, false},
+	}
+	for _, tt := range tests {
+		price, found := registry.GetPrice(tt.name)
+		if found != tt.found || price != tt.expected {
+			t.Errorf("GetPrice(%q) = %+v, %v; expected %+v, %v", tt.name, price, found, tt.expected, tt.found)
+		}
+	}
+
+	// Cached tokens are billed at the cached rate, and thoughts at the output rate
+	price, _ := registry.GetPrice("gemini-3-flash")
+	if cost := price.Cost(1_000_000, 100_000, 100_000, 500_000); cost < 0.874999 || cost > 0.875001 {
+		t.Errorf("Expected cost 0.875, got %v", cost)
+	}
+	// Cached input defaults to the input price
+	price, _ = registry.GetPrice("gemini-3-pro")
+	if cost := price.Cost(1_000_000, 0, 0, 500_000); cost < 0.999999 || cost > 1.000001 {
+		t.Errorf("Expected cost 1.0, got %v", cost)
+	}
+}
+
 func TestValidation(t *testing.T) {
 	registry, err := LoadSpecs(minimalModelsJSON)
 	if err != nil {
@@ -505,19 +547,28 @@ func TestGenerationParamsUnmarshal(t *testing.T) {
 			name: "all fields",
 			json: `{"temperature": 0.7, "topK": 64, "topP": 0.95}`,
 			expected: GenerationParams{
-				Temperature: 0.7,
-				TopK:        64,
-				TopP:        0.95,
+				Temperature: float32Ptr(0.7),
+				TopK:        int32Ptr(64),
+				TopP:        float32Ptr(0.95),
 			},
 		},
 		{
 			name: "with thinking",
 			json: `{"temperature": 0.5, "thinking": "low"}`,
 			expected: GenerationParams{
-				Temperature: 0.5,
+				Temperature: float32Ptr(0.5),
 				Thinking:    "low",
 			},
 		},
+		{
+			name: "explicit zeros",
+			json: `{"temperature": 0, "topK": -1, "topP": 0}`,
+			expected: GenerationParams{
+				Temperature: float32Ptr(0),
+				TopK:        int32Ptr(-1),
+				TopP:        float32Ptr(0),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -528,18 +579,56 @@ func TestGenerationParamsUnmarshal(t *testing.T) {
 				t.Fatalf("Failed to unmarshal: %v", err)
 			}
 
-			if gp.Temperature != tt.expected.Temperature {
-				t.Errorf("Expected Temperature %f, got %f", tt.expected.Temperature, gp.Temperature)
-			}
-			if gp.TopK != tt.expected.TopK {
-				t.Errorf("Expected TopK %d, got %d", tt.expected.TopK, gp.TopK)
-			}
-			if gp.TopP != tt.expected.TopP {
-				t.Errorf("Expected TopP %f, got %f", tt.expected.TopP, gp.TopP)
-			}
-			if gp.Thinking != tt.expected.Thinking {
-				t.Errorf("Expected Thinking %v, got %v", tt.expected.Thinking, gp.Thinking)
+			if !reflect.DeepEqual(gp, tt.expected) {
+				t.Errorf("Unexpected genParams:\ngot:  %+v\nwant: %+v", gp, tt.expected)
 			}
 		})
 	}
 }
+
+func TestGenerationParamsExtendedFields(t *testing.T) {
+	registry, err := LoadSpecs([]byte(`{
+		"genParams": {
+			"@base": {"temperature": 1.0, "maxOutputTokens": 8192, "stopSequences": ["END"], "presencePenalty": 0.5},
+			"@strict": {"extends": "@base", "seed": 42, "frequencyPenalty": 0, "mediaResolution": "MEDIA_RESOLUTION_LOW"}
+		},
+		"models": {
+			"test-model": {"providers": ["::test-model"], "genParams": "@strict"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to load specs: %v", err)
+	}
+
+	seed := int64(42)
+	presencePenalty := float32(0.5)
+	frequencyPenalty := float32(0)
+	expected := GenerationParams{
+		Temperature:      float32Ptr(1.0),
+		MaxOutputTokens:  8192,
+		StopSequences:    []string{"END"},
+		Seed:             &seed,
+		PresencePenalty:  &presencePenalty,
+		FrequencyPenalty: &frequencyPenalty,
+		MediaResolution:  "MEDIA_RESOLUTION_LOW",
+	}
+	gp := registry.GetModelSpec("test-model").GenParams
+	if !reflect.DeepEqual(gp, expected) {
+		t.Errorf("Unexpected genParams:\ngot:  %+v\nwant: %+v", gp, expected)
+	}
+
+	// Unset fields in the override keep the preset values
+	merged := gp.Merge(GenerationParams{Temperature: float32Ptr(0.2), StopSequences: []string{}})
+	if *merged.Temperature != 0.2 || merged.MaxOutputTokens != 8192 || len(merged.StopSequences) != 0 || merged.Seed != gp.Seed {
+		t.Errorf("Unexpected merged genParams: %+v", merged)
+	}
+
+	// Zero sampling parameters in the override are not unset
+	merged = gp.Merge(GenerationParams{Temperature: float32Ptr(0), TopK: int32Ptr(0)})
+	if merged.Temperature == nil || *merged.Temperature != 0 || merged.TopK == nil || *merged.TopK != 0 {
+		t.Errorf("Expected zero sampling parameters to override, got %+v", merged)
+	}
+}
+
+func float32Ptr(v float32) *float32 { return &v }
+func int32Ptr(v int32) *int32       { return &v }
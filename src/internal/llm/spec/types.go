@@ -1,6 +1,9 @@
 package spec
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // ModelsConfig represents the top-level models.json structure
 type ModelsConfig struct {
@@ -8,6 +11,30 @@ type ModelsConfig struct {
 	Models         map[string]interface{} `json:"models"`
 	KnownProviders []string               `json:"knownProviders"`
 	DisplayOrder   []string               `json:"displayOrder"`
+	Prices         map[string]Price       `json:"prices,omitempty"`
+}
+
+// Price represents the price of a model in USD per million tokens
+type Price struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`                // Also applies to thought tokens
+	CachedInput float64 `json:"cachedInput,omitempty"` // Defaults to Input if not given
+}
+
+// Cost returns the estimated cost in USD for the given token counts.
+// promptTokens includes cachedTokens, and candidatesTokens excludes thoughtsTokens.
+func (p Price) Cost(promptTokens, candidatesTokens, thoughtsTokens, cachedTokens int64) float64 {
+	cachedInput := p.CachedInput
+	if cachedInput == 0 {
+		cachedInput = p.Input
+	}
+	uncached := promptTokens - cachedTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	return (float64(uncached)*p.Input +
+		float64(cachedTokens)*cachedInput +
+		float64(candidatesTokens+thoughtsTokens)*p.Output) / 1e6
 }
 
 // RawModel represents a model definition from models.json
@@ -28,10 +55,53 @@ type RawModel struct {
 
 // GenerationParams represents LLM generation parameters
 type GenerationParams struct {
-	Temperature float32     `json:"temperature,omitempty"`
-	TopK        int32       `json:"topK,omitempty"`
-	TopP        float32     `json:"topP,omitempty"`
-	Thinking    interface{} `json:"thinking,omitempty"`
+	Temperature      *float32    `json:"temperature,omitempty"` // Negative values leave the provider default
+	TopK             *int32      `json:"topK,omitempty"`        // Negative values leave the provider default
+	TopP             *float32    `json:"topP,omitempty"`        // Negative values leave the provider default
+	Thinking         interface{} `json:"thinking,omitempty"`
+	MaxOutputTokens  int32       `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string    `json:"stopSequences,omitempty"`
+	Seed             *int64      `json:"seed,omitempty"`
+	PresencePenalty  *float32    `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float32    `json:"frequencyPenalty,omitempty"`
+	MediaResolution  string      `json:"mediaResolution,omitempty"` // e.g., "MEDIA_RESOLUTION_LOW"
+}
+
+// Merge returns a copy of gp with every field set in override taking precedence.
+// Nil pointers and zero values of non-pointer fields in override are treated as unset.
+func (gp GenerationParams) Merge(override GenerationParams) GenerationParams {
+	result := gp
+	if override.Temperature != nil {
+		result.Temperature = override.Temperature
+	}
+	if override.TopK != nil {
+		result.TopK = override.TopK
+	}
+	if override.TopP != nil {
+		result.TopP = override.TopP
+	}
+	if override.Thinking != nil {
+		result.Thinking = override.Thinking
+	}
+	if override.MaxOutputTokens != 0 {
+		result.MaxOutputTokens = override.MaxOutputTokens
+	}
+	if override.StopSequences != nil {
+		result.StopSequences = override.StopSequences
+	}
+	if override.Seed != nil {
+		result.Seed = override.Seed
+	}
+	if override.PresencePenalty != nil {
+		result.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		result.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.MediaResolution != "" {
+		result.MediaResolution = override.MediaResolution
+	}
+	return result
 }
 
 // ProviderModel represents a parsed provider::model specification
@@ -118,12 +188,48 @@ func (gp *GenerationParams) UnmarshalJSON(data []byte) error {
 		return 0
 	}
 
-	gp.Temperature = getFloat("temperature")
-	gp.TopK = getInt("topK")
-	gp.TopP = getFloat("topP")
+	getFloatPtr := func(key string) *float32 {
+		if _, ok := raw[key].(float64); ok {
+			v := getFloat(key)
+			return &v
+		}
+		return nil
+	}
+
+	getIntPtr := func(key string) *int32 {
+		if _, ok := raw[key].(float64); ok {
+			v := getInt(key)
+			return &v
+		}
+		return nil
+	}
+
+	gp.Temperature = getFloatPtr("temperature")
+	gp.TopK = getIntPtr("topK")
+	gp.TopP = getFloatPtr("topP")
 	if thinking, ok := raw["thinking"]; ok {
 		gp.Thinking = thinking
 	}
+	gp.MaxOutputTokens = getInt("maxOutputTokens")
+	if stops, ok := raw["stopSequences"].([]interface{}); ok {
+		gp.StopSequences = make([]string, 0, len(stops))
+		for _, stop := range stops {
+			s, ok := stop.(string)
+			if !ok {
+				return fmt.Errorf("stopSequences must be an array of strings")
+			}
+			gp.StopSequences = append(gp.StopSequences, s)
+		}
+	}
+	if seed, ok := raw["seed"].(float64); ok {
+		v := int64(seed)
+		gp.Seed = &v
+	}
+	gp.PresencePenalty = getFloatPtr("presencePenalty")
+	gp.FrequencyPenalty = getFloatPtr("frequencyPenalty")
+	if mediaResolution, ok := raw["mediaResolution"].(string); ok {
+		gp.MediaResolution = mediaResolution
+	}
 
 	return nil
 }
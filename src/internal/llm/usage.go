@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"log"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TokenCost estimates the cost in USD of the given token counts with the price table in models.json.
+// It returns false if the model has no known price. It can be used as a database.TokenCostFunc.
+func (r *Models) TokenCost(model string, promptTokens, candidatesTokens, thoughtsTokens, cachedTokens int64) (float64, bool) {
+	price, ok := r.specRegistry.GetPrice(model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(promptTokens, candidatesTokens, thoughtsTokens, cachedTokens), true
+}
+
+// MakeTokenUsage converts usage metadata reported by a provider into a TokenUsage.
+func MakeTokenUsage(sessionId, model, kind string, usage *UsageMetadata) TokenUsage {
+	return TokenUsage{
+		SessionID:        sessionId,
+		Model:            model,
+		Kind:             kind,
+		PromptTokens:     int64(usage.PromptTokenCount + usage.ToolUsePromptTokenCount),
+		CandidatesTokens: int64(usage.CandidatesTokenCount),
+		ThoughtsTokens:   int64(usage.ThoughtsTokenCount),
+		CachedTokens:     int64(usage.CachedContentTokenCount),
+	}
+}
+
+// RecordTokenUsage records the token usage of an LLM call for usage and cost reports.
+// Calls without reported usage are ignored, and failures are only logged.
+func RecordTokenUsage(db *database.Database, sessionId, model, kind string, usage *UsageMetadata) {
+	if db == nil || usage == nil {
+		return
+	}
+	if _, err := database.InsertTokenUsage(db, MakeTokenUsage(sessionId, model, kind, usage)); err != nil {
+		log.Printf("Failed to record %s token usage for session %s: %v", kind, sessionId, err)
+	}
+}
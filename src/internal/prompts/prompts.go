@@ -33,12 +33,20 @@ func Platform() string {
 // PromptData holds data that can be passed to the prompt templates.
 type PromptData struct {
 	workspaceName string
+	memories      func() []string
 }
 
 func NewPromptData(workspaceName string) PromptData {
 	return PromptData{workspaceName: workspaceName}
 }
 
+// WithMemories returns a copy of the data with a function loading memories of the workspace.
+// The function is only called when the template uses them.
+func (d PromptData) WithMemories(memories func() []string) PromptData {
+	d.memories = memories
+	return d
+}
+
 func (PromptData) String() string {
 	return `Available methods:
 
@@ -71,6 +79,7 @@ func (p BuiltinPrompts) systemPromptArgs() map[string]any {
 		"Today":         Today(),
 		"Platform":      Platform(),
 		"WorkspaceName": p.data.workspaceName,
+		"Memories":      p.data.Workspace().Memories(),
 	}
 }
 
@@ -90,12 +99,27 @@ type PromptWorkspace struct{ data PromptData }
 func (PromptWorkspace) String() string {
 	return `Available methods:
 
-.Workspace.Name     Workspace name.
+.Workspace.Name      Workspace name.
+.Workspace.Memories  Long-term memories stored in the workspace, one per line.
+                     Evaluated once when the session is created.
 `
 }
 
 func (w PromptWorkspace) Name() string { return w.data.workspaceName }
 
+func (w PromptWorkspace) Memories() string {
+	if w.data.memories == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, memory := range w.data.memories() {
+		sb.WriteString("- ")
+		sb.WriteString(strings.ReplaceAll(strings.TrimSpace(memory), "\n", "\n  "))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
 // EvaluatePrompt evaluates the given prompt string as a Go template.
 func (d PromptData) EvaluatePrompt(promptContent string) (string, error) {
 	tmpl, err := template.New("prompt").Parse(promptContent)
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lifthrasiir/angel/internal/chat"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/env"
+)
+
+// stringListFlag is a flag.Value which can be given multiple times.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// RunCommand implements `angel run [flags] "prompt"`, which runs a new session without the browser
+// and prints its final text, tool calls and attachments as JSON. The prompt is read from stdin if omitted.
+// It returns the exit status, which is non-zero if the run has failed.
+func RunCommand(config *env.EnvConfig, modelsJSON []byte, args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	workspace := flags.String("workspace", "", "ID or name of the workspace to run in")
+	model := flags.String("model", "", "model to use (defaults to the default model)")
+	systemPrompt := flags.String("system-prompt", "", "system prompt (defaults to the default prompt of the workspace)")
+	var roots stringListFlag
+	flags.Var(&roots, "root", "directory to expose to the agent (can be repeated)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s run [flags] \"prompt\"\n", getExecutableName())
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	prompt := strings.Join(flags.Args(), " ")
+	if prompt == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read the prompt from stdin: %v\n", err)
+			return 1
+		}
+		prompt = string(data)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		flags.Usage()
+		return 2
+	}
+
+	for i, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid root %s: %v\n", root, err)
+			return 2
+		}
+		roots[i] = absRoot
+	}
+
+	db, models, ga, tools := initServices(config, modelsJSON)
+	defer db.Close()
+
+	workspaceID, err := resolveWorkspace(db, *workspace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	result, err := chat.RunSession(context.Background(), db, models, ga, tools, config, prompt, *systemPrompt, workspaceID, *model, roots)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run session: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write the result: %v\n", err)
+		return 1
+	}
+	if result.Error != "" {
+		return 1
+	}
+	return 0
+}
+
+// resolveWorkspace returns the ID of the workspace given either by its ID or its name.
+func resolveWorkspace(db *database.Database, workspace string) (string, error) {
+	if workspace == "" {
+		return "", nil
+	}
+	workspaces, err := database.GetAllWorkspaces(db)
+	if err != nil {
+		return "", fmt.Errorf("failed to get workspaces: %w", err)
+	}
+	for _, w := range workspaces {
+		if w.ID == workspace {
+			return w.ID, nil
+		}
+	}
+	for _, w := range workspaces {
+		if w.Name == workspace {
+			return w.ID, nil
+		}
+	}
+	return "", fmt.Errorf("workspace %s not found", workspace)
+}
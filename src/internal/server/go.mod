@@ -13,6 +13,7 @@ require (
 	github.com/lifthrasiir/angel/internal/prompts v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/tool v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/tool/file v0.0.0-00010101000000-000000000000
+	github.com/lifthrasiir/angel/internal/tool/memory v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/tool/search_chat v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/tool/shell v0.0.0-00010101000000-000000000000
 	github.com/lifthrasiir/angel/internal/tool/subagent v0.0.0-00010101000000-000000000000
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -21,7 +22,8 @@ import (
 	"github.com/lifthrasiir/angel/internal/database"
 	"github.com/lifthrasiir/angel/internal/env"
 	"github.com/lifthrasiir/angel/internal/llm"
-	"github.com/lifthrasiir/angel/internal/prompts"
+	"github.com/lifthrasiir/angel/internal/llm/spec"
+	"github.com/lifthrasiir/angel/internal/tool"
 	. "github.com/lifthrasiir/angel/internal/types"
 )
 
@@ -419,6 +421,100 @@ func updateSessionWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "Session workspace updated successfully")
 }
 
+func getSessionGenParamsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	vars := mux.Vars(r)
+	sessionId := vars["sessionId"]
+	if sessionId == "" {
+		sendBadRequestError(w, r, "Session ID is required")
+		return
+	}
+
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+	defer sdb.Close()
+
+	paramsJSON, err := database.GetSessionGenParams(sdb)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to get session generation params")
+		return
+	}
+
+	var genParams spec.GenerationParams
+	if paramsJSON != "" {
+		if err := json.Unmarshal([]byte(paramsJSON), &genParams); err != nil {
+			sendInternalServerError(w, r, err, "Failed to parse session generation params")
+			return
+		}
+	}
+
+	sendJSONResponse(w, genParams)
+}
+
+func updateSessionGenParamsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	vars := mux.Vars(r)
+	sessionId := vars["sessionId"]
+	if sessionId == "" {
+		sendBadRequestError(w, r, "Session ID is required")
+		return
+	}
+
+	var genParams spec.GenerationParams
+	if !decodeJSONRequest(r, w, &genParams, "updateSessionGenParamsHandler") {
+		return
+	}
+
+	switch genParams.MediaResolution {
+	case "", MediaResolutionUnspecified, MediaResolutionLow, MediaResolutionMedium, MediaResolutionHigh:
+	default:
+		sendBadRequestError(w, r, fmt.Sprintf("Unknown media resolution: %s", genParams.MediaResolution))
+		return
+	}
+	if genParams.MaxOutputTokens < 0 {
+		sendBadRequestError(w, r, "maxOutputTokens must not be negative")
+		return
+	}
+
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+	defer sdb.Close()
+
+	exists, err := database.SessionExists(sdb)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to check session existence")
+		return
+	}
+	if !exists {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+
+	paramsJSON, err := json.Marshal(genParams)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to encode session generation params")
+		return
+	}
+	if string(paramsJSON) == "{}" {
+		paramsJSON = nil // No overrides left
+	}
+
+	if err := database.UpdateSessionGenParams(sdb, string(paramsJSON)); err != nil {
+		sendInternalServerError(w, r, err, "Failed to update session generation params")
+		return
+	}
+
+	sendJSONResponse(w, genParams)
+}
+
 func createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
 	db := getDb(w, r)
 
@@ -537,6 +633,32 @@ func handleCall(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// steerCallHandler posts a steering note to the active call of the session without cancelling it
+func steerCallHandler(w http.ResponseWriter, r *http.Request) {
+	sessionId := mux.Vars(r)["sessionId"]
+	if sessionId == "" {
+		sendBadRequestError(w, r, "Session ID is required")
+		return
+	}
+
+	var requestBody struct {
+		Message string `json:"message"`
+	}
+	if !decodeJSONRequest(r, w, &requestBody, "steerCallHandler") {
+		return
+	}
+	if strings.TrimSpace(requestBody.Message) == "" {
+		sendBadRequestError(w, r, "Steering message is required")
+		return
+	}
+
+	if err := chat.SteerCall(sessionId, requestBody.Message); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to steer call for session %s", sessionId))
+		return
+	}
+	sendJSONResponse(w, map[string]string{"status": "success", "message": "Steering message will be delivered with the next function response"})
+}
+
 // handleEvaluatePrompt evaluates a Go template string and returns the result
 func handleEvaluatePrompt(w http.ResponseWriter, r *http.Request) {
 	db := getDb(w, r) // Get DB from context
@@ -560,7 +682,7 @@ func handleEvaluatePrompt(w http.ResponseWriter, r *http.Request) {
 		workspaceName = workspace.Name
 	}
 
-	data := prompts.NewPromptData(workspaceName)
+	data := chat.NewPromptData(db, requestBody.WorkspaceID, workspaceName)
 	evaluatedPrompt, err := data.EvaluatePrompt(requestBody.Template)
 	if err != nil {
 		sendBadRequestError(w, r, fmt.Sprintf("Error evaluating prompt template: %v", err))
@@ -604,14 +726,9 @@ func getMCPConfigsHandler(w http.ResponseWriter, r *http.Request) {
 
 		if frontendConfig.IsConnected {
 
-			toolsIterator := conn.Session.Tools(context.Background(), nil)
 			builtinToolNames := tools.BuiltinNames()
 			var tools []string
-			for tool, err := range toolsIterator {
-				if err != nil {
-					log.Printf("Error iterating tools for %s: %v", dbConfig.Name, err)
-					break
-				}
+			for _, tool := range conn.Tools() {
 				mappedName := tool.Name
 				if _, exists := builtinToolNames[tool.Name]; exists {
 					mappedName = dbConfig.Name + "__" + tool.Name
@@ -683,6 +800,223 @@ func deleteMCPConfigHandler(w http.ResponseWriter, r *http.Request) {
 	sendJSONResponse(w, map[string]string{"status": "success", "message": "MCP config deleted successfully"})
 }
 
+func getScriptToolsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	configs, err := database.GetScriptToolConfigs(db)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to retrieve script tools from DB")
+		return
+	}
+
+	sendJSONResponse(w, configs)
+}
+
+func saveScriptToolHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	tools := getTools(w, r)
+
+	var config ScriptToolConfig
+	if !decodeJSONRequest(r, w, &config, "saveScriptToolHandler") {
+		return
+	}
+
+	if err := tools.ValidateScriptTool(config); err != nil {
+		sendBadRequestError(w, r, err.Error())
+		return
+	}
+
+	if err := database.SaveScriptToolConfig(db, config); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to save script tool %s", config.Name))
+		return
+	}
+
+	if err := tools.ReloadScriptTools(db); err != nil {
+		sendInternalServerError(w, r, err, "Failed to reload script tools")
+		return
+	}
+
+	sendJSONResponse(w, config)
+}
+
+func deleteScriptToolHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	tools := getTools(w, r)
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		sendBadRequestError(w, r, "Script tool name is required")
+		return
+	}
+
+	if err := database.DeleteScriptToolConfig(db, name); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to delete script tool %s", name))
+		return
+	}
+
+	if err := tools.ReloadScriptTools(db); err != nil {
+		sendInternalServerError(w, r, err, "Failed to reload script tools")
+		return
+	}
+
+	sendJSONResponse(w, map[string]string{"status": "success", "message": "Script tool deleted successfully"})
+}
+
+// ToolSettings holds global settings for tool execution.
+type ToolSettings struct {
+	MaxInlineResultSize int `json:"max_inline_result_size"` // Zero disables offloading
+}
+
+func getToolSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	tools := getTools(w, r)
+
+	sendJSONResponse(w, ToolSettings{MaxInlineResultSize: tools.MaxInlineResultSize()})
+}
+
+func saveToolSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	tools := getTools(w, r)
+
+	var settings ToolSettings
+	if !decodeJSONRequest(r, w, &settings, "saveToolSettingsHandler") {
+		return
+	}
+	if settings.MaxInlineResultSize < 0 {
+		sendBadRequestError(w, r, "max_inline_result_size cannot be negative")
+		return
+	}
+
+	value := []byte(strconv.Itoa(settings.MaxInlineResultSize))
+	if err := database.SetAppConfig(db, tool.MaxInlineResultSizeConfigName, value); err != nil {
+		sendInternalServerError(w, r, err, "Failed to save tool settings")
+		return
+	}
+	tools.SetMaxInlineResultSize(settings.MaxInlineResultSize)
+
+	sendJSONResponse(w, settings)
+}
+
+const maxToolCallAuditLimit = 1000
+
+// parseToolCallAuditFilter parses tool call audit filters from query parameters.
+// since and until are Unix timestamps in milliseconds.
+func parseToolCallAuditFilter(r *http.Request) (ToolCallAuditFilter, error) {
+	query := r.URL.Query()
+	filter := ToolCallAuditFilter{
+		SessionID:  query.Get("sessionId"),
+		BranchID:   query.Get("branchId"),
+		ToolName:   query.Get("tool"),
+		ErrorsOnly: query.Get("errorsOnly") == "1" || query.Get("errorsOnly") == "true",
+	}
+
+	for name, dest := range map[string]*int64{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				return filter, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dest = parsed
+		}
+	}
+	for name, dest := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return filter, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dest = parsed
+		}
+	}
+	if filter.Limit > maxToolCallAuditLimit {
+		filter.Limit = maxToolCallAuditLimit
+	}
+	return filter, nil
+}
+
+func getToolCallAuditsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	filter, err := parseToolCallAuditFilter(r)
+	if err != nil {
+		sendBadRequestError(w, r, err.Error())
+		return
+	}
+
+	audits, err := database.GetToolCallAudits(db, filter)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to retrieve tool call audits")
+		return
+	}
+
+	sendJSONResponse(w, audits)
+}
+
+func getToolCallStatsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	filter, err := parseToolCallAuditFilter(r)
+	if err != nil {
+		sendBadRequestError(w, r, err.Error())
+		return
+	}
+
+	stats, err := database.GetToolCallStats(db, filter)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to compute tool call stats")
+		return
+	}
+
+	sendJSONResponse(w, stats)
+}
+
+// parseTokenUsageFilter parses token usage filters from query parameters.
+// since and until are Unix timestamps in milliseconds.
+func parseTokenUsageFilter(r *http.Request) (TokenUsageFilter, error) {
+	query := r.URL.Query()
+	filter := TokenUsageFilter{
+		SessionID:   query.Get("sessionId"),
+		WorkspaceID: query.Get("workspaceId"),
+		Model:       query.Get("model"),
+		Kind:        query.Get("kind"),
+	}
+
+	for name, dest := range map[string]*int64{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				return filter, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dest = parsed
+		}
+	}
+	return filter, nil
+}
+
+// getTokenUsageHandler reports token usage and estimated cost grouped by session, workspace, model, day or kind.
+// The grouping defaults to session.
+func getTokenUsageHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	models := getModels(w, r)
+
+	filter, err := parseTokenUsageFilter(r)
+	if err != nil {
+		sendBadRequestError(w, r, err.Error())
+		return
+	}
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy == "" {
+		groupBy = database.TokenUsageBySession
+	}
+
+	summaries, err := database.GetTokenUsageSummaries(db, groupBy, filter, models.TokenCost)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to aggregate token usage")
+		return
+	}
+
+	sendJSONResponse(w, summaries)
+}
+
 // sendInternalServerError logs the error and sends a 500 Internal Server Error response.
 // As special cases, BadRequestError and NotFoundError types are handled to send 400 and 404 responses respectively.
 func sendInternalServerError(w http.ResponseWriter, r *http.Request, err error, msg string) {
@@ -926,10 +1260,18 @@ func saveSystemPromptsHandler(w http.ResponseWriter, r *http.Request) {
 	sendJSONResponse(w, map[string]string{"status": "success", "message": "Global prompts updated successfully"})
 }
 
+// Search modes
+const (
+	searchModeKeyword = "keyword" // Newest messages matching FTS5 queries, paged by max_id
+	searchModeHybrid  = "hybrid"  // Messages ranked by keywords and semantic similarity, paged by offset
+)
+
 // SearchRequest represents the search request payload
 type SearchRequest struct {
 	Query       string `json:"query"`
+	Mode        string `json:"mode,omitempty"` // searchModeKeyword (default) or searchModeHybrid
 	MaxID       int    `json:"max_id,omitempty"`
+	Offset      int    `json:"offset,omitempty"`
 	Limit       int    `json:"limit,omitempty"`
 	WorkspaceID string `json:"workspace_id,omitempty"`
 }
@@ -949,7 +1291,19 @@ func searchMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results, hasMore, err := database.SearchMessages(db, req.Query, req.MaxID, req.Limit, req.WorkspaceID)
+	var results []database.SearchResult
+	var hasMore bool
+	var err error
+	switch req.Mode {
+	case "", searchModeKeyword:
+		results, hasMore, err = database.SearchMessages(db, req.Query, req.MaxID, req.Limit, req.WorkspaceID)
+	case searchModeHybrid:
+		models := getModels(w, r)
+		results, hasMore, err = llm.SearchMessagesHybrid(r.Context(), db, models, req.Query, req.Offset, req.Limit, req.WorkspaceID)
+	default:
+		sendBadRequestError(w, r, fmt.Sprintf("Unknown search mode: %s", req.Mode))
+		return
+	}
 	if err != nil {
 		sendInternalServerError(w, r, err, "Failed to search messages")
 		return
@@ -963,6 +1317,42 @@ func searchMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	sendJSONResponse(w, response)
 }
 
+// getEmbeddingSettingsHandler handles GET requests for /api/search/embedding
+func getEmbeddingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	models := getModels(w, r)
+
+	sendJSONResponse(w, models.EmbeddingSettings())
+}
+
+// saveEmbeddingSettingsHandler handles PUT requests for /api/search/embedding.
+// Messages are embedded in the background, and embeddings from a previous model are discarded then.
+func saveEmbeddingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	models := getModels(w, r)
+
+	var settings EmbeddingSettings
+	if !decodeJSONRequest(r, w, &settings, "saveEmbeddingSettingsHandler") {
+		return
+	}
+	if _, err := models.ResolveEmbeddingModel(settings); err != nil {
+		sendInternalServerError(w, r, err, "Invalid embedding settings")
+		return
+	}
+
+	value, err := json.Marshal(settings)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to encode embedding settings")
+		return
+	}
+	if err := database.SetAppConfig(db, llm.EmbeddingSettingsConfigName, value); err != nil {
+		sendInternalServerError(w, r, err, "Failed to save embedding settings")
+		return
+	}
+	models.SetEmbeddingSettings(settings)
+
+	sendJSONResponse(w, settings)
+}
+
 // getOpenAIConfigsHandler handles GET requests for /api/openai-configs
 func getOpenAIConfigsHandler(w http.ResponseWriter, r *http.Request) {
 	db := getDb(w, r)
@@ -986,6 +1376,15 @@ func saveOpenAIConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch config.APIMode {
+	case "":
+		config.APIMode = OpenAIAPIModeChat
+	case OpenAIAPIModeChat, OpenAIAPIModeResponses:
+	default:
+		sendBadRequestError(w, r, fmt.Sprintf("Unknown API mode: %s", config.APIMode))
+		return
+	}
+
 	// Generate ID if not provided
 	if config.ID == "" {
 		config.ID = database.GenerateID()
@@ -1132,3 +1531,166 @@ func deleteGeminiAPIConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// getAnthropicConfigsHandler handles GET requests for /api/anthropic-configs
+func getAnthropicConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	configs, err := database.GetAnthropicConfigs(db)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to retrieve Anthropic configs")
+		return
+	}
+
+	sendJSONResponse(w, configs)
+}
+
+// saveAnthropicConfigHandler handles POST requests for /api/anthropic-configs
+func saveAnthropicConfigHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	var config AnthropicConfig
+	if !decodeJSONRequest(r, w, &config, "saveAnthropicConfigHandler") {
+		return
+	}
+	if strings.TrimSpace(config.APIKey) == "" {
+		sendBadRequestError(w, r, "Anthropic API key is required")
+		return
+	}
+
+	// Generate ID if not provided
+	if config.ID == "" {
+		config.ID = database.GenerateID()
+	}
+
+	if err := database.SaveAnthropicConfig(db, config); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to save Anthropic config %s", config.Name))
+		return
+	}
+
+	sendJSONResponse(w, config)
+}
+
+// deleteAnthropicConfigHandler handles DELETE requests for /api/anthropic-configs/{id}
+func deleteAnthropicConfigHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		sendBadRequestError(w, r, "Anthropic config ID is required")
+		return
+	}
+
+	if err := database.DeleteAnthropicConfig(db, id); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to delete Anthropic config %s", id))
+		return
+	}
+
+	sendJSONResponse(w, map[string]string{"status": "success", "message": "Anthropic config deleted successfully"})
+}
+
+// listMemoriesHandler handles GET requests for /api/memories?workspaceId=...
+func listMemoriesHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	memories, err := database.GetMemories(db, r.URL.Query().Get("workspaceId"))
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to retrieve memories")
+		return
+	}
+
+	sendJSONResponse(w, memories)
+}
+
+// createMemoryHandler handles POST requests for /api/memories
+func createMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	var requestBody struct {
+		WorkspaceID string `json:"workspaceId"`
+		Content     string `json:"content"`
+	}
+	if !decodeJSONRequest(r, w, &requestBody, "createMemoryHandler") {
+		return
+	}
+	if strings.TrimSpace(requestBody.Content) == "" {
+		sendBadRequestError(w, r, "Memory content is required")
+		return
+	}
+
+	memory, err := database.AddMemory(db, requestBody.WorkspaceID, strings.TrimSpace(requestBody.Content), "")
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to add memory")
+		return
+	}
+
+	sendJSONResponse(w, memory)
+}
+
+// parseMemoryID parses the memory ID in the URL, sending an error response if invalid or nonexistent.
+func parseMemoryID(w http.ResponseWriter, r *http.Request, db *database.Database) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		sendBadRequestError(w, r, "Invalid memory ID")
+		return 0, false
+	}
+	if _, err := database.GetMemory(db, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			sendNotFoundError(w, r, "Memory not found")
+		} else {
+			sendInternalServerError(w, r, err, "Failed to retrieve memory")
+		}
+		return 0, false
+	}
+	return id, true
+}
+
+// updateMemoryHandler handles PUT requests for /api/memories/{id}
+func updateMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	id, ok := parseMemoryID(w, r, db)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Content string `json:"content"`
+	}
+	if !decodeJSONRequest(r, w, &requestBody, "updateMemoryHandler") {
+		return
+	}
+	if strings.TrimSpace(requestBody.Content) == "" {
+		sendBadRequestError(w, r, "Memory content is required")
+		return
+	}
+
+	if err := database.UpdateMemory(db, id, strings.TrimSpace(requestBody.Content)); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to update memory %d", id))
+		return
+	}
+	memory, err := database.GetMemory(db, id)
+	if err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to retrieve memory %d", id))
+		return
+	}
+
+	sendJSONResponse(w, memory)
+}
+
+// deleteMemoryHandler handles DELETE requests for /api/memories/{id}
+func deleteMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	id, ok := parseMemoryID(w, r, db)
+	if !ok {
+		return
+	}
+
+	if err := database.DeleteMemory(db, id); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to delete memory %d", id))
+		return
+	}
+
+	sendJSONResponse(w, map[string]string{"status": "success", "message": "Memory deleted successfully"})
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 
@@ -61,6 +62,42 @@ func newSessionAndMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// runSessionHandler creates a new session and waits for the agent to finish, without streaming.
+// The final text, tool calls and attachments are returned as JSON.
+func runSessionHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	models := getModels(w, r)
+	ga := getGeminiAuth(w, r)
+	tools := getTools(w, r)
+	config := getEnvConfig(w, r)
+
+	var requestBody struct {
+		Message      string   `json:"message"`
+		SystemPrompt string   `json:"systemPrompt"`
+		WorkspaceID  string   `json:"workspaceId"`
+		Model        string   `json:"model"`
+		InitialRoots []string `json:"initialRoots"`
+	}
+
+	if !decodeJSONRequest(r, w, &requestBody, "runSession") {
+		return
+	}
+	if strings.TrimSpace(requestBody.Message) == "" {
+		sendBadRequestError(w, r, "Message is required")
+		return
+	}
+
+	result, err := chat.RunSession(
+		r.Context(), db, models, ga, tools, config,
+		requestBody.Message, requestBody.SystemPrompt, requestBody.WorkspaceID, requestBody.Model, requestBody.InitialRoots,
+	)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to run session")
+		return
+	}
+	sendJSONResponse(w, result)
+}
+
 // New temporary session and message handler
 func newTempSessionAndMessageHandler(w http.ResponseWriter, r *http.Request) {
 	db := getDb(w, r)
@@ -153,6 +190,104 @@ func chatMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// listQueuedMessagesHandler lists user messages waiting for the active call of the session to finish
+func listQueuedMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sessionId := mux.Vars(r)["sessionId"]
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+	defer sdb.Close()
+
+	messages, err := database.GetQueuedMessages(sdb)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to get queued messages")
+		return
+	}
+	sendJSONResponse(w, messages)
+}
+
+func updateQueuedMessageHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	vars := mux.Vars(r)
+	queuedID, err := strconv.Atoi(vars["queuedId"])
+	if err != nil {
+		sendBadRequestError(w, r, "Invalid queued message ID")
+		return
+	}
+
+	var requestBody struct {
+		Message string `json:"message"`
+	}
+	if !decodeJSONRequest(r, w, &requestBody, "updateQueuedMessageHandler") {
+		return
+	}
+
+	sdb, err := db.WithSession(vars["sessionId"])
+	if err != nil {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+	defer sdb.Close()
+
+	message, err := database.UpdateQueuedMessage(sdb, queuedID, requestBody.Message)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			sendNotFoundError(w, r, "Queued message not found")
+		} else {
+			sendInternalServerError(w, r, err, "Failed to update queued message")
+		}
+		return
+	}
+
+	broadcastQueuedMessages(sdb)
+	sendJSONResponse(w, message)
+}
+
+func deleteQueuedMessageHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	vars := mux.Vars(r)
+	queuedID, err := strconv.Atoi(vars["queuedId"])
+	if err != nil {
+		sendBadRequestError(w, r, "Invalid queued message ID")
+		return
+	}
+
+	sdb, err := db.WithSession(vars["sessionId"])
+	if err != nil {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+	defer sdb.Close()
+
+	if err := database.DeleteQueuedMessage(sdb, queuedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			sendNotFoundError(w, r, "Queued message not found")
+		} else {
+			sendInternalServerError(w, r, err, "Failed to cancel queued message")
+		}
+		return
+	}
+
+	broadcastQueuedMessages(sdb)
+	sendJSONResponse(w, map[string]string{"status": "success", "message": "Queued message cancelled successfully"})
+}
+
+// broadcastQueuedMessages notifies every client of the session that its queue has been changed
+func broadcastQueuedMessages(sdb *database.SessionDatabase) {
+	payload, err := chat.QueuedMessagesPayload(sdb)
+	if err != nil {
+		log.Printf("Failed to broadcast queued messages for session %s: %v", sdb.SessionId(), err)
+		return
+	}
+	broadcastToSession(sdb.SessionId(), EventQueueChanged, payload)
+}
+
 // New endpoint to load chat session history
 func loadChatSessionHandler(w http.ResponseWriter, r *http.Request) {
 	db := getDb(w, r)
@@ -550,6 +685,45 @@ func retryErrorBranchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// resumeBranchHandler handles requests to resume a turn of a branch interrupted by a server restart.
+func resumeBranchHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	models := getModels(w, r)
+	ga := getGeminiAuth(w, r)
+	tools := getTools(w, r)
+	config := getEnvConfig(w, r)
+
+	vars := mux.Vars(r)
+	sessionId := vars["sessionId"]
+	branchId := vars["branchId"]
+
+	if sessionId == "" || branchId == "" {
+		sendBadRequestError(w, r, "Session ID and Branch ID are required")
+		return
+	}
+
+	ew := newSseWriter(r.Context(), sessionId, w)
+	if ew == nil {
+		return
+	}
+
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to access session database")
+		return
+	}
+	defer sdb.Close()
+
+	if err := chat.ResumeBranch(r.Context(), sdb, models, ga, tools, config, ew, branchId); err != nil {
+		if ew.HeadersSent() {
+			log.Printf("Failed to resume branch: %v", err)
+		} else {
+			sendInternalServerError(w, r, err, "Failed to resume branch")
+		}
+		return
+	}
+}
+
 // commandHandler handles POST requests for /api/chat/{sessionId}/command
 func commandHandler(w http.ResponseWriter, r *http.Request) {
 	db := getDb(w, r)
@@ -637,9 +811,180 @@ func compressSessionHandler(w http.ResponseWriter, r *http.Request) {
 		"compressionMessageId":    result.CompressionMsgID,
 		"compressedUpToMessageId": result.CompressedUpToMessageID,
 		"extractedSummary":        result.ExtractedSummary,
+		"strategy":                result.Strategy,
+		"tokensSaved":             result.TokensSaved,
+	})
+}
+
+// CompressionSettings holds global settings for history compression.
+type CompressionSettings struct {
+	AutoThreshold float64  `json:"auto_threshold"`       // Fraction of the context window triggering compression, zero disables
+	Strategy      string   `json:"strategy"`             // Default compression strategy, empty means the built-in default
+	Strategies    []string `json:"strategies,omitempty"` // All available compression strategies, only in responses
+}
+
+func getCompressionSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sendJSONResponse(w, CompressionSettings{
+		AutoThreshold: chat.GetAutoCompressionThreshold(db),
+		Strategy:      chat.GetDefaultCompressionStrategy(db),
+		Strategies:    chat.CompressionStrategies(),
+	})
+}
+
+func saveCompressionSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	var settings CompressionSettings
+	if !decodeJSONRequest(r, w, &settings, "saveCompressionSettingsHandler") {
+		return
+	}
+	if err := chat.ValidateCompressionStrategy(settings.Strategy); err != nil {
+		sendInternalServerError(w, r, err, "Failed to save compression settings")
+		return
+	}
+	if err := chat.SetAutoCompressionThreshold(db, settings.AutoThreshold); err != nil {
+		sendInternalServerError(w, r, err, "Failed to save compression settings")
+		return
+	}
+	if err := database.SetAppConfig(db, chat.CompressionStrategyConfigName, []byte(settings.Strategy)); err != nil {
+		sendInternalServerError(w, r, err, "Failed to save compression settings")
+		return
+	}
+
+	settings.Strategy = chat.GetDefaultCompressionStrategy(db)
+	settings.Strategies = nil
+	sendJSONResponse(w, settings)
+}
+
+// CompressionStrategySettings holds the compression strategy chosen by a session or workspace.
+type CompressionStrategySettings struct {
+	Strategy  string `json:"strategy"`            // Empty if inherited from the workspace or global settings
+	Effective string `json:"effective,omitempty"` // The strategy actually used, only in responses
+}
+
+func getSessionCompressionHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sessionId := mux.Vars(r)["sessionId"]
+	if sessionId == "" {
+		sendBadRequestError(w, r, "Session ID is required")
+		return
+	}
+
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+	defer sdb.Close()
+
+	value, err := database.GetSessionConfig(sdb, chat.CompressionStrategyConfigName)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to get session compression strategy")
+		return
+	}
+
+	sendJSONResponse(w, CompressionStrategySettings{
+		Strategy:  string(value),
+		Effective: chat.ResolveCompressionStrategy(sdb),
 	})
 }
 
+func updateSessionCompressionHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sessionId := mux.Vars(r)["sessionId"]
+	if sessionId == "" {
+		sendBadRequestError(w, r, "Session ID is required")
+		return
+	}
+
+	var settings CompressionStrategySettings
+	if !decodeJSONRequest(r, w, &settings, "updateSessionCompressionHandler") {
+		return
+	}
+	if err := chat.ValidateCompressionStrategy(settings.Strategy); err != nil {
+		sendInternalServerError(w, r, err, "Failed to update session compression strategy")
+		return
+	}
+
+	sdb, err := db.WithSession(sessionId)
+	if err != nil {
+		sendNotFoundError(w, r, "Session not found")
+		return
+	}
+	defer sdb.Close()
+
+	var value []byte
+	if settings.Strategy != "" {
+		value = []byte(settings.Strategy)
+	}
+	if err := database.SetSessionConfig(sdb, chat.CompressionStrategyConfigName, value); err != nil {
+		sendInternalServerError(w, r, err, "Failed to update session compression strategy")
+		return
+	}
+
+	settings.Effective = chat.ResolveCompressionStrategy(sdb)
+	sendJSONResponse(w, settings)
+}
+
+func getWorkspaceCompressionHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	workspaceID := mux.Vars(r)["id"]
+	if _, err := database.GetWorkspace(db, workspaceID); err != nil {
+		sendNotFoundError(w, r, "Workspace not found")
+		return
+	}
+
+	value, err := database.GetWorkspaceConfig(db, workspaceID, chat.CompressionStrategyConfigName)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to get workspace compression strategy")
+		return
+	}
+
+	settings := CompressionStrategySettings{Strategy: string(value), Effective: string(value)}
+	if err := chat.ValidateCompressionStrategy(settings.Strategy); err != nil || settings.Strategy == "" {
+		settings.Effective = chat.GetDefaultCompressionStrategy(db)
+	}
+	sendJSONResponse(w, settings)
+}
+
+func updateWorkspaceCompressionHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	workspaceID := mux.Vars(r)["id"]
+	var settings CompressionStrategySettings
+	if !decodeJSONRequest(r, w, &settings, "updateWorkspaceCompressionHandler") {
+		return
+	}
+	if err := chat.ValidateCompressionStrategy(settings.Strategy); err != nil {
+		sendInternalServerError(w, r, err, "Failed to update workspace compression strategy")
+		return
+	}
+	if _, err := database.GetWorkspace(db, workspaceID); err != nil {
+		sendNotFoundError(w, r, "Workspace not found")
+		return
+	}
+
+	var value []byte
+	if settings.Strategy != "" {
+		value = []byte(settings.Strategy)
+	}
+	if err := database.SetWorkspaceConfig(db, workspaceID, chat.CompressionStrategyConfigName, value); err != nil {
+		sendInternalServerError(w, r, err, "Failed to update workspace compression strategy")
+		return
+	}
+
+	settings.Effective = settings.Strategy
+	if settings.Effective == "" {
+		settings.Effective = chat.GetDefaultCompressionStrategy(db)
+	}
+	sendJSONResponse(w, settings)
+}
+
 // extractSessionHandler extracts messages from a specific branch up to a given message and creates a new session.
 func extractSessionHandler(w http.ResponseWriter, r *http.Request) {
 	db := getDb(w, r)
@@ -23,11 +23,13 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/lifthrasiir/angel/filesystem"
+	"github.com/lifthrasiir/angel/internal/chat"
 	"github.com/lifthrasiir/angel/internal/database"
 	"github.com/lifthrasiir/angel/internal/env"
 	"github.com/lifthrasiir/angel/internal/llm"
 	"github.com/lifthrasiir/angel/internal/tool"
 	"github.com/lifthrasiir/angel/internal/tool/file"
+	"github.com/lifthrasiir/angel/internal/tool/memory"
 	"github.com/lifthrasiir/angel/internal/tool/search_chat"
 	"github.com/lifthrasiir/angel/internal/tool/shell"
 	"github.com/lifthrasiir/angel/internal/tool/subagent"
@@ -39,6 +41,7 @@ import (
 // InitTools initializes all built-in tools
 func InitTools(tools *tool.Tools) {
 	tools.Register(file.AllTools...)
+	tools.Register(memory.AllTools...)
 	tools.Register(search_chat.AllTools...)
 	tools.Register(shell.AllTools...)
 	tools.Register(subagent.AllTools...)
@@ -46,6 +49,26 @@ func InitTools(tools *tool.Tools) {
 	tools.Register(webfetch.AllTools...)
 }
 
+// setupLLMRecording records all LLM calls to the JSONL file given by ANGEL_LLM_RECORD,
+// or answers them from the recording given by ANGEL_LLM_REPLAY instead of actual providers.
+func setupLLMRecording(models *llm.Models) {
+	if path := os.Getenv("ANGEL_LLM_REPLAY"); path != "" {
+		replay, err := llm.LoadReplayProvider(path)
+		if err != nil {
+			log.Fatalf("Failed to load LLM recording %s: %v", path, err)
+		}
+		models.SetLLMProviderWrapper(func(llm.LLMProvider) llm.LLMProvider { return replay })
+		log.Printf("Replaying LLM calls from %s", path)
+	} else if path := os.Getenv("ANGEL_LLM_RECORD"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatalf("Failed to open LLM recording %s: %v", path, err)
+		}
+		models.SetLLMProviderWrapper(llm.NewRecorder(f).Wrap)
+		log.Printf("Recording LLM calls to %s", path)
+	}
+}
+
 // getExecutableName returns the appropriate executable name for the current platform
 func getExecutableName() string {
 	if runtime.GOOS == "windows" {
@@ -54,7 +77,8 @@ func getExecutableName() string {
 	return "./angel"
 }
 
-func Main(config *env.EnvConfig, embeddedFiles embed.FS, loginUnavailableHTML []byte, modelsJSON []byte) {
+// initServices initializes the database, LLM providers and tools shared by the server and CLI commands.
+func initServices(config *env.EnvConfig, modelsJSON []byte) (*database.Database, *llm.Models, *llm.GeminiAuth, *tool.Tools) {
 	// Initialize tools registry
 	tools := tool.NewTools()
 	InitTools(tools)
@@ -64,6 +88,65 @@ func Main(config *env.EnvConfig, embeddedFiles embed.FS, loginUnavailableHTML []
 		log.Fatalf("Failed to load models.json: %v", err)
 	}
 
+	checkNetworkFilesystem(config.DBPath())
+
+	ctx := env.ContextWithEnvConfig(context.Background(), config)
+	db, err := database.InitDB(ctx, config.DBPath())
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	// Initialize MCP connections
+	tools.InitMCPManager(db)
+
+	// Register user-defined script tools
+	tools.InitScriptTools(db)
+
+	// Load the size limit for inline tool results
+	if value, err := database.GetAppConfig(db, tool.MaxInlineResultSizeConfigName); err != nil {
+		log.Printf("Failed to load inline tool result size limit: %v", err)
+	} else if value != nil {
+		if size, err := strconv.Atoi(string(value)); err == nil {
+			tools.SetMaxInlineResultSize(size)
+		}
+	}
+
+	geminiAuth := llm.NewGeminiAuth("http://localhost:8080/oauth2callback")
+
+	// Record or replay LLM calls if requested; this should precede any provider registration
+	setupLLMRecording(models)
+
+	// Initialize OpenAI endpoints from database configurations
+	models.InitializeOpenAIEndpoints(db)
+
+	// Initialize Gemini providers
+	models.SetLLMProvider("api", llm.NewGeminiAPIProvider(models))
+	models.SetLLMProvider("geminicli", llm.NewCodeAssistProvider("geminicli", models))
+	models.SetLLMProvider("antigravity", llm.NewCodeAssistProvider("antigravity", models))
+	models.SetLLMProvider("anthropic", llm.NewAnthropicProvider())
+	models.SetLLMProvider("angel-internal", &llm.AngelEvalProvider{})
+
+	// Load the embedding model for semantic search
+	if value, err := database.GetAppConfig(db, llm.EmbeddingSettingsConfigName); err != nil {
+		log.Printf("Failed to load embedding settings: %v", err)
+	} else if value != nil {
+		var settings EmbeddingSettings
+		if err := json.Unmarshal(value, &settings); err != nil {
+			log.Printf("Failed to parse embedding settings: %v", err)
+		} else {
+			models.SetEmbeddingSettings(settings)
+		}
+	}
+
+	return db, models, geminiAuth, tools
+}
+
+func Main(config *env.EnvConfig, embeddedFiles embed.FS, loginUnavailableHTML []byte, modelsJSON []byte) {
+	// Subcommands are run without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(RunCommand(config, modelsJSON, os.Args[2:]))
+	}
+
 	// Parse port from command line argument (default: 8080)
 	port := 8080
 	if len(os.Args) > 1 {
@@ -74,33 +157,12 @@ func Main(config *env.EnvConfig, embeddedFiles embed.FS, loginUnavailableHTML []
 		}
 	}
 
-	checkNetworkFilesystem(config.DBPath())
-
-	ctx := env.ContextWithEnvConfig(context.Background(), config)
-	db, err := database.InitDB(ctx, config.DBPath())
-	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
+	db, models, geminiAuth, tools := initServices(config, modelsJSON)
 	defer db.Close()
 
 	// Start the shell command manager
 	shell.StartShellCommandManager(db)
 
-	jobs := []HousekeepingJob{
-		database.Job(db),
-		&tempSessionCleanupJob{
-			db:             db,
-			olderThan:      48 * time.Hour,
-			sandboxBaseDir: config.SessionDir(),
-		},
-		&attachPoolCleanupJob{
-			db:        db,
-			olderThan: 10 * time.Minute,
-		},
-	}
-
-	StartHousekeepingJobs(jobs)
-
 	// Retrieve or generate CSRF key
 	csrfKey, err := database.GetAppConfig(db, database.CSRFKeyName)
 	if err != nil {
@@ -119,19 +181,24 @@ func Main(config *env.EnvConfig, embeddedFiles embed.FS, loginUnavailableHTML []
 		log.Println("Loaded CSRF key from DB.")
 	}
 
-	// Initialize MCP connections
-	tools.InitMCPManager(db)
-
-	geminiAuth := llm.NewGeminiAuth("http://localhost:8080/oauth2callback")
-
-	// Initialize OpenAI endpoints from database configurations
-	models.InitializeOpenAIEndpoints(db)
+	// Jobs are started once providers are available, as some of them call LLMs
+	jobs := []HousekeepingJob{
+		database.Job(db),
+		&tempSessionCleanupJob{
+			db:             db,
+			olderThan:      48 * time.Hour,
+			sandboxBaseDir: config.SessionDir(),
+		},
+		&attachPoolCleanupJob{
+			db:        db,
+			olderThan: 10 * time.Minute,
+		},
+		llm.EmbeddingJob(db, models),
+		newScheduledPromptJob(db, models, geminiAuth, tools, config),
+		chat.InterruptedCallsJob(db),
+	}
 
-	// Initialize Gemini providers
-	models.SetLLMProvider("api", llm.NewGeminiAPIProvider(models))
-	models.SetLLMProvider("geminicli", llm.NewCodeAssistProvider("geminicli", models))
-	models.SetLLMProvider("antigravity", llm.NewCodeAssistProvider("antigravity", models))
-	models.SetLLMProvider("angel-internal", &llm.AngelEvalProvider{})
+	StartHousekeepingJobs(jobs)
 
 	router := mux.NewRouter()
 	router.Use(MakeContextMiddleware(db, models, geminiAuth, tools, config))
@@ -267,26 +334,38 @@ func InitRouter(router *mux.Router, embeddedFiles embed.FS) {
 	router.HandleFunc("/api/workspaces", createWorkspaceHandler).Methods("POST")
 	router.HandleFunc("/api/workspaces", listWorkspacesHandler).Methods("GET")
 	router.HandleFunc("/api/workspaces/{id}", deleteWorkspaceHandler).Methods("DELETE")
+	router.HandleFunc("/api/workspaces/{id}/compression", getWorkspaceCompressionHandler).Methods("GET")
+	router.HandleFunc("/api/workspaces/{id}/compression", updateWorkspaceCompressionHandler).Methods("PUT")
 
 	router.HandleFunc("/api/sessions", listSessionsWithDetailsHandler).Methods("GET")
 	router.HandleFunc("/api/chat", listSessionsByWorkspaceHandler).Methods("GET")
 	router.HandleFunc("/api/chat", newSessionAndMessageHandler).Methods("POST")
 	router.HandleFunc("/api/chat/temp", newTempSessionAndMessageHandler).Methods("POST")
+	router.HandleFunc("/api/run", runSessionHandler).Methods("POST")
 	router.HandleFunc("/api/chat/new/envChanged", calculateNewSessionEnvChangedHandler).Methods("GET")
 	router.HandleFunc("/api/chat/{sessionId}", chatMessageHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}", loadChatSessionHandler).Methods("GET")
 	router.HandleFunc("/api/chat/{sessionId}/name", updateSessionNameHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}/workspace", updateSessionWorkspaceHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}/roots", updateSessionRootsHandler).Methods("POST")
+	router.HandleFunc("/api/chat/{sessionId}/genParams", getSessionGenParamsHandler).Methods("GET")
+	router.HandleFunc("/api/chat/{sessionId}/genParams", updateSessionGenParamsHandler).Methods("PUT")
 	router.HandleFunc("/api/chat/{sessionId}/call", handleCall).Methods("GET", "DELETE")
+	router.HandleFunc("/api/chat/{sessionId}/steer", steerCallHandler).Methods("POST")
+	router.HandleFunc("/api/chat/{sessionId}/queue", listQueuedMessagesHandler).Methods("GET")
+	router.HandleFunc("/api/chat/{sessionId}/queue/{queuedId}", updateQueuedMessageHandler).Methods("PUT")
+	router.HandleFunc("/api/chat/{sessionId}/queue/{queuedId}", deleteQueuedMessageHandler).Methods("DELETE")
 	router.HandleFunc("/api/chat/{sessionId}", deleteSessionHandler).Methods("DELETE")
 	router.HandleFunc("/api/chat/{sessionId}/branch", createBranchHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}/branch", switchBranchHandler).Methods("PUT")
 	router.HandleFunc("/api/chat/{sessionId}/message/{messageId}", updateMessageHandler).Methods("PUT")
 	router.HandleFunc("/api/chat/{sessionId}/branch/{branchId}/confirm", confirmBranchHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}/branch/{branchId}/retry-error", retryErrorBranchHandler).Methods("POST")
+	router.HandleFunc("/api/chat/{sessionId}/branch/{branchId}/resume", resumeBranchHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}/archive", archiveSessionHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}/compress", compressSessionHandler).Methods("POST")
+	router.HandleFunc("/api/chat/{sessionId}/compression", getSessionCompressionHandler).Methods("GET")
+	router.HandleFunc("/api/chat/{sessionId}/compression", updateSessionCompressionHandler).Methods("PUT")
 	router.HandleFunc("/api/chat/{sessionId}/extract", extractSessionHandler).Methods("POST")
 	router.HandleFunc("/api/chat/{sessionId}/command", commandHandler).Methods("POST")
 
@@ -297,10 +376,34 @@ func InitRouter(router *mux.Router, embeddedFiles embed.FS) {
 	router.HandleFunc("/api/mcp/configs", getMCPConfigsHandler).Methods("GET")
 	router.HandleFunc("/api/mcp/configs", saveMCPConfigHandler).Methods("POST")
 	router.HandleFunc("/api/mcp/configs/{name}", deleteMCPConfigHandler).Methods("DELETE")
+	router.HandleFunc("/api/script-tools", getScriptToolsHandler).Methods("GET")
+	router.HandleFunc("/api/script-tools", saveScriptToolHandler).Methods("POST")
+	router.HandleFunc("/api/script-tools/{name}", deleteScriptToolHandler).Methods("DELETE")
+	router.HandleFunc("/api/memories", listMemoriesHandler).Methods("GET")
+	router.HandleFunc("/api/memories", createMemoryHandler).Methods("POST")
+	router.HandleFunc("/api/memories/{id}", updateMemoryHandler).Methods("PUT")
+	router.HandleFunc("/api/memories/{id}", deleteMemoryHandler).Methods("DELETE")
+	router.HandleFunc("/api/schedules", listScheduledPromptsHandler).Methods("GET")
+	router.HandleFunc("/api/schedules", createScheduledPromptHandler).Methods("POST")
+	router.HandleFunc("/api/schedules/events", scheduleEventsHandler).Methods("GET")
+	router.HandleFunc("/api/schedules/{id}", getScheduledPromptHandler).Methods("GET")
+	router.HandleFunc("/api/schedules/{id}", updateScheduledPromptHandler).Methods("PUT")
+	router.HandleFunc("/api/schedules/{id}", deleteScheduledPromptHandler).Methods("DELETE")
+	router.HandleFunc("/api/schedules/{id}/runs", listScheduledPromptRunsHandler).Methods("GET")
+	router.HandleFunc("/api/schedules/{id}/run", runScheduledPromptHandler).Methods("POST")
+	router.HandleFunc("/api/compression/settings", getCompressionSettingsHandler).Methods("GET")
+	router.HandleFunc("/api/compression/settings", saveCompressionSettingsHandler).Methods("PUT")
+	router.HandleFunc("/api/tools/settings", getToolSettingsHandler).Methods("GET")
+	router.HandleFunc("/api/tools/settings", saveToolSettingsHandler).Methods("PUT")
+	router.HandleFunc("/api/tools/audit", getToolCallAuditsHandler).Methods("GET")
+	router.HandleFunc("/api/tools/audit/stats", getToolCallStatsHandler).Methods("GET")
+	router.HandleFunc("/api/usage", getTokenUsageHandler).Methods("GET")
 	router.HandleFunc("/api/models", listModelsHandler).Methods("GET")
 	router.HandleFunc("/api/systemPrompts", getSystemPromptsHandler).Methods("GET")
 	router.HandleFunc("/api/systemPrompts", saveSystemPromptsHandler).Methods("PUT")
 	router.HandleFunc("/api/search", searchMessagesHandler).Methods("POST")
+	router.HandleFunc("/api/search/embedding", getEmbeddingSettingsHandler).Methods("GET")
+	router.HandleFunc("/api/search/embedding", saveEmbeddingSettingsHandler).Methods("PUT")
 
 	// OpenAI configuration endpoints
 	router.HandleFunc("/api/openai-configs", getOpenAIConfigsHandler).Methods("GET")
@@ -313,6 +416,9 @@ func InitRouter(router *mux.Router, embeddedFiles embed.FS) {
 	router.HandleFunc("/api/gemini-api-configs", getGeminiAPIConfigsHandler).Methods("GET")
 	router.HandleFunc("/api/gemini-api-configs", saveGeminiAPIConfigHandler).Methods("POST")
 	router.HandleFunc("/api/gemini-api-configs/{id}", deleteGeminiAPIConfigHandler).Methods("DELETE")
+	router.HandleFunc("/api/anthropic-configs", getAnthropicConfigsHandler).Methods("GET")
+	router.HandleFunc("/api/anthropic-configs", saveAnthropicConfigHandler).Methods("POST")
+	router.HandleFunc("/api/anthropic-configs/{id}", deleteAnthropicConfigHandler).Methods("DELETE")
 
 	router.HandleFunc("/api/ui/directory", handleDirectoryNavigation).Methods("GET")
 	router.HandleFunc("/api/ui/directory", handlePickDirectory).Methods("POST")
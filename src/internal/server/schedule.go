@@ -0,0 +1,382 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lifthrasiir/angel/internal/chat"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/env"
+	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// scheduleEventsKey is the pseudo session ID under which clients listen to schedule events.
+// It can't collide with real session IDs, which never start with `!`.
+const scheduleEventsKey = "!schedules"
+
+// scheduledRunHistoryLimit is the number of recent runs returned by the run history API.
+const scheduledRunHistoryLimit = 50
+
+var (
+	scheduledRunsMutex      sync.Mutex
+	runningScheduledPrompts = make(map[int]bool) // Scheduled prompt ID -> true while running
+)
+
+// startScheduledRun records a new run of the scheduled prompt and runs it in the background.
+// The run is skipped, returning false, if the previous run of the same prompt is still running.
+// A failed run is notified to clients listening to schedule events.
+func startScheduledRun(
+	db *database.Database, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig,
+	sp ScheduledPrompt,
+) (ScheduledPromptRun, bool, error) {
+	scheduledRunsMutex.Lock()
+	defer scheduledRunsMutex.Unlock()
+	if runningScheduledPrompts[sp.ID] {
+		return ScheduledPromptRun{}, false, nil
+	}
+
+	run, err := database.AddScheduledPromptRun(db, sp.ID)
+	if err != nil {
+		return ScheduledPromptRun{}, false, err
+	}
+	runningScheduledPrompts[sp.ID] = true
+
+	go func() {
+		defer func() {
+			scheduledRunsMutex.Lock()
+			delete(runningScheduledPrompts, sp.ID)
+			scheduledRunsMutex.Unlock()
+		}()
+
+		log.Printf("Running scheduled prompt %d (%s)", sp.ID, sp.Name)
+		result, err := chat.RunScheduledPrompt(context.Background(), db, models, ga, tools, config, broadcastToSession, sp)
+		errorMessage := result.Error
+		if err != nil {
+			errorMessage = err.Error()
+		}
+
+		finished, err := database.FinishScheduledPromptRun(db, run.ID, result.SessionID, errorMessage)
+		if err != nil {
+			log.Printf("Failed to record the outcome of scheduled prompt %d: %v", sp.ID, err)
+			return
+		}
+		if finished.Status == ScheduledRunFailed {
+			log.Printf("Scheduled prompt %d (%s) failed: %s", sp.ID, sp.Name, finished.Error)
+			runJSON, _ := json.Marshal(finished)
+			broadcastToSession(scheduleEventsKey, EventScheduledRunFailed, fmt.Sprintf("%s\n%s", sp.Name, runJSON))
+		}
+	}()
+	return run, true, nil
+}
+
+// scheduledPromptJob is a housekeeping job that runs scheduled prompts when they are due.
+// Housekeeping jobs run too infrequently for schedules, so due prompts are checked every minute by its own ticker.
+// Runs missed while the server was down are not caught up.
+type scheduledPromptJob struct {
+	db     *database.Database
+	models *llm.Models
+	ga     *llm.GeminiAuth
+	tools  *tool.Tools
+	config *env.EnvConfig
+	stop   chan struct{}
+}
+
+func newScheduledPromptJob(db *database.Database, models *llm.Models, ga *llm.GeminiAuth, tools *tool.Tools, config *env.EnvConfig) *scheduledPromptJob {
+	return &scheduledPromptJob{db: db, models: models, ga: ga, tools: tools, config: config, stop: make(chan struct{})}
+}
+
+func (job *scheduledPromptJob) Name() string { return "Scheduled prompts" }
+func (job *scheduledPromptJob) First() error {
+	if err := database.CleanupStaleScheduledPromptRuns(job.db); err != nil {
+		return err
+	}
+	go job.loop(time.Now())
+	return nil
+}
+func (job *scheduledPromptJob) Sometimes() error { return nil }
+func (job *scheduledPromptJob) Last() error      { close(job.stop); return nil }
+
+func (job *scheduledPromptJob) loop(since time.Time) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-job.stop:
+			return
+		case now := <-ticker.C:
+			if err := job.runDue(since, now); err != nil {
+				log.Printf("Failed to run scheduled prompts: %v", err)
+			}
+			since = now
+		}
+	}
+}
+
+// runDue starts all enabled prompts scheduled after since and no later than now.
+func (job *scheduledPromptJob) runDue(since, now time.Time) error {
+	prompts, err := database.GetScheduledPrompts(job.db)
+	if err != nil {
+		return err
+	}
+	for _, sp := range prompts {
+		if !sp.Enabled {
+			continue
+		}
+		schedule, err := chat.ParseSchedule(sp.Schedule)
+		if err != nil {
+			log.Printf("Skipping scheduled prompt %d with an invalid schedule: %v", sp.ID, err)
+			continue
+		}
+		if next := schedule.Next(since); next.IsZero() || next.After(now) {
+			continue
+		}
+		if _, started, err := startScheduledRun(job.db, job.models, job.ga, job.tools, job.config, sp); err != nil {
+			log.Printf("Failed to start scheduled prompt %d: %v", sp.ID, err)
+		} else if !started {
+			log.Printf("Skipping scheduled prompt %d: the previous run is still running", sp.ID)
+		}
+	}
+	return nil
+}
+
+// withNextRunAt fills the computed NextRunAt field of the scheduled prompt.
+func withNextRunAt(sp ScheduledPrompt) ScheduledPrompt {
+	if !sp.Enabled {
+		return sp
+	}
+	if schedule, err := chat.ParseSchedule(sp.Schedule); err == nil {
+		if next := schedule.Next(time.Now()); !next.IsZero() {
+			sp.NextRunAt = &next
+		}
+	}
+	return sp
+}
+
+// parseScheduledPrompt reads and validates a scheduled prompt from the request body, sending an error response if invalid.
+func parseScheduledPrompt(w http.ResponseWriter, r *http.Request, db *database.Database, handlerName string) (ScheduledPrompt, bool) {
+	sp := ScheduledPrompt{Enabled: true} // Enabled unless specified otherwise
+	if !decodeJSONRequest(r, w, &sp, handlerName) {
+		return sp, false
+	}
+
+	sp.Name = strings.TrimSpace(sp.Name)
+	sp.Schedule = strings.TrimSpace(sp.Schedule)
+	if sp.Name == "" {
+		sendBadRequestError(w, r, "Name is required")
+		return sp, false
+	}
+	if strings.TrimSpace(sp.Prompt) == "" {
+		sendBadRequestError(w, r, "Prompt is required")
+		return sp, false
+	}
+	if _, err := chat.ParseSchedule(sp.Schedule); err != nil {
+		sendBadRequestError(w, r, fmt.Sprintf("Invalid schedule: %v", err))
+		return sp, false
+	}
+	if len(sp.Tools) > 0 {
+		knownTools := getTools(w, r).Names()
+		for _, name := range sp.Tools {
+			if !knownTools[name] {
+				sendBadRequestError(w, r, fmt.Sprintf("Unknown tool: %s", name))
+				return sp, false
+			}
+		}
+	}
+	if sp.WorkspaceID != "" {
+		if _, err := database.GetWorkspace(db, sp.WorkspaceID); err != nil {
+			sendBadRequestError(w, r, fmt.Sprintf("Workspace %s not found", sp.WorkspaceID))
+			return sp, false
+		}
+	}
+	if sp.SessionID != "" {
+		sdb, err := db.WithSession(sp.SessionID)
+		if err != nil {
+			sendBadRequestError(w, r, fmt.Sprintf("Session %s not found", sp.SessionID))
+			return sp, false
+		}
+		sdb.Close()
+	}
+	return sp, true
+}
+
+// parseScheduledPromptID parses the scheduled prompt ID in the URL and retrieves it, sending an error response if invalid or nonexistent.
+func parseScheduledPromptID(w http.ResponseWriter, r *http.Request, db *database.Database) (ScheduledPrompt, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		sendBadRequestError(w, r, "Invalid scheduled prompt ID")
+		return ScheduledPrompt{}, false
+	}
+	sp, err := database.GetScheduledPrompt(db, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			sendNotFoundError(w, r, "Scheduled prompt not found")
+		} else {
+			sendInternalServerError(w, r, err, "Failed to retrieve scheduled prompt")
+		}
+		return ScheduledPrompt{}, false
+	}
+	return sp, true
+}
+
+// listScheduledPromptsHandler handles GET requests for /api/schedules
+func listScheduledPromptsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	prompts, err := database.GetScheduledPrompts(db)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to retrieve scheduled prompts")
+		return
+	}
+	for i := range prompts {
+		prompts[i] = withNextRunAt(prompts[i])
+	}
+
+	sendJSONResponse(w, prompts)
+}
+
+// createScheduledPromptHandler handles POST requests for /api/schedules
+func createScheduledPromptHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sp, ok := parseScheduledPrompt(w, r, db, "createScheduledPromptHandler")
+	if !ok {
+		return
+	}
+
+	sp, err := database.AddScheduledPrompt(db, sp)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to add scheduled prompt")
+		return
+	}
+
+	sendJSONResponse(w, withNextRunAt(sp))
+}
+
+// getScheduledPromptHandler handles GET requests for /api/schedules/{id}
+func getScheduledPromptHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sp, ok := parseScheduledPromptID(w, r, db)
+	if !ok {
+		return
+	}
+
+	sendJSONResponse(w, withNextRunAt(sp))
+}
+
+// updateScheduledPromptHandler handles PUT requests for /api/schedules/{id}
+func updateScheduledPromptHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	existing, ok := parseScheduledPromptID(w, r, db)
+	if !ok {
+		return
+	}
+	sp, ok := parseScheduledPrompt(w, r, db, "updateScheduledPromptHandler")
+	if !ok {
+		return
+	}
+
+	sp.ID = existing.ID
+	if err := database.UpdateScheduledPrompt(db, sp); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to update scheduled prompt %d", sp.ID))
+		return
+	}
+	sp, err := database.GetScheduledPrompt(db, sp.ID)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to retrieve scheduled prompt")
+		return
+	}
+
+	sendJSONResponse(w, withNextRunAt(sp))
+}
+
+// deleteScheduledPromptHandler handles DELETE requests for /api/schedules/{id}
+func deleteScheduledPromptHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sp, ok := parseScheduledPromptID(w, r, db)
+	if !ok {
+		return
+	}
+
+	if err := database.DeleteScheduledPrompt(db, sp.ID); err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to delete scheduled prompt %d", sp.ID))
+		return
+	}
+
+	sendJSONResponse(w, map[string]string{"status": "success"})
+}
+
+// listScheduledPromptRunsHandler handles GET requests for /api/schedules/{id}/runs
+func listScheduledPromptRunsHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+
+	sp, ok := parseScheduledPromptID(w, r, db)
+	if !ok {
+		return
+	}
+
+	runs, err := database.GetScheduledPromptRuns(db, sp.ID, scheduledRunHistoryLimit)
+	if err != nil {
+		sendInternalServerError(w, r, err, "Failed to retrieve scheduled prompt runs")
+		return
+	}
+
+	sendJSONResponse(w, runs)
+}
+
+// runScheduledPromptHandler handles POST requests for /api/schedules/{id}/run, which starts a run immediately.
+// It returns the started run without waiting for it to finish.
+func runScheduledPromptHandler(w http.ResponseWriter, r *http.Request) {
+	db := getDb(w, r)
+	models := getModels(w, r)
+	ga := getGeminiAuth(w, r)
+	tools := getTools(w, r)
+	config := getEnvConfig(w, r)
+
+	sp, ok := parseScheduledPromptID(w, r, db)
+	if !ok {
+		return
+	}
+
+	run, started, err := startScheduledRun(db, models, ga, tools, config, sp)
+	if err != nil {
+		sendInternalServerError(w, r, err, fmt.Sprintf("Failed to start scheduled prompt %d", sp.ID))
+		return
+	}
+	if !started {
+		http.Error(w, "The previous run is still running", http.StatusConflict)
+		return
+	}
+
+	sendJSONResponse(w, run)
+}
+
+// scheduleEventsHandler handles GET requests for /api/schedules/events,
+// which streams schedule events like EventScheduledRunFailed until the client disconnects.
+func scheduleEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ew := newSseWriter(r.Context(), scheduleEventsKey, w)
+	if ew == nil {
+		return
+	}
+
+	ew.Acquire()
+	defer ew.Release()
+	ew.Send(EventPing, "") // Send headers right away
+
+	<-r.Context().Done()
+}
@@ -138,12 +138,25 @@ func (sseW *sseWriter) Broadcast(eventType EventType, data string) {
 	sseWritersMutex.Lock()
 	defer sseWritersMutex.Unlock()
 
-	writers, ok := activeSseWriters[sseW.sessionId]
-	if !ok || len(writers) == 0 {
+	if len(activeSseWriters[sseW.sessionId]) == 0 {
 		return
 	}
 
 	sseW.postInitUnsafe()
+	broadcastUnsafe(sseW.sessionId, eventType, data)
+}
+
+// broadcastToSession sends an event to all active sseWriters for a given session,
+// for events that don't originate from any streaming request.
+func broadcastToSession(sessionId string, eventType EventType, data string) {
+	sseWritersMutex.Lock()
+	defer sseWritersMutex.Unlock()
+	broadcastUnsafe(sessionId, eventType, data)
+}
+
+// broadcastUnsafe performs the actual broadcast (must be called with sseWritersMutex held)
+func broadcastUnsafe(sessionId string, eventType EventType, data string) {
+	writers := activeSseWriters[sessionId]
 
 	// Prepare the event data once
 	eventData := prepareSSEEventData(eventType, data)
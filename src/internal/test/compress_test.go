@@ -0,0 +1,289 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestAutoCompression tests that the history is compressed in the middle of a tool loop once it grows too large
+func TestAutoCompression(t *testing.T) {
+	router, db, models := setupTest(t)
+	database.CreateWorkspace(db, "compressWs", "Compression Workspace", "")
+
+	provider, err := models.GetModelProvider(DefaultGeminiModel)
+	if err != nil {
+		t.Fatalf("Failed to get model provider: %v", err)
+	}
+	maxTokens := provider.MaxTokens()
+
+	// Calls a tool first with a large history, then answers once the function response is available
+	var calls [][]Content
+	models.SetLLMProvider("", &llm.MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			calls = append(calls, params.Contents)
+			part := Part{FunctionCall: &FunctionCall{Name: "no_such_tool", Args: map[string]interface{}{}}}
+			usage := &UsageMetadata{PromptTokenCount: maxTokens / 2, TotalTokenCount: maxTokens * 6 / 10}
+			if last := params.Contents[len(params.Contents)-1]; len(last.Parts) > 0 && last.Parts[0].FunctionResponse != nil {
+				part = Part{Text: "All done"}
+				usage = &UsageMetadata{PromptTokenCount: 90, TotalTokenCount: 100}
+			}
+			return func(yield func(GenerateContentResponse) bool) {
+				yield(GenerateContentResponse{
+					Candidates:    []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{part}}}},
+					UsageMetadata: usage,
+				})
+			}, io.NopCloser(nil), nil
+		},
+		GenerateContentOneShotFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (llm.OneShotResult, error) {
+			return llm.OneShotResult{Text: "<state_snapshot>Summary of the tool call</state_snapshot>"}, nil
+		},
+		CountTokensFunc: func(ctx context.Context, modelName string, contents []Content) (*CaCountTokenResponse, error) {
+			return &CaCountTokenResponse{TotalTokens: 100 * len(contents)}, nil
+		},
+	})
+
+	runChat := func(t *testing.T) (compressions []string) {
+		calls = nil
+		payload := []byte(`{"message": "Call a tool", "workspaceId": "compressWs"}`)
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", payload, http.StatusOK)
+		defer resp.Body.Close()
+		for event := range parseSseStream(t, resp) {
+			switch event.Type {
+			case EventCompression:
+				compressions = append(compressions, event.Payload)
+			case EventError:
+				t.Fatalf("Unexpected error event: %s", event.Payload)
+			}
+		}
+		return compressions
+	}
+
+	testRequest(t, router, "PUT", "/api/compression/settings", []byte(`{"auto_threshold": 1.5}`), http.StatusBadRequest)
+	testRequest(t, router, "PUT", "/api/compression/settings", []byte(`{"auto_threshold": 0.5}`), http.StatusOK)
+	rr := testRequest(t, router, "GET", "/api/compression/settings", nil, http.StatusOK)
+	var settings struct {
+		AutoThreshold float64 `json:"auto_threshold"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &settings); err != nil || settings.AutoThreshold != 0.5 {
+		t.Fatalf("Unexpected compression settings: %s (%v)", rr.Body.String(), err)
+	}
+
+	t.Run("Compressed", func(t *testing.T) {
+		compressions := runChat(t)
+		if len(compressions) != 1 {
+			t.Fatalf("Expected a single compression event, got %q", compressions)
+		}
+		fields := strings.SplitN(compressions[0], "\n", 5)
+		// The summary is followed by the last function call and response, 100 tokens each
+		if len(fields) != 5 || fields[2] != "300" || fields[4] != "Summary of the tool call" {
+			t.Fatalf("Unexpected compression event payload: %q", compressions[0])
+		}
+
+		if len(calls) != 2 {
+			t.Fatalf("Expected 2 LLM calls, got %d", len(calls))
+		}
+		if contents := calls[1]; len(contents) != 3 || contents[0].Parts[0].Text != "Summary of the tool call" || contents[2].Parts[0].FunctionResponse == nil {
+			t.Errorf("Expected the second call to continue from the summary, got %+v", contents)
+		}
+
+		var sessionID string
+		querySingleRow(t, db, "SELECT id FROM sessions WHERE workspace_id = ?", []interface{}{"compressWs"}, &sessionID)
+		sdb, err := db.WithSession(sessionID)
+		if err != nil {
+			t.Fatalf("Failed to open session database: %v", err)
+		}
+		defer sdb.Close()
+		session, err := database.GetSession(sdb)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+
+		// The uncompressed messages remain in the branch, followed by the compression message and the answer
+		history, err := database.GetSessionHistory(sdb, session.PrimaryBranchID)
+		if err != nil {
+			t.Fatalf("Failed to get session history: %v", err)
+		}
+		var types []string
+		for _, msg := range history {
+			types = append(types, string(msg.Type))
+		}
+		if got := strings.Join(types, ","); !strings.HasPrefix(got, "user,") || !strings.HasSuffix(got, ",function_call,function_response,compression,model") {
+			t.Errorf("Unexpected message types in the branch: %s", got)
+		}
+		if last := history[len(history)-1]; len(last.Parts) == 0 || last.Parts[0].Text != "All done" {
+			t.Errorf("Expected the answer after the compression message, got %+v", last)
+		}
+		// The next call starts from the compression message
+		if compressed := history[len(history)-2]; compressed.CumulTokenCount == nil || *compressed.CumulTokenCount != 90 {
+			t.Errorf("Expected the prompt token count of the next call, got %v", compressed.CumulTokenCount)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		testRequest(t, router, "PUT", "/api/compression/settings", []byte(`{"auto_threshold": 0}`), http.StatusOK)
+		if compressions := runChat(t); len(compressions) != 0 {
+			t.Errorf("Expected no compression, got %q", compressions)
+		}
+	})
+}
+
+// TestCompressionStrategies tests each compression strategy and how the strategy is chosen
+func TestCompressionStrategies(t *testing.T) {
+	largeResponse := map[string]interface{}{"content": strings.Repeat("x", 3000)}
+	largePayload, _ := json.Marshal(largeResponse)
+	largeHash := database.BlobHash(largePayload)
+	padding := strings.Repeat(" and some more words", 10)
+
+	// Sets up a session with a tool call, whose large response should be compressed.
+	// Each test has its own environment, as all in-memory session DBs are shared.
+	var summaries int
+	setup := func(t *testing.T) (*mux.Router, *database.SessionDatabase, func(msgType MessageType, text string)) {
+		router, db, models := setupTest(t)
+		database.CreateWorkspace(db, "strategyWs", "Strategy Workspace", "")
+
+		summaries = 0
+		models.SetLLMProvider("", &llm.MockLLMProvider{
+			GenerateContentOneShotFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (llm.OneShotResult, error) {
+				summaries++
+				return llm.OneShotResult{Text: fmt.Sprintf("<state_snapshot>Chunk %d</state_snapshot>", summaries)}, nil
+			},
+			CountTokensFunc: func(ctx context.Context, modelName string, contents []Content) (*CaCountTokenResponse, error) {
+				data, _ := json.Marshal(contents)
+				return &CaCountTokenResponse{TotalTokens: len(data) / 4}, nil
+			},
+		})
+
+		sessionID := database.GenerateID()
+		sdb, branchID, err := database.CreateSession(db, sessionID, "", "strategyWs")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		t.Cleanup(func() { sdb.Close() })
+
+		var parentID *int
+		addMessage := func(msgType MessageType, text string) {
+			id, err := database.AddMessageToSession(context.Background(), sdb, Message{
+				LocalSessionID: sdb.LocalSessionId(), BranchID: branchID, Type: msgType, Text: text, ParentMessageID: parentID,
+			})
+			if err != nil {
+				t.Fatalf("Failed to add message: %v", err)
+			}
+			if parentID != nil {
+				if err := database.UpdateMessageChosenNextID(sdb, *parentID, &id); err != nil {
+					t.Fatalf("Failed to update chosen_next_id: %v", err)
+				}
+			}
+			parentID = &id
+		}
+
+		call, _ := json.Marshal(FunctionCall{Name: "read_file", Args: map[string]interface{}{"path": "a.txt"}})
+		response, _ := json.Marshal(FunctionResponse{Name: "read_file", Response: largeResponse})
+		addMessage(TypeUserText, "Read a.txt")
+		addMessage(TypeFunctionCall, string(call))
+		addMessage(TypeFunctionResponse, string(response))
+		addMessage(TypeModelText, "The file is full of x")
+		addMessage(TypeUserText, "Thanks"+padding)
+		addMessage(TypeModelText, "You're welcome"+padding)
+		return router, sdb, addMessage
+	}
+
+	type compressResponse struct {
+		OriginalTokenCount int    `json:"originalTokenCount"`
+		NewTokenCount      int    `json:"newTokenCount"`
+		ExtractedSummary   string `json:"extractedSummary"`
+		Strategy           string `json:"strategy"`
+		TokensSaved        int    `json:"tokensSaved"`
+	}
+	compress := func(t *testing.T, router *mux.Router, sdb *database.SessionDatabase, strategy string) compressResponse {
+		rr := testRequest(t, router, "POST", "/api/chat/"+sdb.SessionId()+"/compress", nil, http.StatusOK)
+		var result compressResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to decode compression result: %v", err)
+		}
+		if result.Strategy != strategy {
+			t.Errorf("Expected %s strategy, got %s", strategy, result.Strategy)
+		}
+		if result.TokensSaved <= 0 || result.TokensSaved != result.OriginalTokenCount-result.NewTokenCount {
+			t.Errorf("Unexpected tokens saved: %+v", result)
+		}
+		return result
+	}
+	setStrategy := func(t *testing.T, router *mux.Router, url, strategy string) {
+		testRequest(t, router, "PUT", url, []byte(fmt.Sprintf(`{"strategy": %q}`, strategy)), http.StatusOK)
+	}
+
+	t.Run("Summary", func(t *testing.T) {
+		router, sdb, _ := setup(t)
+		testRequest(t, router, "PUT", "/api/chat/"+sdb.SessionId()+"/compression", []byte(`{"strategy": "no_such_strategy"}`), http.StatusBadRequest)
+		if result := compress(t, router, sdb, "summary"); result.ExtractedSummary != "Chunk 1" {
+			t.Errorf("Unexpected summary: %q", result.ExtractedSummary)
+		}
+	})
+
+	t.Run("DropResults", func(t *testing.T) {
+		router, sdb, _ := setup(t)
+		setStrategy(t, router, "/api/chat/"+sdb.SessionId()+"/compression", "drop_results")
+		result := compress(t, router, sdb, "drop_results")
+		for _, expected := range []string{"[user] Read a.txt", "[model] Called `read_file` with {\"path\":\"a.txt\"}", "[tool] Result of `read_file` omitted.", "[model] The file is full of x"} {
+			if !strings.Contains(result.ExtractedSummary, expected) {
+				t.Errorf("Expected %q in the transcript, got %q", expected, result.ExtractedSummary)
+			}
+		}
+		if strings.Contains(result.ExtractedSummary, "xxx") || strings.Contains(result.ExtractedSummary, "Thanks") {
+			t.Errorf("Unexpected messages in the transcript: %q", result.ExtractedSummary)
+		}
+	})
+
+	t.Run("BlobResults", func(t *testing.T) {
+		router, sdb, _ := setup(t)
+		setStrategy(t, router, "/api/compression/settings", "blob_results")
+		result := compress(t, router, sdb, "blob_results")
+		if !strings.Contains(result.ExtractedSummary, "moved to blob "+largeHash) {
+			t.Errorf("Expected the result to be moved to a blob, got %q", result.ExtractedSummary)
+		}
+		if data, err := database.GetBlob(sdb, largeHash); err != nil || string(data) != string(largePayload) {
+			t.Errorf("Expected the result to be saved as a blob: %v", err)
+		}
+		var attachments string
+		querySingleRow(t, sdb, "SELECT attachments FROM S.messages WHERE type = 'compression'", nil, &attachments)
+		if !strings.Contains(attachments, largeHash) || !strings.Contains(attachments, `"omitted":true`) {
+			t.Errorf("Expected an omitted attachment in the compression message, got %s", attachments)
+		}
+	})
+
+	t.Run("Rolling", func(t *testing.T) {
+		router, sdb, addMessage := setup(t)
+		setStrategy(t, router, "/api/workspaces/strategyWs/compression", "rolling")
+		rr := testRequest(t, router, "GET", "/api/chat/"+sdb.SessionId()+"/compression", nil, http.StatusOK)
+		if !strings.Contains(rr.Body.String(), `"strategy":""`) || !strings.Contains(rr.Body.String(), `"effective":"rolling"`) {
+			t.Fatalf("Expected the workspace strategy to be inherited, got %s", rr.Body.String())
+		}
+
+		result := compress(t, router, sdb, "rolling")
+		if result.ExtractedSummary != "<summary level=\"1\">\nChunk 1\n</summary>" {
+			t.Fatalf("Unexpected rolling summary: %q", result.ExtractedSummary)
+		}
+		// Four summaries at the first level are merged into a summary at the second level
+		for i := 2; i <= 4; i++ {
+			addMessage(TypeUserText, fmt.Sprintf("Question %d", i)+padding)
+			addMessage(TypeModelText, fmt.Sprintf("Answer %d", i)+padding)
+			result = compress(t, router, sdb, "rolling")
+		}
+		if summaries != 5 || result.ExtractedSummary != "<summary level=\"2\">\nChunk 5\n</summary>" {
+			t.Errorf("Unexpected rolling summary after %d summaries: %q", summaries, result.ExtractedSummary)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestMemories tests memory tools, memories in system prompts and the memory management API
+func TestMemories(t *testing.T) {
+	router, db, models := setupTest(t)
+	database.CreateWorkspace(db, "memWs", "Memory Workspace", "")
+	database.CreateWorkspace(db, "otherWs", "Other Workspace", "")
+
+	// Calls nextCall if any, then answers with the function response
+	var nextCall *FunctionCall
+	var systemPrompt, lastResponse string
+	models.SetLLMProvider("", &llm.MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			systemPrompt = params.SystemPrompt
+			part := Part{Text: "Done"}
+			if last := params.Contents[len(params.Contents)-1]; len(last.Parts) > 0 && last.Parts[0].FunctionResponse != nil {
+				response, _ := json.Marshal(last.Parts[0].FunctionResponse.Response)
+				lastResponse = string(response)
+			} else if nextCall != nil {
+				part = Part{FunctionCall: nextCall}
+			}
+			return func(yield func(GenerateContentResponse) bool) {
+				yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{part}}}}})
+			}, io.NopCloser(nil), nil
+		},
+	})
+
+	runChatWithPrompt := func(t *testing.T, call *FunctionCall, prompt string) {
+		nextCall, lastResponse = call, ""
+		payload, _ := json.Marshal(map[string]string{"message": "Hello", "workspaceId": "memWs", "systemPrompt": prompt})
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", payload, http.StatusOK)
+		defer resp.Body.Close()
+		for event := range parseSseStream(t, resp) {
+			if event.Type == EventError {
+				t.Fatalf("Unexpected error event: %s", event.Payload)
+			}
+		}
+	}
+	runChat := func(t *testing.T, call *FunctionCall) {
+		runChatWithPrompt(t, call, "Memories:\n{{.Workspace.Memories}}")
+	}
+	listMemories := func(t *testing.T, workspaceID string) []Memory {
+		rr := testRequest(t, router, "GET", "/api/memories?workspaceId="+workspaceID, nil, http.StatusOK)
+		var memories []Memory
+		if err := json.Unmarshal(rr.Body.Bytes(), &memories); err != nil {
+			t.Fatalf("Failed to decode memories: %v", err)
+		}
+		return memories
+	}
+
+	runChat(t, &FunctionCall{Name: "remember", Args: map[string]interface{}{"content": "The user prefers tabs"}})
+	memories := listMemories(t, "memWs")
+	if len(memories) != 1 || memories[0].Content != "The user prefers tabs" || memories[0].SessionID == "" {
+		t.Fatalf("Expected a memory stored by the session, got %+v (%s)", memories, lastResponse)
+	}
+	if strings.Contains(systemPrompt, "tabs") {
+		t.Errorf("Expected no memories in the system prompt yet, got %q", systemPrompt)
+	}
+
+	// Memories are available to new sessions in the same workspace
+	runChat(t, nil)
+	if systemPrompt != "Memories:\n- The user prefers tabs\n" {
+		t.Errorf("Expected the memory in the system prompt, got %q", systemPrompt)
+	}
+	for _, prompt := range []string{"{{.Builtin.SystemPrompt}}", "{{.Builtin.SystemPromptForCoding}}"} {
+		runChatWithPrompt(t, nil, prompt)
+		if !strings.Contains(systemPrompt, "# Memories") || !strings.Contains(systemPrompt, "- The user prefers tabs\n") {
+			t.Errorf("Expected the memory in the built-in system prompt %s, got %q", prompt, systemPrompt)
+		}
+	}
+
+	rr := testRequest(t, router, "PUT", fmt.Sprintf("/api/memories/%d", memories[0].ID), []byte(`{"content": "The user prefers spaces"}`), http.StatusOK)
+	if !strings.Contains(rr.Body.String(), "The user prefers spaces") {
+		t.Errorf("Expected the updated memory, got %s", rr.Body.String())
+	}
+	runChat(t, &FunctionCall{Name: "list_memories", Args: map[string]interface{}{}})
+	if !strings.Contains(lastResponse, "The user prefers spaces") {
+		t.Errorf("Expected the updated memory to be listed, got %s", lastResponse)
+	}
+
+	// Memories of other workspaces cannot be forgotten
+	rr = testRequest(t, router, "POST", "/api/memories", []byte(`{"workspaceId": "otherWs", "content": "Unrelated"}`), http.StatusOK)
+	var other Memory
+	if err := json.Unmarshal(rr.Body.Bytes(), &other); err != nil {
+		t.Fatalf("Failed to decode memory: %v", err)
+	}
+	runChat(t, &FunctionCall{Name: "forget", Args: map[string]interface{}{"id": float64(other.ID)}})
+	if !strings.Contains(lastResponse, "not found") || len(listMemories(t, "otherWs")) != 1 {
+		t.Errorf("Expected the memory of another workspace to be kept, got %s", lastResponse)
+	}
+
+	runChat(t, &FunctionCall{Name: "forget", Args: map[string]interface{}{"id": float64(memories[0].ID)}})
+	if memories := listMemories(t, "memWs"); len(memories) != 0 {
+		t.Errorf("Expected the memory to be forgotten, got %+v (%s)", memories, lastResponse)
+	}
+
+	testRequest(t, router, "DELETE", fmt.Sprintf("/api/memories/%d", other.ID), nil, http.StatusOK)
+	testRequest(t, router, "DELETE", fmt.Sprintf("/api/memories/%d", other.ID), nil, http.StatusNotFound)
+	testRequest(t, router, "POST", "/api/memories", []byte(`{"workspaceId": "memWs", "content": " "}`), http.StatusBadRequest)
+}
@@ -1,14 +1,22 @@
 package test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"math"
 	"net/http"
 	"strings"
 	"testing"
 
+	"github.com/gorilla/mux"
+
 	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
 	"github.com/lifthrasiir/angel/internal/server"
 	. "github.com/lifthrasiir/angel/internal/types"
 )
@@ -202,3 +210,235 @@ func TestDeleteMCPConfigHandler(t *testing.T) {
 	})
 
 }
+
+// TestTokenUsageHandler tests that token usage is recorded per LLM call and aggregated with estimated costs
+func TestTokenUsageHandler(t *testing.T) {
+	router, testDB, _ := setupTest(t)
+
+	if err := database.CreateWorkspace(testDB, "usageWs", "Usage Workspace", ""); err != nil {
+		t.Fatalf("Failed to create workspace: %v", err)
+	}
+	sessionId := "usageSession"
+	sdb, _, err := database.CreateSession(testDB, sessionId, "System prompt", "usageWs")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer sdb.Close()
+
+	MockLLMProviderForTests.SendMessageStreamFunc = func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+		return func(yield func(GenerateContentResponse) bool) {
+			yield(GenerateContentResponse{
+				Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{{Text: "Answer"}}}}},
+				UsageMetadata: &UsageMetadata{
+					PromptTokenCount:        1_000_000,
+					CandidatesTokenCount:    100_000,
+					ThoughtsTokenCount:      100_000,
+					CachedContentTokenCount: 500_000,
+				},
+			})
+		}, io.NopCloser(nil), nil
+	}
+
+	payload := []byte(fmt.Sprintf(`{"message": "Question", "model": "%s"}`, DefaultGeminiModel))
+	testRequest(t, router, "POST", "/api/chat/"+sessionId, payload, http.StatusOK)
+
+	// The usage is also attached to the model message
+	var thoughtsTokens int
+	querySingleRow(t, sdb, "SELECT json_extract(aux, '$.usage.thoughtsTokens') FROM S.messages WHERE type = 'model' ORDER BY id DESC LIMIT 1", nil, &thoughtsTokens)
+	if thoughtsTokens != 100_000 {
+		t.Errorf("Expected 100000 thought tokens in the model message, got %d", thoughtsTokens)
+	}
+
+	// Subsessions count towards their main session and workspace
+	if _, err := database.InsertTokenUsage(testDB, TokenUsage{
+		SessionID: sessionId + ".sub", Model: "unknown-model", Kind: TokenUsageSubagent, PromptTokens: 10, CandidatesTokens: 5,
+	}); err != nil {
+		t.Fatalf("Failed to insert token usage: %v", err)
+	}
+
+	getSummaries := func(query string) []TokenUsageSummary {
+		rr := testRequest(t, router, "GET", "/api/usage?"+query, nil, http.StatusOK)
+		var summaries []TokenUsageSummary
+		if err := json.Unmarshal(rr.Body.Bytes(), &summaries); err != nil {
+			t.Fatalf("Failed to decode usage summaries: %v", err)
+		}
+		return summaries
+	}
+
+	// gemini-2.5-flash: 0.5M uncached input at $0.30, 0.5M cached input at $0.03 and 0.2M output at $2.50
+	const expectedCost = 0.665
+
+	for _, groupBy := range []string{"session", "workspace"} {
+		summaries := getSummaries("groupBy=" + groupBy)
+		if len(summaries) != 1 {
+			t.Fatalf("Expected a single summary grouped by %s, got %+v", groupBy, summaries)
+		}
+		summary := summaries[0]
+		if expectedKey := map[string]string{"session": sessionId, "workspace": "usageWs"}[groupBy]; summary.Key != expectedKey {
+			t.Errorf("Expected key %q grouped by %s, got %q", expectedKey, groupBy, summary.Key)
+		}
+		if summary.Calls != 2 || summary.UnpricedCalls != 1 || summary.PromptTokens != 1_000_010 || summary.CachedTokens != 500_000 {
+			t.Errorf("Unexpected summary grouped by %s: %+v", groupBy, summary)
+		}
+		if math.Abs(summary.Cost-expectedCost) > 1e-9 {
+			t.Errorf("Expected cost %v grouped by %s, got %v", expectedCost, groupBy, summary.Cost)
+		}
+	}
+
+	summaries := getSummaries("groupBy=model&sessionId=" + sessionId + "&kind=chat")
+	if len(summaries) != 1 || summaries[0].Key != DefaultGeminiModel || summaries[0].UnpricedCalls != 0 {
+		t.Errorf("Unexpected summaries grouped by model: %+v", summaries)
+	}
+
+	summaries = getSummaries("groupBy=day&workspaceId=otherWs")
+	if len(summaries) != 0 {
+		t.Errorf("Expected no usage for another workspace, got %+v", summaries)
+	}
+
+	testRequest(t, router, "GET", "/api/usage?groupBy=month", nil, http.StatusBadRequest)
+	testRequest(t, router, "GET", "/api/usage?since=yesterday", nil, http.StatusBadRequest)
+}
+
+// TestRecordAndReplayToolLoop tests that a recorded tool loop is replayed through the chat API without the original provider
+func TestRecordAndReplayToolLoop(t *testing.T) {
+	// Calls a tool first, then answers once the function response is available
+	toolLoopProvider := &llm.MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			last := params.Contents[len(params.Contents)-1]
+			part := Part{FunctionCall: &FunctionCall{Name: "no_such_tool", Args: map[string]interface{}{"path": "a.txt"}}}
+			if len(last.Parts) > 0 && last.Parts[0].FunctionResponse != nil {
+				part = Part{Text: "All done"}
+			}
+			return func(yield func(GenerateContentResponse) bool) {
+				yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{part}}}}})
+			}, io.NopCloser(nil), nil
+		},
+		GenerateContentOneShotFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (llm.OneShotResult, error) {
+			return llm.OneShotResult{Text: "Tool loop"}, nil
+		},
+	}
+
+	runChat := func(t *testing.T, router *mux.Router) (events []string) {
+		payload := []byte(`{"message": "Read a.txt", "workspaceId": "replayWs"}`)
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", payload, http.StatusOK)
+		defer resp.Body.Close()
+		for event := range parseSseStream(t, resp) {
+			switch event.Type {
+			case EventFunctionCall, EventFunctionResponse, EventModelMessage, EventSessionName, EventError:
+				// Strip message and session IDs, which may differ between runs
+				_, payload, _ := strings.Cut(event.Payload, "\n")
+				events = append(events, fmt.Sprintf("%c:%s", event.Type, payload))
+			}
+		}
+		return events
+	}
+
+	var recording bytes.Buffer
+	var recorded []string
+	t.Run("Record", func(t *testing.T) {
+		router, db, models := setupTest(t)
+		database.CreateWorkspace(db, "replayWs", "Replay Workspace", "")
+		models.SetLLMProviderWrapper(llm.NewRecorder(&recording).Wrap)
+		models.SetLLMProvider("", toolLoopProvider)
+		recorded = runChat(t, router)
+	})
+	if len(recorded) < 4 || !strings.Contains(strings.Join(recorded, "|"), "All done") {
+		t.Fatalf("Unexpected recorded events: %q", recorded)
+	}
+
+	t.Run("Replay", func(t *testing.T) {
+		replay, err := llm.NewReplayProvider(&recording)
+		if err != nil {
+			t.Fatalf("Failed to load recording: %v", err)
+		}
+		router, db, models := setupTest(t)
+		database.CreateWorkspace(db, "replayWs", "Replay Workspace", "")
+		models.SetLLMProvider("", &llm.MockLLMProvider{}) // Fails all calls unless replayed
+		models.SetLLMProviderWrapper(func(llm.LLMProvider) llm.LLMProvider { return replay })
+
+		replayed := runChat(t, router)
+		if strings.Join(replayed, "|") != strings.Join(recorded, "|") {
+			t.Errorf("Replayed events differ:\nrecorded: %q\nreplayed: %q", recorded, replayed)
+		}
+	})
+}
+
+// wordEmbedder embeds texts by the presence of a few words, so that pets and food are far apart
+type wordEmbedder struct {
+	*llm.MockLLMProvider
+}
+
+func (e *wordEmbedder) Embed(ctx context.Context, modelName string, params llm.EmbedParams) ([][]float32, error) {
+	var embeddings [][]float32
+	for _, text := range params.Texts {
+		text = strings.ToLower(text)
+		embedding := []float32{0.1, 0.1}
+		for _, word := range []string{"cat", "kitten", "dog", "puppy"} {
+			if strings.Contains(text, word) {
+				embedding[0] += 1
+			}
+		}
+		for _, word := range []string{"pasta", "soup"} {
+			if strings.Contains(text, word) {
+				embedding[1] += 1
+			}
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, nil
+}
+
+// TestSearchEmbeddingHandlers tests embedding settings and the hybrid search mode
+func TestSearchEmbeddingHandlers(t *testing.T) {
+	router, db, models := setupTest(t)
+	models.SetLLMProvider("embed", &wordEmbedder{MockLLMProviderForTests})
+
+	testRequest(t, router, "PUT", "/api/search/embedding", []byte(`{"provider":"nonexistent","model":"m"}`), http.StatusBadRequest)
+	testRequest(t, router, "PUT", "/api/search/embedding", []byte(`{"provider":"embed"}`), http.StatusBadRequest)
+	testRequest(t, router, "PUT", "/api/search/embedding", []byte(`{"provider":"embed","model":"words"}`), http.StatusOK)
+
+	rr := testRequest(t, router, "GET", "/api/search/embedding", nil, http.StatusOK)
+	var settings EmbeddingSettings
+	if err := json.Unmarshal(rr.Body.Bytes(), &settings); err != nil {
+		t.Fatalf("Failed to unmarshal settings: %v", err)
+	}
+	if settings.Provider != "embed" || settings.Model != "words" {
+		t.Errorf("Unexpected embedding settings: %+v", settings)
+	}
+
+	if _, err := db.Exec("INSERT INTO sessions (id, name, workspace_id) VALUES ('s1', 'Pets', '')"); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	for i, text := range []string{"My kitten chased a puppy", "Boil the pasta for ten minutes", "The cat sleeps all day"} {
+		_, err := db.Exec("INSERT INTO messages_searchable (text, session_id, workspace_id, message_id, type, created_at) VALUES (?, 's1', '', ?, 'user', '2025-01-01 00:00:00')", text, i+1)
+		if err != nil {
+			t.Fatalf("Failed to insert message: %v", err)
+		}
+	}
+	for _, table := range []string{"message_stems", "message_trigrams"} {
+		_, err := db.Exec(fmt.Sprintf("INSERT INTO %s (rowid, text, session_id, workspace_id) SELECT id, text, session_id, workspace_id FROM messages_searchable", table))
+		if err != nil {
+			t.Fatalf("Failed to populate %s: %v", table, err)
+		}
+	}
+
+	embedded, err := llm.IndexMessageEmbeddings(database.ContextWith(context.Background(), db), db, models, 100)
+	if err != nil || embedded != 3 {
+		t.Fatalf("Expected 3 embedded messages, got %d (%v)", embedded, err)
+	}
+
+	rr = testRequest(t, router, "POST", "/api/search", []byte(`{"query":"cat","mode":"hybrid"}`), http.StatusOK)
+	var response server.SearchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal search response: %v", err)
+	}
+	var texts []string
+	for _, result := range response.Results {
+		texts = append(texts, result.Excerpt)
+	}
+	if len(texts) != 3 || !strings.Contains(texts[0], "<mark>cat</mark>") || !strings.Contains(texts[1], "kitten") {
+		t.Errorf("Expected the keyword match followed by the semantic match, got %q", texts)
+	}
+
+	testRequest(t, router, "POST", "/api/search", []byte(`{"query":"cat","mode":"unknown"}`), http.StatusBadRequest)
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/chat"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestQueuedMessages tests queueing user messages while a call is active
+func TestQueuedMessages(t *testing.T) {
+	router, _, models := setupTest(t)
+
+	// The first call is held until released, so that subsequent messages get queued
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var received []string
+	models.SetLLMProvider("", &llm.MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			text := params.Contents[len(params.Contents)-1].Parts[0].Text
+			mu.Lock()
+			received = append(received, text)
+			first := len(received) == 1
+			mu.Unlock()
+			return func(yield func(GenerateContentResponse) bool) {
+				if first {
+					select {
+					case <-release:
+					case <-ctx.Done():
+						return
+					}
+				}
+				yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{{Text: "Reply to " + text}}}}}})
+			}, io.NopCloser(nil), nil
+		},
+	})
+
+	sessionIdCh := make(chan string, 1)
+	firstDone := make(chan struct{})
+	var sentFromQueue []string
+	go func() {
+		defer close(firstDone)
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", []byte(`{"message": "First"}`), http.StatusOK)
+		defer resp.Body.Close()
+		for event := range parseSseStream(t, resp) {
+			switch event.Type {
+			case EventInitialState:
+				var initialState chat.InitialState
+				if err := json.Unmarshal([]byte(event.Payload), &initialState); err != nil {
+					t.Errorf("Failed to unmarshal initial state: %v", err)
+				}
+				sessionIdCh <- initialState.SessionId
+			case EventQueuedMessageSent:
+				_, payload, _ := strings.Cut(event.Payload, "\n")
+				var message FrontendMessage
+				if err := json.Unmarshal([]byte(payload), &message); err != nil {
+					t.Errorf("Failed to unmarshal queued message: %v", err)
+				} else if len(message.Parts) > 0 {
+					sentFromQueue = append(sentFromQueue, message.Parts[0].Text)
+				}
+			case EventError:
+				t.Errorf("Unexpected error event: %s", event.Payload)
+			}
+		}
+	}()
+
+	var sessionId string
+	select {
+	case sessionId = <-sessionIdCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the initial state")
+	}
+	for deadline := time.Now().Add(5 * time.Second); !chat.HasActiveCall(sessionId); {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the call to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Messages sent during the call are only queued
+	var queue []QueuedMessage
+	for _, text := range []string{"Second", "Third", "Fourth"} {
+		resp := testStreamingRequest(t, router, "POST", "/api/chat/"+sessionId, []byte(fmt.Sprintf(`{"message": %q}`, text)), http.StatusOK)
+		for event := range parseSseStream(t, resp) {
+			if event.Type != EventQueueChanged {
+				t.Fatalf("Unexpected event while queueing: %c %s", event.Type, event.Payload)
+			}
+			if err := json.Unmarshal([]byte(event.Payload), &queue); err != nil {
+				t.Fatalf("Failed to unmarshal queue: %v", err)
+			}
+		}
+		resp.Body.Close()
+	}
+	if len(queue) != 3 || queue[2].Text != "Fourth" {
+		t.Fatalf("Expected 3 queued messages, got %+v", queue)
+	}
+
+	testRequest(t, router, "PUT", fmt.Sprintf("/api/chat/%s/queue/%d", sessionId, queue[1].ID), []byte(`{"message": "Third edited"}`), http.StatusOK)
+	testRequest(t, router, "DELETE", fmt.Sprintf("/api/chat/%s/queue/%d", sessionId, queue[2].ID), nil, http.StatusOK)
+	testRequest(t, router, "DELETE", fmt.Sprintf("/api/chat/%s/queue/%d", sessionId, queue[2].ID), nil, http.StatusNotFound)
+
+	rr := testRequest(t, router, "GET", fmt.Sprintf("/api/chat/%s/queue", sessionId), nil, http.StatusOK)
+	if err := json.Unmarshal(rr.Body.Bytes(), &queue); err != nil {
+		t.Fatalf("Failed to unmarshal queue: %v", err)
+	}
+	if len(queue) != 2 || queue[0].Text != "Second" || queue[1].Text != "Third edited" {
+		t.Fatalf("Unexpected queue after editing: %+v", queue)
+	}
+
+	// Queued messages are shown in the initial state
+	resp := testStreamingRequest(t, router, "GET", "/api/chat/"+sessionId, nil, http.StatusOK)
+	for event := range parseSseStream(t, resp) {
+		if event.Type == EventInitialState {
+			var initialState chat.InitialState
+			if err := json.Unmarshal([]byte(event.Payload), &initialState); err != nil {
+				t.Fatalf("Failed to unmarshal initial state: %v", err)
+			}
+			if len(initialState.QueuedMessages) != 2 {
+				t.Errorf("Expected queued messages in the initial state, got %+v", initialState.QueuedMessages)
+			}
+			break
+		}
+	}
+	resp.Body.Close()
+
+	// Queued messages are sent in order once the call finishes
+	close(release)
+	select {
+	case <-firstDone:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timeout waiting for queued messages to be sent")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(received, ",") != "First,Second,Third edited" {
+		t.Errorf("Unexpected messages sent to the model: %v", received)
+	}
+	if strings.Join(sentFromQueue, ",") != "Second,Third edited" {
+		t.Errorf("Unexpected messages sent from the queue: %v", sentFromQueue)
+	}
+	if chat.HasActiveCall(sessionId) {
+		t.Errorf("Expected the call to be finished")
+	}
+	rr = testRequest(t, router, "GET", fmt.Sprintf("/api/chat/%s/queue", sessionId), nil, http.StatusOK)
+	if strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("Expected the queue to be empty, got %s", rr.Body.String())
+	}
+}
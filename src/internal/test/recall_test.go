@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestRecallReferences tests recalling multiple hashes and messages of other sessions
+func TestRecallReferences(t *testing.T) {
+	router, db, models := setupTest(t)
+	database.CreateWorkspace(db, "recallWs", "Recall Workspace", "")
+	database.CreateWorkspace(db, "otherWs", "Other Workspace", "")
+
+	addSession := func(workspaceID, text string, attachments []FileAttachment) (string, int) {
+		sessionID := database.GenerateID()
+		sdb, branchID, err := database.CreateSession(db, sessionID, "", workspaceID)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		defer sdb.Close()
+		msgID, err := database.AddMessageToSession(context.Background(), sdb, Message{
+			LocalSessionID: sdb.LocalSessionId(), BranchID: branchID, Type: TypeUserText, Text: text, Attachments: attachments,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add message: %v", err)
+		}
+		return sessionID, msgID
+	}
+
+	attachmentData := []byte("attached notes")
+	sameSession, sameMsgID := addSession("recallWs", "Notes from the same workspace", []FileAttachment{
+		{FileName: "notes.txt", MimeType: "text/plain", Data: attachmentData},
+	})
+	otherSession, otherMsgID := addSession("otherWs", "Secret from another workspace", nil)
+
+	// Message IDs of search results are IDs of the search index
+	result, err := db.Exec("INSERT INTO messages_searchable (text, session_id, workspace_id, message_id, type) VALUES (?, ?, ?, ?, ?)",
+		"Notes from the same workspace", sameSession, "recallWs", sameMsgID, "user")
+	if err != nil {
+		t.Fatalf("Failed to index message: %v", err)
+	}
+	searchID, _ := result.LastInsertId()
+
+	// Calls recall with the query, then captures the function response
+	var query string
+	var response struct {
+		Response string `json:"response"`
+		Messages []struct {
+			Ref  string `json:"ref"`
+			Text string `json:"text"`
+		} `json:"messages"`
+		Errors []string `json:"errors"`
+		Error  string   `json:"error"`
+	}
+	var responseParts []Part
+	models.SetLLMProvider("", &llm.MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			part := Part{FunctionCall: &FunctionCall{Name: "recall", Args: map[string]interface{}{"query": query}}}
+			if last := params.Contents[len(params.Contents)-1]; len(last.Parts) > 0 && last.Parts[0].FunctionResponse != nil {
+				encoded, _ := json.Marshal(last.Parts[0].FunctionResponse.Response)
+				json.Unmarshal(encoded, &response)
+				responseParts = last.Parts
+				part = Part{Text: "Done"}
+			}
+			return func(yield func(GenerateContentResponse) bool) {
+				yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{part}}}}})
+			}, io.NopCloser(nil), nil
+		},
+	})
+	recall := func(t *testing.T, q string) {
+		query, responseParts = q, nil
+		response.Response, response.Messages, response.Errors, response.Error = "", nil, nil, ""
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", []byte(`{"message": "Recall", "workspaceId": "recallWs"}`), http.StatusOK)
+		defer resp.Body.Close()
+		for event := range parseSseStream(t, resp) {
+			if event.Type == EventError {
+				t.Fatalf("Unexpected error event: %s", event.Payload)
+			}
+		}
+		if responseParts == nil {
+			t.Fatalf("No function response for recall(%q)", q)
+		}
+	}
+
+	t.Run("Messages", func(t *testing.T) {
+		sameRef := fmt.Sprintf("%s:%d", sameSession, sameMsgID)
+		otherRef := fmt.Sprintf("%s:%d", otherSession, otherMsgID)
+		recall(t, fmt.Sprintf("%s, %d %s", sameRef, searchID, otherRef))
+
+		if len(response.Messages) != 2 {
+			t.Fatalf("Expected the message to be recalled twice, got %+v", response)
+		}
+		for _, message := range response.Messages {
+			if message.Ref != sameRef || message.Text != "Notes from the same workspace" {
+				t.Errorf("Unexpected recalled message: %+v", message)
+			}
+		}
+		if len(response.Errors) != 1 || response.Errors[0] != "message "+otherRef+" not found" {
+			t.Errorf("Expected the message of another workspace to be inaccessible, got %+v", response)
+		}
+
+		// Attachments of recalled messages follow the function response
+		inlineData := 0
+		for _, part := range responseParts {
+			if part.InlineData != nil {
+				inlineData++
+			}
+		}
+		if inlineData != 2 {
+			t.Errorf("Expected 2 recalled attachments, got %+v", responseParts)
+		}
+	})
+
+	t.Run("Hashes", func(t *testing.T) {
+		hash := database.BlobHash(attachmentData)
+		recall(t, hash+" "+strings.Repeat("0", 64))
+		if response.Response != fmt.Sprintf("Recalled content for hash %s follows:", hash) {
+			t.Errorf("Unexpected response: %+v", response)
+		}
+		if len(response.Errors) != 1 || !strings.Contains(response.Errors[0], "failed to retrieve content for hash") {
+			t.Errorf("Expected an error for the unknown hash, got %+v", response)
+		}
+	})
+
+	t.Run("AllFailed", func(t *testing.T) {
+		recall(t, fmt.Sprintf("%s:%d", otherSession, otherMsgID))
+		if !strings.Contains(response.Error, "not found") {
+			t.Errorf("Expected an error, got %+v", response)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/chat"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestResumeInterruptedTurn tests resuming turns which were still running when the server stopped
+func TestResumeInterruptedTurn(t *testing.T) {
+	textResponse := func(text string) iter.Seq[GenerateContentResponse] {
+		return func(yield func(GenerateContentResponse) bool) {
+			yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{{Text: text}}}}}})
+		}
+	}
+
+	// interruptedSession runs a turn and then makes it look like the server stopped in the middle of it
+	interruptedSession := func(t *testing.T, interrupt func(mc *database.MessageChain)) (router *mux.Router, db *database.Database, sessionId, branchId string, calls *[][]Content) {
+		router, db, models := setupTest(t)
+		calls = new([][]Content)
+		models.SetLLMProvider("", &llm.MockLLMProvider{
+			SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+				*calls = append(*calls, params.Contents)
+				return textResponse(fmt.Sprintf("Reply %d", len(*calls))), io.NopCloser(nil), nil
+			},
+		})
+
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", []byte(`{"message": "Hello"}`), http.StatusOK)
+		for event := range parseSseStream(t, resp) {
+			if event.Type == EventInitialState {
+				var initialState chat.InitialState
+				if err := json.Unmarshal([]byte(event.Payload), &initialState); err != nil {
+					t.Fatalf("Failed to unmarshal initial state: %v", err)
+				}
+				sessionId = initialState.SessionId
+				branchId = initialState.PrimaryBranchID
+			}
+		}
+		resp.Body.Close()
+
+		sdb, err := db.WithSession(sessionId)
+		if err != nil {
+			t.Fatalf("Failed to open session DB: %v", err)
+		}
+		defer sdb.Close()
+		mc, err := database.NewMessageChain(context.Background(), sdb, branchId)
+		if err != nil {
+			t.Fatalf("Failed to create message chain: %v", err)
+		}
+		interrupt(mc)
+		if err := database.RecordActiveCall(sdb, branchId); err != nil {
+			t.Fatalf("Failed to record active call: %v", err)
+		}
+		return router, db, sessionId, branchId, calls
+	}
+
+	loadInterrupted := func(t *testing.T, router *mux.Router, sessionId string) *chat.InterruptedTurn {
+		t.Helper()
+		resp := testStreamingRequest(t, router, "GET", "/api/chat/"+sessionId, nil, http.StatusOK)
+		defer resp.Body.Close()
+		for event := range parseSseStream(t, resp) {
+			if event.Type == EventInitialStateNoCall {
+				var initialState chat.InitialState
+				if err := json.Unmarshal([]byte(event.Payload), &initialState); err != nil {
+					t.Fatalf("Failed to unmarshal initial state: %v", err)
+				}
+				return initialState.Interrupted
+			}
+		}
+		t.Fatalf("No initial state received")
+		return nil
+	}
+
+	resume := func(t *testing.T, router *mux.Router, sessionId, branchId string) map[EventType][]string {
+		t.Helper()
+		events := make(map[EventType][]string)
+		resp := testStreamingRequest(t, router, "POST", fmt.Sprintf("/api/chat/%s/branch/%s/resume", sessionId, branchId), nil, http.StatusOK)
+		defer resp.Body.Close()
+		for event := range parseSseStream(t, resp) {
+			if event.Type == EventError {
+				t.Fatalf("Unexpected error event: %s", event.Payload)
+			}
+			events[event.Type] = append(events[event.Type], event.Payload)
+		}
+		return events
+	}
+
+	t.Run("PendingFunctionCall", func(t *testing.T) {
+		router, _, sessionId, branchId, calls := interruptedSession(t, func(mc *database.MessageChain) {
+			fcJson, _ := json.Marshal(FunctionCall{Name: "list_memories", Args: map[string]interface{}{}})
+			if _, err := mc.Add(Message{Type: TypeFunctionCall, Text: string(fcJson)}); err != nil {
+				t.Fatalf("Failed to add function call: %v", err)
+			}
+		})
+
+		interrupted := loadInterrupted(t, router, sessionId)
+		if interrupted == nil || interrupted.BranchID != branchId || interrupted.PendingFunction != "list_memories" {
+			t.Fatalf("Expected an interrupted turn with a pending function, got %+v", interrupted)
+		}
+
+		events := resume(t, router, sessionId, branchId)
+		if len(events[EventFunctionResponse]) != 1 || !strings.Contains(events[EventFunctionResponse][0], "\nlist_memories\n") {
+			t.Errorf("Expected the pending function to be re-run, got %v", events[EventFunctionResponse])
+		}
+		if len(*calls) != 2 {
+			t.Fatalf("Expected 2 LLM calls, got %d", len(*calls))
+		}
+		contents := (*calls)[1]
+		last := contents[len(contents)-1]
+		if last.Role != RoleUser || len(last.Parts) == 0 || last.Parts[0].FunctionResponse == nil {
+			t.Errorf("Expected the LLM loop to continue from the function response, got %+v", last)
+		}
+
+		if interrupted := loadInterrupted(t, router, sessionId); interrupted != nil {
+			t.Errorf("Expected no interrupted turn after resuming, got %+v", interrupted)
+		}
+		testRequest(t, router, "POST", fmt.Sprintf("/api/chat/%s/branch/%s/resume", sessionId, branchId), nil, http.StatusNotFound)
+	})
+
+	t.Run("PartialModelMessage", func(t *testing.T) {
+		var modelMessageID int
+		router, _, sessionId, branchId, calls := interruptedSession(t, func(mc *database.MessageChain) {
+			modelMessageID = mc.LastMessageID
+		})
+
+		interrupted := loadInterrupted(t, router, sessionId)
+		if interrupted == nil || interrupted.PendingFunction != "" {
+			t.Fatalf("Expected an interrupted turn without a pending function, got %+v", interrupted)
+		}
+
+		events := resume(t, router, sessionId, branchId)
+		if len(*calls) != 2 {
+			t.Fatalf("Expected 2 LLM calls, got %d", len(*calls))
+		}
+		if len(events[EventModelMessage]) == 0 {
+			t.Fatalf("Expected model messages on resume, got %v", events)
+		}
+		// The partial model message is continued in place
+		for _, payload := range events[EventModelMessage] {
+			if id, _, _ := strings.Cut(payload, "\n"); id != fmt.Sprint(modelMessageID) {
+				t.Errorf("Expected model message %d to be continued, got %v", modelMessageID, events[EventModelMessage])
+			}
+		}
+		if interrupted := loadInterrupted(t, router, sessionId); interrupted != nil {
+			t.Errorf("Expected no interrupted turn after resuming, got %+v", interrupted)
+		}
+	})
+
+	t.Run("StartupScan", func(t *testing.T) {
+		router, db, sessionId, branchId, _ := interruptedSession(t, func(mc *database.MessageChain) {})
+
+		sdb, err := db.WithSession(sessionId)
+		if err != nil {
+			t.Fatalf("Failed to open session DB: %v", err)
+		}
+		defer sdb.Close()
+		now := time.Now().Unix()
+		for _, cmd := range []ShellCommand{
+			{ID: "before", BranchID: branchId, Command: "sleep 100", Status: "running", StartTime: now - 60},
+			{ID: "after", BranchID: branchId, Command: "sleep 100", Status: "running", StartTime: now + 60},
+		} {
+			if err := database.InsertShellCommand(sdb, cmd); err != nil {
+				t.Fatalf("Failed to insert shell command: %v", err)
+			}
+		}
+
+		if err := chat.InterruptedCallsJob(db).First(); err != nil {
+			t.Fatalf("Interrupted call detection failed: %v", err)
+		}
+
+		// Only commands started before the scan are from the previous process
+		for id, expected := range map[string]string{"before": "failed_on_startup", "after": "running"} {
+			cmd, err := database.GetShellCommandByID(sdb, id)
+			if err != nil {
+				t.Fatalf("Failed to get shell command %s: %v", id, err)
+			}
+			if cmd.Status != expected {
+				t.Errorf("Expected shell command %s to be %s, got %s", id, expected, cmd.Status)
+			}
+		}
+		// Interrupted turns are kept for resuming
+		if interrupted := loadInterrupted(t, router, sessionId); interrupted == nil || interrupted.BranchID != branchId {
+			t.Errorf("Expected the interrupted turn to remain, got %+v", interrupted)
+		}
+	})
+
+	t.Run("NotInterrupted", func(t *testing.T) {
+		router, _, _ := setupTest(t)
+		testRequest(t, router, "POST", "/api/chat/nonexistent/branch/nonexistent/resume", nil, http.StatusNotFound)
+	})
+}
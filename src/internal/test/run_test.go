@@ -0,0 +1,59 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+	"testing"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/chat"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestRunSession tests the headless run API
+func TestRunSession(t *testing.T) {
+	router, _, models := setupTest(t)
+
+	calls := 0
+	models.SetLLMProvider("", &llm.MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			calls++
+			parts := []Part{{Text: "Let me check. "}, {FunctionCall: &FunctionCall{Name: "list_memories", Args: map[string]interface{}{}}}}
+			if calls > 1 {
+				parts = []Part{{Text: "There are "}, {Text: "no memories."}}
+			}
+			return func(yield func(GenerateContentResponse) bool) {
+				yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: parts}}}})
+			}, io.NopCloser(nil), nil
+		},
+	})
+
+	rr := testRequest(t, router, "POST", "/api/run", []byte(`{"message": "What do you remember?"}`), http.StatusOK)
+	var result chat.RunResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal run result: %v", err)
+	}
+
+	if result.SessionID == "" {
+		t.Errorf("Expected the session ID of the run")
+	}
+	if result.Text != "There are no memories." {
+		t.Errorf("Expected the final text only, got %q", result.Text)
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Name != "list_memories" || result.ToolCalls[0].Response == nil {
+		t.Errorf("Expected a tool call with its response, got %+v", result.ToolCalls)
+	}
+	if result.Error != "" {
+		t.Errorf("Unexpected error: %s", result.Error)
+	}
+
+	// The session is kept like any other session
+	testRequest(t, router, "GET", "/api/chat/"+result.SessionID, nil, http.StatusOK)
+
+	testRequest(t, router, "POST", "/api/run", []byte(`{"message": " "}`), http.StatusBadRequest)
+	testRequest(t, router, "POST", "/api/run", []byte(`{"message": "Hello", "workspaceId": "nonexistent"}`), http.StatusNotFound)
+}
@@ -0,0 +1,236 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/chat"
+	"github.com/lifthrasiir/angel/internal/llm"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestParseSchedule tests parsing cron-like schedules and computing their next run times
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2025, time.January, 15, 10, 30, 45, 0, time.UTC) // Wednesday
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.January, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, time.January, 15, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2025, time.January, 16, 10, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, time.January, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 6,7", time.Date(2025, time.January, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day of month or day of week matches if both are restricted
+		{"0 0 20 * 5", time.Date(2025, time.January, 17, 0, 0, 0, 0, time.UTC)},
+		// No such date
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := chat.ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if next := schedule.Next(base); !next.Equal(tt.expected) {
+			t.Errorf("ParseSchedule(%q).Next() = %v, want %v", tt.expr, next, tt.expected)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@never"} {
+		if _, err := chat.ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) should have failed", expr)
+		}
+	}
+}
+
+// waitForScheduledRun waits until the latest run of the scheduled prompt finishes
+func waitForScheduledRun(t *testing.T, router *mux.Router, id int) ScheduledPromptRun {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		rr := testRequest(t, router, "GET", fmt.Sprintf("/api/schedules/%d/runs", id), nil, http.StatusOK)
+		var runs []ScheduledPromptRun
+		if err := json.Unmarshal(rr.Body.Bytes(), &runs); err != nil {
+			t.Fatalf("Failed to unmarshal runs: %v", err)
+		}
+		if len(runs) > 0 && runs[0].Status != ScheduledRunRunning {
+			return runs[0]
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Scheduled prompt %d did not finish in time", id)
+	return ScheduledPromptRun{}
+}
+
+// TestScheduledPrompts tests the scheduled prompt API and running scheduled prompts
+func TestScheduledPrompts(t *testing.T) {
+	createScheduledPrompt := func(t *testing.T, router *mux.Router, body string) ScheduledPrompt {
+		t.Helper()
+		rr := testRequest(t, router, "POST", "/api/schedules", []byte(body), http.StatusOK)
+		var sp ScheduledPrompt
+		if err := json.Unmarshal(rr.Body.Bytes(), &sp); err != nil {
+			t.Fatalf("Failed to unmarshal scheduled prompt: %v", err)
+		}
+		return sp
+	}
+
+	t.Run("CRUD", func(t *testing.T) {
+		router, _, _ := setupTest(t)
+
+		testRequest(t, router, "POST", "/api/schedules", []byte(`{"name": "Bad", "schedule": "every day", "prompt": "Hi"}`), http.StatusBadRequest)
+		testRequest(t, router, "POST", "/api/schedules", []byte(`{"name": "Empty", "schedule": "@daily", "prompt": " "}`), http.StatusBadRequest)
+		testRequest(t, router, "POST", "/api/schedules", []byte(`{"name": "Typo", "schedule": "@daily", "prompt": "Hi", "tools": ["list_memorys"]}`), http.StatusBadRequest)
+		testRequest(t, router, "POST", "/api/schedules", []byte(`{"name": "Orphan", "schedule": "@daily", "prompt": "Hi", "sessionId": "nonexistent"}`), http.StatusBadRequest)
+
+		sp := createScheduledPrompt(t, router, `{"name": "Digest", "schedule": "0 9 * * *", "prompt": "Summarize the day", "tools": ["list_memories"]}`)
+		if sp.ID == 0 || !sp.Enabled || sp.NextRunAt == nil || len(sp.Tools) != 1 {
+			t.Fatalf("Unexpected scheduled prompt: %+v", sp)
+		}
+		if sp.NextRunAt.Hour() != 9 || sp.NextRunAt.Minute() != 0 {
+			t.Errorf("Expected the next run at 9:00, got %v", sp.NextRunAt)
+		}
+
+		rr := testRequest(t, router, "PUT", fmt.Sprintf("/api/schedules/%d", sp.ID),
+			[]byte(`{"name": "Digest", "schedule": "@weekly", "prompt": "Summarize the week", "enabled": false}`), http.StatusOK)
+		var updated ScheduledPrompt
+		if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+			t.Fatalf("Failed to unmarshal scheduled prompt: %v", err)
+		}
+		if updated.Schedule != "@weekly" || updated.Prompt != "Summarize the week" || updated.Enabled || updated.NextRunAt != nil || len(updated.Tools) != 0 {
+			t.Errorf("Unexpected updated scheduled prompt: %+v", updated)
+		}
+
+		rr = testRequest(t, router, "GET", "/api/schedules", nil, http.StatusOK)
+		var prompts []ScheduledPrompt
+		if err := json.Unmarshal(rr.Body.Bytes(), &prompts); err != nil {
+			t.Fatalf("Failed to unmarshal scheduled prompts: %v", err)
+		}
+		if len(prompts) != 1 || prompts[0].ID != sp.ID {
+			t.Errorf("Expected 1 scheduled prompt, got %+v", prompts)
+		}
+
+		testRequest(t, router, "DELETE", fmt.Sprintf("/api/schedules/%d", sp.ID), nil, http.StatusOK)
+		testRequest(t, router, "GET", fmt.Sprintf("/api/schedules/%d", sp.ID), nil, http.StatusNotFound)
+		testRequest(t, router, "GET", fmt.Sprintf("/api/schedules/%d/runs", sp.ID), nil, http.StatusNotFound)
+	})
+
+	t.Run("RunNewSession", func(t *testing.T) {
+		router, _, models := setupTest(t)
+
+		var declared []string
+		models.SetLLMProvider("", &llm.MockLLMProvider{
+			SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+				tools, err := tool.FromContext(ctx)
+				if err != nil {
+					return nil, nil, err
+				}
+				declared = nil
+				for _, t := range tools.ForGemini() {
+					for _, fd := range t.FunctionDeclarations {
+						declared = append(declared, fd.Name)
+					}
+				}
+				return func(yield func(GenerateContentResponse) bool) {
+					yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{{Text: "All tests pass."}}}}}})
+				}, io.NopCloser(nil), nil
+			},
+		})
+
+		sp := createScheduledPrompt(t, router, `{"name": "Nightly", "schedule": "0 3 * * *", "prompt": "Run go test", "tools": ["list_memories"]}`)
+		testRequest(t, router, "POST", fmt.Sprintf("/api/schedules/%d/run", sp.ID), []byte(`{}`), http.StatusOK)
+
+		run := waitForScheduledRun(t, router, sp.ID)
+		if run.Status != ScheduledRunSucceeded || run.SessionID == "" || run.FinishedAt == "" {
+			t.Fatalf("Expected a successful run with a new session, got %+v", run)
+		}
+		if len(declared) != 1 || declared[0] != "list_memories" {
+			t.Errorf("Expected only the allowed tool to be declared, got %v", declared)
+		}
+		testRequest(t, router, "GET", "/api/chat/"+run.SessionID, nil, http.StatusOK)
+	})
+
+	t.Run("RunExistingSession", func(t *testing.T) {
+		router, _, models := setupTest(t)
+
+		var calls [][]Content
+		models.SetLLMProvider("", &llm.MockLLMProvider{
+			SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+				calls = append(calls, params.Contents)
+				return func(yield func(GenerateContentResponse) bool) {
+					yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{{Text: "Done."}}}}}})
+				}, io.NopCloser(nil), nil
+			},
+		})
+
+		rr := testRequest(t, router, "POST", "/api/run", []byte(`{"message": "Hello"}`), http.StatusOK)
+		var result chat.RunResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to unmarshal run result: %v", err)
+		}
+
+		sp := createScheduledPrompt(t, router, fmt.Sprintf(`{"name": "Follow-up", "schedule": "@hourly", "prompt": "Any updates?", "sessionId": %q}`, result.SessionID))
+		testRequest(t, router, "POST", fmt.Sprintf("/api/schedules/%d/run", sp.ID), []byte(`{}`), http.StatusOK)
+
+		run := waitForScheduledRun(t, router, sp.ID)
+		if run.Status != ScheduledRunSucceeded || run.SessionID != result.SessionID {
+			t.Fatalf("Expected a successful run in the existing session, got %+v", run)
+		}
+		if len(calls) != 2 || len(calls[1]) != 3 {
+			t.Fatalf("Expected the prompt to continue the existing session, got %+v", calls)
+		}
+		if last := calls[1][2]; last.Role != RoleUser || last.Parts[0].Text != "Any updates?" {
+			t.Errorf("Expected the scheduled prompt as the last message, got %+v", last)
+		}
+	})
+
+	t.Run("FailureNotification", func(t *testing.T) {
+		router, _, models := setupTest(t)
+		models.SetLLMProvider("", &llm.MockLLMProvider{
+			SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+				return nil, nil, errors.New("quota exceeded")
+			},
+		})
+
+		sp := createScheduledPrompt(t, router, `{"name": "Broken", "schedule": "@daily", "prompt": "Hello"}`)
+
+		resp := testStreamingRequest(t, router, "GET", "/api/schedules/events", nil, http.StatusOK)
+		defer resp.Body.Close()
+
+		testRequest(t, router, "POST", fmt.Sprintf("/api/schedules/%d/run", sp.ID), []byte(`{}`), http.StatusOK)
+
+		for event := range parseSseStream(t, resp) {
+			if event.Type != EventScheduledRunFailed {
+				continue
+			}
+			name, runJSON, _ := strings.Cut(event.Payload, "\n")
+			var run ScheduledPromptRun
+			if err := json.Unmarshal([]byte(runJSON), &run); err != nil {
+				t.Fatalf("Failed to unmarshal run: %v", err)
+			}
+			if name != "Broken" || run.ScheduledPromptID != sp.ID || run.Status != ScheduledRunFailed || run.Error == "" {
+				t.Errorf("Unexpected failure notification: %s %+v", name, run)
+			}
+			break
+		}
+
+		if run := waitForScheduledRun(t, router, sp.ID); run.Status != ScheduledRunFailed {
+			t.Errorf("Expected the run to be recorded as failed, got %+v", run)
+		}
+	})
+}
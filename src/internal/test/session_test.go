@@ -4,14 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"iter"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/chat"
 	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
 	. "github.com/lifthrasiir/angel/internal/types"
 )
 
@@ -385,6 +389,92 @@ func TestUpdateSessionNameHandler(t *testing.T) {
 	})
 }
 
+// TestSessionGenParamsHandler tests per-session generation parameter overrides
+func TestSessionGenParamsHandler(t *testing.T) {
+	router, testDB, _ := setupTest(t)
+
+	sessionId := "testGenParamsSession"
+	sdb, primaryBranchID, err := database.CreateSession(testDB, sessionId, "System prompt", "default")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer sdb.Close()
+
+	var receivedParams llm.SessionParams
+	MockLLMProviderForTests.SendMessageStreamFunc = func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+		receivedParams = params
+		return iter.Seq[GenerateContentResponse](func(yield func(GenerateContentResponse) bool) {}), io.NopCloser(nil), nil
+	}
+
+	// Test case 1: No overrides by default
+	t.Run("Empty", func(t *testing.T) {
+		rr := testRequest(t, router, "GET", "/api/chat/"+sessionId+"/genParams", nil, http.StatusOK)
+		if body := strings.TrimSpace(rr.Body.String()); body != "{}" {
+			t.Errorf("Expected no overrides, got %s", body)
+		}
+	})
+
+	// Test case 2: Overrides are stored and merged over the model preset
+	t.Run("Success", func(t *testing.T) {
+		payload := []byte(`{"temperature": 0.3, "maxOutputTokens": 1024, "stopSequences": ["END"], "seed": 7}`)
+		testRequest(t, router, "PUT", "/api/chat/"+sessionId+"/genParams", payload, http.StatusOK)
+
+		rr := testRequest(t, router, "GET", "/api/chat/"+sessionId+"/genParams", nil, http.StatusOK)
+		var stored map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &stored); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if stored["maxOutputTokens"] != float64(1024) || stored["seed"] != float64(7) {
+			t.Errorf("Unexpected stored overrides: %v", stored)
+		}
+
+		msg := Message{LocalSessionID: sdb.LocalSessionId(), BranchID: primaryBranchID, Text: "Initial message", Type: "user", Model: DefaultGeminiModel}
+		if _, err := database.AddMessageToSession(context.Background(), sdb, msg); err != nil {
+			t.Fatalf("Failed to add initial message: %v", err)
+		}
+		payload = []byte(fmt.Sprintf(`{"message": "Another message", "model": "%s"}`, DefaultGeminiModel))
+		testRequest(t, router, "POST", "/api/chat/"+sessionId, payload, http.StatusOK)
+
+		genParams := receivedParams.GenParams
+		if genParams.Temperature == nil || *genParams.Temperature != 0.3 || genParams.MaxOutputTokens != 1024 || len(genParams.StopSequences) != 1 {
+			t.Errorf("Overrides were not passed to the provider: %+v", genParams)
+		}
+		if genParams.TopK == nil || *genParams.TopK != 64 {
+			t.Errorf("Expected topK from the model preset, got %v", genParams.TopK)
+		}
+	})
+
+	// Test case 3: Zero sampling parameters override non-zero presets
+	t.Run("ZeroTemperature", func(t *testing.T) {
+		testRequest(t, router, "PUT", "/api/chat/"+sessionId+"/genParams", []byte(`{"temperature": 0}`), http.StatusOK)
+		payload := []byte(fmt.Sprintf(`{"message": "Deterministic message", "model": "%s"}`, DefaultGeminiModel))
+		testRequest(t, router, "POST", "/api/chat/"+sessionId, payload, http.StatusOK)
+
+		if temperature := receivedParams.GenParams.Temperature; temperature == nil || *temperature != 0 {
+			t.Errorf("Expected zero temperature to be passed to the provider, got %v", temperature)
+		}
+	})
+
+	// Test case 4: Clearing overrides
+	t.Run("Clear", func(t *testing.T) {
+		testRequest(t, router, "PUT", "/api/chat/"+sessionId+"/genParams", []byte(`{}`), http.StatusOK)
+		paramsJSON, err := database.GetSessionGenParams(sdb)
+		if err != nil {
+			t.Fatalf("Failed to get session generation params: %v", err)
+		}
+		if paramsJSON != "" {
+			t.Errorf("Expected overrides to be removed, got %s", paramsJSON)
+		}
+	})
+
+	// Test case 5: Invalid values
+	t.Run("Invalid", func(t *testing.T) {
+		testRequest(t, router, "PUT", "/api/chat/"+sessionId+"/genParams", []byte(`{"mediaResolution": "ULTRA"}`), http.StatusBadRequest)
+		testRequest(t, router, "PUT", "/api/chat/"+sessionId+"/genParams", []byte(`{"stopSequences": [1]}`), http.StatusBadRequest)
+		testRequest(t, router, "PUT", "/api/chat/NonExistentSession/genParams", []byte(`{}`), http.StatusNotFound)
+	})
+}
+
 // TestDeleteSession tests the deleteSession function
 func TestDeleteSession(t *testing.T) {
 	router, testDB, _ := setupTestWithFilesystem(t)
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/chat"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestSteering tests steering notes posted while the model is running tools
+func TestSteering(t *testing.T) {
+	textResponse := func(text string) iter.Seq[GenerateContentResponse] {
+		return func(yield func(GenerateContentResponse) bool) {
+			yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{{Text: text}}}}}})
+		}
+	}
+
+	t.Run("WithFunctionResponse", func(t *testing.T) {
+		router, _, models := setupTest(t)
+
+		var calls [][]Content
+		models.SetLLMProvider("", &llm.MockLLMProvider{
+			SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+				calls = append(calls, params.Contents)
+				if len(calls) > 1 {
+					return textResponse("Done"), io.NopCloser(nil), nil
+				}
+				// The note is posted while the model is still working
+				if err := chat.SteerCall(params.SessionId, "Prefer tabs"); err != nil {
+					t.Errorf("Failed to steer the call: %v", err)
+				}
+				return func(yield func(GenerateContentResponse) bool) {
+					yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{
+						{FunctionCall: &FunctionCall{Name: "list_memories", Args: map[string]interface{}{}}},
+					}}}}})
+				}, io.NopCloser(nil), nil
+			},
+		})
+
+		var sessionId, steeringPayload string
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", []byte(`{"message": "Format the code"}`), http.StatusOK)
+		for event := range parseSseStream(t, resp) {
+			switch event.Type {
+			case EventInitialState:
+				var initialState chat.InitialState
+				if err := json.Unmarshal([]byte(event.Payload), &initialState); err != nil {
+					t.Fatalf("Failed to unmarshal initial state: %v", err)
+				}
+				sessionId = initialState.SessionId
+			case EventSteering:
+				steeringPayload = event.Payload
+			case EventError:
+				t.Fatalf("Unexpected error event: %s", event.Payload)
+			}
+		}
+		resp.Body.Close()
+
+		if _, text, _ := strings.Cut(steeringPayload, "\n"); text != "Prefer tabs" {
+			t.Errorf("Expected the steering note to be broadcast, got %q", steeringPayload)
+		}
+		if len(calls) != 2 {
+			t.Fatalf("Expected 2 LLM calls, got %d", len(calls))
+		}
+		checkSteered := func(contents []Content) {
+			t.Helper()
+			for _, content := range contents {
+				if len(content.Parts) > 0 && content.Parts[0].FunctionResponse != nil {
+					last := content.Parts[len(content.Parts)-1]
+					if content.Role != RoleUser || !strings.HasSuffix(last.Text, "\nPrefer tabs") {
+						t.Errorf("Expected the steering note along with the function response, got %+v", content)
+					}
+					return
+				}
+			}
+			t.Errorf("No function response found in %+v", contents)
+		}
+		checkSteered(calls[1])
+
+		// The note is persisted and delivered the same way in subsequent turns
+		resp = testStreamingRequest(t, router, "POST", "/api/chat/"+sessionId, []byte(`{"message": "Thanks"}`), http.StatusOK)
+		for event := range parseSseStream(t, resp) {
+			if event.Type == EventError {
+				t.Fatalf("Unexpected error event: %s", event.Payload)
+			}
+		}
+		resp.Body.Close()
+		if len(calls) != 3 {
+			t.Fatalf("Expected 3 LLM calls, got %d", len(calls))
+		}
+		checkSteered(calls[2])
+		for _, content := range calls[2] {
+			if content.Role == RoleUser && len(content.Parts) == 1 && strings.Contains(content.Parts[0].Text, "Prefer tabs") {
+				t.Errorf("Expected no separate content for the steering note, got %+v", calls[2])
+			}
+		}
+	})
+
+	t.Run("WithoutFunctionResponse", func(t *testing.T) {
+		router, _, models := setupTest(t)
+
+		var received []string
+		models.SetLLMProvider("", &llm.MockLLMProvider{
+			SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+				received = append(received, params.Contents[len(params.Contents)-1].Parts[0].Text)
+				if len(received) == 1 {
+					if err := chat.SteerCall(params.SessionId, "Too late"); err != nil {
+						t.Errorf("Failed to steer the call: %v", err)
+					}
+				}
+				return textResponse("Done"), io.NopCloser(nil), nil
+			},
+		})
+
+		// Notes without any function response to go along with are sent as queued messages
+		resp := testStreamingRequest(t, router, "POST", "/api/chat", []byte(`{"message": "Hello"}`), http.StatusOK)
+		for event := range parseSseStream(t, resp) {
+			if event.Type == EventError {
+				t.Fatalf("Unexpected error event: %s", event.Payload)
+			}
+		}
+		resp.Body.Close()
+		if strings.Join(received, ",") != "Hello,Too late" {
+			t.Errorf("Expected the steering note to be sent afterwards, got %v", received)
+		}
+	})
+
+	t.Run("NoActiveCall", func(t *testing.T) {
+		router, _, _ := setupTest(t)
+		testRequest(t, router, "POST", "/api/chat/nonexistent/steer", []byte(`{"message": "Hello"}`), http.StatusNotFound)
+		testRequest(t, router, "POST", "/api/chat/nonexistent/steer", []byte(`{"message": " "}`), http.StatusBadRequest)
+	})
+}
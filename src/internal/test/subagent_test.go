@@ -0,0 +1,73 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"iter"
+	"strings"
+	"testing"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/llm"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// TestSubagentStructuredOutput tests that the subagent itself is given the schema and re-prompted for invalid output
+func TestSubagentStructuredOutput(t *testing.T) {
+	router, _, models := setupTest(t)
+
+	schema := `{"type":"object","properties":{"answer":{"type":"integer"}},"required":["answer"]}`
+	var subagentMessages []string
+	var lastResponse map[string]interface{}
+	models.SetLLMProvider("", &llm.MockLLMProvider{
+		SendMessageStreamFunc: func(ctx context.Context, modelName string, params llm.SessionParams) (iter.Seq[GenerateContentResponse], io.Closer, error) {
+			last := params.Contents[len(params.Contents)-1]
+			var part Part
+			switch {
+			case params.SystemPrompt == "subagent":
+				subagentMessages = append(subagentMessages, last.Parts[0].Text)
+				if len(subagentMessages) == 1 {
+					part = Part{Text: "The answer is 42."}
+				} else {
+					part = Part{Text: "```json\n{\"answer\": 42}\n```"}
+				}
+			case last.Parts[0].FunctionResponse != nil:
+				lastResponse, _ = last.Parts[0].FunctionResponse.Response.(map[string]interface{})
+				part = Part{Text: "Done"}
+			default:
+				part = Part{FunctionCall: &FunctionCall{Name: "subagent", Args: map[string]interface{}{
+					"system_prompt":     "subagent",
+					"text":              "What is the answer?",
+					"structured_output": schema,
+				}}}
+			}
+			return func(yield func(GenerateContentResponse) bool) {
+				yield(GenerateContentResponse{Candidates: []Candidate{{Content: Content{Role: RoleModel, Parts: []Part{part}}}}})
+			}, io.NopCloser(nil), nil
+		},
+	})
+
+	resp := testStreamingRequest(t, router, "POST", "/api/chat", []byte(`{"message": "Ask the subagent"}`), 200)
+	defer resp.Body.Close()
+	for event := range parseSseStream(t, resp) {
+		if event.Type == EventError {
+			t.Fatalf("Unexpected error event: %s", event.Payload)
+		}
+	}
+
+	if len(subagentMessages) != 2 {
+		t.Fatalf("Expected the subagent to be prompted twice, got %q", subagentMessages)
+	}
+	if !strings.Contains(subagentMessages[0], "What is the answer?") || !strings.Contains(subagentMessages[0], schema) {
+		t.Errorf("Expected the schema in the subagent message, got %q", subagentMessages[0])
+	}
+	if !strings.Contains(subagentMessages[1], "The JSON is invalid") {
+		t.Errorf("Expected the subagent to be re-prompted with the validation error, got %q", subagentMessages[1])
+	}
+
+	output, _ := json.Marshal(lastResponse["structured_output"])
+	if string(output) != `{"answer":42}` || lastResponse["error"] != nil {
+		t.Errorf("Expected the validated structured output, got %v", lastResponse)
+	}
+}
@@ -0,0 +1,71 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// argsDigest returns a digest identifying the tool call arguments without storing them.
+func argsDigest(args map[string]interface{}) string {
+	data, err := json.Marshal(args) // Map keys are sorted, so equal arguments give equal digests
+	if err != nil {
+		return ""
+	}
+	return database.BlobHash(data)
+}
+
+// recordToolCall adds an audit entry for a finished tool call.
+// Failures are only logged, as auditing should never affect the tool call itself.
+func recordToolCall(ctx context.Context, fc FunctionCall, params HandlerParams, start time.Time, resultSize int, callErr error) {
+	db, err := database.FromContext(ctx)
+	if err != nil {
+		return // Not running inside the server (e.g. tests)
+	}
+
+	audit := ToolCallAudit{
+		SessionID:  params.SessionId,
+		BranchID:   params.BranchId,
+		ToolName:   fc.Name,
+		ArgsDigest: argsDigest(fc.Args),
+		StartedAt:  start.UnixMilli(),
+		DurationMs: time.Since(start).Milliseconds(),
+		ResultSize: resultSize,
+	}
+	var pending *PendingConfirmation
+	switch {
+	case errors.As(callErr, &pending):
+		audit.Confirmation = ConfirmationPending
+	case params.ConfirmationReceived:
+		audit.Confirmation = ConfirmationApproved
+	}
+	if callErr != nil && pending == nil {
+		audit.Error = callErr.Error()
+	}
+
+	if _, err := database.InsertToolCallAudit(db, audit); err != nil {
+		log.Printf("Failed to record tool call audit for %s: %v", fc.Name, err)
+	}
+}
+
+// RecordDenial adds an audit entry for a tool call whose confirmation was denied by the user.
+func RecordDenial(db *database.Database, fc FunctionCall, params HandlerParams) {
+	_, err := database.InsertToolCallAudit(db, ToolCallAudit{
+		SessionID:    params.SessionId,
+		BranchID:     params.BranchId,
+		ToolName:     fc.Name,
+		ArgsDigest:   argsDigest(fc.Args),
+		StartedAt:    time.Now().UnixMilli(),
+		Error:        "User denied tool execution",
+		Confirmation: ConfirmationDenied,
+	})
+	if err != nil {
+		log.Printf("Failed to record tool call denial for %s: %v", fc.Name, err)
+	}
+}
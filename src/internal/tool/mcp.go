@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
+	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/database"
 	. "github.com/lifthrasiir/angel/internal/types"
 )
@@ -25,8 +27,51 @@ type MCPConnection struct {
 	Config    MCPServerConfig
 	Session   *mcp.ClientSession
 	IsEnabled bool
+	Timeout   time.Duration // Timeout for each tool call
+
+	toolsMu sync.RWMutex
+	tools   []MCPTool
+}
+
+// MCPTool is a tool provided by an MCP server, with its input schema already converted for the Gemini API.
+type MCPTool struct {
+	Name        string
+	Description string
+	Parameters  *Schema
+}
+
+// Tools returns the tools of the MCP server as of the last refresh.
+func (c *MCPConnection) Tools() []MCPTool {
+	c.toolsMu.RLock()
+	defer c.toolsMu.RUnlock()
+	return c.tools
+}
+
+// refreshTools lists tools from the MCP server and converts their input schemas.
+// This is done once on connection and then whenever the server reports a change,
+// so that lossy conversions are not repeated (and warned about) for every request.
+func (c *MCPConnection) refreshTools(ctx context.Context, session *mcp.ClientSession) {
+	var tools []MCPTool
+	for tool, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			log.Printf("Failed to list tools from MCP server %s: %v", c.Config.Name, err)
+			return
+		}
+		tools = append(tools, MCPTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  ConvertJSONSchemaToGeminiSchema(c.Config.Name+"/"+tool.Name, tool.InputSchema),
+		})
+	}
+
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+	c.tools = tools
 }
 
+// DefaultMCPToolTimeout is used when an MCP config doesn't specify `timeout`.
+const DefaultMCPToolTimeout = 5 * time.Minute
+
 // init initializes MCP connections from database
 func (m *MCPManager) init(tools *Tools, db *database.Database) {
 	m.connections = make(map[string]*MCPConnection)
@@ -51,36 +96,52 @@ func (m *MCPManager) StartConnection(config MCPServerConfig) {
 	log.Printf("Attempting to connect to MCP server: %s", config.Name)
 
 	var connDetails struct {
-		Endpoint string `json:"endpoint"`
+		Endpoint string  `json:"endpoint"`
+		Timeout  float64 `json:"timeout"` // In seconds; negative disables the timeout
 	}
 	if err := json.Unmarshal(config.ConfigJSON, &connDetails); err != nil {
 		log.Printf("Error parsing MCP config for %s: %v", config.Name, err)
 		return
 	}
+	timeout := DefaultMCPToolTimeout
+	if connDetails.Timeout != 0 {
+		timeout = time.Duration(connDetails.Timeout * float64(time.Second))
+	}
 
-	ctx := context.Background()
 	transport := mcp.NewSSEClientTransport(connDetails.Endpoint, nil)
+	if err := m.connect(context.Background(), config, timeout, transport); err != nil {
+		log.Printf("Failed to connect to MCP server %s: %v", config.Name, err)
+		return
+	}
+	log.Printf("MCP connection '%s' to %s established.", config.Name, connDetails.Endpoint)
+}
+
+// connect connects to an MCP server over the transport and registers the connection
+func (m *MCPManager) connect(ctx context.Context, config MCPServerConfig, timeout time.Duration, transport mcp.Transport) error {
+	conn := &MCPConnection{
+		Config:    config,
+		IsEnabled: true,
+		Timeout:   timeout,
+	}
 
 	// The first argument to NewClient cannot be nil.
-	client := mcp.NewClient(&mcp.Implementation{}, nil)
+	client := mcp.NewClient(&mcp.Implementation{}, &mcp.ClientOptions{
+		ToolListChangedHandler: func(ctx context.Context, session *mcp.ClientSession, _ *mcp.ToolListChangedParams) {
+			conn.refreshTools(ctx, session)
+		},
+	})
 
 	session, err := client.Connect(ctx, transport)
 	if err != nil {
-		log.Printf("Failed to connect to MCP server %s: %v", config.Name, err)
-		return
+		return err
 	}
+	conn.Session = session
+	conn.refreshTools(ctx, session)
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
-
-	conn := &MCPConnection{
-		Config:    config,
-		Session:   session,
-		IsEnabled: true,
-	}
 	m.connections[config.Name] = conn
-
-	log.Printf("MCP connection '%s' to %s established.", config.Name, connDetails.Endpoint)
+	return nil
 }
 
 // StopConnection stops a connection to an MCP server
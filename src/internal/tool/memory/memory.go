@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// sessionWorkspace returns the database and the workspace ID of the current session.
+func sessionWorkspace(ctx context.Context, sessionID string) (*database.Database, string, error) {
+	db, err := database.FromContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	sdb, err := db.WithSession(sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get session DB: %w", err)
+	}
+	defer sdb.Close()
+
+	session, err := database.GetSession(sdb)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get current session: %w", err)
+	}
+	return db, session.WorkspaceID, nil
+}
+
+func memoryValue(m Memory) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         m.ID,
+		"content":    m.Content,
+		"created_at": m.CreatedAt,
+	}
+}
+
+// RememberTool handles the remember tool call.
+func RememberTool(ctx context.Context, args map[string]interface{}, params tool.HandlerParams) (tool.HandlerResults, error) {
+	if err := tool.EnsureKnownKeys("remember", args, "content"); err != nil {
+		return tool.HandlerResults{}, err
+	}
+	content, ok := args["content"].(string)
+	if !ok || strings.TrimSpace(content) == "" {
+		return tool.HandlerResults{}, fmt.Errorf("content must be a non-empty string")
+	}
+
+	db, workspaceID, err := sessionWorkspace(ctx, params.SessionId)
+	if err != nil {
+		return tool.HandlerResults{}, err
+	}
+	memory, err := database.AddMemory(db, workspaceID, strings.TrimSpace(content), params.SessionId)
+	if err != nil {
+		return tool.HandlerResults{}, err
+	}
+	return tool.HandlerResults{Value: map[string]interface{}{
+		"status":  "success",
+		"message": fmt.Sprintf("Memory stored with ID %d.", memory.ID),
+	}}, nil
+}
+
+// ForgetTool handles the forget tool call.
+func ForgetTool(ctx context.Context, args map[string]interface{}, params tool.HandlerParams) (tool.HandlerResults, error) {
+	if err := tool.EnsureKnownKeys("forget", args, "id"); err != nil {
+		return tool.HandlerResults{}, err
+	}
+	idValue, ok := args["id"].(float64)
+	if !ok || idValue != float64(int(idValue)) {
+		return tool.HandlerResults{}, fmt.Errorf("id must be an integer")
+	}
+	id := int(idValue)
+
+	db, workspaceID, err := sessionWorkspace(ctx, params.SessionId)
+	if err != nil {
+		return tool.HandlerResults{}, err
+	}
+	// Memories of other workspaces are treated as nonexistent
+	memory, err := database.GetMemory(db, id)
+	if err != nil || memory.WorkspaceID != workspaceID {
+		return tool.HandlerResults{}, fmt.Errorf("memory with ID %d not found", id)
+	}
+	if err := database.DeleteMemory(db, id); err != nil {
+		return tool.HandlerResults{}, err
+	}
+	return tool.HandlerResults{Value: map[string]interface{}{
+		"status":  "success",
+		"message": fmt.Sprintf("Memory with ID %d forgotten.", id),
+	}}, nil
+}
+
+// ListMemoriesTool handles the list_memories tool call.
+func ListMemoriesTool(ctx context.Context, args map[string]interface{}, params tool.HandlerParams) (tool.HandlerResults, error) {
+	if err := tool.EnsureKnownKeys("list_memories", args); err != nil {
+		return tool.HandlerResults{}, err
+	}
+
+	db, workspaceID, err := sessionWorkspace(ctx, params.SessionId)
+	if err != nil {
+		return tool.HandlerResults{}, err
+	}
+	memories, err := database.GetMemories(db, workspaceID)
+	if err != nil {
+		return tool.HandlerResults{}, err
+	}
+
+	values := []map[string]interface{}{}
+	for _, m := range memories {
+		values = append(values, memoryValue(m))
+	}
+	return tool.HandlerResults{Value: map[string]interface{}{"memories": values}}, nil
+}
+
+var rememberTool = tool.Definition{
+	Name: "remember",
+	Description: "Stores a long-term memory shared by all sessions in the current workspace. " +
+		"Use this for durable facts worth knowing in future sessions, such as user preferences, project conventions or decisions. " +
+		"Each memory should be a single self-contained statement. Do not store secrets or transient details.",
+	Parameters: &Schema{
+		Type: TypeObject,
+		Properties: map[string]*Schema{
+			"content": {
+				Type:        TypeString,
+				Description: "The statement to remember.",
+			},
+		},
+		Required: []string{"content"},
+	},
+	Handler: RememberTool,
+}
+
+var forgetTool = tool.Definition{
+	Name:        "forget",
+	Description: "Deletes a long-term memory of the current workspace that is wrong or no longer relevant. Use `list_memories` to find its ID.",
+	Parameters: &Schema{
+		Type: TypeObject,
+		Properties: map[string]*Schema{
+			"id": {
+				Type:        TypeInteger,
+				Description: "ID of the memory to delete.",
+			},
+		},
+		Required: []string{"id"},
+	},
+	Handler: ForgetTool,
+}
+
+var listMemoriesTool = tool.Definition{
+	Name:        "list_memories",
+	Description: "Lists all long-term memories of the current workspace with their IDs.",
+	Parameters: &Schema{
+		Type:       TypeObject,
+		Properties: map[string]*Schema{},
+	},
+	Handler: ListMemoriesTool,
+}
+
+var AllTools = []tool.Definition{
+	rememberTool,
+	forgetTool,
+	listMemoriesTool,
+}
@@ -0,0 +1,88 @@
+package tool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/lifthrasiir/angel/internal/database"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// DefaultMaxInlineResultSize is the default size in bytes of the JSON-encoded tool result
+// above which the result is offloaded to a blob.
+const DefaultMaxInlineResultSize = 64 * 1024
+
+// resultPreviewSize is the maximum size in bytes of the preview left in place of an offloaded result.
+// It is much smaller than the inline limit, as the preview only has to show what the result looks like.
+const resultPreviewSize = 4 * 1024
+
+// MaxInlineResultSizeConfigName is the app config key overriding DefaultMaxInlineResultSize.
+const MaxInlineResultSizeConfigName = "max_inline_tool_result_size"
+
+// SetMaxInlineResultSize sets the size limit for inline tool results. Zero or negative disables offloading.
+func (t *Tools) SetMaxInlineResultSize(size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxInlineResultSize = size
+}
+
+// MaxInlineResultSize returns the size limit for inline tool results.
+func (t *Tools) MaxInlineResultSize() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.maxInlineResultSize
+}
+
+// offloadLargeResult replaces an oversized results.Value, whose JSON encoding is payload, with a truncated preview,
+// moving the full JSON payload to an omitted attachment that can be retrieved with `recall`.
+// The attachment data is saved as a blob when the function response message is added.
+func offloadLargeResult(toolName string, results *HandlerResults, payload []byte, limit int) {
+	if limit <= 0 || results.Value == nil || len(payload) <= limit {
+		return
+	}
+
+	hash := database.BlobHash(payload)
+	preview := resultPreview(payload, min(limit, resultPreviewSize))
+	log.Printf("Offloading %d-byte result of tool '%s' to blob %s", len(payload), toolName, hash)
+
+	results.Value = map[string]interface{}{
+		"truncated":     true,
+		"preview":       preview,
+		"original_size": len(payload),
+		"hash":          hash,
+		"note":          fmt.Sprintf("The result was too large and has been truncated. Use recall(query='%s') to retrieve the full JSON result.", hash),
+	}
+	results.Attachments = append(results.Attachments, FileAttachment{
+		FileName: toolName + "-result.json",
+		MimeType: "application/json",
+		Hash:     hash,
+		Data:     payload,
+		Omitted:  true,
+	})
+}
+
+// resultPreview returns a prefix of the indented JSON payload of at most size bytes.
+// The prefix ends at an element boundary, or at a line boundary inside a long string, unless that loses too much.
+func resultPreview(payload []byte, size int) string {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, payload, "", " "); err == nil {
+		payload = indented.Bytes()
+	}
+	if len(payload) <= size {
+		return string(payload)
+	}
+
+	preview := payload[:size]
+	if i := bytes.LastIndexByte(preview, '\n'); i >= size/2 {
+		preview = preview[:i]
+	} else if i := bytes.LastIndex(preview, []byte(`\n`)); i >= size/2 {
+		preview = preview[:i]
+	}
+	for len(preview) > 0 && !utf8.Valid(preview) {
+		preview = preview[:len(preview)-1]
+	}
+	return string(preview)
+}
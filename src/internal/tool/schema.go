@@ -0,0 +1,540 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+
+	. "github.com/lifthrasiir/angel/gemini"
+)
+
+// jsonSchemaTypeToGeminiType converts JSON schema type to Gemini type
+func jsonSchemaTypeToGeminiType(jsonType string) Type {
+	switch jsonType {
+	case "string":
+		return TypeString
+	case "number":
+		return TypeNumber
+	case "integer":
+		return TypeInteger
+	case "boolean":
+		return TypeBoolean
+	case "array":
+		return TypeArray
+	case "object":
+		return TypeObject
+	case "null":
+		return TypeNull
+	default:
+		return TypeUnspecified
+	}
+}
+
+// ConvertJSONSchemaToGeminiSchema converts a jsonschema.Schema to a Gemini API compatible Schema.
+// `$ref`s are inlined, and any keyword that cannot be represented is logged as a warning under `name`.
+func ConvertJSONSchemaToGeminiSchema(name string, jsonSchema *jsonschema.Schema) *Schema {
+	schema, lossy := convertJSONSchemaToGeminiSchema(jsonSchema)
+	if len(lossy) > 0 {
+		log.Printf("Warning: Lossy schema conversion for %s: %s", name, strings.Join(lossy, "; "))
+	}
+	return schema
+}
+
+// ParseJSONSchema parses a JSON-encoded JSON schema and converts it to a Gemini API compatible Schema.
+func ParseJSONSchema(name string, data []byte) (*Schema, error) {
+	var jsonSchema jsonschema.Schema
+	if err := json.Unmarshal(data, &jsonSchema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema for %s: %w", name, err)
+	}
+	return ConvertJSONSchemaToGeminiSchema(name, &jsonSchema), nil
+}
+
+// OutputSchema is a JSON schema for structured output, used both to constrain a response and to validate it.
+type OutputSchema struct {
+	Schema   *Schema // Gemini API compatible form, to be used as a response schema
+	resolved *jsonschema.Resolved
+}
+
+// ParseOutputSchema parses a JSON-encoded JSON schema for structured output.
+func ParseOutputSchema(name string, data []byte) (*OutputSchema, error) {
+	var jsonSchema jsonschema.Schema
+	if err := json.Unmarshal(data, &jsonSchema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema for %s: %w", name, err)
+	}
+	schema := ConvertJSONSchemaToGeminiSchema(name, &jsonSchema)
+
+	// Only draft 2020-12 can be validated, and older drafts are close enough for typical output schemas
+	jsonSchema.Schema = ""
+	resolved, err := jsonSchema.Resolve(nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema for %s: %w", name, err)
+	}
+	return &OutputSchema{Schema: schema, resolved: resolved}, nil
+}
+
+// Validate parses text as JSON and validates it against the schema, returning the parsed value.
+// A surrounding Markdown code fence is ignored, as models tend to add one regardless of instructions.
+func (s *OutputSchema) Validate(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	if rest, ok := strings.CutPrefix(text, "```"); ok {
+		if _, body, found := strings.Cut(rest, "\n"); found {
+			if body, ok := strings.CutSuffix(strings.TrimSpace(body), "```"); ok {
+				text = body
+			}
+		}
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	if err := s.resolved.Validate(value); err != nil {
+		return nil, fmt.Errorf("response does not match the schema: %w", err)
+	}
+	return value, nil
+}
+
+// convertJSONSchemaToGeminiSchema converts a jsonschema.Schema and also returns
+// a list of notes describing what could not be converted faithfully.
+func convertJSONSchemaToGeminiSchema(jsonSchema *jsonschema.Schema) (*Schema, []string) {
+	if jsonSchema == nil {
+		return nil, nil
+	}
+	c := &schemaConverter{root: jsonSchema, inlining: make(map[string]bool)}
+	return c.convert(jsonSchema, "#"), c.lossy
+}
+
+// schemaConverter holds the state of a single JSON schema conversion.
+type schemaConverter struct {
+	root     *jsonschema.Schema
+	inlining map[string]bool // $ref targets currently being inlined, to break cycles
+	lossy    []string
+}
+
+func (c *schemaConverter) note(path string, format string, args ...interface{}) {
+	c.lossy = append(c.lossy, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (c *schemaConverter) convert(s *jsonschema.Schema, path string) *Schema {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return c.convertRef(s, path)
+	}
+
+	out := &Schema{
+		Title:         s.Title,
+		Description:   s.Description,
+		Format:        s.Format,
+		Pattern:       s.Pattern,
+		Minimum:       s.Minimum,
+		Maximum:       s.Maximum,
+		MinLength:     intToString(s.MinLength),
+		MaxLength:     intToString(s.MaxLength),
+		MinItems:      intToString(s.MinItems),
+		MaxItems:      intToString(s.MaxItems),
+		MinProperties: intToString(s.MinProperties),
+		MaxProperties: intToString(s.MaxProperties),
+		Required:      slices.Clone(s.Required),
+	}
+	nullable := false
+
+	// Handle Type; "null" in a type union becomes Nullable, and other unions become anyOf
+	types := s.Types
+	if s.Type != "" {
+		types = []string{s.Type}
+	}
+	var nonNullTypes []string
+	for _, t := range types {
+		if t == "null" {
+			nullable = true
+		} else {
+			nonNullTypes = append(nonNullTypes, t)
+		}
+	}
+	switch len(nonNullTypes) {
+	case 0:
+		if nullable {
+			out.Type = TypeNull
+			nullable = false
+		}
+	case 1:
+		out.Type = jsonSchemaTypeToGeminiType(nonNullTypes[0])
+	default:
+		for _, t := range nonNullTypes {
+			out.AnyOf = append(out.AnyOf, &Schema{Type: jsonSchemaTypeToGeminiType(t)})
+		}
+	}
+	for _, t := range nonNullTypes {
+		if jsonSchemaTypeToGeminiType(t) == TypeUnspecified {
+			c.note(path, "unknown type %q", t)
+		}
+	}
+
+	// Handle Enum and Const; Gemini only supports string enums
+	enum := s.Enum
+	if s.Const != nil {
+		enum = append(enum, *s.Const)
+	}
+	nonStringEnum := false
+	for _, v := range enum {
+		switch v := v.(type) {
+		case nil:
+			nullable = true
+		case string:
+			out.Enum = append(out.Enum, v)
+		default:
+			nonStringEnum = true
+			encoded, _ := json.Marshal(v)
+			out.Enum = append(out.Enum, string(encoded))
+		}
+	}
+	if nonStringEnum {
+		c.note(path, "non-string enum values converted to strings")
+	}
+
+	if len(s.Default) > 0 {
+		var def interface{}
+		if err := json.Unmarshal(s.Default, &def); err == nil {
+			out.Default = def
+		}
+	}
+	if len(s.Examples) > 0 {
+		out.Example = s.Examples[0]
+	}
+
+	if s.ExclusiveMinimum != nil && out.Minimum == nil {
+		out.Minimum = s.ExclusiveMinimum
+		c.note(path, "exclusiveMinimum approximated as minimum")
+	}
+	if s.ExclusiveMaximum != nil && out.Maximum == nil {
+		out.Maximum = s.ExclusiveMaximum
+		c.note(path, "exclusiveMaximum approximated as maximum")
+	}
+
+	// Handle Items and Properties recursively
+	out.Items = c.convert(s.Items, path+"/items")
+	if len(s.Properties) > 0 {
+		out.Properties = make(map[string]*Schema)
+		for _, key := range sortedKeys(s.Properties) {
+			out.Properties[key] = c.convert(s.Properties[key], path+"/properties/"+key)
+		}
+	}
+
+	// Infer the type from structural keywords when it is absent
+	if len(types) == 0 && len(s.AnyOf) == 0 && len(s.OneOf) == 0 && len(s.AllOf) == 0 {
+		switch {
+		case out.Properties != nil:
+			out.Type = TypeObject
+		case out.Items != nil:
+			out.Type = TypeArray
+		case out.Enum != nil && !nonStringEnum:
+			out.Type = TypeString
+		}
+	}
+
+	// Handle combinators
+	if len(s.AnyOf) > 0 {
+		nullable = c.convertUnion(out, s.AnyOf, path+"/anyOf") || nullable
+	}
+	if len(s.OneOf) > 0 {
+		c.note(path, "oneOf approximated as anyOf")
+		nullable = c.convertUnion(out, s.OneOf, path+"/oneOf") || nullable
+	}
+	if len(s.AllOf) > 1 {
+		c.note(path, "allOf merged into a single schema")
+	}
+	for i, sub := range s.AllOf {
+		mergeGeminiSchema(out, c.convert(sub, fmt.Sprintf("%s/allOf/%d", path, i)))
+	}
+
+	if nullable {
+		out.Nullable = &nullable
+	}
+
+	c.noteUnsupported(s, path)
+	return out
+}
+
+// convertUnion converts anyOf-like branches into out, folding `{"type": "null"}` branches
+// into nullability and a single remaining branch into out itself.
+func (c *schemaConverter) convertUnion(out *Schema, branches []*jsonschema.Schema, path string) (nullable bool) {
+	var converted []*Schema
+	for i, branch := range branches {
+		sub := c.convert(branch, fmt.Sprintf("%s/%d", path, i))
+		if sub == nil {
+			continue
+		}
+		if sub.Type == TypeNull && sub.Enum == nil && sub.Properties == nil {
+			nullable = true
+			continue
+		}
+		converted = append(converted, sub)
+	}
+	if len(converted) == 1 && out.Type == "" && out.AnyOf == nil {
+		mergeGeminiSchema(out, converted[0])
+	} else {
+		out.AnyOf = append(out.AnyOf, converted...)
+	}
+	return nullable
+}
+
+// convertRef inlines the target of a `$ref`, with sibling keywords taking precedence.
+func (c *schemaConverter) convertRef(s *jsonschema.Schema, path string) *Schema {
+	siblings := *s
+	siblings.Ref = ""
+	out := c.convert(&siblings, path)
+
+	target := c.resolveRef(s.Ref)
+	switch {
+	case target == nil:
+		c.note(path, "unresolvable $ref %q dropped", s.Ref)
+	case c.inlining[s.Ref]:
+		c.note(path, "recursive $ref %q truncated", s.Ref)
+		truncated := &Schema{Description: target.Description}
+		if target.Type != "" {
+			truncated.Type = jsonSchemaTypeToGeminiType(target.Type)
+		} else if len(target.Properties) > 0 {
+			truncated.Type = TypeObject
+		}
+		mergeGeminiSchema(out, truncated)
+	default:
+		c.inlining[s.Ref] = true
+		mergeGeminiSchema(out, c.convert(target, path))
+		delete(c.inlining, s.Ref)
+	}
+	return out
+}
+
+// resolveRef resolves a local `$ref` (`#` or a JSON pointer such as `#/$defs/Foo`) against the root schema.
+func (c *schemaConverter) resolveRef(ref string) *jsonschema.Schema {
+	if ref == "#" {
+		return c.root
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+
+	var tokens []string
+	for _, token := range strings.Split(ref[2:], "/") {
+		token, err := url.PathUnescape(token)
+		if err != nil {
+			return nil
+		}
+		token = strings.ReplaceAll(token, "~1", "/")
+		token = strings.ReplaceAll(token, "~0", "~")
+		tokens = append(tokens, token)
+	}
+
+	cur := c.root
+	for i := 0; i < len(tokens) && cur != nil; i++ {
+		next := func() string {
+			i++
+			if i < len(tokens) {
+				return tokens[i]
+			}
+			return ""
+		}
+		index := func(list []*jsonschema.Schema) *jsonschema.Schema {
+			n, err := strconv.Atoi(next())
+			if err != nil || n < 0 || n >= len(list) {
+				return nil
+			}
+			return list[n]
+		}
+
+		switch tokens[i] {
+		case "$defs":
+			cur = cur.Defs[next()]
+		case "definitions":
+			cur = cur.Definitions[next()]
+		case "properties":
+			cur = cur.Properties[next()]
+		case "items":
+			cur = cur.Items
+		case "additionalProperties":
+			cur = cur.AdditionalProperties
+		case "anyOf":
+			cur = index(cur.AnyOf)
+		case "oneOf":
+			cur = index(cur.OneOf)
+		case "allOf":
+			cur = index(cur.AllOf)
+		case "prefixItems":
+			cur = index(cur.PrefixItems)
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// noteUnsupported records keywords that have no Gemini counterpart.
+func (c *schemaConverter) noteUnsupported(s *jsonschema.Schema, path string) {
+	var dropped []string
+	if len(s.PrefixItems) > 0 {
+		dropped = append(dropped, "prefixItems")
+	}
+	if s.AdditionalItems != nil {
+		dropped = append(dropped, "additionalItems")
+	}
+	if s.UniqueItems {
+		dropped = append(dropped, "uniqueItems")
+	}
+	if s.Contains != nil {
+		dropped = append(dropped, "contains")
+	}
+	if s.UnevaluatedItems != nil {
+		dropped = append(dropped, "unevaluatedItems")
+	}
+	if s.MultipleOf != nil {
+		dropped = append(dropped, "multipleOf")
+	}
+	// `additionalProperties: false` and `true` are common and harmless for function calling
+	if s.AdditionalProperties != nil && !isBooleanSchema(s.AdditionalProperties) {
+		dropped = append(dropped, "additionalProperties")
+	}
+	if len(s.PatternProperties) > 0 {
+		dropped = append(dropped, "patternProperties")
+	}
+	if s.PropertyNames != nil {
+		dropped = append(dropped, "propertyNames")
+	}
+	if s.UnevaluatedProperties != nil && !isBooleanSchema(s.UnevaluatedProperties) {
+		dropped = append(dropped, "unevaluatedProperties")
+	}
+	if len(s.DependentRequired) > 0 {
+		dropped = append(dropped, "dependentRequired")
+	}
+	if len(s.DependentSchemas) > 0 {
+		dropped = append(dropped, "dependentSchemas")
+	}
+	if s.Not != nil && !isBooleanSchema(s) {
+		dropped = append(dropped, "not")
+	}
+	if s.If != nil || s.Then != nil || s.Else != nil {
+		dropped = append(dropped, "if/then/else")
+	}
+	if s.DynamicRef != "" {
+		dropped = append(dropped, "$dynamicRef")
+	}
+	for _, key := range sortedKeys(s.Extra) {
+		dropped = append(dropped, key)
+	}
+	if len(dropped) > 0 {
+		c.note(path, "unsupported keywords dropped: %s", strings.Join(dropped, ", "))
+	}
+}
+
+// isBooleanSchema reports whether s is the schema form of `true` (`{}`) or `false` (`{"not": {}}`).
+func isBooleanSchema(s *jsonschema.Schema) bool {
+	if isEmptySchema(s) {
+		return true
+	}
+	withoutNot := *s
+	withoutNot.Not = nil
+	return s.Not != nil && isEmptySchema(s.Not) && isEmptySchema(&withoutNot)
+}
+
+func isEmptySchema(s *jsonschema.Schema) bool {
+	b, err := json.Marshal(s)
+	return err == nil && string(b) == "{}"
+}
+
+// mergeGeminiSchema fills unset fields of dst from src, and unions properties and required fields.
+func mergeGeminiSchema(dst, src *Schema) {
+	if src == nil {
+		return
+	}
+	if dst.Type == "" {
+		dst.Type = src.Type
+	}
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Description == "" {
+		dst.Description = src.Description
+	}
+	if dst.Format == "" {
+		dst.Format = src.Format
+	}
+	if dst.Pattern == "" {
+		dst.Pattern = src.Pattern
+	}
+	if dst.Enum == nil {
+		dst.Enum = src.Enum
+	}
+	if dst.Default == nil {
+		dst.Default = src.Default
+	}
+	if dst.Example == nil {
+		dst.Example = src.Example
+	}
+	if dst.Items == nil {
+		dst.Items = src.Items
+	}
+	if dst.Nullable == nil {
+		dst.Nullable = src.Nullable
+	}
+	if dst.Minimum == nil {
+		dst.Minimum = src.Minimum
+	}
+	if dst.Maximum == nil {
+		dst.Maximum = src.Maximum
+	}
+	if dst.MinLength == "" {
+		dst.MinLength = src.MinLength
+	}
+	if dst.MaxLength == "" {
+		dst.MaxLength = src.MaxLength
+	}
+	if dst.MinItems == "" {
+		dst.MinItems = src.MinItems
+	}
+	if dst.MaxItems == "" {
+		dst.MaxItems = src.MaxItems
+	}
+	if dst.MinProperties == "" {
+		dst.MinProperties = src.MinProperties
+	}
+	if dst.MaxProperties == "" {
+		dst.MaxProperties = src.MaxProperties
+	}
+	dst.AnyOf = append(dst.AnyOf, src.AnyOf...)
+	for key, prop := range src.Properties {
+		if dst.Properties == nil {
+			dst.Properties = make(map[string]*Schema)
+		}
+		if _, exists := dst.Properties[key]; !exists {
+			dst.Properties[key] = prop
+		}
+	}
+	for _, req := range src.Required {
+		if !slices.Contains(dst.Required, req) {
+			dst.Required = append(dst.Required, req)
+		}
+	}
+}
+
+func intToString(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,203 @@
+package tool
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+
+	. "github.com/lifthrasiir/angel/gemini"
+)
+
+func TestConvertJSONSchemaToGeminiSchema(t *testing.T) {
+	yes := true
+	minimum := 1.0
+
+	tests := []struct {
+		name     string
+		input    string
+		expected *Schema
+		lossy    []string // substrings expected in lossy notes, in order
+	}{
+		{
+			name:  "Scalars",
+			input: `{"type":"string","description":"A name","format":"date-time","minLength":1,"maxLength":10,"pattern":"^a"}`,
+			expected: &Schema{
+				Type: TypeString, Description: "A name", Format: "date-time",
+				MinLength: "1", MaxLength: "10", Pattern: "^a",
+			},
+		},
+		{
+			name:  "ArrayItemsAndEnum",
+			input: `{"type":"array","items":{"type":"string","enum":["a","b"]},"minItems":1}`,
+			expected: &Schema{
+				Type:     TypeArray,
+				Items:    &Schema{Type: TypeString, Enum: []string{"a", "b"}},
+				MinItems: "1",
+			},
+		},
+		{
+			name:     "NullableTypeUnion",
+			input:    `{"type":["integer","null"],"minimum":1}`,
+			expected: &Schema{Type: TypeInteger, Nullable: &yes, Minimum: &minimum},
+		},
+		{
+			name:     "NullableAnyOf",
+			input:    `{"anyOf":[{"type":"string"},{"type":"null"}],"description":"Optional"}`,
+			expected: &Schema{Type: TypeString, Nullable: &yes, Description: "Optional"},
+		},
+		{
+			name:  "AnyOf",
+			input: `{"anyOf":[{"type":"string"},{"type":"number"}]}`,
+			expected: &Schema{
+				AnyOf: []*Schema{{Type: TypeString}, {Type: TypeNumber}},
+			},
+		},
+		{
+			name: "RefInlining",
+			input: `{
+				"type":"object",
+				"properties":{
+					"a":{"$ref":"#/$defs/Point"},
+					"b":{"$ref":"#/$defs/Point","description":"Override"}
+				},
+				"required":["a"],
+				"$defs":{"Point":{"type":"object","description":"A point","properties":{"x":{"type":"number"}},"required":["x"]}}
+			}`,
+			expected: &Schema{
+				Type: TypeObject,
+				Properties: map[string]*Schema{
+					"a": {Type: TypeObject, Description: "A point", Properties: map[string]*Schema{"x": {Type: TypeNumber}}, Required: []string{"x"}},
+					"b": {Type: TypeObject, Description: "Override", Properties: map[string]*Schema{"x": {Type: TypeNumber}}, Required: []string{"x"}},
+				},
+				Required: []string{"a"},
+			},
+		},
+		{
+			name: "RecursiveRef",
+			input: `{
+				"$ref":"#/definitions/Node",
+				"definitions":{"Node":{"type":"object","properties":{"child":{"$ref":"#/definitions/Node"}}}}
+			}`,
+			expected: &Schema{
+				Type:       TypeObject,
+				Properties: map[string]*Schema{"child": {Type: TypeObject}},
+			},
+			lossy: []string{`recursive $ref "#/definitions/Node"`},
+		},
+		{
+			name:     "AdditionalPropertiesFalseIsNotLossy",
+			input:    `{"type":"object","properties":{"a":{"type":"boolean"}},"additionalProperties":false}`,
+			expected: &Schema{Type: TypeObject, Properties: map[string]*Schema{"a": {Type: TypeBoolean}}},
+		},
+		{
+			name:     "Lossy",
+			input:    `{"type":"integer","enum":[1,2],"multipleOf":2,"not":{"const":1}}`,
+			expected: &Schema{Type: TypeInteger, Enum: []string{"1", "2"}},
+			lossy:    []string{"non-string enum values", "multipleOf, not"},
+		},
+		{
+			name:     "UnresolvableRef",
+			input:    `{"$ref":"https://example.com/schema.json","description":"External"}`,
+			expected: &Schema{Description: "External"},
+			lossy:    []string{"unresolvable $ref"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input jsonschema.Schema
+			if err := json.Unmarshal([]byte(tt.input), &input); err != nil {
+				t.Fatalf("Failed to unmarshal input schema: %v", err)
+			}
+
+			actual, lossy := convertJSONSchemaToGeminiSchema(&input)
+			if !reflect.DeepEqual(actual, tt.expected) {
+				actualJSON, _ := json.Marshal(actual)
+				expectedJSON, _ := json.Marshal(tt.expected)
+				t.Errorf("Schema mismatch:\n got: %s\nwant: %s", actualJSON, expectedJSON)
+			}
+
+			if len(lossy) != len(tt.lossy) {
+				t.Fatalf("Expected %d lossy notes, got %d: %v", len(tt.lossy), len(lossy), lossy)
+			}
+			for i, want := range tt.lossy {
+				if !strings.Contains(lossy[i], want) {
+					t.Errorf("Lossy note %d: expected to contain %q, got %q", i, want, lossy[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOutputSchemaValidate(t *testing.T) {
+	outputSchema, err := ParseOutputSchema("test", []byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"properties": {"name": {"type": "string"}, "count": {"type": "integer", "minimum": 0}},
+		"required": ["name"]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseOutputSchema failed: %v", err)
+	}
+	if outputSchema.Schema == nil || outputSchema.Schema.Type != TypeObject {
+		t.Fatalf("Expected an object schema, got %+v", outputSchema.Schema)
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected interface{}
+		errMsg   string
+	}{
+		{
+			name:     "Valid",
+			text:     `{"name": "a", "count": 3}`,
+			expected: map[string]interface{}{"name": "a", "count": 3.0},
+		},
+		{
+			name:     "CodeFence",
+			text:     "```json\n{\"name\": \"a\"}\n```",
+			expected: map[string]interface{}{"name": "a"},
+		},
+		{
+			name:   "NotJSON",
+			text:   "The name is a.",
+			errMsg: "not valid JSON",
+		},
+		{
+			name:   "MissingRequired",
+			text:   `{"count": 3}`,
+			errMsg: "does not match the schema",
+		},
+		{
+			name:   "OutOfRange",
+			text:   `{"name": "a", "count": -1}`,
+			errMsg: "does not match the schema",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := outputSchema.Validate(tt.text)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Errorf("Value mismatch: got %#v, want %#v", value, tt.expected)
+			}
+		})
+	}
+
+	if _, err := ParseOutputSchema("test", []byte(`{"type": 3}`)); err == nil {
+		t.Errorf("Expected an error for an invalid schema")
+	}
+}
@@ -0,0 +1,252 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+// DefaultScriptToolTimeout is used when a script tool doesn't specify `timeout`.
+const DefaultScriptToolTimeout = 5 * time.Minute
+
+// scriptTemplateFuncs are available in script tool command templates.
+// Every action is shell-quoted unless it ends with quote or raw, see autoQuoteActions.
+var scriptTemplateFuncs = template.FuncMap{
+	"quote": shellQuote,
+	"raw":   func(v interface{}) string { return fmt.Sprint(v) },
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// autoQuoteActions appends quote to the pipeline of every action that outputs a value,
+// so that model-provided arguments can't inject shell syntax unless explicitly marked as raw.
+func autoQuoteActions(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			autoQuoteActions(child)
+		}
+	case *parse.ActionNode:
+		pipe := node.Pipe
+		if len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+			return // Variable declarations print nothing
+		}
+		last := pipe.Cmds[len(pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && (ident.Ident == "quote" || ident.Ident == "raw") {
+			return
+		}
+		pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      last.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("quote").SetPos(last.Pos)},
+		})
+	case *parse.IfNode:
+		autoQuoteActions(node.List)
+		autoQuoteActions(node.ElseList)
+	case *parse.RangeNode:
+		autoQuoteActions(node.List)
+		autoQuoteActions(node.ElseList)
+	case *parse.WithNode:
+		autoQuoteActions(node.List)
+		autoQuoteActions(node.ElseList)
+	}
+}
+
+// shellQuote quotes a value as a single POSIX shell word.
+func shellQuote(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// NewScriptToolDefinition builds a tool definition from a user-defined script tool.
+// The command is a text/template evaluated against the tool arguments, where each action is shell-quoted
+// unless piped to raw, and the arguments are also passed to the command as JSON on stdin.
+func NewScriptToolDefinition(config ScriptToolConfig) (Definition, error) {
+	if config.Name == "" {
+		return Definition{}, fmt.Errorf("script tool name is required")
+	}
+	if strings.TrimSpace(config.Command) == "" {
+		return Definition{}, fmt.Errorf("command is required for script tool %s", config.Name)
+	}
+
+	parameters := &Schema{Type: TypeObject}
+	if len(config.Parameters) > 0 && string(config.Parameters) != "null" {
+		var err error
+		parameters, err = ParseJSONSchema(config.Name, config.Parameters)
+		if err != nil {
+			return Definition{}, err
+		}
+	}
+
+	tmpl, err := template.New(config.Name).Funcs(scriptTemplateFuncs).Parse(config.Command)
+	if err != nil {
+		return Definition{}, fmt.Errorf("invalid command template for script tool %s: %w", config.Name, err)
+	}
+	for _, t := range tmpl.Templates() {
+		autoQuoteActions(t.Tree.Root)
+	}
+
+	timeout := DefaultScriptToolTimeout
+	if config.Timeout != 0 {
+		timeout = time.Duration(config.Timeout * float64(time.Second))
+	}
+
+	return Definition{
+		Name:        config.Name,
+		Description: config.Description,
+		Parameters:  parameters,
+		Timeout:     timeout,
+		Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+			return runScriptTool(ctx, config.Name, tmpl, parameters, args, params)
+		},
+	}, nil
+}
+
+// runScriptTool renders and runs a script tool command inside the session sandbox.
+func runScriptTool(ctx context.Context, name string, tmpl *template.Template, parameters *Schema, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+
+	// Omitted optional arguments are rendered as empty strings
+	data := make(map[string]interface{})
+	for key := range parameters.Properties {
+		data[key] = ""
+	}
+	for key, value := range args {
+		data[key] = value
+	}
+
+	var command strings.Builder
+	if err := tmpl.Execute(&command, data); err != nil {
+		return HandlerResults{}, fmt.Errorf("failed to render command for %s: %w", name, err)
+	}
+	stdin, err := json.Marshal(args)
+	if err != nil {
+		return HandlerResults{}, fmt.Errorf("failed to encode arguments for %s: %w", name, err)
+	}
+
+	if !params.ConfirmationReceived {
+		return HandlerResults{}, &PendingConfirmation{
+			Data: map[string]interface{}{
+				"tool":      name,
+				"command":   command.String(),
+				"arguments": args,
+			},
+		}
+	}
+
+	sfs, err := database.GetSessionFS(ctx, params.SessionId)
+	if err != nil {
+		return HandlerResults{}, fmt.Errorf("failed to get SessionFS: %w", err)
+	}
+	defer database.ReleaseSessionFS(params.SessionId)
+
+	rc, err := sfs.RunWithStdin(ctx, command.String(), "", stdin)
+	if err != nil {
+		return HandlerResults{}, fmt.Errorf("failed to run script tool %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	select {
+	case <-rc.Done():
+	case <-ctx.Done():
+		return HandlerResults{}, ctx.Err()
+	}
+
+	// The PTY merges stderr into stdout and translates newlines
+	output := strings.ReplaceAll(string(rc.TakeStdout()), "\r\n", "\n")
+	exitCode := -1
+	if rc.Cmd.ProcessState != nil {
+		exitCode = rc.Cmd.ProcessState.ExitCode()
+	}
+	log.Printf("Script tool %s exited with code %d", name, exitCode)
+
+	if exitCode != 0 {
+		return HandlerResults{Value: map[string]interface{}{
+			"exit_code": exitCode,
+			"output":    output,
+		}}, nil
+	}
+
+	// Same convention as MCP tools: a JSON object is returned as is, anything else is wrapped
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &result); err == nil && result != nil {
+		return HandlerResults{Value: result}, nil
+	}
+	return HandlerResults{Value: map[string]interface{}{"result": output}}, nil
+}
+
+// ValidateScriptTool checks that a script tool definition is valid and does not conflict with built-in tools.
+func (t *Tools) ValidateScriptTool(config ScriptToolConfig) error {
+	if _, err := NewScriptToolDefinition(config); err != nil {
+		return err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if _, exists := t.builtinTools[config.Name]; exists {
+		return fmt.Errorf("script tool name %s conflicts with a built-in tool", config.Name)
+	}
+	return nil
+}
+
+// InitScriptTools registers enabled script tools from database
+func (t *Tools) InitScriptTools(db *database.Database) {
+	if err := t.ReloadScriptTools(db); err != nil {
+		log.Printf("Error loading script tools: %v", err)
+		return
+	}
+	log.Println("Script tools initialized.")
+}
+
+// ReloadScriptTools replaces all registered script tools with enabled ones from database.
+// Script tools whose names conflict with built-in tools are skipped.
+func (t *Tools) ReloadScriptTools(db *database.Database) error {
+	configs, err := database.GetScriptToolConfigs(db)
+	if err != nil {
+		return err
+	}
+
+	scriptTools := make(map[string]Definition)
+	for _, config := range configs {
+		if !config.Enabled {
+			continue
+		}
+		def, err := NewScriptToolDefinition(config)
+		if err != nil {
+			log.Printf("Skipping script tool %s: %v", config.Name, err)
+			continue
+		}
+		scriptTools[def.Name] = def
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name := range scriptTools {
+		if _, exists := t.builtinTools[name]; exists {
+			log.Printf("Skipping script tool %s: conflicts with a built-in tool", name)
+			delete(scriptTools, name)
+		}
+	}
+	t.scriptTools = scriptTools
+	return nil
+}
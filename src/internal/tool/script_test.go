@@ -0,0 +1,114 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	. "github.com/lifthrasiir/angel/internal/types"
+)
+
+func TestScriptToolPendingConfirmation(t *testing.T) {
+	def, err := NewScriptToolDefinition(ScriptToolConfig{
+		Name:        "greet",
+		Description: "Greets someone",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"name":{"type":"string"},"greeting":{"type":"string"}},"required":["name"]}`),
+		Command:     `echo hello{{.greeting}} {{quote .name}}`,
+		Enabled:     true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create script tool: %v", err)
+	}
+	if def.Parameters.Type != TypeObject || def.Parameters.Properties["name"].Type != TypeString {
+		t.Errorf("Unexpected parameters: %+v", def.Parameters)
+	}
+
+	_, err = def.Handler(context.Background(), map[string]interface{}{"name": "O'Brien"}, HandlerParams{})
+	pending, ok := err.(*PendingConfirmation)
+	if !ok {
+		t.Fatalf("Expected PendingConfirmation, got %v", err)
+	}
+	data := pending.Data.(map[string]interface{})
+	if expected := `echo hello'' 'O'\''Brien'`; data["command"] != expected {
+		t.Errorf("Expected command %q, got %q", expected, data["command"])
+	}
+}
+
+func TestScriptToolQuoting(t *testing.T) {
+	def, err := NewScriptToolDefinition(ScriptToolConfig{
+		Name:       "say",
+		Parameters: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"},"flag":{"type":"string"}}}`),
+		Command:    `printf '%s\n' {{.text}} {{quote .text}} {{json .text}}{{if .flag}} {{raw .flag}}{{end}}`,
+		Enabled:    true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create script tool: %v", err)
+	}
+
+	malicious := `a; echo pwned $(echo pwned) "b" 'c'`
+	_, err = def.Handler(context.Background(), map[string]interface{}{"text": malicious, "flag": "-- x y"}, HandlerParams{})
+	pending, ok := err.(*PendingConfirmation)
+	if !ok {
+		t.Fatalf("Expected PendingConfirmation, got %v", err)
+	}
+	command := pending.Data.(map[string]interface{})["command"].(string)
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	output, err := exec.Command("sh", "-c", command).Output()
+	if err != nil {
+		t.Fatalf("Failed to run %q: %v", command, err)
+	}
+	jsonText, _ := json.Marshal(malicious)
+	expected := []string{malicious, malicious, string(jsonText), "--", "x", "y"}
+	if lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"); strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected arguments %q from %q, got %q", expected, command, lines)
+	}
+}
+
+func TestScriptToolTimeout(t *testing.T) {
+	tests := []struct {
+		timeout  float64
+		expected time.Duration
+	}{
+		{0, DefaultScriptToolTimeout},
+		{1.5, 1500 * time.Millisecond},
+		{-1, -time.Second}, // Disabled
+	}
+	for _, tt := range tests {
+		def, err := NewScriptToolDefinition(ScriptToolConfig{Name: "wait", Command: "sleep 1", Timeout: tt.timeout})
+		if err != nil {
+			t.Fatalf("Failed to create script tool: %v", err)
+		}
+		if def.Timeout != tt.expected {
+			t.Errorf("Expected timeout %s for %v, got %s", tt.expected, tt.timeout, def.Timeout)
+		}
+	}
+}
+
+func TestScriptToolValidation(t *testing.T) {
+	tools := NewTools()
+	tools.Register(Definition{Name: "read_file"})
+
+	tests := []struct {
+		name   string
+		config ScriptToolConfig
+	}{
+		{"MissingCommand", ScriptToolConfig{Name: "a"}},
+		{"InvalidTemplate", ScriptToolConfig{Name: "a", Command: "echo {{"}},
+		{"InvalidSchema", ScriptToolConfig{Name: "a", Command: "true", Parameters: json.RawMessage(`[1]`)}},
+		{"BuiltinConflict", ScriptToolConfig{Name: "read_file", Command: "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tools.ValidateScriptTool(tt.config); err == nil {
+				t.Errorf("Expected validation error for %+v", tt.config)
+			}
+		})
+	}
+}
@@ -2,18 +2,23 @@ package search_chat
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/database"
+	"github.com/lifthrasiir/angel/internal/llm"
 	"github.com/lifthrasiir/angel/internal/tool"
 	. "github.com/lifthrasiir/angel/internal/types"
 )
 
 // ChatSearchResult represents a single chat search result
 type ChatSearchResult struct {
+	MessageID   int    `json:"message_id"` // Unique across sessions, can be recalled with `recall`
 	Excerpt     string `json:"excerpt"`
 	SessionName string `json:"session_name"`
 	Who         string `json:"who"` // "user" or "model"
@@ -61,7 +66,7 @@ func SearchChatTool(ctx context.Context, args map[string]interface{}, params too
 	}
 
 	// Perform search
-	results, err := searchChatHistory(db, keywords, currentWorkspaceID, currentSessionID)
+	results, err := searchChatHistory(ctx, db, keywords, currentWorkspaceID, currentSessionID)
 	if err != nil {
 		return tool.HandlerResults{}, fmt.Errorf("failed to search chat history: %w", err)
 	}
@@ -70,6 +75,7 @@ func SearchChatTool(ctx context.Context, args map[string]interface{}, params too
 	var resultsArray []map[string]interface{}
 	for _, result := range results {
 		resultsArray = append(resultsArray, map[string]interface{}{
+			"message_id":   result.MessageID,
 			"excerpt":      result.Excerpt,
 			"session_name": result.SessionName,
 			"who":          result.Who,
@@ -85,10 +91,22 @@ func SearchChatTool(ctx context.Context, args map[string]interface{}, params too
 	}, nil
 }
 
-// searchChatHistory searches through chat history using the common SearchMessages function
-func searchChatHistory(db *database.Database, keywords, workspaceID, currentSessionID string) ([]ChatSearchResult, error) {
-	// Use the common SearchMessages function
-	searchResults, _, err := database.SearchMessages(db, keywords, 0, 20, workspaceID)
+// searchMessages ranks messages by both keywords and semantic similarity if embeddings are enabled,
+// and returns the newest messages matching keywords otherwise
+func searchMessages(ctx context.Context, db *database.Database, keywords, workspaceID string) ([]database.SearchResult, error) {
+	if models, err := llm.ModelsFromContext(ctx); err == nil {
+		if model, err := models.GetEmbeddingModel(); err == nil && model != nil {
+			results, _, err := llm.SearchMessagesHybrid(ctx, db, models, keywords, 0, 20, workspaceID)
+			return results, err
+		}
+	}
+	results, _, err := database.SearchMessages(db, keywords, 0, 20, workspaceID)
+	return results, err
+}
+
+// searchChatHistory searches through chat history using the common search functions
+func searchChatHistory(ctx context.Context, db *database.Database, keywords, workspaceID, currentSessionID string) ([]ChatSearchResult, error) {
+	searchResults, err := searchMessages(ctx, db, keywords, workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search messages: %w", err)
 	}
@@ -109,6 +127,7 @@ func searchChatHistory(db *database.Database, keywords, workspaceID, currentSess
 		formattedDate := formatCreatedAt(result.CreatedAt)
 
 		results = append(results, ChatSearchResult{
+			MessageID:   result.MessageID,
 			Excerpt:     result.Excerpt,
 			SessionName: resultSessionName,
 			Who:         who,
@@ -163,7 +182,9 @@ func formatCreatedAt(createdAt string) string {
 	return t.Format("2006-01-02 15:04:05")
 }
 
-// RecallTool handles recalling unprocessed binary content
+// RecallTool handles recalling unprocessed binary content and messages of other sessions.
+// The query is a list of references separated by spaces or commas, each of which is either
+// a blob hash, a message ID from search_chat results, or a `session_id:message_id` reference.
 func RecallTool(ctx context.Context, args map[string]interface{}, params tool.HandlerParams) (tool.HandlerResults, error) {
 	// Validate arguments
 	if err := tool.EnsureKnownKeys("recall", args, "query"); err != nil {
@@ -175,7 +196,8 @@ func RecallTool(ctx context.Context, args map[string]interface{}, params tool.Ha
 		return tool.HandlerResults{}, fmt.Errorf("query must be a string")
 	}
 
-	if strings.TrimSpace(query) == "" {
+	refs := strings.FieldsFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == ',' })
+	if len(refs) == 0 {
 		return tool.HandlerResults{}, fmt.Errorf("query cannot be empty")
 	}
 
@@ -190,38 +212,167 @@ func RecallTool(ctx context.Context, args map[string]interface{}, params tool.Ha
 	}
 	defer sdb.Close()
 
-	// For now, treat query as a single hash
-	// In the future, this could be expanded to handle multiple hashes or search functionality
-	hash := strings.TrimSpace(query)
-
-	// Try to retrieve the blob as a file attachment
-	attachment, err := database.GetBlobAsFileAttachment(sdb, hash)
+	session, err := database.GetSession(sdb)
 	if err != nil {
-		return tool.HandlerResults{}, fmt.Errorf("failed to retrieve content for hash %s: %w", hash, err)
+		return tool.HandlerResults{}, fmt.Errorf("failed to get current session: %w", err)
+	}
+
+	var responses []string
+	var messages []map[string]interface{}
+	var attachments []FileAttachment
+	var errors []string
+	var firstErr error
+	for _, ref := range refs {
+		response, message, refAttachments, err := recallRef(db, sdb, session.WorkspaceID, ref, params.SessionId)
+		if err != nil {
+			errors = append(errors, err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		responses = append(responses, response)
+		if message != nil {
+			messages = append(messages, message)
+		}
+		attachments = append(attachments, refAttachments...)
+	}
+	if len(responses) == 0 {
+		return tool.HandlerResults{}, firstErr
 	}
 
 	// Return the hash as response text and the content as attachment
 	// This matches the generate_image tool response format
 	result := map[string]interface{}{
-		"response": fmt.Sprintf("Recalled content for hash %s follows:", hash),
+		"response": strings.Join(responses, "\n"),
+	}
+	if len(messages) > 0 {
+		result["messages"] = messages
+	}
+	if len(errors) > 0 {
+		result["errors"] = errors
 	}
 
 	return tool.HandlerResults{
 		Value:       result,
-		Attachments: []FileAttachment{attachment},
+		Attachments: attachments,
 	}, nil
 }
 
+// recallRef recalls a single reference in the recall query.
+// The message is only returned for message references.
+func recallRef(db *database.Database, sdb *database.SessionDatabase, workspaceID, ref, callerSessionID string) (string, map[string]interface{}, []FileAttachment, error) {
+	sessionID, msgIDStr, isMessageRef := cutLast(ref, ":")
+	if !isMessageRef && !isBlobHash(ref) && isDigits(ref) {
+		// Message IDs of search results are unique across sessions
+		searchMessageID, _ := strconv.Atoi(ref)
+		var msgID int
+		var err error
+		sessionID, msgID, err = database.GetSearchResultMessage(db, searchMessageID)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("message %s not found", ref)
+		}
+		msgIDStr, isMessageRef = strconv.Itoa(msgID), true
+	}
+
+	if isMessageRef {
+		message, attachments, err := recallMessage(db, workspaceID, sessionID, msgIDStr, callerSessionID)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return fmt.Sprintf("Recalled message %s follows.", ref), message, attachments, nil
+	}
+
+	// Try to retrieve the blob as a file attachment
+	attachment, err := database.GetBlobAsFileAttachment(sdb, ref)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to retrieve content for hash %s: %w", ref, err)
+	}
+	return fmt.Sprintf("Recalled content for hash %s follows:", ref), nil, []FileAttachment{attachment}, nil
+}
+
+// recallMessage returns the message of the session in the workspace and its attachments.
+// Attachments include their data, so that they are also saved into the session of the caller.
+func recallMessage(db *database.Database, workspaceID, sessionID, msgIDStr, callerSessionID string) (map[string]interface{}, []FileAttachment, error) {
+	ref := sessionID + ":" + msgIDStr
+	notFound := fmt.Errorf("message %s not found", ref)
+
+	msgID, err := strconv.Atoi(msgIDStr)
+	if err != nil {
+		return nil, nil, notFound
+	}
+	sdb, err := db.WithSession(sessionID)
+	if err != nil {
+		return nil, nil, notFound
+	}
+	defer sdb.Close()
+
+	// Sessions of other workspaces are treated as nonexistent
+	session, err := database.GetSession(sdb)
+	if err != nil || session.WorkspaceID != workspaceID {
+		return nil, nil, notFound
+	}
+	msg, err := database.GetMessageByID(sdb, msgID)
+	if err != nil {
+		return nil, nil, notFound
+	}
+
+	var attachments []FileAttachment
+	for _, attachment := range msg.Attachments {
+		data, err := database.GetBlob(sdb, attachment.Hash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve attachment %s of message %s: %w", attachment.Hash, ref, err)
+		}
+		attachment.Data = data
+		attachment.SessionId = callerSessionID
+		attachments = append(attachments, attachment)
+	}
+
+	return map[string]interface{}{
+		"ref":          ref,
+		"session_name": session.Name,
+		"type":         string(msg.Type),
+		"text":         msg.Text,
+		"created_at":   msg.CreatedAt,
+	}, attachments, nil
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// isBlobHash returns whether s looks like a hex-encoded SHA-512/256 hash.
+func isBlobHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
 var searchChatTool = tool.Definition{
 	Name:        "search_chat",
-	Description: "Search through chat history using keywords. Returns recent matching messages with context excerpts.",
+	Description: "Search through chat history using keywords. Returns recent matching messages with context excerpts, or the most relevant messages if semantic search is enabled. The full content of a result can be retrieved by passing its `message_id` to `recall`.",
 	Parameters: &Schema{
 		Type:        TypeObject,
 		Description: "Search for messages containing specific keywords",
 		Properties: map[string]*Schema{
 			"keywords": {
 				Type:        TypeString,
-				Description: "Keywords to search for in chat messages",
+				Description: "Keywords to search for in chat messages. A short phrase also works if semantic search is enabled.",
 			},
 		},
 		Required: []string{"keywords"},
@@ -234,14 +385,17 @@ var recallTool = tool.Definition{
 	Description: `**Retrieves content for binary hashes that are NOT directly rendered or explicitly described in the chat.**
 When binary content (e.g., images, audio, PDFs) is provided directly in the chat with a hash reference (e.g., '[Binary with hash ... follows:]' immediately followed by the rendered content), you can directly perceive and understand its details. In such cases, 'recall' is generally NOT required for basic comprehension.
 However, 'recall' is **ESSENTIAL** when you encounter messages explicitly stating that a binary with a given hash is **UNPROCESSED** (e.g., 'Binary with hash xyz is currently **UNPROCESSED**') and its content has not been rendered or described for you. In these situations, you **MUST** use 'recall' to access the content's details for internal analysis and understanding.
-This tool recovers previously un-perceived or raw data from SHA-512/256 hashes, enabling you to accurately comprehend content details, formulate precise responses, or perform further processing.`,
+This tool recovers previously un-perceived or raw data from SHA-512/256 hashes, enabling you to accurately comprehend content details, formulate precise responses, or perform further processing.
+It also retrieves the full content of a tool result that was truncated to a preview, using the hash given in that result.
+Besides hashes, it retrieves the full text and attachments of messages in other sessions of the current workspace, referred either by 'message_id' from 'search_chat' results or by 'session_id:message_id'.
+Multiple references can be recalled at once.`,
 	Parameters: &Schema{
 		Type:        TypeObject,
-		Description: "Recall unprocessed binary content for internal AI processing",
+		Description: "Recall unprocessed binary content or messages of other sessions for internal AI processing",
 		Properties: map[string]*Schema{
 			"query": {
 				Type:        TypeString,
-				Description: "The SHA-512/256 hash of the unprocessed binary content required for your internal comprehension and subsequent actions.",
+				Description: "The SHA-512/256 hash of the unprocessed binary content required for your internal comprehension and subsequent actions, a 'message_id' from 'search_chat' results, or a 'session_id:message_id' reference. Separate multiple references with commas.",
 			},
 		},
 		Required: []string{"query"},
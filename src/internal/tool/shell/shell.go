@@ -506,6 +506,7 @@ var runShellCommandTool = tool.Definition{
 		Required: []string{"command"},
 	},
 	Handler: RunShellCommandTool,
+	Timeout: time.Minute, // Waits for InitialPollDelayInSeconds at most, and the command keeps running afterwards
 }
 
 var pollShellCommandTool = tool.Definition{
@@ -522,6 +523,7 @@ var pollShellCommandTool = tool.Definition{
 		Required: []string{"command_id"},
 	},
 	Handler: PollShellCommandTool,
+	Timeout: 2 * time.Minute, // Waits for MaxPollDelayInSeconds at most
 }
 
 var killShellCommandTool = tool.Definition{
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/chat"
@@ -142,7 +143,7 @@ func (src *SubagentResultCollector) processEvent(eventType EventType, payload st
 	case EventComplete:
 		// Mark generation as complete
 		src.generationComplete = true
-	case EventThought, EventGenerationChanged, EventSessionName, EventCumulTokenCount, EventFinish:
+	case EventThought, EventGenerationChanged, EventSessionName, EventCumulTokenCount, EventCompression, EventFinish:
 		// Thoughts and metadata are ignored for subagent results
 	}
 }
@@ -175,7 +176,7 @@ func (src *SubagentResultCollector) ErrorMessage() string {
 
 // SubagentTool handles the subagent tool call, allowing to spawn a new subagent or interact with an existing one.
 func SubagentTool(ctx context.Context, args map[string]interface{}, params tool.HandlerParams) (tool.HandlerResults, error) {
-	if err := tool.EnsureKnownKeys("subagent", args, "subagent_id", "system_prompt", "text"); err != nil {
+	if err := tool.EnsureKnownKeys("subagent", args, "subagent_id", "system_prompt", "text", "structured_output"); err != nil {
 		return tool.HandlerResults{}, err
 	}
 
@@ -193,6 +194,21 @@ func SubagentTool(ctx context.Context, args map[string]interface{}, params tool.
 		return tool.HandlerResults{}, fmt.Errorf("subagent tool: must provide 'text'")
 	}
 
+	var outputSchema *tool.OutputSchema
+	if structuredOutput, ok := args["structured_output"]; ok {
+		schemaJSON, ok := structuredOutput.(string)
+		if !ok {
+			return tool.HandlerResults{}, fmt.Errorf("subagent tool: 'structured_output' must be a JSON schema encoded as a string")
+		}
+		var err error
+		outputSchema, err = tool.ParseOutputSchema("structured_output", []byte(schemaJSON))
+		if err != nil {
+			return tool.HandlerResults{}, fmt.Errorf("subagent tool: %w", err)
+		}
+		// The subagent itself should know the schema, as it may need to use tools to fill it
+		text = fmt.Sprintf("%s\n\nRespond only with JSON matching the following JSON schema:\n%s", text, schemaJSON)
+	}
+
 	db, err := database.FromContext(ctx)
 	if err != nil {
 		return tool.HandlerResults{}, err
@@ -265,42 +281,72 @@ func SubagentTool(ctx context.Context, args map[string]interface{}, params tool.
 		return tool.HandlerResults{}, fmt.Errorf("failed to resolve subagent: %w", err)
 	}
 
-	// Create result collector to capture chat events
-	resultCollector := newSubagentResultCollector(newAgentID, false)
-
 	// Use chat package's NewChatMessage to handle the subagent interaction
 	// with the resolved subagent model name
-	err = chat.NewChatMessage(
-		ctx,
-		subDb,
-		models,
-		ga,
-		tools,
-		config,
-		resultCollector, // Custom EventWriter that captures events
-		text,
-		nil,                          // No attachments for regular subagent
-		subagentModelProvider.Name(), // Use the resolved subagent model
-		0,                            // fetchLimit is not needed for subagent
-	)
+	runSubagent := func(text string) (*SubagentResultCollector, error) {
+		// Create result collector to capture chat events
+		resultCollector := newSubagentResultCollector(newAgentID, false)
+		err := chat.NewChatMessage(
+			ctx,
+			subDb,
+			models,
+			ga,
+			tools,
+			config,
+			resultCollector, // Custom EventWriter that captures events
+			text,
+			nil,                          // No attachments for regular subagent
+			subagentModelProvider.Name(), // Use the resolved subagent model
+			0,                            // fetchLimit is not needed for subagent
+		)
+		if err != nil {
+			return nil, fmt.Errorf("subagent execution failed: %w", err)
+		}
+		return resultCollector, nil
+	}
 
+	resultCollector, err := runSubagent(text)
 	if err != nil {
-		return tool.HandlerResults{}, fmt.Errorf("subagent execution failed: %w", err)
+		return tool.HandlerResults{}, err
 	}
 
-	result := map[string]interface{}{
-		"response_text": resultCollector.Response(),
-	}
+	result := map[string]interface{}{}
 	if subagentID := resultCollector.SubagentID(); subagentID != "" {
 		result["subagent_id"] = subagentID
 	}
-	if errorMessage := resultCollector.ErrorMessage(); errorMessage != "" {
+	attachments := resultCollector.Attachments()
+	errorMessage := resultCollector.ErrorMessage()
+	if outputSchema != nil && errorMessage == "" {
+		// The subagent is re-prompted once with the validation error if its response is invalid
+		value, err := outputSchema.Validate(resultCollector.Response())
+		if err != nil {
+			log.Printf("Subagent structured output is invalid: %v", err)
+			resultCollector, err = runSubagent(fmt.Sprintf("The JSON is invalid: %v\nRespond again with corrected JSON only.", err))
+			if err != nil {
+				return tool.HandlerResults{}, err
+			}
+			attachments = append(attachments, resultCollector.Attachments()...)
+			errorMessage = resultCollector.ErrorMessage()
+			if errorMessage == "" {
+				value, err = outputSchema.Validate(resultCollector.Response())
+			}
+		}
+		if err == nil && errorMessage == "" {
+			result["structured_output"] = value
+		} else if err != nil {
+			errorMessage = fmt.Sprintf("failed to get structured output: %v", err)
+		}
+	}
+	if _, ok := result["structured_output"]; !ok {
+		result["response_text"] = resultCollector.Response()
+	}
+	if errorMessage != "" {
 		result["error"] = errorMessage
 	}
 
 	return tool.HandlerResults{
 		Value:       result,
-		Attachments: resultCollector.Attachments(),
+		Attachments: attachments,
 	}, nil
 }
 
@@ -465,7 +511,7 @@ func GenerateImageTool(ctx context.Context, args map[string]interface{}, params
 
 var subagentTool = tool.Definition{
 	Name:        "subagent",
-	Description: "Spawns a new subagent session with a given system prompt, or sends a text message to an existing subagent session (identified by its session-local ID) and returns its text response. Exactly one of 'subagent_id' or 'system_prompt' must be provided. 'subagent_id' is returned only when 'system_prompt' is provided.",
+	Description: "Spawns a new subagent session with a given system prompt, or sends a text message to an existing subagent session (identified by its session-local ID) and returns its text response. Exactly one of 'subagent_id' or 'system_prompt' must be provided. 'subagent_id' is returned only when 'system_prompt' is provided. If 'structured_output' is provided, the response is returned as a JSON value in 'structured_output' instead of 'response_text'.",
 	Parameters: &Schema{
 		Type: TypeObject,
 		Properties: map[string]*Schema{
@@ -481,10 +527,15 @@ var subagentTool = tool.Definition{
 				Type:        TypeString,
 				Description: "The text message to send to the subagent.",
 			},
+			"structured_output": {
+				Type:        TypeString,
+				Description: "A JSON schema, encoded as a string (not as an object), that the response must conform to. The schema is given to the subagent along with 'text', and the validated response is returned as a parsed JSON value.",
+			},
 		},
 		Required: []string{"text"},
 	},
 	Handler: SubagentTool,
+	Timeout: 30 * time.Minute, // Subagents can run many turns with their own tool calls
 }
 
 var generateImageTool = tool.Definition{
@@ -508,6 +559,7 @@ var generateImageTool = tool.Definition{
 		Required: []string{"text"},
 	},
 	Handler: GenerateImageTool,
+	Timeout: 5 * time.Minute,
 }
 
 var AllTools = []tool.Definition{
@@ -2,11 +2,13 @@ package tool
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
-
-	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+	"time"
 
 	. "github.com/lifthrasiir/angel/gemini"
 	"github.com/lifthrasiir/angel/internal/database"
@@ -36,28 +38,53 @@ type HandlerResults struct {
 	Attachments []FileAttachment
 }
 
+// TimeoutError is returned by Tools.Call when a tool did not finish within its timeout.
+type TimeoutError struct {
+	Tool    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("tool %s timed out after %s", e.Tool, e.Timeout)
+}
+
+// Response returns a structured function response describing the timeout for the model.
+func (e *TimeoutError) Response() map[string]interface{} {
+	return map[string]interface{}{
+		"error":           e.Error(),
+		"timed_out":       true,
+		"timeout_seconds": e.Timeout.Seconds(),
+	}
+}
+
 // Definition represents a tool with its schema and handler function.
 type Definition struct {
 	Name        string
 	Description string
 	Parameters  *Schema
 	Handler     func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error)
+	Timeout     time.Duration // Zero means no timeout other than the cancellation of the call itself
 }
 
 // Tools manages all tool state including built-in tools and MCP connections
 type Tools struct {
-	builtinTools       map[string]Definition
-	mcpManager         *MCPManager
-	mu                 sync.RWMutex
-	mcpToolNameMapping map[string]string // MappedName -> OriginalName
+	builtinTools        map[string]Definition
+	scriptTools         map[string]Definition // User-defined script tools, see ReloadScriptTools
+	mcpManager          *MCPManager
+	mu                  sync.RWMutex
+	mcpToolNameMapping  map[string]string // MappedName -> OriginalName
+	maxInlineResultSize int
+	allowed             map[string]bool // Restricts MCP tools if not nil, see Restrict
 }
 
 // NewTools creates a new Tools instance
 func NewTools() *Tools {
 	return &Tools{
-		builtinTools:       make(map[string]Definition),
-		mcpManager:         &MCPManager{connections: make(map[string]*MCPConnection)},
-		mcpToolNameMapping: make(map[string]string),
+		builtinTools:        make(map[string]Definition),
+		scriptTools:         make(map[string]Definition),
+		mcpManager:          &MCPManager{connections: make(map[string]*MCPConnection)},
+		mcpToolNameMapping:  make(map[string]string),
+		maxInlineResultSize: DefaultMaxInlineResultSize,
 	}
 }
 
@@ -70,7 +97,38 @@ func (t *Tools) Register(defs ...Definition) {
 	}
 }
 
-// BuiltinNames returns a set of all built-in tool names
+// Restrict returns a snapshot of t which only exposes the given tools, including MCP tools by their mapped names.
+// MCP connections are shared with t, while script tools registered later are not reflected.
+func (t *Tools) Restrict(names []string) *Tools {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	allowed := make(map[string]bool)
+	for _, name := range names {
+		allowed[name] = true
+	}
+	restricted := &Tools{
+		builtinTools:        make(map[string]Definition),
+		scriptTools:         make(map[string]Definition),
+		mcpManager:          t.mcpManager,
+		mcpToolNameMapping:  make(map[string]string),
+		maxInlineResultSize: t.maxInlineResultSize,
+		allowed:             allowed,
+	}
+	for name, def := range t.builtinTools {
+		if allowed[name] {
+			restricted.builtinTools[name] = def
+		}
+	}
+	for name, def := range t.scriptTools {
+		if allowed[name] {
+			restricted.scriptTools[name] = def
+		}
+	}
+	return restricted
+}
+
+// BuiltinNames returns a set of all built-in and script tool names, which take precedence over MCP tools
 func (t *Tools) BuiltinNames() map[string]bool {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -79,9 +137,24 @@ func (t *Tools) BuiltinNames() map[string]bool {
 	for toolName := range t.builtinTools {
 		builtinToolNames[toolName] = true
 	}
+	for toolName := range t.scriptTools {
+		builtinToolNames[toolName] = true
+	}
 	return builtinToolNames
 }
 
+// Names returns a set of all tool names, including MCP tools by their mapped names
+func (t *Tools) Names() map[string]bool {
+	names := t.BuiltinNames()
+	// ForGemini also updates the MCP tool name mapping, so mapped names are consistent with tool calls
+	for _, tool := range t.ForGemini() {
+		for _, fd := range tool.FunctionDeclarations {
+			names[fd.Name] = true
+		}
+	}
+	return names
+}
+
 // InitMCPManager initializes MCP connections from database
 func (t *Tools) InitMCPManager(db *database.Database) {
 	t.mcpManager.init(t, db)
@@ -106,31 +179,44 @@ func (t *Tools) ForGemini() []Tool {
 		builtinToolNames[toolDef.Name] = true
 	}
 
+	// Add script tools
+	for toolName, toolDef := range t.scriptTools {
+		functionDeclarations = append(functionDeclarations, FunctionDeclaration{
+			Name:        toolName,
+			Description: toolDef.Description,
+			Parameters:  toolDef.Parameters,
+		})
+		builtinToolNames[toolName] = true
+	}
+
 	// Update MCP tool name mapping
 	t.updateToolNameMapping(builtinToolNames)
 
 	// Add tools from active MCP connections with name conflict resolution
 	for mcpName, conn := range t.mcpManager.connections {
 		if conn.IsEnabled && conn.Session != nil {
-			toolsIterator := conn.Session.Tools(context.Background(), nil)
-			for tool, err := range toolsIterator {
-				if err != nil {
-					log.Printf("Failed to list tools from MCP server %s: %v", mcpName, err)
-					break
-				}
+			for _, tool := range conn.Tools() {
 				mappedName := tool.Name
 				if _, exists := builtinToolNames[tool.Name]; exists {
 					mappedName = mcpName + "__" + tool.Name
 				}
+				if t.allowed != nil && !t.allowed[mappedName] {
+					continue
+				}
 				functionDeclarations = append(functionDeclarations, FunctionDeclaration{
 					Name:        mappedName,
 					Description: tool.Description,
-					Parameters:  convertJSONSchemaToGeminiSchema(tool.InputSchema),
+					Parameters:  tool.Parameters,
 				})
 			}
 		}
 	}
 
+	// Map iteration order is random, but the tool list should be stable (e.g. for context caching)
+	sort.Slice(functionDeclarations, func(i, j int) bool {
+		return functionDeclarations[i].Name < functionDeclarations[j].Name
+	})
+
 	tools = append(tools, Tool{FunctionDeclarations: functionDeclarations})
 	return tools
 }
@@ -141,47 +227,64 @@ func (t *Tools) updateToolNameMapping(builtinToolNames map[string]bool) {
 
 	for mcpName, conn := range t.mcpManager.connections {
 		if conn.IsEnabled && conn.Session != nil {
-			toolsIterator := conn.Session.Tools(context.Background(), nil)
-			for tool, err := range toolsIterator {
-				if err != nil {
-					log.Printf("Failed to list tools from MCP server %s for mapping: %v", mcpName, err)
-					continue
-				}
+			for _, tool := range conn.Tools() {
 				mappedName := tool.Name
 				if _, exists := builtinToolNames[tool.Name]; exists {
 					mappedName = mcpName + "__" + tool.Name
 				}
+				if t.allowed != nil && !t.allowed[mappedName] {
+					continue
+				}
 				t.mcpToolNameMapping[mappedName] = tool.Name
 			}
 		}
 	}
 }
 
-// Call executes the handler for the given function call
+// Call executes the handler for the given function call.
+// The call is cancelled with ctx, and fails with *TimeoutError when the tool's timeout is exceeded.
+// Results larger than MaxInlineResultSize are offloaded to an attachment.
 func (t *Tools) Call(ctx context.Context, fc FunctionCall, params HandlerParams) (HandlerResults, error) {
+	start := time.Now()
+	results, err := t.call(ctx, fc, params)
+
+	var payload []byte
+	if err == nil && results.Value != nil {
+		payload, _ = json.Marshal(results.Value)
+		offloadLargeResult(fc.Name, &results, payload, t.MaxInlineResultSize())
+	}
+	recordToolCall(ctx, fc, params, start, len(payload), err)
+	return results, err
+}
+
+func (t *Tools) call(ctx context.Context, fc FunctionCall, params HandlerParams) (HandlerResults, error) {
 	t.mu.RLock()
-	defer t.mu.RUnlock()
+	toolDef, ok := t.builtinTools[fc.Name]
+	if !ok {
+		toolDef, ok = t.scriptTools[fc.Name]
+	}
+	originalToolName, isMCPTool := t.mcpToolNameMapping[fc.Name]
+	t.mu.RUnlock()
 
 	// Check if it's a local tool first
-	if toolDef, ok := t.builtinTools[fc.Name]; ok {
-		return toolDef.Handler(ctx, fc.Args, params)
+	if ok {
+		return callWithTimeout(ctx, fc.Name, toolDef.Timeout, func(ctx context.Context) (HandlerResults, error) {
+			return toolDef.Handler(ctx, fc.Args, params)
+		})
 	}
 
 	// Check if it's an MCP tool (potentially with a mapped name)
-	originalToolName, isMCPTool := t.mcpToolNameMapping[fc.Name]
 	if isMCPTool {
 		// Find the MCP server that provides this original tool name
-		for mcpName, conn := range t.mcpManager.connections {
+		for mcpName, conn := range t.mcpManager.GetMCPConnections() {
 			if conn.IsEnabled && conn.Session != nil {
-				toolsIterator := conn.Session.Tools(context.Background(), nil)
-				for tool, err := range toolsIterator {
-					if err != nil {
-						break // Cannot check this server
-					}
+				for _, tool := range conn.Tools() {
 					if tool.Name == originalToolName {
 						log.Printf("Dispatching tool call '%s' (originally '%s') to MCP server '%s'", fc.Name, originalToolName, mcpName)
-						val, err := t.mcpManager.DispatchToolCall(context.Background(), mcpName, originalToolName, fc.Args)
-						return HandlerResults{Value: val}, err
+						return callWithTimeout(ctx, fc.Name, conn.Timeout, func(ctx context.Context) (HandlerResults, error) {
+							val, err := t.mcpManager.DispatchToolCall(ctx, mcpName, originalToolName, fc.Args)
+							return HandlerResults{Value: val}, err
+						})
 					}
 				}
 			}
@@ -191,6 +294,41 @@ func (t *Tools) Call(ctx context.Context, fc FunctionCall, params HandlerParams)
 	return HandlerResults{}, fmt.Errorf("unknown tool: %s", fc.Name)
 }
 
+// callWithTimeout runs call with the given timeout if positive.
+// The call is abandoned as soon as the deadline passes, even if it does not honor the context.
+func callWithTimeout(ctx context.Context, toolName string, timeout time.Duration, call func(ctx context.Context) (HandlerResults, error)) (HandlerResults, error) {
+	if timeout <= 0 {
+		return call(ctx)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		results HandlerResults
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		results, err := call(callCtx)
+		done <- result{results, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return HandlerResults{}, &TimeoutError{Tool: toolName, Timeout: timeout}
+		}
+		return r.results, r.err
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return HandlerResults{}, ctx.Err()
+		}
+		log.Printf("Tool call '%s' timed out after %s", toolName, timeout)
+		return HandlerResults{}, &TimeoutError{Tool: toolName, Timeout: timeout}
+	}
+}
+
 // GetMCPConnections returns a snapshot of the current MCP connections
 func (t *Tools) GetMCPConnections() map[string]*MCPConnection {
 	t.mu.RLock()
@@ -208,59 +346,6 @@ func (t *Tools) GetMCPManager() *MCPManager {
 	return t.mcpManager
 }
 
-// jsonSchemaTypeToGeminiType converts JSON schema type to Gemini type
-func jsonSchemaTypeToGeminiType(jsonType string) Type {
-	switch jsonType {
-	case "string":
-		return TypeString
-	case "number":
-		return TypeNumber
-	case "integer":
-		return TypeInteger
-	case "boolean":
-		return TypeBoolean
-	case "array":
-		return TypeArray
-	case "object":
-		return TypeObject
-	case "null":
-		return TypeNull
-	default:
-		return TypeUnspecified
-	}
-}
-
-// convertJSONSchemaToGeminiSchema converts a jsonschema.Schema to a Gemini API compatible Schema
-func convertJSONSchemaToGeminiSchema(jsonSchema *jsonschema.Schema) *Schema {
-	if jsonSchema == nil {
-		return nil
-	}
-
-	geminiSchema := &Schema{}
-
-	// Handle Type
-	if jsonSchema.Type != "" {
-		geminiSchema.Type = jsonSchemaTypeToGeminiType(jsonSchema.Type)
-	} else if len(jsonSchema.Types) > 0 {
-		geminiSchema.Type = jsonSchemaTypeToGeminiType(jsonSchema.Types[0]) // Take the first type if multiple are present
-	}
-
-	// Handle Properties recursively
-	if len(jsonSchema.Properties) > 0 {
-		geminiSchema.Properties = make(map[string]*Schema)
-		for key, propSchema := range jsonSchema.Properties {
-			geminiSchema.Properties[key] = convertJSONSchemaToGeminiSchema(propSchema)
-		}
-	}
-
-	// Handle Required
-	if len(jsonSchema.Required) > 0 {
-		geminiSchema.Required = jsonSchema.Required
-	}
-
-	return geminiSchema
-}
-
 // EnsureKnownKeys checks if all keys in 'args' are present in 'keys'
 func EnsureKnownKeys(toolName string, args map[string]interface{}, keys ...string) error {
 	knownKeys := make(map[string]bool)
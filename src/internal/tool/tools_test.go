@@ -0,0 +1,295 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
+	. "github.com/lifthrasiir/angel/internal/types"
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCallTimeout(t *testing.T) {
+	tools := NewTools()
+	tools.Register(
+		Definition{
+			Name:    "slow",
+			Timeout: 50 * time.Millisecond,
+			Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+				<-ctx.Done()
+				return HandlerResults{}, ctx.Err()
+			},
+		},
+		Definition{
+			Name:    "stubborn",
+			Timeout: 50 * time.Millisecond,
+			Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+				time.Sleep(time.Second) // Ignores the context
+				return HandlerResults{}, nil
+			},
+		},
+		Definition{
+			Name:    "fast",
+			Timeout: time.Second,
+			Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+				return HandlerResults{Value: map[string]interface{}{"ok": true}}, nil
+			},
+		},
+	)
+
+	for _, name := range []string{"slow", "stubborn"} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			_, err := tools.Call(context.Background(), FunctionCall{Name: name}, HandlerParams{})
+			var timeoutErr *TimeoutError
+			if !errors.As(err, &timeoutErr) {
+				t.Fatalf("Expected TimeoutError, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("Call took too long to time out: %s", elapsed)
+			}
+			if timeoutErr.Response()["timed_out"] != true {
+				t.Errorf("Expected structured timeout response, got %v", timeoutErr.Response())
+			}
+		})
+	}
+
+	t.Run("fast", func(t *testing.T) {
+		results, err := tools.Call(context.Background(), FunctionCall{Name: "fast"}, HandlerParams{})
+		if err != nil || results.Value["ok"] != true {
+			t.Errorf("Expected successful result, got %v, %v", results.Value, err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := tools.Call(ctx, FunctionCall{Name: "stubborn"}, HandlerParams{})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestCallOffloadsLargeResult(t *testing.T) {
+	tools := NewTools()
+	tools.SetMaxInlineResultSize(100)
+	tools.Register(Definition{
+		Name: "big",
+		Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+			return HandlerResults{Value: map[string]interface{}{"output": strings.Repeat("가", 100)}}, nil
+		},
+	})
+
+	results, err := tools.Call(context.Background(), FunctionCall{Name: "big"}, HandlerParams{})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if results.Value["truncated"] != true {
+		t.Fatalf("Expected truncated result, got %v", results.Value)
+	}
+	preview := results.Value["preview"].(string)
+	if len(preview) > 100 || !utf8.ValidString(preview) {
+		t.Errorf("Expected a valid preview of at most 100 bytes, got %q", preview)
+	}
+	if len(results.Attachments) != 1 {
+		t.Fatalf("Expected 1 attachment, got %d", len(results.Attachments))
+	}
+	att := results.Attachments[0]
+	if !att.Omitted || att.Hash != results.Value["hash"] || att.Hash != database.BlobHash(att.Data) {
+		t.Errorf("Unexpected attachment: %+v", att)
+	}
+	var full map[string]interface{}
+	if err := json.Unmarshal(att.Data, &full); err != nil || full["output"] != strings.Repeat("가", 100) {
+		t.Errorf("Attachment does not contain the full result: %v", err)
+	}
+
+	// Previews are much smaller than the limit, and cut between elements or lines
+	tools.SetMaxInlineResultSize(DefaultMaxInlineResultSize)
+	tools.Register(Definition{
+		Name: "list",
+		Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+			items := make([]interface{}, 2000)
+			for i := range items {
+				items[i] = fmt.Sprintf("item %d: %s", i, strings.Repeat("x", 40))
+			}
+			return HandlerResults{Value: map[string]interface{}{"items": items}}, nil
+		},
+	})
+	tools.Register(Definition{
+		Name: "log",
+		Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+			return HandlerResults{Value: map[string]interface{}{"output": strings.Repeat("a log line\n", 10000)}}, nil
+		},
+	})
+	for name, suffix := range map[string]string{"list": ",", "log": "a log line"} {
+		results, _ = tools.Call(context.Background(), FunctionCall{Name: name}, HandlerParams{})
+		preview, _ := results.Value["preview"].(string)
+		if len(preview) > resultPreviewSize || len(preview) < resultPreviewSize/2 || !strings.HasSuffix(preview, suffix) {
+			t.Errorf("Expected a preview of %s cut at a boundary, got %d bytes ending with %q", name, len(preview), preview[max(len(preview)-20, 0):])
+		}
+	}
+
+	tools.SetMaxInlineResultSize(0)
+	results, _ = tools.Call(context.Background(), FunctionCall{Name: "big"}, HandlerParams{})
+	if _, ok := results.Value["output"]; !ok {
+		t.Errorf("Expected offloading to be disabled, got %v", results.Value)
+	}
+}
+
+func TestCallRecordsAudit(t *testing.T) {
+	db, err := database.InitTestDB(t.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+	defer db.Close()
+	ctx := database.ContextWith(context.Background(), db)
+
+	tools := NewTools()
+	tools.Register(
+		Definition{
+			Name: "echo",
+			Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+				return HandlerResults{Value: args}, nil
+			},
+		},
+		Definition{
+			Name: "fail",
+			Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+				return HandlerResults{}, errors.New("boom")
+			},
+		},
+		Definition{
+			Name: "guarded",
+			Handler: func(ctx context.Context, args map[string]interface{}, params HandlerParams) (HandlerResults, error) {
+				if !params.ConfirmationReceived {
+					return HandlerResults{}, &PendingConfirmation{}
+				}
+				return HandlerResults{Value: map[string]interface{}{"ok": true}}, nil
+			},
+		},
+	)
+
+	params := HandlerParams{SessionId: "s1", BranchId: "b1"}
+	for i := 0; i < 3; i++ {
+		tools.Call(ctx, FunctionCall{Name: "echo", Args: map[string]interface{}{"x": "y"}}, params)
+	}
+	tools.Call(ctx, FunctionCall{Name: "fail"}, HandlerParams{SessionId: "s1.sub", BranchId: "b2"})
+	tools.Call(ctx, FunctionCall{Name: "fail"}, HandlerParams{SessionId: "s2", BranchId: "b3"})
+	tools.Call(ctx, FunctionCall{Name: "guarded"}, params)
+	tools.Call(ctx, FunctionCall{Name: "guarded"}, HandlerParams{SessionId: "s1", BranchId: "b1", ConfirmationReceived: true})
+	RecordDenial(db, FunctionCall{Name: "guarded"}, params)
+
+	audits, err := database.GetToolCallAudits(db, ToolCallAuditFilter{SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("GetToolCallAudits failed: %v", err)
+	}
+	if len(audits) != 7 {
+		t.Fatalf("Expected 7 audits for s1 and its subsessions, got %d", len(audits))
+	}
+	confirmations := map[string]int{}
+	for _, audit := range audits {
+		confirmations[audit.Confirmation]++
+		if audit.ToolName == "echo" && (audit.ArgsDigest != argsDigest(map[string]interface{}{"x": "y"}) || audit.ResultSize != len(`{"x":"y"}`)) {
+			t.Errorf("Unexpected echo audit: %+v", audit)
+		}
+	}
+	expected := map[string]int{ConfirmationNone: 4, ConfirmationPending: 1, ConfirmationApproved: 1, ConfirmationDenied: 1}
+	if !reflect.DeepEqual(confirmations, expected) {
+		t.Errorf("Expected confirmation outcomes %v, got %v", expected, confirmations)
+	}
+
+	failures, err := database.GetToolCallAudits(db, ToolCallAuditFilter{ErrorsOnly: true, ToolName: "fail"})
+	if err != nil || len(failures) != 2 || failures[0].Error != "boom" {
+		t.Errorf("Expected 2 failed calls, got %+v, %v", failures, err)
+	}
+
+	stats, err := database.GetToolCallStats(db, ToolCallAuditFilter{})
+	if err != nil {
+		t.Fatalf("GetToolCallStats failed: %v", err)
+	}
+	byName := map[string]ToolCallStats{}
+	for _, s := range stats {
+		byName[s.ToolName] = s
+	}
+	if s := byName["echo"]; s.Calls != 3 || s.Failures != 0 || s.FailureRate != 0 {
+		t.Errorf("Unexpected echo stats: %+v", s)
+	}
+	if s := byName["fail"]; s.Calls != 2 || s.Failures != 2 || s.FailureRate != 1 {
+		t.Errorf("Unexpected fail stats: %+v", s)
+	}
+	if s := byName["guarded"]; s.Calls != 3 || s.Denials != 1 || s.Failures != 0 || s.FailureRate != 0 {
+		t.Errorf("Unexpected guarded stats: %+v", s)
+	}
+}
+
+func TestMCPToolsAreConvertedOnce(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	handler := func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[map[string]any]) (*mcp.CallToolResultFor[any], error) {
+		return &mcp.CallToolResultFor[any]{}, nil
+	}
+	multipleOf := 2.0
+	server.AddTool(&mcp.Tool{
+		Name: "even",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{"n": {Type: "integer", MultipleOf: &multipleOf}},
+		},
+	}, handler)
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport)
+	if err != nil {
+		t.Fatalf("Failed to start MCP server: %v", err)
+	}
+	defer serverSession.Close()
+
+	tools := NewTools()
+	config := MCPServerConfig{Name: "test", Enabled: true}
+	if err := tools.mcpManager.connect(ctx, config, DefaultMCPToolTimeout, clientTransport); err != nil {
+		t.Fatalf("Failed to connect to MCP server: %v", err)
+	}
+	defer tools.mcpManager.StopConnection("test")
+
+	for i := 0; i < 3; i++ {
+		var even *FunctionDeclaration
+		for _, decl := range tools.ForGemini()[0].FunctionDeclarations {
+			if decl.Name == "even" {
+				even = &decl
+			}
+		}
+		if even == nil || even.Parameters.Properties["n"].Type != TypeInteger {
+			t.Fatalf("Expected the converted MCP tool, got %+v", even)
+		}
+	}
+	if n := strings.Count(logs.String(), "Lossy schema conversion"); n != 1 {
+		t.Errorf("Expected the lossy conversion to be warned once, got %d warnings:\n%s", n, logs.String())
+	}
+
+	// Tools are refreshed when the server reports changes
+	server.AddTool(&mcp.Tool{Name: "odd", InputSchema: &jsonschema.Schema{Type: "object"}}, handler)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tools.mcpManager.GetMCPConnections()["test"].Tools()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the tool list to be refreshed, got %+v", tools.mcpManager.GetMCPConnections()["test"].Tools())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -15,9 +15,11 @@ import (
 	html2text "github.com/k3a/html2text"
 
 	. "github.com/lifthrasiir/angel/gemini"
+	"github.com/lifthrasiir/angel/internal/database"
 	"github.com/lifthrasiir/angel/internal/llm"
 	"github.com/lifthrasiir/angel/internal/prompts"
 	"github.com/lifthrasiir/angel/internal/tool"
+	. "github.com/lifthrasiir/angel/internal/types"
 )
 
 const (
@@ -88,8 +90,17 @@ func fetchWithTimeout(ctx context.Context, targetURL string, timeout time.Durati
 	return string(bodyBytes), nil
 }
 
+// recordUsage records the token usage of a web fetch call for the calling session
+func recordUsage(ctx context.Context, sessionId string, modelProvider llm.ModelProvider, result llm.OneShotResult) {
+	db, err := database.FromContext(ctx)
+	if err != nil {
+		return
+	}
+	llm.RecordTokenUsage(db, sessionId, modelProvider.Name(), TokenUsageWebFetch, result.UsageMetadata)
+}
+
 // executeWebFetchFallback handles web fetching using a direct HTTP request and returns the fetched content processed by LLM.
-func executeWebFetchFallback(ctx context.Context, prompt string, modelProvider llm.ModelProvider) (tool.HandlerResults, error) {
+func executeWebFetchFallback(ctx context.Context, sessionId, prompt string, modelProvider llm.ModelProvider) (tool.HandlerResults, error) {
 	urls := extractURLs(prompt)
 	if len(urls) == 0 {
 		return tool.HandlerResults{}, fmt.Errorf("no URL found in the prompt for fallback")
@@ -125,6 +136,7 @@ func executeWebFetchFallback(ctx context.Context, prompt string, modelProvider l
 	if err != nil {
 		return tool.HandlerResults{}, fmt.Errorf("error during LLM processing of fallback content: %v", err)
 	}
+	recordUsage(ctx, sessionId, modelProvider, oneShotResult)
 
 	llmContent := oneShotResult.Text
 
@@ -134,7 +146,7 @@ func executeWebFetchFallback(ctx context.Context, prompt string, modelProvider l
 	}}, nil
 }
 
-func executeWebFetch(ctx context.Context, prompt string, modelProvider, fallbackModelProvider llm.ModelProvider) (tool.HandlerResults, error) {
+func executeWebFetch(ctx context.Context, sessionId, prompt string, modelProvider, fallbackModelProvider llm.ModelProvider) (tool.HandlerResults, error) {
 	urls := extractURLs(prompt)
 	if len(urls) == 0 {
 		// If no URLs are found, perform a DuckDuckGo search
@@ -145,14 +157,14 @@ func executeWebFetch(ctx context.Context, prompt string, modelProvider, fallback
 		// Modify the prompt to explicitly ask to exclude irrelevant content
 		modifiedPrompt := fmt.Sprintf("Process the content from this URL: %s\nExtract relevant information, excluding any irrelevant content.", duckDuckGoURL)
 
-		return executeWebFetchFallback(ctx, modifiedPrompt, fallbackModelProvider)
+		return executeWebFetchFallback(ctx, sessionId, modifiedPrompt, fallbackModelProvider)
 	}
 
 	// Check for private IP before calling LLM
 	urlToProcess := urls[0] // Assuming we only process the first URL for private IP check
 	if isPrivateIp(urlToProcess) {
 		log.Printf("WebFetchTool: Detected private IP for %s. Bypassing LLM and performing manual fetch.", urlToProcess)
-		return executeWebFetchFallback(ctx, prompt, fallbackModelProvider)
+		return executeWebFetchFallback(ctx, sessionId, prompt, fallbackModelProvider)
 	}
 
 	// Primary Gemini API call with urlContext
@@ -171,6 +183,8 @@ func executeWebFetch(ctx context.Context, prompt string, modelProvider, fallback
 		log.Printf("WebFetchTool: Processing error detected (%s). Attempting fallback.", err)
 		processingError = true
 	} else {
+		recordUsage(ctx, sessionId, modelProvider, oneShotResult)
+
 		// Check URL retrieval status from LLM
 		if oneShotResult.URLContextMetadata != nil && len(oneShotResult.URLContextMetadata.URLMetadata) > 0 {
 			allSuccessful := true
@@ -193,7 +207,7 @@ func executeWebFetch(ctx context.Context, prompt string, modelProvider, fallback
 
 	if processingError {
 		// Perform fallback for the original prompt
-		return executeWebFetchFallback(ctx, prompt, fallbackModelProvider)
+		return executeWebFetchFallback(ctx, sessionId, prompt, fallbackModelProvider)
 	}
 
 	// If no processing error, return the LLM's response
@@ -228,7 +242,7 @@ func WebFetchTool(ctx context.Context, args map[string]interface{}, params tool.
 		return tool.HandlerResults{}, fmt.Errorf("LLM provider not initialized for web_fetch_fallback (model: %s): %w", params.ModelName, err)
 	}
 
-	return executeWebFetch(ctx, prompt, modelProvider, fallbackModelProvider)
+	return executeWebFetch(ctx, params.SessionId, prompt, modelProvider, fallbackModelProvider)
 }
 
 var webFetchTool = tool.Definition{
@@ -245,6 +259,7 @@ var webFetchTool = tool.Definition{
 		Required: []string{"prompt"},
 	},
 	Handler: WebFetchTool,
+	Timeout: 5 * time.Minute, // Fetches up to 20 URLs and has them processed by another model
 }
 
 var AllTools = []tool.Definition{
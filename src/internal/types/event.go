@@ -5,9 +5,14 @@ type EventType rune
 const (
 	// SSE Event Types
 	//
-	// Sending initial messages: A -> 0 -> any number of T/M/F/R/C/I -> P/E or (Q -> N) -> $
-	// Sending subsequent messages: any number of G -> A -> any number of T/M/F/R/C/I -> P/E/Q -> $
-	// Loading messages and streaming current call: W -> 1 or (0 -> any number of T/M/F/R/C/I -> P/E or (Q -> optional N) -> $)
+	// Sending initial messages: A -> 0 -> any number of T/M/F/R/C/I/Z -> P/E or (Q -> N) -> $
+	// Sending subsequent messages: any number of G -> A -> any number of T/M/F/R/C/I/Z -> P/E/Q -> $
+	// Steering notes posted during a call are delivered with the next function response, so S may follow any R.
+	// Loading messages and streaming current call: W -> 1 or (0 -> any number of T/M/F/R/C/I/Z -> P/E or (Q -> optional N) -> $)
+	// Sending messages while a call is active: K -> $ (the message is queued, and every subscribed client gets K as well)
+	// Once a call finishes with Q, any queued message is sent as if it was a subsequent message: U -> any number of T/M/F/R/C/I/Z -> P/E/Q
+	// Editing or cancelling queued messages broadcasts K to every subscribed client at any time.
+	// Schedule events (/api/schedules/events) are not tied to any session: any number of Y, never followed by $.
 	//
 	// Several events have payloads, described in brackets after the event type.
 	// Multiple comma-separated items in the payload should be separated by newlines.
@@ -22,9 +27,14 @@ const (
 	EventFunctionResponse    EventType = 'R' // Function response                       [Function name, FunctionResponsePayload JSON]
 	EventInlineData          EventType = 'I' // Inline file/image data with hash keys                        [InlineDataPayload JSON]
 	EventSessionName         EventType = 'N' // Session name inferred/updated                                      [New session name]
-	EventCumulTokenCount     EventType = 'C' // Cumulative token count update                                       [New token count]
+	EventCumulTokenCount     EventType = 'C' // Cumulative token count update           [Message ID, new token count, optional cached token count]
+	EventCompression         EventType = 'Z' // History compressed automatically [Message ID, original/new token counts, compressed up to message ID, summary]
 	EventPendingConfirmation EventType = 'P' // Pending confirmation, following EventFunctionCall msg [tool.PendingConfirmation JSON]
 	EventGenerationChanged   EventType = 'G' // Generation changed event                                        [env.EnvChanged JSON]
+	EventQueueChanged        EventType = 'K' // Queued messages changed                                      [QueuedMessage JSON array]
+	EventQueuedMessageSent   EventType = 'U' // Queued message sent as a new user message     [Queued message ID, FrontendMessage JSON]
+	EventSteering            EventType = 'S' // Steering note delivered with a function response                  [Message ID, text]
+	EventScheduledRunFailed  EventType = 'Y' // Scheduled prompt run failed          [Scheduled prompt name, ScheduledPromptRun JSON]
 	EventError               EventType = 'E' // Error message                                                     [Error description]
 	EventComplete            EventType = 'Q' // Query complete, but more auxiliary messages possible (e.g. EventSessionName)
 	EventFinish              EventType = '$' // Query completely finished, no further messages will be sent
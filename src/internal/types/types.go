@@ -76,11 +76,12 @@ const (
 	TypeError            MessageType = "error"
 	TypeModelError       MessageType = "model_error"
 	TypeCommand          MessageType = "command"
+	TypeSteering         MessageType = "steering" // User note delivered to the model in the middle of a tool loop
 )
 
 func (mt MessageType) Role() string {
 	switch mt {
-	case TypeUserText, TypeFunctionResponse, TypeCompression, TypeSystemPrompt, TypeEnvChanged, TypeCommand:
+	case TypeUserText, TypeFunctionResponse, TypeCompression, TypeSystemPrompt, TypeEnvChanged, TypeCommand, TypeSteering:
 		return RoleUser
 	case TypeModelText, TypeModelError, TypeFunctionCall, TypeError:
 		return RoleModel
@@ -170,6 +171,59 @@ type Workspace struct {
 	CreatedAt           string `json:"created_at"`
 }
 
+// Memory is a long-term memory curated by the agent or users, shared by all sessions in a workspace.
+type Memory struct {
+	ID          int    `json:"id"`
+	WorkspaceID string `json:"workspace_id"`
+	Content     string `json:"content"`
+	SessionID   string `json:"session_id,omitempty"` // Session which stored the memory, empty if stored by users
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// QueuedMessage is a user message waiting for the active call of the session to finish.
+type QueuedMessage struct {
+	ID          int              `json:"id"`
+	Text        string           `json:"text"`
+	Attachments []FileAttachment `json:"attachments,omitempty"`
+	Model       string           `json:"model,omitempty"`
+	CreatedAt   string           `json:"createdAt"`
+}
+
+// ScheduledPrompt is a prompt run periodically on a cron-like schedule.
+type ScheduledPrompt struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"` // Five-field cron expression or a macro like @daily
+	Prompt       string     `json:"prompt"`
+	WorkspaceID  string     `json:"workspaceId,omitempty"`
+	SessionID    string     `json:"sessionId,omitempty"` // Session to run in, a new session is created for each run if empty
+	Model        string     `json:"model,omitempty"`
+	SystemPrompt string     `json:"systemPrompt,omitempty"` // Only used for new sessions
+	Tools        []string   `json:"tools,omitempty"`        // Tools available to the run, all tools if empty
+	Enabled      bool       `json:"enabled"`
+	CreatedAt    string     `json:"createdAt"`
+	NextRunAt    *time.Time `json:"nextRunAt,omitempty"` // Computed from Schedule, nil if disabled
+}
+
+// Status values of ScheduledPromptRun
+const (
+	ScheduledRunRunning   = "running"
+	ScheduledRunSucceeded = "succeeded"
+	ScheduledRunFailed    = "failed"
+)
+
+// ScheduledPromptRun is a single run of a scheduled prompt.
+type ScheduledPromptRun struct {
+	ID                int    `json:"id"`
+	ScheduledPromptID int    `json:"scheduledPromptId"`
+	SessionID         string `json:"sessionId,omitempty"`
+	Status            string `json:"status"`
+	Error             string `json:"error,omitempty"`
+	StartedAt         string `json:"startedAt"`
+	FinishedAt        string `json:"finishedAt,omitempty"`
+}
+
 // GlobalPrompt struct to hold global prompt data
 type PredefinedPrompt struct {
 	Label string `json:"label"`
@@ -183,12 +237,29 @@ type MCPServerConfig struct {
 	Enabled    bool            `json:"enabled"`
 }
 
+// ScriptToolConfig struct to hold a user-defined script tool
+type ScriptToolConfig struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"` // JSON schema for the tool arguments
+	Command     string          `json:"command"`    // Command template, executed in the session sandbox
+	Timeout     float64         `json:"timeout"`    // In seconds; zero uses the default, negative disables the timeout
+	Enabled     bool            `json:"enabled"`
+}
+
+// OpenAI-compatible API modes
+const (
+	OpenAIAPIModeChat      = "chat"      // /chat/completions
+	OpenAIAPIModeResponses = "responses" // /responses
+)
+
 // OpenAIConfig struct to hold OpenAI-compatible API configuration data
 type OpenAIConfig struct {
 	ID        string `json:"id"`
 	Name      string `json:"name"`
 	Endpoint  string `json:"endpoint"`
 	APIKey    string `json:"api_key"`
+	APIMode   string `json:"api_mode"` // OpenAIAPIModeChat (default) or OpenAIAPIModeResponses
 	Enabled   bool   `json:"enabled"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
@@ -199,10 +270,22 @@ func (config *OpenAIConfig) Hash() string {
 	hasher := sha256.New()
 	hasher.Write([]byte(config.Endpoint))
 	hasher.Write([]byte(config.APIKey))
+	hasher.Write([]byte(config.APIMode))
 	hasher.Write([]byte(fmt.Sprintf("%v", config.Enabled)))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
+// AnthropicConfig represents an Anthropic Messages API configuration
+type AnthropicConfig struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Endpoint  string `json:"endpoint"` // Base URL, defaults to the official API when empty
+	APIKey    string `json:"api_key"`
+	Enabled   bool   `json:"enabled"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
 // GeminiAPIConfig represents a Gemini API configuration
 type GeminiAPIConfig struct {
 	ID              string               `json:"id"`
@@ -214,6 +297,24 @@ type GeminiAPIConfig struct {
 	UpdatedAt       string               `json:"updated_at"`
 }
 
+// EmbeddingSettings selects the embedding model used for semantic search over chat history
+type EmbeddingSettings struct {
+	Provider   string `json:"provider"`             // "api" or an OpenAI-compatible endpoint URL, empty if disabled
+	Model      string `json:"model"`                // Model name as known to the provider, e.g. "gemini-embedding-001"
+	Dimensions int    `json:"dimensions,omitempty"` // Requested dimensions, zero for the model default
+}
+
+// ContentCache represents a provider-side cache of the stable prefix of a session's requests
+type ContentCache struct {
+	ConfigID     string // Caches are only accessible with the API key that created them
+	Model        string
+	Name         string // Provider-side cache name, e.g. "cachedContents/..."
+	PrefixHash   string // Digest of everything cached, to check that the prefix still matches
+	ContentCount int    // Number of leading contents cached
+	TokenCount   int
+	ExpireAt     int64 // Unix seconds
+}
+
 // OAuthToken represents an OAuth token
 type OAuthToken struct {
 	ID              int                  `json:"id"`
@@ -226,6 +327,99 @@ type OAuthToken struct {
 	UpdatedAt       string               `json:"updated_at"`
 }
 
+// Tool call confirmation outcomes recorded in ToolCallAudit.Confirmation
+const (
+	ConfirmationNone     = ""
+	ConfirmationPending  = "pending"
+	ConfirmationApproved = "approved"
+	ConfirmationDenied   = "denied"
+)
+
+// ToolCallAudit records a single tool invocation.
+type ToolCallAudit struct {
+	ID           int64  `json:"id"`
+	SessionID    string `json:"session_id"`
+	BranchID     string `json:"branch_id"`
+	ToolName     string `json:"tool_name"`
+	ArgsDigest   string `json:"args_digest"`
+	StartedAt    int64  `json:"started_at"` // Unix milliseconds
+	DurationMs   int64  `json:"duration_ms"`
+	ResultSize   int    `json:"result_size"` // Size of the JSON-encoded result in bytes
+	Error        string `json:"error,omitempty"`
+	Confirmation string `json:"confirmation,omitempty"`
+}
+
+// ToolCallAuditFilter restricts the tool call audits to be retrieved. Zero values mean no restriction.
+type ToolCallAuditFilter struct {
+	SessionID  string // Also matches subsessions
+	BranchID   string
+	ToolName   string
+	ErrorsOnly bool
+	Since      int64 // Unix milliseconds, inclusive
+	Until      int64 // Unix milliseconds, exclusive
+	Limit      int
+	Offset     int
+}
+
+// ToolCallStats summarizes tool call audits for a single tool.
+type ToolCallStats struct {
+	ToolName      string  `json:"tool_name"`
+	Calls         int     `json:"calls"`
+	Failures      int     `json:"failures"`
+	FailureRate   float64 `json:"failure_rate"`
+	Denials       int     `json:"denials"`
+	AvgDurationMs float64 `json:"avg_duration_ms"`
+	P95DurationMs int64   `json:"p95_duration_ms"`
+	MaxDurationMs int64   `json:"max_duration_ms"`
+	AvgResultSize float64 `json:"avg_result_size"`
+}
+
+// Kinds of LLM calls recorded in TokenUsage.Kind
+const (
+	TokenUsageChat        = "chat"
+	TokenUsageSubagent    = "subagent"
+	TokenUsageCompression = "compression"
+	TokenUsageSessionName = "session_name"
+	TokenUsageWebFetch    = "web_fetch"
+)
+
+// TokenUsage records the token counts reported for a single LLM call.
+type TokenUsage struct {
+	ID               int64  `json:"id"`
+	SessionID        string `json:"session_id"`
+	WorkspaceID      string `json:"workspace_id"`
+	MessageID        int    `json:"message_id,omitempty"` // The resulting model message, if any
+	Model            string `json:"model"`
+	Kind             string `json:"kind"`
+	PromptTokens     int64  `json:"prompt_tokens"` // Includes CachedTokens
+	CandidatesTokens int64  `json:"candidates_tokens"`
+	ThoughtsTokens   int64  `json:"thoughts_tokens"`
+	CachedTokens     int64  `json:"cached_tokens"`
+	CreatedAt        int64  `json:"created_at"` // Unix milliseconds
+}
+
+// TokenUsageFilter restricts the token usages to be aggregated. Zero values mean no restriction.
+type TokenUsageFilter struct {
+	SessionID   string // Also matches subsessions
+	WorkspaceID string
+	Model       string
+	Kind        string
+	Since       int64 // Unix milliseconds, inclusive
+	Until       int64 // Unix milliseconds, exclusive
+}
+
+// TokenUsageSummary aggregates token usages sharing the same key.
+type TokenUsageSummary struct {
+	Key              string  `json:"key"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CandidatesTokens int64   `json:"candidates_tokens"`
+	ThoughtsTokens   int64   `json:"thoughts_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	Cost             float64 `json:"cost"`           // Estimated cost in USD
+	UnpricedCalls    int     `json:"unpriced_calls"` // Calls to models without a known price, excluded from Cost
+}
+
 // ShellCommand struct to hold shell command data
 type ShellCommand struct {
 	ID            string